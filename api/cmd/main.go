@@ -1,19 +1,72 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
+	"os"
 	"time"
 
 	"github.com/Corray333/notion-manager/internal/config"
 	"github.com/Corray333/notion-manager/internal/gsheets"
+	"github.com/Corray333/notion-manager/internal/invoice"
+	"github.com/Corray333/notion-manager/internal/notion"
 	"github.com/Corray333/notion-manager/internal/server"
+	"github.com/Corray333/notion-manager/internal/storage"
+	notionclient "github.com/Corray333/notion-manager/pkg/notion"
 	"github.com/robfig/cron/v3"
+	"github.com/spf13/viper"
 )
 
 func main() {
+	dryRun := flag.Bool("dry-run", false, "print what the sync would change as JSON and exit, nothing is written")
+	projectID := flag.String("project", "", "with -dry-run, plan the sync of the client project with this ID only")
+	pageID := flag.String("page", "", "with -dry-run, plan the sync of the internal page with this ID only")
+	full := flag.Bool("full", false, "with -dry-run, ignore the sync cursors like a full sync")
+	flag.Parse()
 
 	config.MustInit()
 
+	notion.SetClient(notionclient.NewClientFromEnv())
+	if err := notion.LoadMappings("../configs/mappings.yml"); err != nil {
+		panic(err)
+	}
+	if err := notion.LoadValidation("../configs/validation.yml"); err != nil {
+		panic(err)
+	}
+	if err := invoice.LoadConfig("../configs/invoicing.yml"); err != nil {
+		panic(err)
+	}
+	if viper.IsSet("ARCHIVE_GRACE_PERIOD") {
+		notion.SetArchiveGracePeriod(viper.GetDuration("ARCHIVE_GRACE_PERIOD"))
+	}
+	notion.SetWebhookSecret(os.Getenv("NOTION_WEBHOOK_SECRET"))
+	if viper.IsSet("WEBHOOK_DEBOUNCE") {
+		notion.SetWebhookDebounce(viper.GetDuration("WEBHOOK_DEBOUNCE"))
+	}
+	if viper.IsSet("JOB_WORKERS") {
+		notion.SetJobWorkers(viper.GetInt("JOB_WORKERS"))
+	}
+	if viper.IsSet("GOOGLE_CREDENTIALS") {
+		gsheets.SetCredentialsFile(viper.GetString("GOOGLE_CREDENTIALS"))
+	}
+	gsheets.SetRedirectURL(viper.GetString("GOOGLE_REDIRECT_URL"))
+
+	if *dryRun {
+		plan, err := notion.PlanSync(context.Background(), storage.NewStorage(), notion.SyncOptions{ProjectID: *projectID, PageID: *pageID, Full: *full})
+		if err != nil {
+			slog.Error("error planning sync: " + err.Error())
+			os.Exit(1)
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		encoder.Encode(plan)
+		return
+	}
+
 	// projectName, tasks, err := mindmap.ParseMarkdownTasks("Хронодокс.md")
 	// if err != nil {
 	// 	panic(err)
@@ -32,7 +85,40 @@ func main() {
 
 	c := cron.New(cron.WithLocation(time.FixedZone("MSK", 3*60*60)))
 
-	_, err := c.AddFunc("0 5 * * *", func() { gsheets.UpdateGoogleSheets() })
+	store := storage.NewStorage()
+	if err := gsheets.LoadTargets("../configs/sheets.yml", store); err != nil {
+		panic(err)
+	}
+	_, err := c.AddFunc("0 5 * * *", func() {
+		if err := gsheets.UpdateGoogleSheets(context.Background(), store); err != nil {
+			slog.Error("error updating google sheets: " + err.Error())
+		}
+	})
+	if err != nil {
+		fmt.Println("Error scheduling function - ", err)
+		return
+	}
+
+	if err := notion.RecoverJobs(store); err != nil {
+		slog.Error("error recovering jobs: " + err.Error())
+	}
+	_, err = c.AddFunc("@every 1m", func() {
+		if err := notion.ProcessJobs(context.Background(), store); err != nil && !errors.Is(err, notion.ErrSyncRunning) {
+			slog.Error("error processing jobs: " + err.Error())
+		}
+	})
+	if err != nil {
+		fmt.Println("Error scheduling function - ", err)
+		return
+	}
+	_, err = c.AddFunc("30 5 * * *", func() {
+		report, err := notion.FixBroken(context.Background(), store)
+		if err != nil {
+			slog.Error("error fixing broken pages: " + err.Error())
+			return
+		}
+		slog.Info("fixed broken pages", "fixed", len(report.Fixed), "still_broken", len(report.StillBroken), "errored", len(report.Errored))
+	})
 	if err != nil {
 		fmt.Println("Error scheduling function - ", err)
 		return
@@ -40,7 +126,7 @@ func main() {
 
 	c.Start()
 
-	server.NewApp().Run()
+	server.NewApp(store).Run()
 
 	// fmt.Println(gsheets.UpdateGoogleSheets())
 
@@ -15,23 +15,23 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/fix": {
+        "/archived": {
             "get": {
-                "description": "Retrieve the rows that need to be updated",
+                "description": "Retrieve internal pages found archived or deleted and whether their client copies were removed",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
                     "updates"
                 ],
-                "summary": "Get rows to be updated",
+                "summary": "Get archived pages",
                 "responses": {
                     "200": {
                         "description": "OK",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/notion.Validation"
+                                "$ref": "#/definitions/notion.ArchivedPage"
                             }
                         }
                     },
@@ -44,36 +44,245 @@ const docTemplate = `{
                 }
             }
         },
-        "/projects": {
-            "post": {
-                "description": "Create a new project with the given details",
-                "consumes": [
+        "/errors": {
+            "get": {
+                "description": "Retrieve the errors saved by syncs, last seen first. Acknowledged errors are left out by default.",
+                "produces": [
                     "application/json"
                 ],
+                "tags": [
+                    "errors"
+                ],
+                "summary": "Get errors",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Client project ID",
+                        "name": "project",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Type of database: task, time or project",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "warning, error or critical",
+                        "name": "severity",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Errors seen at or after this time, RFC 3339 or YYYY-MM-DD",
+                        "name": "since",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "false (default), true or all",
+                        "name": "acknowledged",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of errors, 50 by default, at most 500",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of errors to skip",
+                        "name": "offset",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.ErrorsResponse"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/errors/summary": {
+            "get": {
+                "description": "Retrieve the errors grouped by message, most frequent first. Takes the same filters as /errors.",
                 "produces": [
                     "application/json"
                 ],
                 "tags": [
-                    "projects"
+                    "errors"
                 ],
-                "summary": "Create a new project",
+                "summary": "Get error summary",
                 "parameters": [
                     {
-                        "description": "New Project",
+                        "type": "string",
+                        "description": "Client project ID",
                         "name": "project",
-                        "in": "body",
-                        "required": true,
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Type of database: task, time or project",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "warning, error or critical",
+                        "name": "severity",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Errors seen at or after this time, RFC 3339 or YYYY-MM-DD",
+                        "name": "since",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "false (default), true or all",
+                        "name": "acknowledged",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
                         "schema": {
-                            "$ref": "#/definitions/handlers.NewProjectRequest"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/notion.ErrorSummary"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
                         }
                     }
+                }
+            }
+        },
+        "/errors/{id}/ack": {
+            "post": {
+                "description": "Mark an error as handled. If it happens again it is saved as a new error.",
+                "tags": [
+                    "errors"
+                ],
+                "summary": "Acknowledge error",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Error ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
                 ],
                 "responses": {
-                    "201": {
-                        "description": "Created",
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
                         "schema": {
                             "type": "string"
                         }
+                    }
+                }
+            }
+        },
+        "/export/times": {
+            "get": {
+                "description": "Download the time rows as an XLSX or CSV file with the columns of the default Google Sheets target,\nor of the target given. Task links are hyperlinks in XLSX.",
+                "produces": [
+                    "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+                    "text/csv"
+                ],
+                "tags": [
+                    "export"
+                ],
+                "summary": "Export times",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "First work date, YYYY-MM-DD",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Last work date, YYYY-MM-DD",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Internal project ID",
+                        "name": "project",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Name of the employee",
+                        "name": "employee",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "xlsx (default) or csv",
+                        "name": "format",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "ID of the sheets target whose columns are exported",
+                        "name": "target",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
                     },
                     "400": {
                         "description": "Bad Request",
@@ -81,6 +290,12 @@ const docTemplate = `{
                             "type": "string"
                         }
                     },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -90,16 +305,55 @@ const docTemplate = `{
                 }
             }
         },
-        "/sync": {
-            "patch": {
-                "description": "Start the process of updating the databases",
+        "/fix": {
+            "get": {
+                "description": "Retrieve the pages that failed validation or have conflicting edits, oldest first.\nWith format=csv every issue is a line of a CSV file, so that each employee can get their own list.",
+                "produces": [
+                    "application/json",
+                    "text/csv"
+                ],
                 "tags": [
-                    "databases"
+                    "updates"
+                ],
+                "summary": "Get rows to be updated",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Client project ID",
+                        "name": "project",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Name of the responsible employee",
+                        "name": "employee",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "task, time, task_conflict or time_conflict",
+                        "name": "type",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "json (default) or csv",
+                        "name": "format",
+                        "in": "query"
+                    }
                 ],
-                "summary": "Update databases",
                 "responses": {
-                    "202": {
-                        "description": "Accepted",
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/notion.Validation"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
                         "schema": {
                             "type": "string"
                         }
@@ -112,71 +366,2463 @@ const docTemplate = `{
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "handlers.NewProjectRequest": {
-            "type": "object",
-            "properties": {
-                "name": {
-                    "description": "Project name",
-                    "type": "string"
-                },
-                "project_client_id": {
-                    "description": "ID of project in internal dashboard",
-                    "type": "string"
-                },
-                "project_internal_id": {
-                    "description": "ID of project in client dashboard",
-                    "type": "string"
-                },
-                "tasks_db_id": {
-                    "description": "ID of tasks database in client dashboard",
-                    "type": "string"
-                },
-                "tasks_last_synced": {
-                    "description": "Time to start searching for updates in tasks database",
-                    "type": "integer"
-                },
-                "time_db_id": {
-                    "description": "ID of time database in client dashboard",
-                    "type": "string"
-                },
-                "time_last_synced": {
-                    "description": "Time to start searching for updates in time database",
-                    "type": "integer"
-                },
-                "worker_db_id": {
-                    "description": "ID of worker database in client dashboard",
-                    "type": "string"
+        },
+        "/fix/run": {
+            "post": {
+                "description": "Sync every page that failed validation again. Pages fixed in the internal dashboard leave the queue.\nA failing page doesn't stop the others. Can't run during a sync.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "updates"
+                ],
+                "summary": "Fix broken pages",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/notion.FixReport"
+                        }
+                    },
+                    "409": {
+                        "description": "A sync is running",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
                 }
             }
         },
-        "notion.Validation": {
-            "type": "object",
-            "properties": {
-                "client_id": {
-                    "description": "ID of page in client dashboard",
-                    "type": "string"
-                },
-                "errors": {
-                    "description": "Errors encountered while validating",
-                    "type": "string"
-                },
-                "internal_id": {
-                    "description": "ID of page in internal dashboard",
-                    "type": "string"
-                },
-                "project_id": {
-                    "description": "ID of project",
-                    "type": "string"
-                },
-                "title": {
-                    "description": "Title of page in database",
-                    "type": "string"
-                },
-                "type": {
-                    "description": "Type of database",
+        "/google/auth": {
+            "get": {
+                "description": "Redirect to the Google consent screen. Google redirects back to /google/callback, which saves the token.",
+                "tags": [
+                    "google"
+                ],
+                "summary": "Authorize Google Sheets",
+                "responses": {
+                    "302": {
+                        "description": "Found"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/google/callback": {
+            "get": {
+                "description": "Exchange the code Google redirected with for a token and save it",
+                "tags": [
+                    "google"
+                ],
+                "summary": "Google OAuth callback",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "State of the consent screen",
+                        "name": "state",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Authorization code",
+                        "name": "code",
+                        "in": "query",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/google/status": {
+            "get": {
+                "description": "Report the credentials in use, the expiry of the token and whether a new consent is needed",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "google"
+                ],
+                "summary": "Google authorization status",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/gsheets.AuthStatus"
+                        }
+                    }
+                }
+            }
+        },
+        "/google/token": {
+            "delete": {
+                "description": "Delete the saved token. The export stops until Google Sheets is authorized again.",
+                "tags": [
+                    "google"
+                ],
+                "summary": "Forget Google token",
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/invoices": {
+            "get": {
+                "description": "Get the invoices of a project or of all projects, newest first",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "invoices"
+                ],
+                "summary": "Get invoices",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Client project ID",
+                        "name": "project",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/invoice.Invoice"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Sum the payable hours of the project in the period by employee and direction and multiply them by\nthe rates of the invoicing config or of the workers. Time rows of issued invoices are left out,\nso are paid ones unless include_paid is set.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "invoices"
+                ],
+                "summary": "Create invoice",
+                "parameters": [
+                    {
+                        "description": "Project and period",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/invoice.Request"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/invoice.Invoice"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Project not found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "422": {
+                        "description": "No time rows to invoice",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/invoices/{id}": {
+            "get": {
+                "description": "Get an invoice with its lines and time rows",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "invoices"
+                ],
+                "summary": "Get invoice",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Invoice ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/invoice.Invoice"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Delete a draft. Issued invoices are kept.",
+                "tags": [
+                    "invoices"
+                ],
+                "summary": "Delete invoice",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Invoice ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Invoice is issued",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/invoices/{id}/document": {
+            "get": {
+                "description": "Render the invoice as an HTML page or a PDF file",
+                "produces": [
+                    "text/html",
+                    "application/pdf"
+                ],
+                "tags": [
+                    "invoices"
+                ],
+                "summary": "Download invoice",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Invoice ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "html (default) or pdf",
+                        "name": "format",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "file"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/invoices/{id}/issue": {
+            "post": {
+                "description": "Issue a draft. Its time rows are not invoiced again.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "invoices"
+                ],
+                "summary": "Issue invoice",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Invoice ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/invoice.Invoice"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Invoice is already issued or its time rows are billed by another invoice",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/invoices/{id}/paid": {
+            "post": {
+                "description": "Check \"Оплата\" of the time rows of an issued invoice in Notion. The invoice stays issued if a time row\ncan't be updated and can be marked again.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "invoices"
+                ],
+                "summary": "Mark invoice paid",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Invoice ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/invoice.Invoice"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Invoice is not issued",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/jobs": {
+            "get": {
+                "description": "Retrieve the latest page upload jobs, newest first. Failed uploads are retried with a growing delay until they run out of attempts.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "databases"
+                ],
+                "summary": "Get jobs",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Filter by status: pending, running, done, failed or cancelled",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Number of jobs, 50 by default, at most 500",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/notion.Job"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/pages/{internalID}/sync": {
+            "patch": {
+                "description": "Start the process of copying a single internal task or time row to the dashboards of its projects.\nErrors about the page itself are reported by the sync run. Only one sync can run at a time.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "databases"
+                ],
+                "summary": "Sync page",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ID of page in internal dashboard",
+                        "name": "internalID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Recreate the client copy if it was deleted",
+                        "name": "full",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Respond with what the sync would change instead of running it, nothing is written",
+                        "name": "dry_run",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Dry run",
+                        "schema": {
+                            "$ref": "#/definitions/notion.SyncPlan"
+                        }
+                    },
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SyncStartedResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Another sync, the job retries or the fix of broken pages are running",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SyncStartedResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/projects": {
+            "get": {
+                "description": "Retrieve all projects with their databases, pause and sync cursors",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "projects"
+                ],
+                "summary": "Get projects",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/project.Project"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Create a new project with the given details. The client databases must exist and have the properties the sync needs.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "projects"
+                ],
+                "summary": "Create a new project",
+                "parameters": [
+                    {
+                        "description": "New Project",
+                        "name": "project",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.NewProjectRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/project.Project"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Project already exists",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/projects/{projectID}": {
+            "get": {
+                "description": "Retrieve a project with its databases, pause and sync cursors",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "projects"
+                ],
+                "summary": "Get project",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Client project ID",
+                        "name": "projectID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/project.Project"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Stop syncing a project and forget it. Client copies are kept.\nProjects linked on the dashboards page are found again by the next sync, pause them instead.",
+                "tags": [
+                    "projects"
+                ],
+                "summary": "Delete project",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Client project ID",
+                        "name": "projectID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Change the name, the databases or the pause of a project. Changed databases are validated like on creation.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "projects"
+                ],
+                "summary": "Update project",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Client project ID",
+                        "name": "projectID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Fields to change",
+                        "name": "project",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handlers.UpdateProjectRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/project.Project"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/projects/{projectID}/reset": {
+            "post": {
+                "description": "Reset the task and time cursors so that the next sync copies all pages of the project again.\nThe cursor of client edits is kept, so client edits are not pulled twice.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "projects"
+                ],
+                "summary": "Reset project cursors",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Client project ID",
+                        "name": "projectID",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/project.Project"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "A sync is running",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/projects/{projectID}/sync": {
+            "patch": {
+                "description": "Start the process of updating the dashboard of a single project. Only one sync can run at a time.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "databases"
+                ],
+                "summary": "Sync project",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Client project ID",
+                        "name": "projectID",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Ignore the sync cursors and copy all pages again, recreating deleted client copies",
+                        "name": "full",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Respond with what the sync would change instead of running it, nothing is written",
+                        "name": "dry_run",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Dry run",
+                        "schema": {
+                            "$ref": "#/definitions/notion.SyncPlan"
+                        }
+                    },
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SyncStartedResponse"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Another sync, the job retries or the fix of broken pages are running",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SyncStartedResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/sheets": {
+            "patch": {
+                "description": "Export the time rows edited since the last export to every enabled target, or to a single target.",
+                "tags": [
+                    "sheets"
+                ],
+                "summary": "Update Google Sheets",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "ID of the target to export to, enabled or not",
+                        "name": "target",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Google authorization is required, see /google/status",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/sheets/targets": {
+            "get": {
+                "description": "Retrieve the sheets the time rows are exported to with their column layouts",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sheets"
+                ],
+                "summary": "Get sheets targets",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/gsheets.Target"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Add a sheet to export the time rows to. Sheet, key_column, last_synced_cell and first_row default to\n\"Sheet1\", \"W\", \"X2\" and 3. Every column value is a property name or a template with {placeholders}.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sheets"
+                ],
+                "summary": "Create sheets target",
+                "parameters": [
+                    {
+                        "description": "Target",
+                        "name": "target",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/gsheets.Target"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Created",
+                        "schema": {
+                            "$ref": "#/definitions/gsheets.Target"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/sheets/targets/{id}": {
+            "put": {
+                "description": "Replace the settings and the columns of a target",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sheets"
+                ],
+                "summary": "Update sheets target",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Target ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "Target",
+                        "name": "target",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/gsheets.Target"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/gsheets.Target"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Stop exporting to a target. The sheet itself is left as it is.",
+                "tags": [
+                    "sheets"
+                ],
+                "summary": "Delete sheets target",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Target ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "204": {
+                        "description": "No Content"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/sheets/targets/{id}/reconcile": {
+            "post": {
+                "description": "Delete the stale rows of the target or write STALE in its mark column, see /sheets/targets/{id}/stale",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sheets"
+                ],
+                "summary": "Remove stale sheet rows",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Target ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "delete or mark, the reconcile mode of the target or delete by default",
+                        "name": "mode",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Removed rows, numbered as before the removal",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/gsheets.StaleRow"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "No time rows found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Google authorization is required, see /google/status",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/sheets/targets/{id}/stale": {
+            "get": {
+                "description": "List the rows of the target whose time row was deleted, archived or moved out of the target, and\nthe duplicates of rows above. Nothing is changed.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "sheets"
+                ],
+                "summary": "Preview stale sheet rows",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Target ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/gsheets.StaleRow"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "No time rows found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Google authorization is required, see /google/status",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/sync": {
+            "get": {
+                "description": "Retrieve the latest sync runs with per-project counts, newest first",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "databases"
+                ],
+                "summary": "Get sync runs",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Number of runs, 20 by default, at most 100",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/notion.SyncRun"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "patch": {
+                "description": "Start the process of updating the databases. Only one sync can run at a time.",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "databases"
+                ],
+                "summary": "Update databases",
+                "parameters": [
+                    {
+                        "type": "boolean",
+                        "description": "Ignore the sync cursors and copy all pages again, recreating deleted client copies",
+                        "name": "full",
+                        "in": "query"
+                    },
+                    {
+                        "type": "boolean",
+                        "description": "Respond with what the sync would change instead of running it, nothing is written",
+                        "name": "dry_run",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Dry run",
+                        "schema": {
+                            "$ref": "#/definitions/notion.SyncPlan"
+                        }
+                    },
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SyncStartedResponse"
+                        }
+                    },
+                    "409": {
+                        "description": "Another sync, the job retries or the fix of broken pages are running",
+                        "schema": {
+                            "$ref": "#/definitions/handlers.SyncStartedResponse"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/sync/events": {
+            "get": {
+                "description": "Stream events of sync runs as Server-Sent Events. The event name is the event type,\nthe data is a notion.SyncEvent. Events of the current run are replayed on connect.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "tags": [
+                    "databases"
+                ],
+                "summary": "Stream sync events",
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/notion.SyncEvent"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/sync/{id}": {
+            "get": {
+                "description": "Retrieve the status, per-project counts and errors of a sync run",
+                "produces": [
+                    "application/json"
+                ],
+                "tags": [
+                    "databases"
+                ],
+                "summary": "Get sync run",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sync run ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK",
+                        "schema": {
+                            "$ref": "#/definitions/notion.SyncRun"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "404": {
+                        "description": "Not Found",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            },
+            "delete": {
+                "description": "Cancel the running sync. Pages already copied stay copied.",
+                "tags": [
+                    "databases"
+                ],
+                "summary": "Cancel sync run",
+                "parameters": [
+                    {
+                        "type": "integer",
+                        "description": "Sync run ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "202": {
+                        "description": "Accepted",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "409": {
+                        "description": "The run is not running",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/notion": {
+            "post": {
+                "description": "Receive page events of the internal tasks and times databases and sync the changed pages shortly after.\nEvents of the same page are debounced. Requests must be signed with the verification token in X-Notion-Signature,\nexcept the verification request Notion sends when the subscription is created: its token is logged.",
+                "consumes": [
+                    "application/json"
+                ],
+                "tags": [
+                    "databases"
+                ],
+                "summary": "Notion webhook",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "sha256=HMAC of the body",
+                        "name": "X-Notion-Signature",
+                        "in": "header",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "OK"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "401": {
+                        "description": "Invalid signature",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "503": {
+                        "description": "Webhook secret is not set",
+                        "schema": {
+                            "type": "string"
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "gsheets.AuthStatus": {
+            "type": "object",
+            "properties": {
+                "auth_url": {
+                    "description": "Where to authorize",
+                    "type": "string"
+                },
+                "authorized": {
+                    "description": "A service account or a usable token is there",
+                    "type": "boolean"
+                },
+                "expiry": {
+                    "description": "Expiry of the access token, it is refreshed with the refresh token",
+                    "type": "string"
+                },
+                "last_error": {
+                    "description": "Why a new consent is needed or the credentials can't be read",
+                    "type": "string"
+                },
+                "mode": {
+                    "description": "\"oauth\", \"service_account\" or empty if there are no credentials",
+                    "type": "string"
+                },
+                "needs_reauth": {
+                    "description": "Open AuthURL to export again",
+                    "type": "boolean"
+                }
+            }
+        },
+        "gsheets.Column": {
+            "type": "object",
+            "properties": {
+                "header": {
+                    "description": "Title of the column, for reference only",
+                    "type": "string"
+                },
+                "value": {
+                    "type": "string"
+                }
+            }
+        },
+        "gsheets.StaleRow": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "description": "ID of the time row in the key column",
+                    "type": "string"
+                },
+                "reason": {
+                    "description": "One of deleted, moved or duplicate",
+                    "type": "string"
+                },
+                "row": {
+                    "description": "1-based row of the sheet",
+                    "type": "integer"
+                }
+            }
+        },
+        "gsheets.Target": {
+            "type": "object",
+            "properties": {
+                "columns": {
+                    "description": "Columns from \"A\" on",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/gsheets.Column"
+                    }
+                },
+                "enabled": {
+                    "type": "boolean"
+                },
+                "first_row": {
+                    "description": "FirstRow is the first row of data, the rows above it are left for headers. 3 by default.",
+                    "type": "integer"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "key_column": {
+                    "description": "KeyColumn is the column holding the ID of the time row, one of the written columns. \"W\" by default.",
+                    "type": "string"
+                },
+                "last_synced_cell": {
+                    "description": "LastSyncedCell keeps the last edit time of the exported rows, only rows edited later are exported. \"X2\" by default.",
+                    "type": "string"
+                },
+                "mark_column": {
+                    "description": "MarkColumn receives StaleMark in marked rows, the column after the written ones by default.",
+                    "type": "string"
+                },
+                "month": {
+                    "description": "Month limits the export to the time rows worked in the month, e.g. \"2024-06\".",
+                    "type": "string"
+                },
+                "name": {
+                    "description": "Unique name of the target",
+                    "type": "string"
+                },
+                "project_id": {
+                    "description": "ProjectID limits the export to the time rows of the internal project with this ID.",
+                    "type": "string"
+                },
+                "reconcile": {
+                    "description": "Reconcile is what every export does with the rows of time rows that are gone, see FindStaleRows:\n\"delete\" or \"mark\". They are left as they are if it is empty.",
+                    "type": "string"
+                },
+                "sheet": {
+                    "description": "Name of the sheet, \"Sheet1\" by default",
+                    "type": "string"
+                },
+                "spreadsheet_id": {
+                    "description": "ID of the spreadsheet from its URL",
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.ErrorsResponse": {
+            "type": "object",
+            "properties": {
+                "errors": {
+                    "description": "Page of errors, last seen first",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/notion.ErrorRecord"
+                    }
+                },
+                "total": {
+                    "description": "Number of errors matching the filter",
+                    "type": "integer"
+                }
+            }
+        },
+        "handlers.NewProjectRequest": {
+            "type": "object",
+            "properties": {
+                "internal_id": {
+                    "description": "ID of project page in internal dashboard",
+                    "type": "string"
+                },
+                "name": {
+                    "description": "Project name",
+                    "type": "string"
+                },
+                "paused": {
+                    "description": "Create the project without syncing it",
+                    "type": "boolean"
+                },
+                "project_id": {
+                    "description": "ID of project page in client dashboard",
+                    "type": "string"
+                },
+                "tasks_db_id": {
+                    "description": "ID of tasks database in client dashboard",
+                    "type": "string"
+                },
+                "time_db_id": {
+                    "description": "ID of time database in client dashboard",
+                    "type": "string"
+                },
+                "workers_db_id": {
+                    "description": "ID of workers database in client dashboard",
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.SyncStartedResponse": {
+            "type": "object",
+            "properties": {
+                "id": {
+                    "description": "ID of the sync run, running or started",
+                    "type": "integer"
+                },
+                "running": {
+                    "description": "Work blocking the sync instead of a run: jobs, fix or reset",
+                    "type": "string"
+                }
+            }
+        },
+        "handlers.UpdateProjectRequest": {
+            "type": "object",
+            "properties": {
+                "internal_id": {
+                    "description": "ID of project page in internal dashboard",
+                    "type": "string"
+                },
+                "name": {
+                    "description": "Project name",
+                    "type": "string"
+                },
+                "paused": {
+                    "description": "Skip the project when syncing all projects",
+                    "type": "boolean"
+                },
+                "tasks_db_id": {
+                    "description": "ID of tasks database in client dashboard",
+                    "type": "string"
+                },
+                "time_db_id": {
+                    "description": "ID of time database in client dashboard",
+                    "type": "string"
+                },
+                "workers_db_id": {
+                    "description": "ID of workers database in client dashboard",
+                    "type": "string"
+                }
+            }
+        },
+        "invoice.Invoice": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "currency": {
+                    "type": "string"
+                },
+                "from": {
+                    "description": "First work date, YYYY-MM-DD",
+                    "type": "string"
+                },
+                "hours": {
+                    "description": "Payable hours of all lines",
+                    "type": "number"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "issued_at": {
+                    "type": "string"
+                },
+                "lines": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/invoice.Line"
+                    }
+                },
+                "paid_at": {
+                    "type": "string"
+                },
+                "project_id": {
+                    "description": "ID of client project",
+                    "type": "string"
+                },
+                "project_name": {
+                    "description": "Name of project",
+                    "type": "string"
+                },
+                "status": {
+                    "description": "draft, issued or paid",
+                    "type": "string"
+                },
+                "time_ids": {
+                    "description": "Internal time rows billed",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "to": {
+                    "description": "Last work date, YYYY-MM-DD",
+                    "type": "string"
+                },
+                "total": {
+                    "type": "number"
+                }
+            }
+        },
+        "invoice.Line": {
+            "type": "object",
+            "properties": {
+                "amount": {
+                    "type": "number"
+                },
+                "direction": {
+                    "type": "string"
+                },
+                "employee": {
+                    "type": "string"
+                },
+                "entries": {
+                    "description": "Number of time rows",
+                    "type": "integer"
+                },
+                "hours": {
+                    "description": "Sum of \"К оплате ч.\"",
+                    "type": "number"
+                },
+                "rate": {
+                    "description": "Hourly rate",
+                    "type": "number"
+                },
+                "rate_source": {
+                    "description": "project, worker or default",
+                    "type": "string"
+                }
+            }
+        },
+        "invoice.Request": {
+            "type": "object",
+            "properties": {
+                "from": {
+                    "description": "First work date, YYYY-MM-DD",
+                    "type": "string"
+                },
+                "include_paid": {
+                    "description": "Bill the time rows checked as paid too",
+                    "type": "boolean"
+                },
+                "project_id": {
+                    "description": "ID of client project",
+                    "type": "string"
+                },
+                "to": {
+                    "description": "Last work date, YYYY-MM-DD",
+                    "type": "string"
+                }
+            }
+        },
+        "notion.ArchivedPage": {
+            "type": "object",
+            "properties": {
+                "client_id": {
+                    "description": "ID of page in client dashboard",
+                    "type": "string"
+                },
+                "detected_at": {
+                    "description": "When the sync noticed the page is gone",
+                    "type": "string"
+                },
+                "internal_id": {
+                    "description": "ID of page in internal dashboard",
+                    "type": "string"
+                },
+                "project_id": {
+                    "description": "ID of project",
+                    "type": "string"
+                },
+                "reason": {
+                    "description": "ReasonArchived or ReasonDeleted",
+                    "type": "string"
+                },
+                "removed_at": {
+                    "description": "When the client copy was archived, nil during the grace period",
+                    "type": "string"
+                },
+                "title": {
+                    "description": "Title of the internal page, empty if it is deleted",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "Type of database",
+                    "type": "string"
+                }
+            }
+        },
+        "notion.ErrorRecord": {
+            "type": "object",
+            "properties": {
+                "acknowledged_at": {
+                    "description": "When the error was acknowledged, nil if it wasn't",
+                    "type": "string"
+                },
+                "count": {
+                    "description": "How many times the error happened",
+                    "type": "integer"
+                },
+                "created_at": {
+                    "description": "When the error happened first",
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "last_seen_at": {
+                    "description": "When the error happened last",
+                    "type": "string"
+                },
+                "message": {
+                    "description": "Error message",
+                    "type": "string"
+                },
+                "page_id": {
+                    "description": "ID of page in internal dashboard, empty for project errors",
+                    "type": "string"
+                },
+                "project_id": {
+                    "description": "ID of project",
+                    "type": "string"
+                },
+                "run_id": {
+                    "description": "Run where the error happened last, 0 outside of a run",
+                    "type": "integer"
+                },
+                "severity": {
+                    "description": "One of Severity* constants",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "Type of database",
+                    "type": "string"
+                }
+            }
+        },
+        "notion.ErrorSummary": {
+            "type": "object",
+            "properties": {
+                "errors": {
+                    "description": "Number of error records",
+                    "type": "integer"
+                },
+                "last_seen_at": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "occurrences": {
+                    "description": "Number of times the errors happened",
+                    "type": "integer"
+                },
+                "projects": {
+                    "description": "Number of projects affected",
+                    "type": "integer"
+                }
+            }
+        },
+        "notion.FixReport": {
+            "type": "object",
+            "properties": {
+                "errored": {
+                    "description": "pages that couldn't be synced",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/notion.FixResult"
+                    }
+                },
+                "fixed": {
+                    "description": "pages that pass validation now",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/notion.FixResult"
+                    }
+                },
+                "still_broken": {
+                    "description": "pages that were synced again but still have issues",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/notion.FixResult"
+                    }
+                }
+            }
+        },
+        "notion.FixResult": {
+            "type": "object",
+            "properties": {
+                "internal_id": {
+                    "description": "ID of page in internal dashboard",
+                    "type": "string"
+                },
+                "message": {
+                    "description": "Issues left or the error",
+                    "type": "string"
+                },
+                "project_id": {
+                    "description": "ID of project",
+                    "type": "string"
+                },
+                "title": {
+                    "description": "Title of page",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "Type of database",
+                    "type": "string"
+                }
+            }
+        },
+        "notion.Job": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "description": "Uploads tried so far",
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "last_error": {
+                    "description": "Error of the last attempt",
+                    "type": "string"
+                },
+                "next_run_at": {
+                    "description": "When a pending job may run",
+                    "type": "string"
+                },
+                "page_id": {
+                    "description": "ID of page in internal dashboard",
+                    "type": "string"
+                },
+                "project_id": {
+                    "description": "ID of project",
+                    "type": "string"
+                },
+                "run_id": {
+                    "description": "Run that created the job",
+                    "type": "integer"
+                },
+                "status": {
+                    "description": "One of Job* constants",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "Type of database",
+                    "type": "string"
+                },
+                "updated_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "notion.PlannedPage": {
+            "type": "object",
+            "properties": {
+                "changes": {
+                    "description": "Properties of the client copy that would change",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/notion.PropertyChange"
+                    }
+                },
+                "client_id": {
+                    "description": "ID of page in client dashboard, empty if it isn't copied",
+                    "type": "string"
+                },
+                "error": {
+                    "description": "Why the page couldn't be planned",
+                    "type": "string"
+                },
+                "internal_id": {
+                    "description": "ID of page in internal dashboard",
+                    "type": "string"
+                },
+                "issues": {
+                    "description": "Failed validation rules",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/notion.ValidationIssue"
+                    }
+                },
+                "reason": {
+                    "description": "Why the client copy would be archived",
+                    "type": "string"
+                },
+                "title": {
+                    "description": "Title of the internal page",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "Type of database",
+                    "type": "string"
+                }
+            }
+        },
+        "notion.ProjectPlan": {
+            "type": "object",
+            "properties": {
+                "archive": {
+                    "description": "Client copies that would be archived, their internal pages are gone",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/notion.PlannedPage"
+                    }
+                },
+                "create": {
+                    "description": "Pages that would be copied to the client dashboard",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/notion.PlannedPage"
+                    }
+                },
+                "errors": {
+                    "description": "Pages that couldn't be planned, see Error",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/notion.PlannedPage"
+                    }
+                },
+                "invalid": {
+                    "description": "Pages failing blocking validation rules, they would not be copied",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/notion.PlannedPage"
+                    }
+                },
+                "name": {
+                    "description": "Name of project",
+                    "type": "string"
+                },
+                "new": {
+                    "description": "The project is not saved yet, all its pages are new",
+                    "type": "boolean"
+                },
+                "project_id": {
+                    "description": "ID of project",
+                    "type": "string"
+                },
+                "skipped": {
+                    "description": "Pages with flagged conflicts",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/notion.PlannedPage"
+                    }
+                },
+                "unchanged": {
+                    "description": "Client copies that would be updated with the values they already have",
+                    "type": "integer"
+                },
+                "update": {
+                    "description": "Client copies whose properties would change",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/notion.PlannedPage"
+                    }
+                }
+            }
+        },
+        "notion.ProjectStats": {
+            "type": "object",
+            "properties": {
+                "created": {
+                    "description": "Pages copied to the client dashboard",
+                    "type": "integer"
+                },
+                "failed": {
+                    "description": "Pages that failed to sync",
+                    "type": "integer"
+                },
+                "name": {
+                    "description": "Name of project",
+                    "type": "string"
+                },
+                "project_id": {
+                    "description": "ID of project",
+                    "type": "string"
+                },
+                "skipped": {
+                    "description": "Pages left as they are, e.g. with a flagged conflict",
+                    "type": "integer"
+                },
+                "updated": {
+                    "description": "Client copies updated",
+                    "type": "integer"
+                }
+            }
+        },
+        "notion.PropertyChange": {
+            "type": "object",
+            "properties": {
+                "from": {
+                    "description": "Current value of the client copy",
+                    "type": "string"
+                },
+                "property": {
+                    "description": "Property in the client database",
+                    "type": "string"
+                },
+                "to": {
+                    "description": "Value the sync would write",
+                    "type": "string"
+                }
+            }
+        },
+        "notion.RunError": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "message": {
+                    "type": "string"
+                },
+                "page_id": {
+                    "type": "string"
+                },
+                "project_id": {
+                    "type": "string"
+                },
+                "type": {
+                    "type": "string"
+                }
+            }
+        },
+        "notion.SyncEvent": {
+            "type": "object",
+            "properties": {
+                "client_url": {
+                    "description": "URL of page copy in client dashboard",
+                    "type": "string"
+                },
+                "message": {
+                    "description": "Error or validation failures",
+                    "type": "string"
+                },
+                "page_id": {
+                    "description": "ID of page in internal dashboard",
+                    "type": "string"
+                },
+                "project_id": {
+                    "description": "ID of project",
+                    "type": "string"
+                },
+                "project_name": {
+                    "description": "Name of project",
+                    "type": "string"
+                },
+                "run_id": {
+                    "description": "ID of the run, 0 for pages fixed outside of a run",
+                    "type": "integer"
+                },
+                "seq": {
+                    "description": "Number of the event, increasing",
+                    "type": "integer"
+                },
+                "stats": {
+                    "description": "Counts of the finished project",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/notion.ProjectStats"
+                        }
+                    ]
+                },
+                "status": {
+                    "description": "Status of the finished run",
+                    "type": "string"
+                },
+                "time": {
+                    "description": "When the event happened",
+                    "type": "string"
+                },
+                "title": {
+                    "description": "Title of page",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "One of Event* constants",
+                    "type": "string"
+                }
+            }
+        },
+        "notion.SyncPlan": {
+            "type": "object",
+            "properties": {
+                "projects": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/notion.ProjectPlan"
+                    }
+                }
+            }
+        },
+        "notion.SyncRun": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "description": "Error that stopped the run",
+                    "type": "string"
+                },
+                "errors": {
+                    "description": "Errors saved during the run",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/notion.RunError"
+                    }
+                },
+                "finished_at": {
+                    "description": "When the run ended, nil while it is running",
+                    "type": "string"
+                },
+                "full": {
+                    "description": "Whether the sync cursors were ignored",
+                    "type": "boolean"
+                },
+                "id": {
+                    "type": "integer"
+                },
+                "page_id": {
+                    "description": "Internal page the run was limited to",
+                    "type": "string"
+                },
+                "project_id": {
+                    "description": "Client project the run was limited to",
+                    "type": "string"
+                },
+                "projects": {
+                    "description": "Progress of every project synced so far",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/notion.ProjectStats"
+                    }
+                },
+                "started_at": {
+                    "description": "When the run was started",
+                    "type": "string"
+                },
+                "status": {
+                    "description": "One of Run* constants",
+                    "type": "string"
+                }
+            }
+        },
+        "notion.Validation": {
+            "type": "object",
+            "properties": {
+                "client_id": {
+                    "description": "ID of page in client dashboard",
+                    "type": "string"
+                },
+                "client_url": {
+                    "description": "URL of page in client dashboard, empty if it isn't copied",
+                    "type": "string"
+                },
+                "employee": {
+                    "description": "Names of the people responsible for the page",
+                    "type": "string"
+                },
+                "errors": {
+                    "description": "Errors encountered while validating, joined",
+                    "type": "string"
+                },
+                "first_seen_at": {
+                    "description": "When the page was saved first",
+                    "type": "string"
+                },
+                "internal_id": {
+                    "description": "ID of page in internal dashboard",
+                    "type": "string"
+                },
+                "internal_url": {
+                    "description": "URL of page in internal dashboard",
+                    "type": "string"
+                },
+                "issues": {
+                    "description": "Failed rules",
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/notion.ValidationIssue"
+                    }
+                },
+                "last_seen_at": {
+                    "description": "When the page was checked last",
+                    "type": "string"
+                },
+                "project_id": {
+                    "description": "ID of project",
+                    "type": "string"
+                },
+                "title": {
+                    "description": "Title of page in database",
+                    "type": "string"
+                },
+                "type": {
+                    "description": "Type of database",
+                    "type": "string"
+                }
+            }
+        },
+        "notion.ValidationIssue": {
+            "type": "object",
+            "properties": {
+                "code": {
+                    "description": "Check of the rule, one of Check* constants or CodeConflict",
+                    "type": "string"
+                },
+                "field": {
+                    "description": "Property of the page",
+                    "type": "string"
+                },
+                "message": {
+                    "description": "What is wrong",
+                    "type": "string"
+                },
+                "severity": {
+                    "description": "SeverityWarning or SeverityError",
+                    "type": "string"
+                }
+            }
+        },
+        "project.Project": {
+            "type": "object",
+            "properties": {
+                "client_last_synced": {
+                    "description": "ClientLastSynced is the last edit of the client dashboard seen by the two-way sync.",
+                    "type": "integer"
+                },
+                "internal_id": {
+                    "description": "ID of project page in internal dashboard",
+                    "type": "string"
+                },
+                "name": {
+                    "description": "Project name",
+                    "type": "string"
+                },
+                "paused": {
+                    "description": "Paused projects are skipped by the sync unless they are synced on their own.",
+                    "type": "boolean"
+                },
+                "project_id": {
+                    "description": "ID of project page in client dashboard",
+                    "type": "string"
+                },
+                "tasks_db_id": {
+                    "description": "ID of tasks database in client dashboard",
+                    "type": "string"
+                },
+                "tasks_last_synced": {
+                    "description": "Last edit of internal tasks copied, unix time",
+                    "type": "integer"
+                },
+                "time_db_id": {
+                    "description": "ID of time database in client dashboard",
+                    "type": "string"
+                },
+                "time_last_synced": {
+                    "description": "Last edit of internal time rows copied, unix time",
+                    "type": "integer"
+                },
+                "workers_db_id": {
+                    "description": "ID of workers database in client dashboard",
                     "type": "string"
                 }
             }
@@ -0,0 +1,157 @@
+// Package export writes time rows to XLSX and CSV files, with the columns of the Google Sheets targets.
+package export
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/Corray333/notion-manager/internal/gsheets"
+	"github.com/Corray333/notion-manager/internal/notion"
+	"github.com/Corray333/notion-manager/pkg/xlsx"
+)
+
+var (
+	ErrUnknownFormat = errors.New("format must be xlsx or csv")
+)
+
+const (
+	FormatXLSX = "xlsx"
+	FormatCSV  = "csv"
+)
+
+// Filter selects the exported time rows.
+type Filter struct {
+	notion.TimeFilter
+	Employee string // Name of an employee of Исполнитель, case-insensitive
+}
+
+// GetTimes returns the time rows of the filter, oldest work date first.
+func GetTimes(ctx context.Context, filter Filter) ([]notion.Time, error) {
+	times, err := notion.FindTimes(ctx, filter.TimeFilter, "")
+	if err != nil {
+		return nil, err
+	}
+	if filter.Employee == "" {
+		return times, nil
+	}
+
+	res := []notion.Time{}
+	for _, tr := range times {
+		for _, person := range tr.Raw["Исполнитель"].People {
+			if strings.EqualFold(strings.TrimSpace(person.Name), strings.TrimSpace(filter.Employee)) {
+				res = append(res, tr)
+				break
+			}
+		}
+	}
+	return res, nil
+}
+
+// ContentType returns the MIME type of the format.
+func ContentType(format string) string {
+	if format == FormatCSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+}
+
+// Write writes a header and a line for every time row. HYPERLINK formulas of the columns are links
+// in XLSX and their text in CSV, other formulas are written as text.
+func Write(w io.Writer, format string, columns gsheets.Columns, times []notion.Time) error {
+	switch format {
+	case FormatXLSX:
+		return writeXLSX(w, columns, times)
+	case FormatCSV:
+		return writeCSV(w, columns, times)
+	}
+	return ErrUnknownFormat
+}
+
+func writeXLSX(w io.Writer, columns gsheets.Columns, times []notion.Time) error {
+	out, err := xlsx.NewWriter(w, "Times")
+	if err != nil {
+		return err
+	}
+	header := []xlsx.Cell{}
+	for _, h := range columns.Headers() {
+		header = append(header, xlsx.Cell{Value: h})
+	}
+	if err := out.WriteRow(header); err != nil {
+		return err
+	}
+	for _, tr := range times {
+		row := []xlsx.Cell{}
+		for _, value := range columns.Row(&tr) {
+			row = append(row, cell(value))
+		}
+		if err := out.WriteRow(row); err != nil {
+			return err
+		}
+	}
+	return out.Close()
+}
+
+func writeCSV(w io.Writer, columns gsheets.Columns, times []notion.Time) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(EscapeCSV(columns.Headers())); err != nil {
+		return err
+	}
+	for _, tr := range times {
+		line := []string{}
+		for _, value := range columns.Row(&tr) {
+			v := cell(value).Value
+			if s, ok := v.(string); ok {
+				line = append(line, escapeCSV(s))
+			} else {
+				line = append(line, fmt.Sprint(v))
+			}
+		}
+		if err := out.Write(line); err != nil {
+			return err
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// EscapeCSV escapes the values of a CSV record, see escapeCSV.
+func EscapeCSV(record []string) []string {
+	escaped := make([]string, len(record))
+	for i, s := range record {
+		escaped[i] = escapeCSV(s)
+	}
+	return escaped
+}
+
+// escapeCSV prefixes text starting like a formula with "'", so that spreadsheet apps
+// opening the file show it instead of evaluating it.
+func escapeCSV(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+// hyperlinkRe matches the HYPERLINK formulas of Google Sheets, arguments separated by "," or ";".
+var hyperlinkRe = regexp.MustCompile(`^=HYPERLINK\(\s*"((?:[^"]|"")*)"\s*[;,]\s*"((?:[^"]|"")*)"\s*\)$`)
+
+// cell turns a value of a sheet row into a cell, HYPERLINK formulas into links.
+func cell(value interface{}) xlsx.Cell {
+	s, ok := value.(string)
+	if !ok {
+		return xlsx.Cell{Value: value}
+	}
+	if m := hyperlinkRe.FindStringSubmatch(s); m != nil {
+		link, text := strings.ReplaceAll(m[1], `""`, `"`), strings.ReplaceAll(m[2], `""`, `"`)
+		if text == "" {
+			text = link
+		}
+		return xlsx.Cell{Value: text, Link: link}
+	}
+	return xlsx.Cell{Value: s}
+}
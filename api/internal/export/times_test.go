@@ -0,0 +1,76 @@
+package export_test
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Corray333/notion-manager/internal/export"
+	"github.com/Corray333/notion-manager/internal/gsheets"
+	"github.com/Corray333/notion-manager/internal/notion"
+	notionclient "github.com/Corray333/notion-manager/pkg/notion"
+	"github.com/Corray333/notion-manager/pkg/notion/notiontest"
+)
+
+const timesDB = "times-db"
+
+func addTime(fake *notiontest.Server, name, date, employee string, hours float64) string {
+	return fake.AddPage(timesDB, map[string]interface{}{
+		"Что делали":  map[string]interface{}{"title": []map[string]interface{}{{"type": "text", "text": map[string]interface{}{"content": name}, "plain_text": name}}},
+		"Всего ч":     map[string]interface{}{"number": hours},
+		"Дата работ":  map[string]interface{}{"date": map[string]interface{}{"start": date}},
+		"Исполнитель": map[string]interface{}{"people": []map[string]interface{}{{"id": employee, "name": employee}}},
+	})
+}
+
+func TestExportTimes(t *testing.T) {
+	fake := notiontest.NewServer()
+	t.Cleanup(fake.Close)
+	notion.SetClient(notionclient.NewClient("secret",
+		notionclient.WithBaseURL(fake.URL()),
+		notionclient.WithRateLimit(1000, 1000),
+		notionclient.WithRetries(3, time.Millisecond, 10*time.Millisecond),
+	))
+	t.Setenv("TIMES_DB", timesDB)
+	fake.AddDatabase(timesDB, "Время", map[string]string{
+		"Что делали":  "title",
+		"Всего ч":     "number",
+		"Дата работ":  "date",
+		"Исполнитель": "people",
+	})
+
+	june := addTime(fake, `Fixed "login"`, "2024-06-10", "Ann", 1.5)
+	addTime(fake, "Other employee", "2024-06-11", "Bob", 2)
+	formula := addTime(fake, "=HYPERLINK(\"https://evil.example\")", "2024-06-12", "Ann", 1)
+	addTime(fake, "Too late", "2024-07-01", "Ann", 3)
+
+	times, err := export.GetTimes(context.Background(), export.Filter{
+		TimeFilter: notion.TimeFilter{From: "2024-06-01", To: "2024-06-30"},
+		Employee:   "ann",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(times) != 2 || times[0].ID != june || times[1].ID != formula {
+		t.Fatalf("expected the June time rows of Ann, got %+v", times)
+	}
+
+	columns := gsheets.Columns{
+		{Header: "Task", Value: `=HYPERLINK("{url}"; "{Что делали}")`},
+		{Value: "Всего ч"},
+		{Header: "Date", Value: "Дата работ"},
+	}
+	var buf bytes.Buffer
+	if err := export.Write(&buf, export.FormatCSV, columns, times); err != nil {
+		t.Fatal(err)
+	}
+	want := "Task,Всего ч,Date\n\"Fixed \"\"login\"\"\",1.5,10/06/2024\n\"'=HYPERLINK(\"\"https://evil.example\"\")\",1,12/06/2024\n"
+	if buf.String() != want {
+		t.Errorf("expected %q, got %q", want, buf.String())
+	}
+
+	if err := export.Write(&buf, "pdf", columns, times); err != export.ErrUnknownFormat {
+		t.Errorf("expected %v, got %v", export.ErrUnknownFormat, err)
+	}
+}
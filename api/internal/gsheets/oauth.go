@@ -2,87 +2,319 @@ package gsheets
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"sync"
+	"time"
 
 	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/google"
+	"google.golang.org/api/sheets/v4"
 )
 
-func GetClient(config *oauth2.Config) *http.Client {
-	tokFile := "../secrets/token.json"
-	tok, err := TokenFromFile(tokFile)
+var (
+	ErrNotConfigured = errors.New("google credentials are not configured")
+	ErrAuthRequired  = errors.New("google authorization is required, open /api/google/auth")
+	ErrInvalidState  = errors.New("invalid or expired oauth state")
+	ErrNoToken       = errors.New("no google token saved")
+)
+
+const (
+	ModeOAuth          = "oauth"
+	ModeServiceAccount = "service_account"
+
+	// stateTTL is how long the consent screen opened by /api/google/auth may take.
+	stateTTL = 10 * time.Minute
+)
+
+var (
+	credentialsFile = "../secrets/credentials.json"
+	// legacyTokenFile is where tokens were kept before they were saved to the database.
+	legacyTokenFile = "../secrets/token.json"
+	redirectURL     string
+
+	authMu sync.Mutex
+	// authErr is the last refresh failure that needs a new consent, cleared when a token is saved.
+	authErr error
+	states  = map[string]time.Time{}
+)
+
+// SetCredentialsFile sets the path of the credentials downloaded from the Google Cloud console:
+// an OAuth client ("web" or "installed") or a service account key.
+func SetCredentialsFile(path string) {
+	credentialsFile = path
+}
+
+// SetRedirectURL sets the URL of /api/google/callback as registered for the OAuth client.
+// The first redirect URL of the credentials is used if it is empty.
+func SetRedirectURL(url string) {
+	redirectURL = url
+}
 
+// credentials reads the credentials file. It returns the OAuth config for OAuth clients
+// and the raw key for service accounts.
+func credentials() (*oauth2.Config, []byte, error) {
+	b, err := os.ReadFile(credentialsFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil, ErrNotConfigured
+	}
 	if err != nil {
-		tok = GetTokenFromWeb(config)
-		SaveToken(tokFile, tok)
+		return nil, nil, err
 	}
 
-	client := config.Client(context.Background(), tok)
-	client.Transport = &tokenSourceTransport{
-		base:    config.TokenSource(context.Background(), tok),
-		config:  config,
-		tokFile: tokFile,
+	var key struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(b, &key); err != nil {
+		return nil, nil, fmt.Errorf("invalid google credentials: %w", err)
+	}
+	if key.Type == ModeServiceAccount {
+		return nil, b, nil
 	}
 
-	return client
+	config, err := google.ConfigFromJSON(b, sheets.SpreadsheetsScope)
+	if err != nil {
+		return nil, nil, err
+	}
+	if redirectURL != "" {
+		config.RedirectURL = redirectURL
+	}
+	return config, nil, nil
 }
 
-type tokenSourceTransport struct {
-	base    oauth2.TokenSource
-	config  *oauth2.Config
-	tokFile string
+// newClient returns an HTTP client authorized with the service account or with the saved OAuth
+// token. Refreshed tokens are saved. It returns ErrAuthRequired if there is no usable token.
+func newClient(ctx context.Context, store Storage) (*http.Client, error) {
+	config, key, err := credentials()
+	if err != nil {
+		return nil, err
+	}
+	if key != nil {
+		jwt, err := google.JWTConfigFromJSON(key, sheets.SpreadsheetsScope)
+		if err != nil {
+			return nil, err
+		}
+		return jwt.Client(ctx), nil
+	}
+
+	token, err := savedToken(store)
+	if errors.Is(err, ErrNoToken) {
+		return nil, ErrAuthRequired
+	}
+	if err != nil {
+		return nil, err
+	}
+	if token.RefreshToken == "" && !token.Valid() {
+		return nil, ErrAuthRequired
+	}
+	if err := authError(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrAuthRequired, err)
+	}
+
+	source := &savingTokenSource{
+		base:  config.TokenSource(ctx, token),
+		store: store,
+		last:  token,
+	}
+	return oauth2.NewClient(ctx, oauth2.ReuseTokenSource(token, source)), nil
 }
 
-func (t *tokenSourceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
-	token, err := t.base.Token()
+// savedToken returns the token of the database. A token file left by the console flow used
+// before is moved to the database and renamed so that it isn't read again.
+func savedToken(store Storage) (*oauth2.Token, error) {
+	token, err := store.GetGoogleToken()
+	if !errors.Is(err, ErrNoToken) {
+		return token, err
+	}
+
+	f, err := os.Open(legacyTokenFile)
 	if err != nil {
-		if token == nil || err.Error() == "oauth2: cannot fetch token: 400 Bad Request: {\"error\":\"invalid_grant\"}" {
-			token = GetTokenFromWeb(t.config)
-			SaveToken(t.tokFile, token)
-			t.base = t.config.TokenSource(context.Background(), token)
-		} else {
-			log.Fatalf("Unable to retrieve refreshed token: %v", err)
-		}
+		return nil, ErrNoToken
+	}
+	defer f.Close()
+	token = &oauth2.Token{}
+	if err := json.NewDecoder(f).Decode(token); err != nil {
+		return nil, ErrNoToken
 	}
-	return oauth2.NewClient(context.Background(), t.base).Transport.RoundTrip(req)
+	if err := store.SaveGoogleToken(token); err != nil {
+		return nil, err
+	}
+	f.Close()
+	if err := os.Rename(legacyTokenFile, legacyTokenFile+".imported"); err != nil {
+		slog.Error("error renaming google token file: " + err.Error())
+	}
+	slog.Info("moved google token from " + legacyTokenFile + " to the database")
+	return token, nil
+}
+
+// savingTokenSource saves the tokens it refreshes and records refresh tokens Google no longer accepts.
+type savingTokenSource struct {
+	base  oauth2.TokenSource
+	store Storage
+
+	mu   sync.Mutex
+	last *oauth2.Token
 }
 
-func GetTokenFromWeb(config *oauth2.Config) *oauth2.Token {
-	authURL := config.AuthCodeURL("state-token", oauth2.AccessTypeOffline)
-	fmt.Printf("Go to the following link in your browser then type the authorization code: \n%v\n", authURL)
+func (s *savingTokenSource) Token() (*oauth2.Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
 
-	var authCode string
-	if _, err := fmt.Scan(&authCode); err != nil {
-		log.Fatalf("Unable to read authorization code: %v", err)
+	token, err := s.base.Token()
+	var retrieveErr *oauth2.RetrieveError
+	if errors.As(err, &retrieveErr) && retrieveErr.Response != nil && retrieveErr.Response.StatusCode < http.StatusInternalServerError {
+		// The refresh token was revoked or expired, only a new consent helps.
+		setAuthError(err)
+		return nil, fmt.Errorf("%w: %v", ErrAuthRequired, err)
+	}
+	if err != nil {
+		return nil, err
 	}
 
-	tok, err := config.Exchange(context.TODO(), authCode)
+	if token.AccessToken != s.last.AccessToken {
+		if token.RefreshToken == "" {
+			token.RefreshToken = s.last.RefreshToken
+		}
+		if err := s.store.SaveGoogleToken(token); err != nil {
+			slog.Error("error saving google token: " + err.Error())
+		}
+		s.last = token
+	}
+	return token, nil
+}
+
+func authError() error {
+	authMu.Lock()
+	defer authMu.Unlock()
+	return authErr
+}
+
+func setAuthError(err error) {
+	authMu.Lock()
+	defer authMu.Unlock()
+	authErr = err
+}
+
+// AuthURL returns the URL of the consent screen. The state it carries is accepted by Callback once.
+func AuthURL() (string, error) {
+	config, key, err := credentials()
 	if err != nil {
-		log.Fatalf("Unable to retrieve token from web: %v", err)
+		return "", err
+	}
+	if key != nil {
+		return "", errors.New("a service account is configured, there is nothing to authorize")
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
 	}
-	return tok
+	state := hex.EncodeToString(b)
+
+	authMu.Lock()
+	now := time.Now()
+	for s, created := range states {
+		if now.Sub(created) > stateTTL {
+			delete(states, s)
+		}
+	}
+	states[state] = now
+	authMu.Unlock()
+
+	// Consent is asked again so that Google returns a refresh token every time.
+	return config.AuthCodeURL(state, oauth2.AccessTypeOffline, oauth2.ApprovalForce), nil
 }
 
-func TokenFromFile(file string) (*oauth2.Token, error) {
-	f, err := os.Open(file)
+// Callback exchanges the code Google redirected with for a token and saves it.
+func Callback(ctx context.Context, store Storage, state, code string) error {
+	authMu.Lock()
+	created, ok := states[state]
+	delete(states, state)
+	authMu.Unlock()
+	if !ok || time.Since(created) > stateTTL {
+		return ErrInvalidState
+	}
+
+	config, _, err := credentials()
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer f.Close()
-	tok := &oauth2.Token{}
-	err = json.NewDecoder(f).Decode(tok)
-	return tok, err
+	if config == nil {
+		return ErrNotConfigured
+	}
+	token, err := config.Exchange(ctx, code)
+	if err != nil {
+		return err
+	}
+	if token.RefreshToken == "" {
+		if old, err := store.GetGoogleToken(); err == nil {
+			token.RefreshToken = old.RefreshToken
+		}
+	}
+	if err := store.SaveGoogleToken(token); err != nil {
+		return err
+	}
+	setAuthError(nil)
+	return nil
+}
+
+// Forget deletes the saved token, the export stops until the next consent.
+func Forget(store Storage) error {
+	if err := store.DeleteGoogleToken(); err != nil {
+		return err
+	}
+	setAuthError(nil)
+	return nil
 }
 
-func SaveToken(path string, token *oauth2.Token) {
-	fmt.Printf("Saving credential file to: %s\n", path)
-	f, err := os.Create(path)
+// AuthStatus tells whether the export can reach Google Sheets.
+type AuthStatus struct {
+	Mode        string     `json:"mode"`                 // "oauth", "service_account" or empty if there are no credentials
+	Authorized  bool       `json:"authorized"`           // A service account or a usable token is there
+	NeedsReauth bool       `json:"needs_reauth"`         // Open AuthURL to export again
+	Expiry      *time.Time `json:"expiry,omitempty"`     // Expiry of the access token, it is refreshed with the refresh token
+	LastError   string     `json:"last_error,omitempty"` // Why a new consent is needed or the credentials can't be read
+	AuthURL     string     `json:"auth_url,omitempty"`   // Where to authorize
+}
+
+// GetStatus reports the credentials in use and whether a new consent is needed.
+func GetStatus(store Storage) AuthStatus {
+	_, key, err := credentials()
+	if errors.Is(err, ErrNotConfigured) {
+		return AuthStatus{LastError: err.Error()}
+	}
 	if err != nil {
-		log.Fatalf("Unable to cache oauth token: %v", err)
+		return AuthStatus{Mode: ModeOAuth, LastError: err.Error()}
 	}
-	defer f.Close()
-	json.NewEncoder(f).Encode(token)
+	if key != nil {
+		return AuthStatus{Mode: ModeServiceAccount, Authorized: true}
+	}
+
+	status := AuthStatus{Mode: ModeOAuth, AuthURL: "/api/google/auth"}
+	token, err := savedToken(store)
+	switch {
+	case errors.Is(err, ErrNoToken):
+		status.NeedsReauth = true
+		status.LastError = ErrNoToken.Error()
+	case err != nil:
+		status.LastError = err.Error()
+	case authError() != nil:
+		status.NeedsReauth = true
+		status.LastError = authError().Error()
+	case token.RefreshToken == "" && !token.Valid():
+		status.NeedsReauth = true
+		status.LastError = "the token expired and has no refresh token"
+	default:
+		status.Authorized = true
+	}
+	if token != nil && !token.Expiry.IsZero() {
+		status.Expiry = &token.Expiry
+	}
+	return status
 }
@@ -0,0 +1,115 @@
+package gsheets_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Corray333/notion-manager/internal/gsheets"
+	"github.com/Corray333/notion-manager/internal/storage/storagetest"
+	"golang.org/x/oauth2"
+)
+
+// tokenServer answers authorization codes with a token and refuses every refresh token.
+func tokenServer(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		w.Header().Set("Content-Type", "application/json")
+		if r.Form.Get("grant_type") == "refresh_token" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error": "invalid_grant"}`)
+			return
+		}
+		fmt.Fprint(w, `{"access_token": "access", "refresh_token": "refresh", "token_type": "Bearer", "expires_in": 3600}`)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestGoogleAuth(t *testing.T) {
+	store := storagetest.New(t)
+	srv := tokenServer(t)
+
+	gsheets.SetCredentialsFile(filepath.Join(t.TempDir(), "missing.json"))
+	if status := gsheets.GetStatus(store); status.Mode != "" || status.Authorized {
+		t.Fatalf("expected no credentials, got %+v", status)
+	}
+
+	credentials := filepath.Join(t.TempDir(), "credentials.json")
+	data := fmt.Sprintf(`{"web": {"client_id": "id", "client_secret": "secret", "auth_uri": "%[1]s/auth", "token_uri": "%[1]s/token", "redirect_uris": ["http://localhost/api/google/callback"]}}`, srv.URL)
+	if err := os.WriteFile(credentials, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	gsheets.SetCredentialsFile(credentials)
+	t.Cleanup(func() { gsheets.SetCredentialsFile("../secrets/credentials.json") })
+
+	if status := gsheets.GetStatus(store); status.Mode != gsheets.ModeOAuth || !status.NeedsReauth {
+		t.Fatalf("expected a consent to be needed, got %+v", status)
+	}
+
+	// The refresh token is revoked: the export fails instead of waiting for a code.
+	expired := &oauth2.Token{AccessToken: "old", RefreshToken: "revoked", Expiry: time.Now().Add(-time.Hour)}
+	if err := store.SaveGoogleToken(expired); err != nil {
+		t.Fatal(err)
+	}
+	target := gsheets.Target{Name: "test", SpreadsheetID: "sheet", KeyColumn: "A", Columns: gsheets.Columns{{Value: "{id}"}}, Enabled: true}
+	if err := target.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.NewSheetsTarget(&target); err != nil {
+		t.Fatal(err)
+	}
+	if err := gsheets.UpdateGoogleSheets(context.Background(), store); !errors.Is(err, gsheets.ErrAuthRequired) {
+		t.Fatalf("expected %v, got %v", gsheets.ErrAuthRequired, err)
+	}
+	if status := gsheets.GetStatus(store); !status.NeedsReauth || status.LastError == "" {
+		t.Fatalf("expected the revoked token to be reported, got %+v", status)
+	}
+
+	authURL, err := gsheets.AuthURL()
+	if err != nil {
+		t.Fatal(err)
+	}
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state := u.Query().Get("state")
+	if u.Query().Get("redirect_uri") != "http://localhost/api/google/callback" || state == "" {
+		t.Fatalf("unexpected auth url %s", authURL)
+	}
+
+	if err := gsheets.Callback(context.Background(), store, "forged", "code"); !errors.Is(err, gsheets.ErrInvalidState) {
+		t.Fatalf("expected %v, got %v", gsheets.ErrInvalidState, err)
+	}
+	if err := gsheets.Callback(context.Background(), store, state, "code"); err != nil {
+		t.Fatal(err)
+	}
+	token, err := store.GetGoogleToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "access" || token.RefreshToken != "refresh" {
+		t.Fatalf("expected the exchanged token to be saved, got %+v", token)
+	}
+	if status := gsheets.GetStatus(store); !status.Authorized || status.NeedsReauth {
+		t.Fatalf("expected the export to be authorized, got %+v", status)
+	}
+	if err := gsheets.Callback(context.Background(), store, state, "code"); !errors.Is(err, gsheets.ErrInvalidState) {
+		t.Fatal("expected a state to be accepted once")
+	}
+
+	if err := gsheets.Forget(store); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetGoogleToken(); !errors.Is(err, gsheets.ErrNoToken) {
+		t.Fatalf("expected the token to be deleted, got %v", err)
+	}
+}
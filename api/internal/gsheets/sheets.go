@@ -1,16 +1,14 @@
 package gsheets
 
 import (
+	"context"
 	"errors"
 	"fmt"
-	"log"
 	"log/slog"
-	"os"
-	"strings"
 	"time"
 
 	"github.com/Corray333/notion-manager/internal/notion"
-	"golang.org/x/oauth2/google"
+	"google.golang.org/api/option"
 	"google.golang.org/api/sheets/v4"
 )
 
@@ -22,23 +20,18 @@ const (
 	TimeLayout = "02/01/2006 15:04:05"
 )
 
-func GetLastSyncedTime(srv *sheets.Service, spreadsheetId string) (int64, error) {
-
-	readRange := "Sheet1!X2"
-	resp, err := srv.Spreadsheets.Values.Get(spreadsheetId, readRange).Do()
+// GetLastSyncedTime reads the last edit time of the rows exported to the target.
+func GetLastSyncedTime(srv *sheets.Service, target *Target) (int64, error) {
+	resp, err := srv.Spreadsheets.Values.Get(target.SpreadsheetID, target.cellRange(target.LastSyncedCell)).Do()
 	if err != nil {
-		log.Fatalf("Unable to retrieve data from sheet: %v", err)
-	}
-
-	for _, row := range resp.Values {
-		fmt.Println(row)
+		return 0, err
 	}
 
 	if len(resp.Values) == 0 || len(resp.Values[0]) == 0 {
 		return 0, ErrNoTime
 	}
 
-	lastSynced, err := time.ParseInLocation(TimeLayout, resp.Values[0][0].(string), time.Local)
+	lastSynced, err := time.ParseInLocation(TimeLayout, fmt.Sprint(resp.Values[0][0]), time.Local)
 	if err != nil {
 		return 0, err
 	}
@@ -46,172 +39,129 @@ func GetLastSyncedTime(srv *sheets.Service, spreadsheetId string) (int64, error)
 	return lastSynced.Unix(), nil
 }
 
-func SetLastSyncedTime(lastSyncedTimestamp int64, srv *sheets.Service, spreadsheetId string) error {
-	writeRange := "Sheet1!X2"
-
+// SetLastSyncedTime saves the last edit time of the rows exported to the target.
+func SetLastSyncedTime(lastSyncedTimestamp int64, srv *sheets.Service, target *Target) error {
 	lastSynced := time.Unix(lastSyncedTimestamp, 0)
 
-	serialized := lastSynced.Format(TimeLayout)
-
-	// Create a ValueRange with the single value
 	var vr sheets.ValueRange
-	myval := []interface{}{serialized} // Replace "Your Value" with the value you want to insert
-	vr.Values = append(vr.Values, myval)
+	vr.Values = append(vr.Values, []interface{}{lastSynced.Format(TimeLayout)})
+
+	_, err := srv.Spreadsheets.Values.Update(target.SpreadsheetID, target.cellRange(target.LastSyncedCell), &vr).ValueInputOption("USER_ENTERED").Do()
+	return err
+}
 
-	// Update the cell with the value
-	_, err := srv.Spreadsheets.Values.Update(spreadsheetId, writeRange, &vr).ValueInputOption("USER_ENTERED").Do()
+// UpdateGoogleSheets exports the time rows edited since the last export to every enabled target.
+// A failing target doesn't stop the others.
+func UpdateGoogleSheets(ctx context.Context, store Storage) error {
+	targets, err := store.GetSheetsTargets()
 	if err != nil {
 		return err
 	}
-
-	return nil
+	enabled := []Target{}
+	for _, t := range targets {
+		if t.Enabled {
+			enabled = append(enabled, t)
+		}
+	}
+	return ExportTargets(ctx, store, enabled)
 }
 
-func UpdateGoogleSheets() error {
+// ExportTargets exports the time rows edited since the last export to the targets, enabled or not.
+func ExportTargets(ctx context.Context, store Storage, targets []Target) error {
 	slog.Info("Updating Google Sheets")
-	b, err := os.ReadFile("../secrets/credentials.json")
+	srv, err := newService(ctx, store)
 	if err != nil {
 		return err
 	}
 
-	config, err := google.ConfigFromJSON(b, sheets.SpreadsheetsScope)
-	if err != nil {
-		return err
+	errs := []error{}
+	for _, target := range targets {
+		if err := exportTarget(ctx, srv, &target); err != nil {
+			errs = append(errs, fmt.Errorf("sheets target %q: %w", target.Name, err))
+		}
 	}
-	client := GetClient(config)
+	return errors.Join(errs...)
+}
 
-	srv, err := sheets.New(client)
+func newService(ctx context.Context, store Storage) (*sheets.Service, error) {
+	client, err := newClient(ctx, store)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return sheets.NewService(ctx, option.WithHTTPClient(client))
+}
 
-	spreadsheetId := "1dStGuMfFU2Vq2V2xgXLyKUq_j3zYBeP15LA0eUQtTAQ"
-
-	lastSynced, err := GetLastSyncedTime(srv, spreadsheetId)
-	if err != nil {
+func exportTarget(ctx context.Context, srv *sheets.Service, target *Target) error {
+	lastSynced, err := GetLastSyncedTime(srv, target)
+	if err != nil && !errors.Is(err, ErrNoTime) {
 		return err
 	}
 
-	readRange := "Sheet1!W:W" // H:H - весь первый столбец
-	fullTable, err := srv.Spreadsheets.Values.Get(spreadsheetId, readRange).Do()
+	if target.Reconcile != "" {
+		rows, err := staleRows(ctx, srv, target)
+		if err != nil {
+			return err
+		}
+		if err := removeStaleRows(srv, target, rows, target.Reconcile); err != nil {
+			return err
+		}
+		if len(rows) > 0 {
+			slog.Info("removed stale sheet rows", "target", target.Name, "rows", len(rows), "mode", target.Reconcile)
+		}
+	}
+
+	keys := target.cellRange(target.KeyColumn + ":" + target.KeyColumn)
+	fullTable, err := srv.Spreadsheets.Values.Get(target.SpreadsheetID, keys).Do()
 	if err != nil {
 		return err
 	}
 
-	var vr sheets.ValueRange
-	times, err := notion.GetTimes(lastSynced, "", "")
+	times, err := notion.GetTimes(ctx, lastSynced, target.ProjectID, "")
 	if err != nil {
 		return err
 	}
 
+	var vr sheets.ValueRange
 	var updateVr []*sheets.ValueRange
-
-	fmt.Println(len(times), err)
+	last := columnName(len(target.Columns) - 1)
 	for _, timeRaw := range times {
-		date, _ := time.Parse(notion.TIME_LAYOUT_IN, timeRaw.Properties.WorkDate.Date.Start)
-		date2, _ := time.Parse("2006-01-02", timeRaw.Properties.WorkDate.Date.Start)
-		if date.Before(date2) {
-			date = date2
-		}
 		lastSyncedRaw, _ := time.Parse(notion.TIME_LAYOUT_IN, timeRaw.LastEditedTime)
-		lastSynced = lastSyncedRaw.Unix()
-		title := ""
-		for _, name := range timeRaw.Properties.WhatDid.Title {
-			title += name.PlainText
-		}
-
-		rawId, err := findRowIndexByID(fullTable, timeRaw.ID)
-
-		if err != nil {
-			return err
+		lastSynced = max(lastSynced, lastSyncedRaw.Unix())
+		if !target.matches(&timeRaw) {
+			continue
 		}
 
-		myval := []interface{}{
-			fmt.Sprintf(`=HYPERLINK("%s"; "%s")`, timeRaw.URL, title),
-			timeRaw.Properties.TotalHours.Number,
-			date.Format("02/01/2006"),
-			func() string {
-				if len(timeRaw.Properties.Task.Relation) == 0 {
-					return ""
-				}
-				url := "https://www.notion.so/"
-				id := strings.Join(strings.Split(timeRaw.Properties.Task.Relation[0].ID, "-"), "")
-				return fmt.Sprintf(`=HYPERLINK("%s"; "%s")`, url+id, timeRaw.Properties.TaskName.Formula.String)
-			}(),
-			timeRaw.Properties.ProjectName.Formula.String,
-		}
-		if len(timeRaw.Properties.WhoDid.People) > 0 {
-			myval = append(myval, timeRaw.Properties.WhoDid.People[0].Name)
-		} else {
-			myval = append(myval, "")
-		}
-		myval = append(myval, []interface{}{
-			// TODO:
-			timeRaw.Properties.PayableHours.Formula.Number,
-			func() string {
-				if len(timeRaw.Properties.Task.Relation) == 0 {
-					return ""
-				}
-				return timeRaw.Properties.Task.Relation[0].ID
-			}(),
-			timeRaw.Properties.Direction.Select.Name,
-			timeRaw.Properties.EstimateHours.Formula.String,
-			lastSyncedRaw.Format(TimeLayout),
-			func() string {
-				if timeRaw.Properties.Payment.Checkbox {
-					return "TRUE"
-				}
-				return "FALSE"
-			}(),
-			func() string {
-				if len(timeRaw.Properties.Project.Rollup.Array) == 0 || len(timeRaw.Properties.Project.Rollup.Array[0].Relation) == 0 {
-					return ""
-				}
-				return timeRaw.Properties.Project.Rollup.Array[0].Relation[0].ID
-			}(),
-			timeRaw.Properties.Month.Formula.String,
-			timeRaw.Properties.BH.Formula.Number,
-			timeRaw.Properties.SH.Number,
-			timeRaw.Properties.DH.Number,
-			timeRaw.Properties.BHGS.Formula.String,
-			timeRaw.Properties.MonthNumber.Formula.Number,
-			timeRaw.Properties.WeekNumber.Formula.Number,
-			timeRaw.Properties.DayNumber.Formula.Number,
-			timeRaw.Properties.ProjectStatus.Formula.String,
-			timeRaw.ID,
-		}...)
-
-		if rawId != -1 {
-			uvr := sheets.ValueRange{
-				Values: [][]interface{}{myval},
-				Range:  fmt.Sprintf("Sheet1!A%d:W%d", rawId, rawId),
-			}
-			updateVr = append(updateVr, &uvr)
+		row := target.row(&timeRaw)
+		if rawId := findRowIndexByID(fullTable, timeRaw.ID); rawId != -1 {
+			updateVr = append(updateVr, &sheets.ValueRange{
+				Values: [][]interface{}{row},
+				Range:  target.cellRange(fmt.Sprintf("A%d:%s%d", rawId, last, rawId)),
+			})
 			continue
 		}
 
-		vr.Values = append(vr.Values, myval)
-
+		vr.Values = append(vr.Values, row)
 	}
 
-	writeRange := "Sheet1!A3:W3"
-
-	_, err = srv.Spreadsheets.Values.BatchUpdate(spreadsheetId, &sheets.BatchUpdateValuesRequest{
-		ValueInputOption: "USER_ENTERED",
-		Data:             updateVr,
-	}).Do()
-
-	if err != nil {
-		return err
+	if len(updateVr) > 0 {
+		_, err = srv.Spreadsheets.Values.BatchUpdate(target.SpreadsheetID, &sheets.BatchUpdateValuesRequest{
+			ValueInputOption: "USER_ENTERED",
+			Data:             updateVr,
+		}).Do()
+		if err != nil {
+			return err
+		}
 	}
 
-	_, err = srv.Spreadsheets.Values.Append(spreadsheetId, writeRange, &vr).ValueInputOption("USER_ENTERED").InsertDataOption("INSERT_ROWS").Do()
-	if err != nil {
-		return err
+	if len(vr.Values) > 0 {
+		writeRange := target.cellRange(fmt.Sprintf("A%d:%s%d", target.FirstRow, last, target.FirstRow))
+		_, err = srv.Spreadsheets.Values.Append(target.SpreadsheetID, writeRange, &vr).ValueInputOption("USER_ENTERED").InsertDataOption("INSERT_ROWS").Do()
+		if err != nil {
+			return err
+		}
 	}
 
-	return SetLastSyncedTime(lastSynced, srv, spreadsheetId)
-
+	return SetLastSyncedTime(lastSynced, srv, target)
 }
 
 type UpdateRequest struct {
@@ -223,19 +173,12 @@ const (
 	MaxRequestsPerMinute = 60
 )
 
-func findRowIndexByID(table *sheets.ValueRange, id string) (int, error) {
-	// Определяем диапазон, который будем получать (весь лист)
-
-	// Ищем строку с нужным значением
+// findRowIndexByID returns the 1-based row of the key column holding the ID, -1 if there is none.
+func findRowIndexByID(table *sheets.ValueRange, id string) int {
 	for i, row := range table.Values {
 		if len(row) > 0 && row[0] == id {
-			// Возвращаем индекс строки (в Google Sheets строки индексируются с 1)
-			fmt.Println("Found: ", i+1)
-			return i + 1, nil
+			return i + 1
 		}
 	}
-
-	fmt.Println("Not found")
-	// Если значение не найдено, возвращаем -1
-	return -1, nil
+	return -1
 }
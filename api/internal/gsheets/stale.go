@@ -0,0 +1,201 @@
+package gsheets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Corray333/notion-manager/internal/notion"
+	"google.golang.org/api/sheets/v4"
+)
+
+var (
+	ErrSheetNotFound = errors.New("sheet not found in the spreadsheet")
+	ErrNoTimeRows    = errors.New("no time rows found, every row of the sheet would be stale")
+)
+
+const (
+	// ReconcileDelete deletes the stale rows of a target.
+	ReconcileDelete = "delete"
+	// ReconcileMark writes StaleMark in the MarkColumn of the stale rows of a target.
+	ReconcileMark = "mark"
+
+	StaleMark = "STALE"
+)
+
+// Reasons a row of a sheet is stale.
+const (
+	StaleDeleted   = "deleted"   // The time row was deleted or archived
+	StaleMoved     = "moved"     // The time row no longer belongs to the project or the month of the target
+	StaleDuplicate = "duplicate" // An earlier row has the same ID, only that one is updated
+)
+
+// StaleRow is a row of a sheet whose time row is gone.
+type StaleRow struct {
+	Row    int    `json:"row"`    // 1-based row of the sheet
+	ID     string `json:"id"`     // ID of the time row in the key column
+	Reason string `json:"reason"` // One of deleted, moved or duplicate
+}
+
+// FindStaleRows returns the rows of the target whose time row is deleted, archived or no longer
+// exported to the target. Rows marked before are left out. Nothing is changed.
+func FindStaleRows(ctx context.Context, store Storage, target *Target) ([]StaleRow, error) {
+	srv, err := newService(ctx, store)
+	if err != nil {
+		return nil, err
+	}
+	return staleRows(ctx, srv, target)
+}
+
+// RemoveStaleRows deletes or marks the stale rows of the target, as the mode says, and returns them.
+func RemoveStaleRows(ctx context.Context, store Storage, target *Target, mode string) ([]StaleRow, error) {
+	if mode != ReconcileDelete && mode != ReconcileMark {
+		return nil, fmt.Errorf("unknown reconcile mode %q", mode)
+	}
+	srv, err := newService(ctx, store)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := staleRows(ctx, srv, target)
+	if err != nil {
+		return nil, err
+	}
+	return rows, removeStaleRows(srv, target, rows, mode)
+}
+
+func staleRows(ctx context.Context, srv *sheets.Service, target *Target) ([]StaleRow, error) {
+	keys, err := srv.Spreadsheets.Values.Get(target.SpreadsheetID, target.cellRange(target.KeyColumn+":"+target.KeyColumn)).Do()
+	if err != nil {
+		return nil, err
+	}
+	marks, err := srv.Spreadsheets.Values.Get(target.SpreadsheetID, target.cellRange(target.markColumn()+":"+target.markColumn())).Do()
+	if err != nil {
+		return nil, err
+	}
+
+	ids, err := notion.GetTimeIDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		// Most likely the wrong database, the sheet is left as it is.
+		return nil, ErrNoTimeRows
+	}
+	live := map[string]bool{}
+	for _, id := range ids {
+		live[normalizeID(id)] = true
+	}
+	exported := live
+	if target.ProjectID != "" || target.Month != "" {
+		times, err := notion.GetTimes(ctx, 0, target.ProjectID, "")
+		if err != nil {
+			return nil, err
+		}
+		exported = map[string]bool{}
+		for _, tr := range times {
+			if target.matches(&tr) {
+				exported[normalizeID(tr.ID)] = true
+			}
+		}
+	}
+	return findStale(target, keys.Values, marks.Values, live, exported), nil
+}
+
+// findStale compares the key column of the sheet with the time rows, live ones and the ones
+// exported to the target.
+func findStale(target *Target, keys, marks [][]interface{}, live, exported map[string]bool) []StaleRow {
+	rows := []StaleRow{}
+	seen := map[string]bool{}
+	for i, row := range keys {
+		if i+1 < target.FirstRow || len(row) == 0 {
+			continue
+		}
+		id := strings.TrimSpace(fmt.Sprint(row[0]))
+		if id == "" {
+			continue
+		}
+		if i < len(marks) && len(marks[i]) > 0 && marks[i][0] == StaleMark {
+			continue
+		}
+
+		key := normalizeID(id)
+		reason := ""
+		switch {
+		case !live[key]:
+			reason = StaleDeleted
+		case !exported[key]:
+			reason = StaleMoved
+		case seen[key]:
+			reason = StaleDuplicate
+		}
+		seen[key] = true
+		if reason != "" {
+			rows = append(rows, StaleRow{Row: i + 1, ID: id, Reason: reason})
+		}
+	}
+	return rows
+}
+
+func removeStaleRows(srv *sheets.Service, target *Target, rows []StaleRow, mode string) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	if mode == ReconcileMark {
+		data := []*sheets.ValueRange{}
+		for _, row := range rows {
+			data = append(data, &sheets.ValueRange{
+				Range:  target.cellRange(fmt.Sprintf("%s%d", target.markColumn(), row.Row)),
+				Values: [][]interface{}{{StaleMark}},
+			})
+		}
+		_, err := srv.Spreadsheets.Values.BatchUpdate(target.SpreadsheetID, &sheets.BatchUpdateValuesRequest{
+			ValueInputOption: "RAW",
+			Data:             data,
+		}).Do()
+		return err
+	}
+
+	spreadsheet, err := srv.Spreadsheets.Get(target.SpreadsheetID).Fields("sheets.properties").Do()
+	if err != nil {
+		return err
+	}
+	i := slices.IndexFunc(spreadsheet.Sheets, func(s *sheets.Sheet) bool { return s.Properties != nil && s.Properties.Title == target.Sheet })
+	if i < 0 {
+		return fmt.Errorf("%w: %s", ErrSheetNotFound, target.Sheet)
+	}
+	sheetID := spreadsheet.Sheets[i].Properties.SheetId
+
+	// Rows are deleted from the bottom so that the rows above keep their numbers.
+	sorted := slices.Clone(rows)
+	slices.SortFunc(sorted, func(a, b StaleRow) int { return b.Row - a.Row })
+	requests := []*sheets.Request{}
+	for _, row := range sorted {
+		requests = append(requests, &sheets.Request{DeleteDimension: &sheets.DeleteDimensionRequest{
+			Range: &sheets.DimensionRange{
+				SheetId:    sheetID,
+				Dimension:  "ROWS",
+				StartIndex: int64(row.Row - 1),
+				EndIndex:   int64(row.Row),
+				// The first sheet and the first row are 0.
+				ForceSendFields: []string{"SheetId", "StartIndex"},
+			},
+		}})
+	}
+	_, err = srv.Spreadsheets.BatchUpdate(target.SpreadsheetID, &sheets.BatchUpdateSpreadsheetRequest{Requests: requests}).Do()
+	return err
+}
+
+// markColumn returns the column stale rows are marked in, the one after the written columns by default.
+func (t *Target) markColumn() string {
+	if t.MarkColumn != "" {
+		return t.MarkColumn
+	}
+	return columnName(len(t.Columns))
+}
+
+func normalizeID(id string) string {
+	return strings.ToLower(strings.ReplaceAll(id, "-", ""))
+}
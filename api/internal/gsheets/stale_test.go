@@ -0,0 +1,35 @@
+package gsheets
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFindStale(t *testing.T) {
+	target := Target{FirstRow: 3, Columns: Columns{{Value: "{id}"}}}
+	keys := [][]interface{}{
+		{"ID"},
+		{},
+		{"aaaa-1"},
+		{"gone"},
+		{},
+		{"moved"},
+		{"AAAA1"},
+		{"marked"},
+	}
+	marks := [][]interface{}{{"STALE"}, {}, {}, {}, {}, {}, {}, {StaleMark}}
+	live := map[string]bool{"aaaa1": true, "moved": true}
+	exported := map[string]bool{"aaaa1": true}
+
+	want := []StaleRow{
+		{Row: 4, ID: "gone", Reason: StaleDeleted},
+		{Row: 6, ID: "moved", Reason: StaleMoved},
+		{Row: 7, ID: "AAAA1", Reason: StaleDuplicate},
+	}
+	if rows := findStale(&target, keys, marks, live, exported); !reflect.DeepEqual(rows, want) {
+		t.Errorf("expected %+v, got %+v", want, rows)
+	}
+	if column := target.markColumn(); column != "B" {
+		t.Errorf("expected to mark the column after the written ones, got %s", column)
+	}
+}
@@ -0,0 +1,388 @@
+package gsheets
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Corray333/notion-manager/internal/notion"
+	"github.com/spf13/viper"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrTargetNotFound = errors.New("sheets target not found")
+	ErrTargetExists   = errors.New("sheets target with this name already exists")
+)
+
+// Storage keeps the export targets and the Google token.
+type Storage interface {
+	GetSheetsTargets() ([]Target, error)
+	GetSheetsTarget(id int64) (*Target, error)
+	NewSheetsTarget(target *Target) error
+	UpdateSheetsTarget(target *Target) error
+	DeleteSheetsTarget(id int64) error
+	GetGoogleToken() (*oauth2.Token, error)
+	SaveGoogleToken(token *oauth2.Token) error
+	DeleteGoogleToken() error
+}
+
+// Target is a sheet the time rows are exported to. Every time row is a row of the sheet,
+// found by its ID in KeyColumn and updated, or appended.
+type Target struct {
+	ID            int64  `json:"id" db:"id"`
+	Name          string `json:"name" db:"name" mapstructure:"name"`                               // Unique name of the target
+	SpreadsheetID string `json:"spreadsheet_id" db:"spreadsheet_id" mapstructure:"spreadsheet_id"` // ID of the spreadsheet from its URL
+	Sheet         string `json:"sheet" db:"sheet" mapstructure:"sheet"`                            // Name of the sheet, "Sheet1" by default
+	// KeyColumn is the column holding the ID of the time row, one of the written columns. "W" by default.
+	KeyColumn string `json:"key_column" db:"key_column" mapstructure:"key_column"`
+	// LastSyncedCell keeps the last edit time of the exported rows, only rows edited later are exported. "X2" by default.
+	LastSyncedCell string `json:"last_synced_cell" db:"last_synced_cell" mapstructure:"last_synced_cell"`
+	// FirstRow is the first row of data, the rows above it are left for headers. 3 by default.
+	FirstRow int `json:"first_row" db:"first_row" mapstructure:"first_row"`
+	// ProjectID limits the export to the time rows of the internal project with this ID.
+	ProjectID string `json:"project_id" db:"project_id" mapstructure:"project_id"`
+	// Month limits the export to the time rows worked in the month, e.g. "2024-06".
+	Month   string  `json:"month" db:"month" mapstructure:"month"`
+	Columns Columns `json:"columns" db:"columns" mapstructure:"columns"` // Columns from "A" on
+	Enabled bool    `json:"enabled" db:"enabled" mapstructure:"enabled"`
+	// Reconcile is what every export does with the rows of time rows that are gone, see FindStaleRows:
+	// "delete" or "mark". They are left as they are if it is empty.
+	Reconcile string `json:"reconcile" db:"reconcile" mapstructure:"reconcile"`
+	// MarkColumn receives StaleMark in marked rows, the column after the written ones by default.
+	MarkColumn string `json:"mark_column" db:"mark_column" mapstructure:"mark_column"`
+}
+
+// Column is a column of a target. Value is either the name of a property of the time row or a template:
+// a text with {placeholders}, which is a formula if it starts with "=". A property is written as its
+// number, date (DD/MM/YYYY), TRUE/FALSE, names of people or text, formulas as their value.
+//
+// Placeholders are properties by name, {Property.id} and {Property.link} for the ID and the Notion
+// link of the first related page, and the fields {id}, {url}, {last_edited} and {project_id} of the
+// time row. A cell referring to a related page that is not set is left empty.
+type Column struct {
+	Header string `json:"header,omitempty" mapstructure:"header"` // Title of the column, for reference only
+	Value  string `json:"value" mapstructure:"value"`
+}
+
+type Columns []Column
+
+func (c Columns) Value() (driver.Value, error) {
+	if c == nil {
+		c = Columns{}
+	}
+	data, err := json.Marshal(c)
+	return string(data), err
+}
+
+func (c *Columns) Scan(src interface{}) error {
+	columns := Columns{}
+	switch src := src.(type) {
+	case nil:
+	case string:
+		if err := json.Unmarshal([]byte(src), &columns); err != nil {
+			return err
+		}
+	case []byte:
+		if err := json.Unmarshal(src, &columns); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported columns value %T", src)
+	}
+	*c = columns
+	return nil
+}
+
+// DefaultTarget is the time sheet exported before targets were configurable.
+var DefaultTarget = Target{
+	Name:           "default",
+	SpreadsheetID:  "1dStGuMfFU2Vq2V2xgXLyKUq_j3zYBeP15LA0eUQtTAQ",
+	Sheet:          "Sheet1",
+	KeyColumn:      "W",
+	LastSyncedCell: "X2",
+	FirstRow:       3,
+	Enabled:        true,
+	Columns: Columns{
+		{Header: "Что делали", Value: `=HYPERLINK("{url}"; "{Что делали}")`},
+		{Header: "Всего ч", Value: "Всего ч"},
+		{Header: "Дата работ", Value: "Дата работ"},
+		{Header: "Задача", Value: `=HYPERLINK("{Задача.link}"; "{Название задачи}")`},
+		{Header: "Имя проекта", Value: "Имя проекта"},
+		{Header: "Исполнитель", Value: "Исполнитель"},
+		{Header: "К оплате ч.", Value: "К оплате ч."},
+		{Header: "ID задачи", Value: "{Задача.id}"},
+		{Header: "Направление", Value: "Направление"},
+		{Header: "Оценка ч", Value: "Оценка ч"},
+		{Header: "Изменено", Value: "{last_edited}"},
+		{Header: "Оплата", Value: "Оплата"},
+		{Header: "ID проекта", Value: "{project_id}"},
+		{Header: "Месяц", Value: "Месяц"},
+		{Header: "BH", Value: "BH"},
+		{Header: "SH", Value: "SH"},
+		{Header: "DH", Value: "DH"},
+		{Header: "BHGS", Value: "BHGS"},
+		{Header: "Номер месяца", Value: "Номер месяца"},
+		{Header: "Номер недели", Value: "Номер недели"},
+		{Header: "Номер дня", Value: "Номер дня"},
+		{Header: "Статус проекта", Value: "Статус проекта"},
+		{Header: "ID", Value: "{id}"},
+	},
+}
+
+var (
+	columnRe = regexp.MustCompile(`^[A-Z]{1,3}$`)
+	cellRe   = regexp.MustCompile(`^[A-Z]{1,3}[1-9][0-9]*$`)
+)
+
+// Validate fills the defaults and checks the target.
+func (t *Target) Validate() error {
+	if t.Sheet == "" {
+		t.Sheet = "Sheet1"
+	}
+	if t.KeyColumn == "" {
+		t.KeyColumn = DefaultTarget.KeyColumn
+	}
+	if t.LastSyncedCell == "" {
+		t.LastSyncedCell = DefaultTarget.LastSyncedCell
+	}
+	if t.FirstRow == 0 {
+		t.FirstRow = DefaultTarget.FirstRow
+	}
+	t.KeyColumn, t.LastSyncedCell = strings.ToUpper(t.KeyColumn), strings.ToUpper(t.LastSyncedCell)
+	t.MarkColumn = strings.ToUpper(t.MarkColumn)
+
+	switch {
+	case t.Name == "":
+		return errors.New("name is required")
+	case t.SpreadsheetID == "":
+		return errors.New("spreadsheet_id is required")
+	case !columnRe.MatchString(t.KeyColumn):
+		return fmt.Errorf("key_column %q is not a column", t.KeyColumn)
+	case !cellRe.MatchString(t.LastSyncedCell):
+		return fmt.Errorf("last_synced_cell %q is not a cell", t.LastSyncedCell)
+	case t.FirstRow < 1:
+		return errors.New("first_row must be positive")
+	case len(t.Columns) == 0:
+		return errors.New("columns are required")
+	case columnIndex(t.KeyColumn) >= len(t.Columns):
+		return fmt.Errorf("key_column %s is not one of the %d columns", t.KeyColumn, len(t.Columns))
+	case t.Reconcile != "" && t.Reconcile != ReconcileDelete && t.Reconcile != ReconcileMark:
+		return fmt.Errorf("reconcile %q is not delete or mark", t.Reconcile)
+	case t.MarkColumn != "" && !columnRe.MatchString(t.MarkColumn):
+		return fmt.Errorf("mark_column %q is not a column", t.MarkColumn)
+	case t.MarkColumn != "" && columnIndex(t.MarkColumn) < len(t.Columns):
+		return fmt.Errorf("mark_column %s is one of the written columns", t.MarkColumn)
+	}
+	if t.Month != "" {
+		if _, err := time.Parse("2006-01", t.Month); err != nil {
+			return fmt.Errorf("month %q is not YYYY-MM", t.Month)
+		}
+	}
+	for i, c := range t.Columns {
+		if strings.TrimSpace(c.Value) == "" {
+			return fmt.Errorf("column %s has no value", columnName(i))
+		}
+	}
+	return nil
+}
+
+// LoadTargets adds the targets of the config file that are not saved yet, by name. Targets saved
+// before are left as they are, they are managed through the API. If there are no targets at all,
+// neither saved nor configured, DefaultTarget is added.
+func LoadTargets(path string, store Storage) error {
+	targets, err := store.GetSheetsTargets()
+	if err != nil {
+		return err
+	}
+	saved := map[string]bool{}
+	for _, t := range targets {
+		saved[t.Name] = true
+	}
+
+	cfg := struct {
+		Targets []Target `mapstructure:"targets"`
+	}{}
+	if _, err := os.Stat(path); err == nil {
+		v := viper.New()
+		v.SetConfigFile(path)
+		if err := v.ReadInConfig(); err != nil {
+			return err
+		}
+		if err := v.Unmarshal(&cfg); err != nil {
+			return err
+		}
+	}
+	if len(cfg.Targets) == 0 && len(targets) == 0 {
+		slog.Info("no sheets targets configured, using the default target")
+		cfg.Targets = []Target{DefaultTarget}
+	}
+
+	for _, t := range cfg.Targets {
+		if saved[t.Name] {
+			continue
+		}
+		if err := t.Validate(); err != nil {
+			return fmt.Errorf("sheets target %q: %w", t.Name, err)
+		}
+		if err := store.NewSheetsTarget(&t); err != nil {
+			return err
+		}
+		saved[t.Name] = true
+	}
+	return nil
+}
+
+// row returns the cells of the time row in the columns of the target.
+func (t *Target) row(tr *notion.Time) []interface{} {
+	return t.Columns.Row(tr)
+}
+
+// Row returns the cells of the time row in the columns: numbers, texts and formulas.
+func (c Columns) Row(tr *notion.Time) []interface{} {
+	row := make([]interface{}, len(c))
+	for i, column := range c {
+		row[i] = cellValue(column.Value, tr)
+	}
+	return row
+}
+
+// Headers returns the headers of the columns, their values if they have none.
+func (c Columns) Headers() []string {
+	headers := make([]string, len(c))
+	for i, column := range c {
+		headers[i] = column.Header
+		if headers[i] == "" {
+			headers[i] = column.Value
+		}
+	}
+	return headers
+}
+
+// matches reports whether the time row belongs to the month of the target.
+func (t *Target) matches(tr *notion.Time) bool {
+	if t.Month == "" {
+		return true
+	}
+	return strings.HasPrefix(tr.Properties.WorkDate.Date.Start, t.Month)
+}
+
+var placeholderRe = regexp.MustCompile(`\{([^{}]+)\}`)
+
+func cellValue(expr string, tr *notion.Time) interface{} {
+	if !strings.Contains(expr, "{") {
+		return propertyValue(tr.Raw[expr])
+	}
+
+	missing := false
+	value := placeholderRe.ReplaceAllStringFunc(expr, func(m string) string {
+		s, ok := placeholderValue(m[1:len(m)-1], tr)
+		if !ok {
+			missing = true
+		}
+		// Quotes would end the strings of formulas.
+		return strings.ReplaceAll(s, `"`, `""`)
+	})
+	if missing {
+		return ""
+	}
+	return value
+}
+
+// placeholderValue returns the value of a placeholder, false if it refers to a related page that is not set.
+func placeholderValue(name string, tr *notion.Time) (string, bool) {
+	switch name {
+	case "id":
+		return tr.ID, true
+	case "url":
+		return tr.URL, true
+	case "last_edited":
+		edited, _ := time.Parse(notion.TIME_LAYOUT_IN, tr.LastEditedTime)
+		return edited.Format(TimeLayout), true
+	case "project_id":
+		for _, item := range tr.Properties.Project.Rollup.Array {
+			for _, rel := range item.Relation {
+				return rel.ID, true
+			}
+		}
+		return "", true
+	}
+
+	if prop, field, ok := strings.Cut(name, "."); ok && (field == "id" || field == "link") {
+		relation := tr.Raw[prop].Relation
+		if len(relation) == 0 {
+			return "", false
+		}
+		if field == "link" {
+			return "https://www.notion.so/" + strings.ReplaceAll(relation[0].ID, "-", ""), true
+		}
+		return relation[0].ID, true
+	}
+
+	switch v := propertyValue(tr.Raw[name]).(type) {
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case string:
+		return v, true
+	}
+	return "", true
+}
+
+func propertyValue(p notion.Property) interface{} {
+	if n, ok := p.NumberValue(); ok {
+		return n
+	}
+	if b, ok := p.BoolValue(); ok {
+		if b {
+			return "TRUE"
+		}
+		return "FALSE"
+	}
+	if date := p.DateValue(); date != nil {
+		parsed, err := time.Parse(notion.TIME_LAYOUT_IN, date.Start)
+		if err != nil {
+			if parsed, err = time.Parse("2006-01-02", date.Start); err != nil {
+				return date.Start
+			}
+		}
+		return parsed.Format("02/01/2006")
+	}
+	if len(p.People) > 0 {
+		names := make([]string, len(p.People))
+		for i, person := range p.People {
+			names[i] = person.Name
+		}
+		return strings.Join(names, ", ")
+	}
+	return p.Text()
+}
+
+// columnIndex returns the 0-based index of a column, e.g. 0 for "A" and 26 for "AA".
+func columnIndex(column string) int {
+	n := 0
+	for _, c := range column {
+		n = n*26 + int(c-'A'+1)
+	}
+	return n - 1
+}
+
+// columnName returns the column at a 0-based index.
+func columnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// cellRange returns a range of the sheet in A1 notation.
+func (t *Target) cellRange(cells string) string {
+	return "'" + strings.ReplaceAll(t.Sheet, "'", "''") + "'!" + cells
+}
@@ -0,0 +1,93 @@
+package gsheets
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/Corray333/notion-manager/internal/notion"
+)
+
+const timeRow = `{
+	"id": "time-1",
+	"url": "https://www.notion.so/time-1",
+	"last_edited_time": "2024-06-03T10:15:00.000Z",
+	"properties": {
+		"Что делали": {"type": "title", "title": [{"plain_text": "Fixed \"login\""}]},
+		"Всего ч": {"type": "number", "number": 1.5},
+		"Дата работ": {"type": "date", "date": {"start": "2024-06-02"}},
+		"Задача": {"type": "relation", "relation": [{"id": "task-1"}]},
+		"Исполнитель": {"type": "people", "people": [{"id": "u1", "name": "Ann"}, {"id": "u2", "name": "Bob"}]},
+		"Оплата": {"type": "checkbox", "checkbox": false},
+		"Родитель": {"type": "relation", "relation": []}
+	}
+}`
+
+func TestTargetRow(t *testing.T) {
+	var tr notion.Time
+	if err := json.Unmarshal([]byte(timeRow), &tr); err != nil {
+		t.Fatal(err)
+	}
+	target := Target{Columns: Columns{
+		{Value: `=HYPERLINK("{url}"; "{Что делали}")`},
+		{Value: "Всего ч"},
+		{Value: "Дата работ"},
+		{Value: "Исполнитель"},
+		{Value: "Оплата"},
+		{Value: "{Задача.id} ({Всего ч} h)"},
+		{Value: "{Родитель.link}"},
+		{Value: "{last_edited}"},
+	}}
+
+	want := []interface{}{
+		`=HYPERLINK("https://www.notion.so/time-1"; "Fixed ""login""")`,
+		1.5,
+		"02/06/2024",
+		"Ann, Bob",
+		"FALSE",
+		"task-1 (1.5 h)",
+		"",
+		"03/06/2024 10:15:00",
+	}
+	if row := target.row(&tr); !reflect.DeepEqual(row, want) {
+		t.Errorf("expected %#v, got %#v", want, row)
+	}
+
+	target.Month = "2024-06"
+	if !target.matches(&tr) {
+		t.Error("expected the row to match its month")
+	}
+	target.Month = "2024-07"
+	if target.matches(&tr) {
+		t.Error("expected the row not to match another month")
+	}
+}
+
+func TestTargetValidate(t *testing.T) {
+	target := Target{Name: "short", SpreadsheetID: "sheet", Columns: Columns{{Value: "{id}"}}}
+	if err := target.Validate(); err == nil {
+		t.Fatal("expected the default key column W to be out of a single column")
+	}
+	target.KeyColumn = "a"
+	if err := target.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if target.KeyColumn != "A" || target.Sheet != "Sheet1" || target.LastSyncedCell != "X2" || target.FirstRow != 3 {
+		t.Errorf("expected the defaults to be filled, got %+v", target)
+	}
+
+	target.Month = "June"
+	if err := target.Validate(); err == nil {
+		t.Error("expected an invalid month to be rejected")
+	}
+
+	d := DefaultTarget
+	if err := d.Validate(); err != nil {
+		t.Errorf("expected the default target to be valid, got %v", err)
+	}
+	for _, i := range []int{0, 22, 25, 26, 701, 702} {
+		if got := columnIndex(columnName(i)); got != i {
+			t.Errorf("expected column %s to be %d, got %d", columnName(i), i, got)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package invoice
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+
+	"github.com/Corray333/notion-manager/pkg/pdf"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+var ErrUnknownFormat = errors.New("format must be html or pdf")
+
+const (
+	FormatHTML = "html"
+	FormatPDF  = "pdf"
+)
+
+// ContentType returns the MIME type of the format.
+func ContentType(format string) string {
+	if format == FormatPDF {
+		return "application/pdf"
+	}
+	return "text/html; charset=utf-8"
+}
+
+// Render writes the invoice document in the format.
+func Render(w io.Writer, format string, inv *Invoice) error {
+	switch format {
+	case FormatHTML:
+		return invoiceHTML.Execute(w, document{Invoice: inv, Issuer: config.Issuer})
+	case FormatPDF:
+		return renderPDF(w, inv)
+	}
+	return ErrUnknownFormat
+}
+
+type document struct {
+	*Invoice
+	Issuer []string
+}
+
+var invoiceHTML = template.Must(template.New("invoice").Funcs(template.FuncMap{
+	"money": money,
+	"hours": hours,
+}).Parse(`<!DOCTYPE html>
+<html lang="ru">
+<head>
+<meta charset="utf-8">
+<title>Счёт № {{.ID}}</title>
+<style>
+body { font-family: sans-serif; margin: 40px; color: #222; }
+table { border-collapse: collapse; width: 100%; margin-top: 24px; }
+th, td { padding: 6px 8px; border-bottom: 1px solid #ccc; text-align: left; }
+th.num, td.num { text-align: right; }
+tfoot td { font-weight: bold; border-bottom: none; }
+.issuer { color: #555; }
+</style>
+</head>
+<body>
+{{range .Issuer}}<div class="issuer">{{.}}</div>
+{{end}}<h1>Счёт № {{.ID}}</h1>
+<p>Проект: {{.ProjectName}}<br>Период: {{.From}} — {{.To}}{{if .IssuedAt}}<br>Дата: {{.IssuedAt.Format "2006-01-02"}}{{end}}</p>
+<table>
+<thead><tr><th>Сотрудник</th><th>Направление</th><th class="num">Часы</th><th class="num">Ставка</th><th class="num">Сумма</th></tr></thead>
+<tbody>
+{{range .Lines}}<tr><td>{{.Employee}}</td><td>{{.Direction}}</td><td class="num">{{hours .Hours}}</td><td class="num">{{money .Rate}}</td><td class="num">{{money .Amount}}</td></tr>
+{{end}}</tbody>
+<tfoot><tr><td colspan="2">Итого, {{.Currency}}</td><td class="num">{{hours .Hours}}</td><td></td><td class="num">{{money .Total}}</td></tr></tfoot>
+</table>
+</body>
+</html>
+`))
+
+// PDF layout, in points.
+const (
+	margin   = 50.0
+	fontSize = 10.0
+	rowGap   = 18.0
+)
+
+func renderPDF(w io.Writer, inv *Invoice) error {
+	doc := pdf.New()
+	regular, err := doc.AddFont(goregular.TTF)
+	if err != nil {
+		return err
+	}
+	bold, err := doc.AddFont(gobold.TTF)
+	if err != nil {
+		return err
+	}
+
+	// Right edges of the number columns and left edges of the text columns.
+	right := pdf.PageWidth - margin
+	columns := []struct {
+		title string
+		x     float64
+		num   bool
+	}{
+		{"Сотрудник", margin, false},
+		{"Направление", margin + 160, false},
+		{"Часы", right - 180, true},
+		{"Ставка", right - 90, true},
+		{"Сумма", right, true},
+	}
+	cell := func(page *pdf.Page, font *pdf.Font, i int, y float64, text string) {
+		x := columns[i].x
+		if columns[i].num {
+			x -= font.Width(text, fontSize)
+		}
+		page.Text(x, y, font, fontSize, text)
+	}
+
+	page := doc.AddPage()
+	y := pdf.PageHeight - margin
+	for _, line := range config.Issuer {
+		page.Text(margin, y, regular, fontSize, line)
+		y -= 14
+	}
+	y -= 16
+	page.Text(margin, y, bold, 18, fmt.Sprintf("Счёт № %d", inv.ID))
+	y -= 24
+	page.Text(margin, y, regular, fontSize, "Проект: "+inv.ProjectName)
+	y -= 14
+	page.Text(margin, y, regular, fontSize, "Период: "+inv.From+" — "+inv.To)
+	if inv.IssuedAt != nil {
+		y -= 14
+		page.Text(margin, y, regular, fontSize, "Дата: "+inv.IssuedAt.Format("2006-01-02"))
+	}
+
+	header := func() {
+		y -= 30
+		for i, c := range columns {
+			cell(page, bold, i, y, c.title)
+		}
+		page.Line(margin, y-6, right, y-6, 0.5)
+	}
+	header()
+	for _, line := range inv.Lines {
+		y -= rowGap
+		if y < margin+rowGap {
+			page = doc.AddPage()
+			y = pdf.PageHeight - margin
+			header()
+			y -= rowGap
+		}
+		cell(page, regular, 0, y, truncate(regular, line.Employee, 155))
+		cell(page, regular, 1, y, truncate(regular, line.Direction, columns[2].x-columns[1].x-50))
+		cell(page, regular, 2, y, hours(line.Hours))
+		cell(page, regular, 3, y, money(line.Rate))
+		cell(page, regular, 4, y, money(line.Amount))
+	}
+	page.Line(margin, y-8, right, y-8, 0.5)
+	y -= rowGap + 4
+	cell(page, bold, 0, y, "Итого, "+inv.Currency)
+	cell(page, bold, 2, y, hours(inv.Hours))
+	cell(page, bold, 4, y, money(inv.Total))
+
+	return doc.Write(w)
+}
+
+// truncate shortens the text to fit the width.
+func truncate(font *pdf.Font, text string, width float64) string {
+	if font.Width(text, fontSize) <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && font.Width(string(runes)+"…", fontSize) > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
+
+// money formats an amount with spaces between thousands, e.g. "12 345.50".
+func money(v float64) string {
+	s := fmt.Sprintf("%.2f", v)
+	sign := ""
+	if strings.HasPrefix(s, "-") {
+		sign, s = "-", s[1:]
+	}
+	whole, frac, _ := strings.Cut(s, ".")
+	for i := len(whole) - 3; i > 0; i -= 3 {
+		whole = whole[:i] + " " + whole[i:]
+	}
+	return sign + whole + "." + frac
+}
+
+func hours(v float64) string {
+	return strings.TrimSuffix(strings.TrimRight(fmt.Sprintf("%.2f", v), "0"), ".")
+}
@@ -0,0 +1,459 @@
+// Package invoice computes client invoices from the time rows of a project and the hourly rates of its workers.
+package invoice
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Corray333/notion-manager/internal/notion"
+	"github.com/Corray333/notion-manager/internal/project"
+	"github.com/spf13/viper"
+)
+
+var (
+	ErrInvoiceNotFound = errors.New("invoice not found")
+	ErrNoTimes         = errors.New("no time rows to invoice in the period")
+	ErrNotDraft        = errors.New("invoice is already issued")
+	ErrNotIssued       = errors.New("invoice is not issued")
+	ErrTimesBilled     = errors.New("time rows of the invoice are billed by another invoice")
+)
+
+// Statuses of invoices.
+const (
+	StatusDraft  = "draft"  // Computed, can be deleted
+	StatusIssued = "issued" // Sent to the client, its time rows are not invoiced again
+	StatusPaid   = "paid"   // Its time rows are checked as paid in Notion
+)
+
+// Sources of the rates of invoice lines.
+const (
+	RateProject = "project" // Override of the project in the invoicing config
+	RateWorker  = "worker"  // "Ставка в час" of the worker in the client workers database
+	RateDefault = "default" // Default of the invoicing config
+)
+
+type Storage interface {
+	GetProjects() ([]project.Project, error)
+	NewInvoice(invoice *Invoice) error
+	GetInvoice(id int64) (*Invoice, error)
+	GetInvoices(projectID string) ([]Invoice, error)
+	UpdateInvoice(invoice *Invoice) error
+	DeleteInvoice(id int64) error
+}
+
+// Invoice is the bill of a project for the payable hours of a period.
+type Invoice struct {
+	ID          int64      `json:"id" db:"id"`
+	ProjectID   string     `json:"project_id" db:"project_id"`     // ID of client project
+	ProjectName string     `json:"project_name" db:"project_name"` // Name of project
+	From        string     `json:"from" db:"period_from"`          // First work date, YYYY-MM-DD
+	To          string     `json:"to" db:"period_to"`              // Last work date, YYYY-MM-DD
+	Currency    string     `json:"currency" db:"currency"`
+	Lines       Lines      `json:"lines" db:"lines"`
+	Hours       float64    `json:"hours" db:"hours"` // Payable hours of all lines
+	Total       float64    `json:"total" db:"total"`
+	TimeIDs     IDs        `json:"time_ids" db:"time_ids"` // Internal time rows billed
+	Status      string     `json:"status" db:"status"`     // draft, issued or paid
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+	IssuedAt    *time.Time `json:"issued_at" db:"issued_at"`
+	PaidAt      *time.Time `json:"paid_at" db:"paid_at"`
+}
+
+// Line is the payable hours of an employee in a direction.
+type Line struct {
+	Employee   string  `json:"employee"`
+	Direction  string  `json:"direction"`
+	Hours      float64 `json:"hours"`       // Sum of "К оплате ч."
+	Rate       float64 `json:"rate"`        // Hourly rate
+	RateSource string  `json:"rate_source"` // project, worker or default
+	Amount     float64 `json:"amount"`
+	Entries    int     `json:"entries"` // Number of time rows
+}
+
+type Lines []Line
+
+func (l Lines) Value() (driver.Value, error) {
+	return jsonValue(l)
+}
+
+func (l *Lines) Scan(src interface{}) error {
+	*l = Lines{}
+	return jsonScan(src, l)
+}
+
+type IDs []string
+
+func (ids IDs) Value() (driver.Value, error) {
+	return jsonValue(ids)
+}
+
+func (ids *IDs) Scan(src interface{}) error {
+	*ids = IDs{}
+	return jsonScan(src, ids)
+}
+
+func jsonValue(v interface{}) (driver.Value, error) {
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+func jsonScan(src interface{}, v interface{}) error {
+	switch src := src.(type) {
+	case nil:
+		return nil
+	case string:
+		return json.Unmarshal([]byte(src), v)
+	case []byte:
+		return json.Unmarshal(src, v)
+	}
+	return fmt.Errorf("unsupported json value %T", src)
+}
+
+// Rates are hourly rates by employee and by direction. Keys are compared case-insensitively.
+type Rates struct {
+	Currency   string             `mapstructure:"currency"`
+	Rate       float64            `mapstructure:"rate"`       // Rate of everyone else
+	Employees  map[string]float64 `mapstructure:"employees"`  // By employee name
+	Directions map[string]float64 `mapstructure:"directions"` // By direction, after employees
+}
+
+// Config is the invoicing configuration. The rates of a project override the rates of its workers,
+// the default rates are used for workers without a rate.
+type Config struct {
+	Issuer   []string         `mapstructure:"issuer"` // Lines printed at the top of invoices
+	Default  Rates            `mapstructure:"default"`
+	Projects map[string]Rates `mapstructure:"projects"` // By client project ID
+}
+
+var config = Config{Default: Rates{Currency: "RUB"}}
+
+// SetConfig replaces the invoicing configuration used by the package.
+func SetConfig(cfg Config) {
+	if cfg.Default.Currency == "" {
+		cfg.Default.Currency = "RUB"
+	}
+	projects := map[string]Rates{}
+	for id, rates := range cfg.Projects {
+		projects[normalizeID(id)] = rates
+	}
+	cfg.Projects = projects
+	config = cfg
+}
+
+// LoadConfig reads the invoicing configuration from a YAML file.
+// A missing file is not an error: only the rates of the workers are used.
+func LoadConfig(path string) error {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		slog.Info("no invoicing config found, using the rates of the workers")
+		SetConfig(Config{})
+		return nil
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return err
+	}
+	cfg := Config{}
+	if err := v.Unmarshal(&cfg); err != nil {
+		return err
+	}
+	SetConfig(cfg)
+	return nil
+}
+
+// Request selects the time rows of an invoice.
+type Request struct {
+	ProjectID   string `json:"project_id"`   // ID of client project
+	From        string `json:"from"`         // First work date, YYYY-MM-DD
+	To          string `json:"to"`           // Last work date, YYYY-MM-DD
+	IncludePaid bool   `json:"include_paid"` // Bill the time rows checked as paid too
+}
+
+// Validate checks the dates of the request.
+func (r *Request) Validate() error {
+	if r.ProjectID == "" {
+		return errors.New("project_id is required")
+	}
+	from, err := time.Parse("2006-01-02", r.From)
+	if err != nil {
+		return errors.New("from must be YYYY-MM-DD")
+	}
+	to, err := time.Parse("2006-01-02", r.To)
+	if err != nil {
+		return errors.New("to must be YYYY-MM-DD")
+	}
+	if to.Before(from) {
+		return errors.New("to is before from")
+	}
+	return nil
+}
+
+// Create computes the invoice of the request and saves it as a draft. Time rows of issued
+// invoices of the project are left out, so are paid ones unless the request includes them.
+//
+// Payable hours are grouped by employee and direction. A time row with several employees is
+// billed to the first one. Employees are told apart by their Notion users, not by their names.
+func Create(ctx context.Context, store Storage, req Request) (*Invoice, error) {
+	if err := req.Validate(); err != nil {
+		return nil, err
+	}
+	projects, err := store.GetProjects()
+	if err != nil {
+		return nil, err
+	}
+	var proj *project.Project
+	for i := range projects {
+		if normalizeID(projects[i].ProjectID) == normalizeID(req.ProjectID) {
+			proj = &projects[i]
+		}
+	}
+	if proj == nil {
+		return nil, notion.ErrProjectNotFound
+	}
+
+	billed, err := billedTimes(store, proj.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	times, err := notion.FindTimes(ctx, notion.TimeFilter{ProjectID: proj.InternalID, From: req.From, To: req.To}, "")
+	if err != nil {
+		return nil, err
+	}
+
+	rates := rater{ctx: ctx, project: proj, workers: map[string]workerRate{}}
+	inv := &Invoice{
+		ProjectID:   proj.ProjectID,
+		ProjectName: proj.Name,
+		From:        req.From,
+		To:          req.To,
+		Currency:    currency(proj),
+		Lines:       Lines{},
+		TimeIDs:     IDs{},
+		Status:      StatusDraft,
+		CreatedAt:   time.Now(),
+	}
+	lines := map[[2]string]*Line{}
+	order := []*Line{}
+	for _, tr := range times {
+		if billed[normalizeID(tr.ID)] || tr.Properties.Payment.Checkbox && !req.IncludePaid {
+			continue
+		}
+		person := notion.Person{}
+		if people := tr.Raw["Исполнитель"].People; len(people) > 0 {
+			person = people[0]
+		}
+		direction := tr.Properties.Direction.Select.Name
+
+		employee := person.ID
+		if employee == "" {
+			employee = person.Name
+		}
+		key := [2]string{employee, direction}
+		line, ok := lines[key]
+		if !ok {
+			rate, source, err := rates.rate(person, direction)
+			if err != nil {
+				return nil, err
+			}
+			line = &Line{Employee: person.Name, Direction: direction, Rate: rate, RateSource: source}
+			lines[key] = line
+			order = append(order, line)
+		}
+		line.Hours += tr.Properties.PayableHours.Formula.Number
+		line.Entries++
+		inv.TimeIDs = append(inv.TimeIDs, tr.ID)
+	}
+	if len(inv.TimeIDs) == 0 {
+		return nil, ErrNoTimes
+	}
+
+	for _, line := range order {
+		line.Hours = round(line.Hours)
+		line.Amount = round(line.Hours * line.Rate)
+		inv.Hours += line.Hours
+		inv.Total += line.Amount
+		inv.Lines = append(inv.Lines, *line)
+	}
+	inv.Hours, inv.Total = round(inv.Hours), round(inv.Total)
+	sort.SliceStable(inv.Lines, func(i, j int) bool {
+		if inv.Lines[i].Employee != inv.Lines[j].Employee {
+			return inv.Lines[i].Employee < inv.Lines[j].Employee
+		}
+		return inv.Lines[i].Direction < inv.Lines[j].Direction
+	})
+
+	if err := store.NewInvoice(inv); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// billedTimes returns the time rows of the issued and paid invoices of the project.
+func billedTimes(store Storage, projectID string) (map[string]bool, error) {
+	invoices, err := store.GetInvoices(projectID)
+	if err != nil {
+		return nil, err
+	}
+	billed := map[string]bool{}
+	for _, inv := range invoices {
+		if inv.Status == StatusDraft {
+			continue
+		}
+		for _, id := range inv.TimeIDs {
+			billed[normalizeID(id)] = true
+		}
+	}
+	return billed, nil
+}
+
+// Issue marks the draft as issued, its time rows won't be invoiced again.
+// ErrTimesBilled is returned if another draft with some of its time rows was issued first.
+func Issue(store Storage, id int64) (*Invoice, error) {
+	inv, err := store.GetInvoice(id)
+	if err != nil {
+		return nil, err
+	}
+	if inv.Status != StatusDraft {
+		return nil, ErrNotDraft
+	}
+	billed, err := billedTimes(store, inv.ProjectID)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range inv.TimeIDs {
+		if billed[normalizeID(id)] {
+			return nil, fmt.Errorf("%w: %s", ErrTimesBilled, id)
+		}
+	}
+	now := time.Now()
+	inv.Status, inv.IssuedAt = StatusIssued, &now
+	return inv, store.UpdateInvoice(inv)
+}
+
+// Delete deletes the draft.
+func Delete(store Storage, id int64) error {
+	inv, err := store.GetInvoice(id)
+	if err != nil {
+		return err
+	}
+	if inv.Status != StatusDraft {
+		return ErrNotDraft
+	}
+	return store.DeleteInvoice(id)
+}
+
+// MarkPaid checks "Оплата" of the time rows of the issued invoice. The invoice stays issued if
+// a time row can't be updated, so that it can be marked again.
+func MarkPaid(ctx context.Context, store Storage, id int64) (*Invoice, error) {
+	inv, err := store.GetInvoice(id)
+	if err != nil {
+		return nil, err
+	}
+	if inv.Status == StatusDraft {
+		return nil, ErrNotIssued
+	}
+
+	errs := []error{}
+	for _, timeID := range inv.TimeIDs {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if err := notion.SetTimePaid(ctx, timeID); err != nil {
+			errs = append(errs, fmt.Errorf("time %s: %w", timeID, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+
+	if inv.Status != StatusPaid {
+		now := time.Now()
+		inv.Status, inv.PaidAt = StatusPaid, &now
+		if err := store.UpdateInvoice(inv); err != nil {
+			return nil, err
+		}
+	}
+	return inv, nil
+}
+
+type workerRate struct {
+	rate  float64
+	found bool
+}
+
+// rater finds the rates of the employees of a project, looking each worker up once.
+type rater struct {
+	ctx     context.Context
+	project *project.Project
+	workers map[string]workerRate
+}
+
+func (r *rater) rate(person notion.Person, direction string) (float64, string, error) {
+	if rates, ok := config.Projects[normalizeID(r.project.ProjectID)]; ok {
+		if rate, ok := rates.find(person.Name, direction); ok {
+			return rate, RateProject, nil
+		}
+		if rates.Rate > 0 {
+			return rates.Rate, RateProject, nil
+		}
+	}
+
+	if person.ID != "" && r.project.WorkersDBID != "" {
+		w, ok := r.workers[person.ID]
+		if !ok {
+			var err error
+			if w.rate, w.found, err = notion.WorkerRate(r.ctx, r.project.WorkersDBID, person.ID); err != nil {
+				return 0, "", err
+			}
+			r.workers[person.ID] = w
+		}
+		if w.found && w.rate > 0 {
+			return w.rate, RateWorker, nil
+		}
+	}
+
+	if rate, ok := config.Default.find(person.Name, direction); ok {
+		return rate, RateDefault, nil
+	}
+	return config.Default.Rate, RateDefault, nil
+}
+
+// find returns the rate of the employee or else of the direction.
+func (r Rates) find(employee, direction string) (float64, bool) {
+	for name, rate := range r.Employees {
+		if employee != "" && strings.EqualFold(name, employee) {
+			return rate, true
+		}
+	}
+	for name, rate := range r.Directions {
+		if direction != "" && strings.EqualFold(name, direction) {
+			return rate, true
+		}
+	}
+	return 0, false
+}
+
+func currency(proj *project.Project) string {
+	if rates, ok := config.Projects[normalizeID(proj.ProjectID)]; ok && rates.Currency != "" {
+		return rates.Currency
+	}
+	return config.Default.Currency
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func normalizeID(id string) string {
+	return strings.ToLower(strings.ReplaceAll(id, "-", ""))
+}
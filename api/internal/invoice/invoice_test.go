@@ -0,0 +1,167 @@
+package invoice_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Corray333/notion-manager/internal/invoice"
+	"github.com/Corray333/notion-manager/internal/notion"
+	"github.com/Corray333/notion-manager/internal/project"
+	"github.com/Corray333/notion-manager/internal/storage/storagetest"
+	notionclient "github.com/Corray333/notion-manager/pkg/notion"
+	"github.com/Corray333/notion-manager/pkg/notion/notiontest"
+)
+
+const (
+	timesDB         = "times-db"
+	workersDB       = "workers-db"
+	clientProject   = "client-project"
+	internalProject = "internal-project"
+)
+
+func people(id, name string) map[string]interface{} {
+	return map[string]interface{}{"people": []map[string]interface{}{{"object": "user", "id": id, "name": name}}}
+}
+
+func addTime(fake *notiontest.Server, proj, date, employee, direction string, hours float64, paid bool) string {
+	return fake.AddPage(timesDB, map[string]interface{}{
+		"Что делали":  map[string]interface{}{"title": []map[string]interface{}{{"type": "text", "text": map[string]interface{}{"content": "work"}, "plain_text": "work"}}},
+		"К оплате ч.": map[string]interface{}{"formula": map[string]interface{}{"type": "number", "number": hours}},
+		"Дата работ":  map[string]interface{}{"date": map[string]interface{}{"start": date}},
+		"Исполнитель": people(strings.ToLower(employee), employee),
+		"Направление": map[string]interface{}{"select": map[string]interface{}{"name": direction}},
+		"Оплата":      map[string]interface{}{"checkbox": paid},
+		"Проект": map[string]interface{}{"rollup": map[string]interface{}{
+			"type":  "array",
+			"array": []map[string]interface{}{{"type": "relation", "relation": []map[string]interface{}{{"id": proj}}}},
+		}},
+	})
+}
+
+func TestInvoice(t *testing.T) {
+	fake := notiontest.NewServer()
+	t.Cleanup(fake.Close)
+	notion.SetClient(notionclient.NewClient("secret",
+		notionclient.WithBaseURL(fake.URL()),
+		notionclient.WithRateLimit(1000, 1000),
+		notionclient.WithRetries(3, time.Millisecond, 10*time.Millisecond),
+	))
+	t.Setenv("TIMES_DB", timesDB)
+	fake.AddDatabase(timesDB, "Время", map[string]string{
+		"Что делали":  "title",
+		"К оплате ч.": "formula",
+		"Дата работ":  "date",
+		"Исполнитель": "people",
+		"Направление": "select",
+		"Оплата":      "checkbox",
+		"Проект":      "rollup",
+	})
+	fake.AddDatabase(workersDB, "Сотрудники", map[string]string{
+		"Имя":          "title",
+		"Ссылка":       "people",
+		"Ставка в час": "number",
+	})
+	fake.AddPage(workersDB, map[string]interface{}{
+		"Ссылка":       people("ann", "Ann"),
+		"Ставка в час": map[string]interface{}{"number": 2000},
+	})
+	fake.AddPage(workersDB, map[string]interface{}{
+		"Ссылка":       people("ann-2", "Ann"),
+		"Ставка в час": map[string]interface{}{"number": 37.5},
+	})
+
+	invoice.SetConfig(invoice.Config{
+		Default:  invoice.Rates{Rate: 1000},
+		Projects: map[string]invoice.Rates{clientProject: {Employees: map[string]float64{"bob": 3000}}},
+	})
+	t.Cleanup(func() { invoice.SetConfig(invoice.Config{}) })
+
+	store := storagetest.New(t)
+	if err := store.NewProject(&project.Project{Name: "Client", ProjectID: clientProject, InternalID: internalProject, WorkersDBID: workersDB}); err != nil {
+		t.Fatal(err)
+	}
+
+	billed := []string{
+		addTime(fake, internalProject, "2024-06-03", "Ann", "Разработка", 2, false),
+		addTime(fake, internalProject, "2024-06-04", "Ann", "Разработка", 1.5, false),
+		addTime(fake, internalProject, "2024-06-05", "Ann", "Дизайн", 1, false),
+		addTime(fake, internalProject, "2024-06-06", "Bob", "Разработка", 4, false),
+		addTime(fake, internalProject, "2024-06-07", "Carl", "Тесты", 0.5, false),
+	}
+	// Another employee with the same name.
+	namesake := addTime(fake, internalProject, "2024-06-08", "Ann", "Дизайн", 1, false)
+	fake.SetPage(namesake, map[string]interface{}{"Исполнитель": people("ann-2", "Ann")})
+	billed = append(billed, namesake)
+	addTime(fake, internalProject, "2024-06-10", "Carl", "Тесты", 3, true)
+	addTime(fake, internalProject, "2024-07-01", "Ann", "Разработка", 5, false)
+	addTime(fake, "other-project", "2024-06-03", "Ann", "Разработка", 7, false)
+
+	ctx := context.Background()
+	req := invoice.Request{ProjectID: clientProject, From: "2024-06-01", To: "2024-06-30"}
+	inv, err := invoice.Create(ctx, store, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := invoice.Lines{
+		{Employee: "Ann", Direction: "Дизайн", Hours: 1, Rate: 2000, RateSource: invoice.RateWorker, Amount: 2000, Entries: 1},
+		{Employee: "Ann", Direction: "Дизайн", Hours: 1, Rate: 37.5, RateSource: invoice.RateWorker, Amount: 37.5, Entries: 1},
+		{Employee: "Ann", Direction: "Разработка", Hours: 3.5, Rate: 2000, RateSource: invoice.RateWorker, Amount: 7000, Entries: 2},
+		{Employee: "Bob", Direction: "Разработка", Hours: 4, Rate: 3000, RateSource: invoice.RateProject, Amount: 12000, Entries: 1},
+		{Employee: "Carl", Direction: "Тесты", Hours: 0.5, Rate: 1000, RateSource: invoice.RateDefault, Amount: 500, Entries: 1},
+	}
+	if len(inv.Lines) != len(want) {
+		t.Fatalf("expected %d lines, got %+v", len(want), inv.Lines)
+	}
+	for i := range want {
+		if inv.Lines[i] != want[i] {
+			t.Errorf("line %d: expected %+v, got %+v", i, want[i], inv.Lines[i])
+		}
+	}
+	if inv.Hours != 10 || inv.Total != 21537.5 || inv.Currency != "RUB" || len(inv.TimeIDs) != len(billed) {
+		t.Errorf("unexpected totals: %v hours, %v %s, %d time rows", inv.Hours, inv.Total, inv.Currency, len(inv.TimeIDs))
+	}
+
+	if _, err := invoice.MarkPaid(ctx, store, inv.ID); !errors.Is(err, invoice.ErrNotIssued) {
+		t.Errorf("expected %v for a draft, got %v", invoice.ErrNotIssued, err)
+	}
+	duplicate, err := invoice.Create(ctx, store, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := invoice.Issue(store, inv.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := invoice.Issue(store, duplicate.ID); !errors.Is(err, invoice.ErrTimesBilled) {
+		t.Errorf("expected %v for a draft of billed time rows, got %v", invoice.ErrTimesBilled, err)
+	}
+	if _, err := invoice.Create(ctx, store, req); !errors.Is(err, invoice.ErrNoTimes) {
+		t.Errorf("expected the issued time rows to be left out, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := invoice.Render(&buf, invoice.FormatHTML, inv); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "21 537.50") {
+		t.Errorf("expected the total in the document, got %s", buf.String())
+	}
+
+	inv, err = invoice.MarkPaid(ctx, store, inv.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inv.Status != invoice.StatusPaid || inv.PaidAt == nil {
+		t.Errorf("expected the invoice to be paid, got %s", inv.Status)
+	}
+	for _, id := range billed {
+		page, _ := fake.Page(id)
+		prop, _ := page.Properties["Оплата"].(map[string]interface{})
+		if paid, _ := prop["checkbox"].(bool); !paid {
+			t.Errorf("expected time %s to be paid, got %v", id, page.Properties["Оплата"])
+		}
+	}
+}
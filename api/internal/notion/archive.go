@@ -0,0 +1,247 @@
+package notion
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Corray333/notion-manager/internal/project"
+	"github.com/Corray333/notion-manager/pkg/notion"
+)
+
+const (
+	ReasonArchived = "archived" // the internal page is archived or in trash
+	ReasonDeleted  = "deleted"  // the internal page doesn't exist anymore
+)
+
+// archiveGracePeriod is how long an internal page must stay archived before its client copy is removed.
+var archiveGracePeriod = 24 * time.Hour
+
+// SetArchiveGracePeriod sets how long an internal page must stay archived before its client copy is removed.
+func SetArchiveGracePeriod(d time.Duration) {
+	archiveGracePeriod = d
+}
+
+// ArchivedPage is an internal page that was archived or deleted after it was copied to a client dashboard.
+type ArchivedPage struct {
+	InternalID string     `json:"internal_id" db:"internal_id"` // ID of page in internal dashboard
+	ClientID   string     `json:"client_id" db:"client_id"`     // ID of page in client dashboard
+	ProjectID  string     `json:"project_id" db:"project_id"`   // ID of project
+	Type       string     `json:"type" db:"type"`               // Type of database
+	Title      string     `json:"title" db:"title"`             // Title of the internal page, empty if it is deleted
+	Reason     string     `json:"reason" db:"reason"`           // ReasonArchived or ReasonDeleted
+	DetectedAt time.Time  `json:"detected_at" db:"detected_at"` // When the sync noticed the page is gone
+	RemovedAt  *time.Time `json:"removed_at" db:"removed_at"`   // When the client copy was archived, nil during the grace period
+}
+
+// ArchiveReport is the result of RemoveArchived.
+type ArchiveReport struct {
+	Detected []ArchivedPage `json:"detected"` // pages found archived by this run
+	Removed  []ArchivedPage `json:"removed"`  // pages whose client copies were archived by this run
+	Restored []string       `json:"restored"` // internal IDs of pages restored during the grace period
+}
+
+// RemoveArchived finds copied pages that were archived or deleted in the internal databases
+// and, once the grace period is over, archives their client copies and forgets them.
+//
+// A page is considered gone when it is missing from a full scan of the internal databases
+// and Notion reports it archived, in trash or not found. Client copies of paused projects
+// are kept until the project is resumed.
+func RemoveArchived(ctx context.Context, store Storage) (*ArchiveReport, error) {
+	report := &ArchiveReport{}
+
+	ids, err := store.GetClientIDs()
+	if err != nil {
+		return nil, err
+	}
+	projects, err := store.GetProjects()
+	if err != nil {
+		return nil, err
+	}
+	paused := map[string]bool{}
+	for _, project := range projects {
+		paused[project.ProjectID] = project.Paused
+	}
+	live := map[string]bool{}
+	for _, dbid := range []string{os.Getenv("TASKS_DB"), os.Getenv("TIMES_DB")} {
+		pages, err := getPageIDs(ctx, dbid, "")
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range pages {
+			live[normalizeID(id)] = true
+		}
+	}
+
+	archived, err := store.GetArchivedPages()
+	if err != nil {
+		return nil, err
+	}
+	pending := map[string]ArchivedPage{}
+	for _, page := range archived {
+		if page.RemovedAt != nil {
+			continue
+		}
+		if live[normalizeID(page.InternalID)] {
+			if err := store.RemoveArchivedPage(page.InternalID); err != nil {
+				return report, err
+			}
+			report.Restored = append(report.Restored, page.InternalID)
+			continue
+		}
+		pending[page.InternalID] = page
+	}
+
+	for internalID, clientID := range ids {
+		if live[normalizeID(internalID)] {
+			continue
+		}
+
+		page, ok := pending[internalID]
+		if !ok {
+			detected, err := detectArchived(ctx, store, projects, internalID, clientID)
+			if err != nil {
+				return report, err
+			}
+			if detected == nil {
+				continue
+			}
+			page = *detected
+			report.Detected = append(report.Detected, page)
+		}
+
+		if paused[page.ProjectID] || time.Since(page.DetectedAt) < archiveGracePeriod {
+			continue
+		}
+		if _, err := client.ArchivePage(ctx, clientID); err != nil && !isNotFound(err) {
+			return report, err
+		}
+		if err := store.RemoveClientID(internalID); err != nil {
+			return report, err
+		}
+		if err := store.RemoveRowToBeUpdated(internalID); err != nil {
+			return report, err
+		}
+		if err := store.SetArchivedPageRemoved(internalID); err != nil {
+			return report, err
+		}
+		report.Removed = append(report.Removed, page)
+	}
+
+	return report, nil
+}
+
+// detectArchived saves the copied page as archived if Notion reports it archived, in trash or not found,
+// which starts its grace period. The projects tell which one the copy belongs to. It returns nil if the page is alive.
+func detectArchived(ctx context.Context, store Storage, projects []project.Project, internalID, clientID string) (*ArchivedPage, error) {
+	reason, title, err := archivedReason(ctx, internalID)
+	if err != nil || reason == "" {
+		return nil, err
+	}
+	page := ArchivedPage{
+		InternalID: internalID,
+		ClientID:   clientID,
+		Title:      title,
+		Reason:     reason,
+		DetectedAt: time.Now(),
+	}
+	page.ProjectID, page.Type = clientPageOwner(ctx, clientID, projects)
+	if err := store.SaveArchivedPage(page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// archivedReason returns why the internal page is gone and its title. The reason is empty if the page is alive.
+func archivedReason(ctx context.Context, id string) (string, string, error) {
+	resp, err := client.GetPage(ctx, id)
+	if isNotFound(err) {
+		return ReasonDeleted, "", nil
+	}
+	if err != nil {
+		return "", "", err
+	}
+	page := struct {
+		pageState
+		Archived bool `json:"archived"`
+		InTrash  bool `json:"in_trash"`
+	}{}
+	if err := json.Unmarshal(resp, &page); err != nil {
+		return "", "", err
+	}
+	if page.Archived || page.InTrash {
+		return ReasonArchived, page.title(), nil
+	}
+	// Moved to another database, it is not ours to remove.
+	return "", "", nil
+}
+
+// clientPageOwner returns the project and the type of a client page by its parent database.
+func clientPageOwner(ctx context.Context, clientID string, projects []project.Project) (string, string) {
+	resp, err := client.GetPage(ctx, clientID)
+	if err != nil {
+		return "", ""
+	}
+	page := struct {
+		Parent struct {
+			DatabaseID string `json:"database_id"`
+		} `json:"parent"`
+	}{}
+	if err := json.Unmarshal(resp, &page); err != nil {
+		return "", ""
+	}
+	parent := normalizeID(page.Parent.DatabaseID)
+	for _, p := range projects {
+		switch parent {
+		case normalizeID(p.TasksDBID):
+			return p.ProjectID, string(TaskTable)
+		case normalizeID(p.TimeDBID):
+			return p.ProjectID, string(TimeTable)
+		}
+	}
+	return "", ""
+}
+
+// getPageIDs returns IDs of all pages of a database.
+func getPageIDs(ctx context.Context, dbid string, cursor string) ([]string, error) {
+	req := map[string]interface{}{}
+	if cursor != "" {
+		req["start_cursor"] = cursor
+	}
+	resp, err := client.SearchPages(ctx, dbid, req)
+	if err != nil {
+		return nil, err
+	}
+	pages := pageStateList{}
+	if err := json.Unmarshal(resp, &pages); err != nil {
+		return nil, err
+	}
+
+	ids := []string{}
+	for _, page := range pages.Results {
+		ids = append(ids, page.ID)
+	}
+	if pages.HasMore {
+		more, err := getPageIDs(ctx, dbid, pages.NextCursor)
+		if err != nil {
+			return nil, err
+		}
+		return append(ids, more...), nil
+	}
+	return ids, nil
+}
+
+// isGone reports whether the error means the page doesn't exist or is archived.
+func isGone(err error) bool {
+	var apiErr *notion.APIError
+	return isNotFound(err) || errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusBadRequest && strings.Contains(apiErr.Message, "archived")
+}
+
+func isNotFound(err error) bool {
+	var apiErr *notion.APIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
@@ -0,0 +1,111 @@
+package notion_test
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/Corray333/notion-manager/internal/notion"
+)
+
+func TestSyncRemovesArchivedPages(t *testing.T) {
+	e := newEnv(t)
+	notion.SetArchiveGracePeriod(0)
+	t.Cleanup(func() { notion.SetArchiveGracePeriod(24 * time.Hour) })
+
+	archived := e.addTask("Archived", internalProject, "")
+	deleted := e.addTask("Deleted", internalProject, "")
+	kept := e.addTask("Kept", internalProject, "")
+	e.sync(t)
+	clientArchived, clientDeleted := e.clientID(t, archived), e.clientID(t, deleted)
+
+	e.fake.Archive(archived)
+	e.fake.Delete(deleted)
+	e.sync(t)
+
+	for _, id := range []string{clientArchived, clientDeleted} {
+		if page, _ := e.fake.Page(id); !page.Archived {
+			t.Errorf("client copy %s is not archived", id)
+		}
+	}
+	for _, id := range []string{archived, deleted} {
+		if _, err := e.store.GetClientID(id); err != sql.ErrNoRows {
+			t.Errorf("ids row of %s is not removed: %v", id, err)
+		}
+	}
+	if page, _ := e.fake.Page(e.clientID(t, kept)); page.Archived {
+		t.Error("client copy of a live page is archived")
+	}
+
+	pages, err := e.store.GetArchivedPages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reasons := map[string]string{}
+	for _, page := range pages {
+		if page.RemovedAt == nil || page.ProjectID != e.clientProject || page.Type != "task" {
+			t.Errorf("unexpected report entry %+v", page)
+		}
+		reasons[page.InternalID] = page.Reason
+	}
+	if reasons[archived] != notion.ReasonArchived || reasons[deleted] != notion.ReasonDeleted {
+		t.Errorf("unexpected reasons %v", reasons)
+	}
+}
+
+func TestArchivedPagesWaitForGracePeriod(t *testing.T) {
+	e := newEnv(t)
+	task := e.addTask("Task", internalProject, "")
+	e.sync(t)
+	clientTask := e.clientID(t, task)
+
+	e.fake.Archive(task)
+	report, err := notion.RemoveArchived(context.Background(), e.store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Detected) != 1 || len(report.Removed) != 0 {
+		t.Fatalf("expected the page to be detected but kept, got %+v", report)
+	}
+	if page, _ := e.fake.Page(clientTask); page.Archived {
+		t.Error("client copy archived during the grace period")
+	}
+
+	// Restoring the page cancels the removal.
+	e.fake.Restore(task)
+	report, err = notion.RemoveArchived(context.Background(), e.store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Restored) != 1 {
+		t.Errorf("expected the page to be restored, got %+v", report)
+	}
+	if pages, _ := e.store.GetArchivedPages(); len(pages) != 0 {
+		t.Errorf("expected no archived pages, got %+v", pages)
+	}
+}
+
+func TestArchivedPagesOfPausedProjectsAreKept(t *testing.T) {
+	e := newEnv(t)
+	notion.SetArchiveGracePeriod(0)
+	t.Cleanup(func() { notion.SetArchiveGracePeriod(24 * time.Hour) })
+
+	task := e.addTask("Task", internalProject, "")
+	e.sync(t)
+	clientTask := e.clientID(t, task)
+	e.pause(t)
+
+	e.fake.Archive(task)
+	report, err := notion.RemoveArchived(context.Background(), e.store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Detected) != 1 || len(report.Removed) != 0 {
+		t.Fatalf("expected the page to be detected but kept, got %+v", report)
+	}
+	if page, _ := e.fake.Page(clientTask); page.Archived {
+		t.Error("client copy of a paused project was archived")
+	}
+	e.clientID(t, task)
+}
@@ -0,0 +1,196 @@
+package notion
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Corray333/notion-manager/internal/project"
+)
+
+// CommentLink pairs a comment with its copy on the other side.
+type CommentLink struct {
+	PageID     string    `json:"page_id" db:"page_id"`         // ID of the internal task
+	InternalID string    `json:"internal_id" db:"internal_id"` // ID of comment on the internal page
+	ClientID   string    `json:"client_id" db:"client_id"`     // ID of comment on the client page
+	CreatedAt  time.Time `json:"created_at" db:"created_at"`   // When the comment was copied
+}
+
+// Comment is a comment on a page.
+type Comment struct {
+	ID        string `json:"id"`
+	CreatedBy struct {
+		ID string `json:"id"`
+	} `json:"created_by"`
+	RichText []RichText `json:"rich_text"`
+}
+
+type commentList struct {
+	Results    []Comment `json:"results"`
+	HasMore    bool      `json:"has_more"`
+	NextCursor string    `json:"next_cursor"`
+}
+
+// syncComments copies new comments of the tasks of the project to the other copy of the task,
+// in both directions. Copies are written by the integration, so the text is prefixed with the
+// name of the author. Copied comments are saved in the comments table and never copied back.
+//
+// Only the tasks synced by the run and the client tasks edited after since are checked, listing
+// the comments of every task would take the rate limit of the sync. Adding a comment doesn't edit
+// the page, so a comment on a task nobody edits waits until either copy is edited.
+func syncComments(ctx context.Context, store Storage, project *project.Project, since int64, synced []Task) error {
+	if !MappingFor(project).Comments {
+		return nil
+	}
+
+	pages := map[string]string{} // client IDs by internal IDs
+	for _, task := range synced {
+		clientID, err := store.GetClientID(task.ID)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		pages[task.ID] = clientID
+	}
+	edited, err := getEditedPages(ctx, project.TasksDBID, since, "")
+	if err != nil {
+		return err
+	}
+	for _, page := range edited {
+		internalID, err := store.GetInternalID(page.ID)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		pages[internalID] = page.ID
+	}
+
+	names := map[string]string{}
+	for internalID, clientID := range pages {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := syncPageComments(ctx, store, names, internalID, clientID); err != nil {
+			store.SaveError(Error{
+				err:        fmt.Errorf("error while syncing comments: %w", err),
+				table_type: TaskTable,
+				project:    *project,
+				id:         internalID,
+				severity:   SeverityWarning,
+			})
+		}
+	}
+	return nil
+}
+
+// syncPageComments copies the comments of one task. names caches user names by ID.
+func syncPageComments(ctx context.Context, store Storage, names map[string]string, internalID, clientID string) error {
+	links, err := store.GetCommentLinks(internalID)
+	if err != nil {
+		return err
+	}
+	synced := map[string]bool{}
+	for _, link := range links {
+		synced[link.InternalID] = true
+		synced[link.ClientID] = true
+	}
+
+	internalComments, err := getComments(ctx, internalID, "")
+	if err != nil {
+		return err
+	}
+	clientComments, err := getComments(ctx, clientID, "")
+	if err != nil {
+		return err
+	}
+
+	for _, comment := range internalComments {
+		if synced[comment.ID] {
+			continue
+		}
+		copyID, err := copyComment(ctx, names, comment, clientID)
+		if err != nil {
+			return err
+		}
+		if err := store.SaveCommentLink(CommentLink{PageID: internalID, InternalID: comment.ID, ClientID: copyID, CreatedAt: time.Now()}); err != nil {
+			return err
+		}
+	}
+	for _, comment := range clientComments {
+		if synced[comment.ID] {
+			continue
+		}
+		copyID, err := copyComment(ctx, names, comment, internalID)
+		if err != nil {
+			return err
+		}
+		if err := store.SaveCommentLink(CommentLink{PageID: internalID, InternalID: copyID, ClientID: comment.ID, CreatedAt: time.Now()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyComment writes the comment with its author to the page and returns the ID of the copy.
+func copyComment(ctx context.Context, names map[string]string, comment Comment, pageID string) (string, error) {
+	author, ok := names[comment.CreatedBy.ID]
+	if !ok {
+		author = getUserName(ctx, comment.CreatedBy.ID)
+		names[comment.CreatedBy.ID] = author
+	}
+	text := author + ": " + strings.TrimSpace(joinText(comment.RichText))
+
+	resp, err := client.CreateComment(ctx, pageID, []map[string]interface{}{
+		{"type": "text", "text": map[string]interface{}{"content": text}},
+	})
+	if err != nil {
+		return "", err
+	}
+	created := Comment{}
+	if err := json.Unmarshal(resp, &created); err != nil {
+		return "", err
+	}
+	return created.ID, nil
+}
+
+// getUserName returns the name of the user, "Unknown" if it can't be read, e.g. for guests.
+func getUserName(ctx context.Context, userID string) string {
+	resp, err := client.GetUser(ctx, userID)
+	if err != nil {
+		return "Unknown"
+	}
+	user := struct {
+		Name string `json:"name"`
+	}{}
+	if err := json.Unmarshal(resp, &user); err != nil || user.Name == "" {
+		return "Unknown"
+	}
+	return user.Name
+}
+
+func getComments(ctx context.Context, pageID string, cursor string) ([]Comment, error) {
+	resp, err := client.GetComments(ctx, pageID, cursor)
+	if err != nil {
+		return nil, err
+	}
+	comments := commentList{}
+	if err := json.Unmarshal(resp, &comments); err != nil {
+		return nil, err
+	}
+
+	if comments.HasMore {
+		more, err := getComments(ctx, pageID, comments.NextCursor)
+		if err != nil {
+			return nil, err
+		}
+		return append(comments.Results, more...), nil
+	}
+	return comments.Results, nil
+}
@@ -0,0 +1,45 @@
+package notion_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Corray333/notion-manager/internal/notion"
+)
+
+func TestSyncComments(t *testing.T) {
+	e := newEnv(t)
+	notion.SetMappings(notion.MappingConfig{Projects: map[string]notion.ProjectMapping{e.clientProject: {Comments: ptr(true)}}})
+	t.Cleanup(func() { notion.SetMappings(notion.MappingConfig{}) })
+	e.fake.AddUser(workerUser, "Mark")
+	e.fake.AddUser("client", "Olga")
+
+	task := e.addTask("Discussed", internalProject, "")
+	e.fake.AddComment(task, workerUser, "Done, please check")
+	e.sync(t)
+
+	clientTask := e.clientID(t, task)
+	// Without edits the comments are not listed.
+	before := len(e.fake.Requests())
+	e.sync(t)
+	for _, req := range e.fake.Requests()[before:] {
+		if req.Method == http.MethodGet && req.Path == "/v1/comments" {
+			t.Fatal("comments of an unchanged task were listed")
+		}
+	}
+
+	// Adding a comment doesn't edit the page, it is copied once the task is edited.
+	e.fake.AddComment(clientTask, "client", "Looks good")
+	setStatus(e, clientTask, "На проверке")
+	e.sync(t)
+	e.sync(t)
+
+	clientComments := e.fake.Comments(clientTask)
+	if len(clientComments) != 2 || clientComments[0].Text != "Mark: Done, please check" {
+		t.Errorf("unexpected client comments %+v", clientComments)
+	}
+	internalComments := e.fake.Comments(task)
+	if len(internalComments) != 2 || internalComments[1].Text != "Olga: Looks good" {
+		t.Errorf("unexpected internal comments %+v", internalComments)
+	}
+}
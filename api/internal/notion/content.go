@@ -0,0 +1,259 @@
+package notion
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/Corray333/notion-manager/internal/project"
+)
+
+// ContentMapping configures copying the body of internal tasks to their client copies.
+type ContentMapping struct {
+	Enabled bool `mapstructure:"enabled"`
+	// Internal lists markers of internal-only blocks: a block whose text starts with one of them
+	// (case-insensitive), e.g. a toggle "Internal" or a paragraph "// note", is not copied with its children.
+	// Defaults to DefaultInternalMarkers.
+	Internal []string `mapstructure:"internal"`
+	// MaxBlocks limits the number of blocks copied per page. Defaults to DefaultMaxBlocks.
+	MaxBlocks int `mapstructure:"max_blocks"`
+}
+
+var DefaultInternalMarkers = []string{"internal", "//"}
+
+const DefaultMaxBlocks = 1000
+
+// appendBatch is the number of blocks Notion accepts in one append request.
+const appendBatch = 100
+
+// Blocks that can't be created through the API or make no sense in a client copy.
+var skippedBlocks = map[string]bool{
+	"child_page":     true,
+	"child_database": true,
+	"link_preview":   true,
+	"synced_block":   true,
+	"template":       true,
+	"unsupported":    true,
+}
+
+// contentBlock is a block of a page body in the write format with its children.
+type contentBlock struct {
+	Type     string                 `json:"type"`
+	Data     map[string]interface{} `json:"data"`
+	Children []contentBlock         `json:"children,omitempty"`
+}
+
+// request returns the block as sent to Notion. Table rows can only be created with their table.
+func (b contentBlock) request() map[string]interface{} {
+	data := map[string]interface{}{}
+	for k, v := range b.Data {
+		data[k] = v
+	}
+	if b.Type == "table" {
+		rows := []interface{}{}
+		for _, row := range b.Children {
+			rows = append(rows, row.request())
+		}
+		data["children"] = rows
+	}
+	return map[string]interface{}{"type": b.Type, b.Type: data}
+}
+
+// syncContent copies the body of the internal page to its client copy if the project copies
+// content and the body changed since the last copy. The client body is replaced as a whole.
+// Failures are saved as warnings, the properties of the page are copied anyway.
+func syncContent(ctx context.Context, store Storage, project *project.Project, internalID, clientID string, created bool) {
+	cfg := MappingFor(project).Content
+	if cfg == nil || !cfg.Enabled {
+		return
+	}
+	saveErr := func(err error) {
+		store.SaveError(Error{
+			err:        err,
+			table_type: TaskTable,
+			project:    *project,
+			id:         internalID,
+			severity:   SeverityWarning,
+		})
+	}
+
+	budget := cfg.MaxBlocks
+	if budget <= 0 {
+		budget = DefaultMaxBlocks
+	}
+	markers := cfg.Internal
+	if len(markers) == 0 {
+		markers = DefaultInternalMarkers
+	}
+	blocks, err := getContent(ctx, internalID, markers, &budget)
+	if err != nil {
+		saveErr(fmt.Errorf("error while reading page content: %w", err))
+		return
+	}
+
+	data, _ := json.Marshal(blocks)
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	if old, err := store.GetContentHash(internalID); err == nil && old == hash {
+		return
+	}
+
+	if !created {
+		if err := clearContent(ctx, clientID); err != nil {
+			saveErr(fmt.Errorf("error while removing old page content: %w", err))
+			return
+		}
+	}
+	if err := appendContent(ctx, clientID, blocks); err != nil {
+		saveErr(fmt.Errorf("error while copying page content: %w", err))
+		return
+	}
+	// Editing the body edits the page, the pull must not take it for a client edit.
+	if resp, err := client.GetPage(ctx, clientID); err == nil {
+		clientEdited(project, resp)
+	}
+	if budget < 0 {
+		saveErr(errors.New("page content has more blocks than the limit, only the first are copied"))
+	}
+	if err := store.SetContentHash(internalID, hash); err != nil {
+		saveErr(err)
+	}
+}
+
+// getContent reads the body of a page or block, dropping internal-only and unsupported blocks.
+// budget is decreased by every block read, the rest is dropped once it goes negative.
+func getContent(ctx context.Context, blockID string, markers []string, budget *int) ([]contentBlock, error) {
+	raw, err := getRawBlocks(ctx, blockID, "")
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := []contentBlock{}
+	for _, item := range raw {
+		typ, _ := item["type"].(string)
+		data, _ := item[typ].(map[string]interface{})
+		if skippedBlocks[typ] || data == nil || isInternalBlock(data, markers) {
+			continue
+		}
+		// Files uploaded to Notion have expiring URLs and can't be attached to another page.
+		if fileType, _ := data["type"].(string); fileType == "file" {
+			continue
+		}
+		if *budget--; *budget < 0 {
+			break
+		}
+
+		block := contentBlock{Type: typ, Data: data}
+		if hasChildren, _ := item["has_children"].(bool); hasChildren {
+			if block.Children, err = getContent(ctx, item["id"].(string), markers, budget); err != nil {
+				return nil, err
+			}
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// isInternalBlock reports whether the text of the block starts with one of the markers.
+func isInternalBlock(data map[string]interface{}, markers []string) bool {
+	items, _ := data["rich_text"].([]interface{})
+	text := ""
+	for _, item := range items {
+		if rt, ok := item.(map[string]interface{}); ok {
+			s, _ := rt["plain_text"].(string)
+			text += s
+		}
+	}
+	text = strings.ToLower(strings.TrimSpace(text))
+	for _, marker := range markers {
+		if marker != "" && strings.HasPrefix(text, strings.ToLower(marker)) {
+			return true
+		}
+	}
+	return false
+}
+
+// appendContent writes the blocks to the end of a page or block in batches Notion accepts.
+func appendContent(ctx context.Context, parentID string, blocks []contentBlock) error {
+	for start := 0; start < len(blocks); start += appendBatch {
+		batch := blocks[start:min(start+appendBatch, len(blocks))]
+		children := make([]interface{}, len(batch))
+		for i, block := range batch {
+			children[i] = block.request()
+		}
+
+		resp, err := client.AppendBlockChildren(ctx, parentID, children)
+		if err != nil {
+			return err
+		}
+		added := struct {
+			Results []struct {
+				ID string `json:"id"`
+			} `json:"results"`
+		}{}
+		if err := json.Unmarshal(resp, &added); err != nil {
+			return err
+		}
+		if len(added.Results) != len(batch) {
+			return fmt.Errorf("expected %d blocks to be added to %s, got %d", len(batch), parentID, len(added.Results))
+		}
+
+		for i, block := range batch {
+			if len(block.Children) == 0 || block.Type == "table" {
+				continue
+			}
+			if err := appendContent(ctx, added.Results[i].ID, block.Children); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// clearContent removes the body of a page.
+func clearContent(ctx context.Context, pageID string) error {
+	blocks, err := getRawBlocks(ctx, pageID, "")
+	if err != nil {
+		return err
+	}
+	for _, block := range blocks {
+		id, _ := block["id"].(string)
+		typ, _ := block["type"].(string)
+		if id == "" || typ == "child_page" || typ == "child_database" {
+			continue
+		}
+		if _, err := client.DeleteBlock(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getRawBlocks returns all children of a page or block as they are returned by Notion.
+func getRawBlocks(ctx context.Context, blockID string, cursor string) ([]map[string]interface{}, error) {
+	body, err := client.GetBlockChildren(ctx, blockID, cursor)
+	if err != nil {
+		return nil, err
+	}
+	res := struct {
+		Results    []map[string]interface{} `json:"results"`
+		HasMore    bool                     `json:"has_more"`
+		NextCursor string                   `json:"next_cursor"`
+	}{}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, err
+	}
+
+	if res.HasMore {
+		more, err := getRawBlocks(ctx, blockID, res.NextCursor)
+		if err != nil {
+			return nil, err
+		}
+		return append(res.Results, more...), nil
+	}
+	return res.Results, nil
+}
@@ -0,0 +1,55 @@
+package notion_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Corray333/notion-manager/internal/notion"
+)
+
+func paragraph(text string) map[string]interface{} {
+	return map[string]interface{}{"paragraph": map[string]interface{}{
+		"rich_text": []map[string]interface{}{{"type": "text", "text": map[string]interface{}{"content": text}, "plain_text": text}},
+	}}
+}
+
+func TestSyncContent(t *testing.T) {
+	e := newEnv(t)
+	notion.SetMappings(notion.MappingConfig{Default: notion.Mapping{Content: &notion.ContentMapping{Enabled: true}}})
+	t.Cleanup(func() { notion.SetMappings(notion.MappingConfig{}) })
+
+	task := e.addTask("Spec", internalProject, "")
+	for i := 0; i < 150; i++ {
+		e.fake.AddBlock(task, paragraph(fmt.Sprintf("Line %d", i)))
+	}
+	list := e.fake.AddBlock(task, map[string]interface{}{"bulleted_list_item": paragraph("Step")["paragraph"]})
+	e.fake.AddBlock(list, paragraph("Substep"))
+	notes := e.fake.AddBlock(task, map[string]interface{}{"toggle": paragraph("Internal notes")["paragraph"]})
+	e.fake.AddBlock(notes, paragraph("Secret"))
+	e.sync(t)
+
+	clientTask := e.clientID(t, task)
+	blocks := e.fake.Children(clientTask)
+	if len(blocks) != 151 {
+		t.Fatalf("expected 151 blocks without the internal toggle, got %d", len(blocks))
+	}
+	if got := e.fake.Children(blocks[150]["id"].(string)); len(got) != 1 {
+		t.Errorf("expected the nested block to be copied, got %+v", got)
+	}
+
+	// The body is replaced only when it changes.
+	e.fake.SetPage(task, map[string]interface{}{"Оценка": map[string]interface{}{"number": 5}})
+	e.sync(t)
+	for _, req := range e.fake.Requests() {
+		if req.Method == "DELETE" {
+			t.Fatalf("unchanged content was replaced: %s", req.Path)
+		}
+	}
+
+	e.fake.AddBlock(task, paragraph("New line"))
+	e.fake.SetPage(task, map[string]interface{}{"Оценка": map[string]interface{}{"number": 6}})
+	e.sync(t)
+	if blocks := e.fake.Children(clientTask); len(blocks) != 152 {
+		t.Errorf("expected the content to be replaced with 152 blocks, got %d", len(blocks))
+	}
+}
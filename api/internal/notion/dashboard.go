@@ -1,22 +1,25 @@
 package notion
 
 import (
+	"context"
 	"encoding/json"
-	"io"
-	"net/http"
 	"os"
 
 	"github.com/Corray333/notion-manager/internal/project"
 )
 
+type Block struct {
+	ID            string `json:"id"`
+	Type          string `json:"type"`
+	ChildDatabase struct {
+		Title string `json:"title"`
+	} `json:"child_database"`
+}
+
 type Dashboard struct {
-	Results []struct {
-		ID            string `json:"id"`
-		Type          string `json:"type"`
-		ChildDatabase struct {
-			Title string `json:"title"`
-		} `json:"child_database"`
-	} `json:"results"`
+	Results    []Block `json:"results"`
+	HasMore    bool    `json:"has_more"`
+	NextCursor string  `json:"next_cursor"`
 }
 
 type ProjectRaw struct {
@@ -35,102 +38,37 @@ type ProjectRaw struct {
 			} `json:"internal"`
 		} `json:"properties"`
 	} `json:"results"`
+	HasMore    bool   `json:"has_more"`
+	NextCursor string `json:"next_cursor"`
 }
 
-type Clients struct {
-	Results []struct {
-		ID   string `json:"id"`
-		Type string `json:"type"`
-	} `json:"results"`
-}
-
-func LoadProjects() []*project.Project {
-	url := "https://api.notion.com/v1/blocks/" + os.Getenv("DASHBOARDS_PAGE") + "/children"
-
-	req, err := http.NewRequest("GET", url, nil)
+func LoadProjects(ctx context.Context) []*project.Project {
+	blocks, err := getBlockChildren(ctx, os.Getenv("DASHBOARDS_PAGE"), "")
 	if err != nil {
 		return nil
 	}
-	req.Header.Set("Authorization", "Bearer "+os.Getenv("NOTION_SECRET"))
-	req.Header.Set("Notion-Version", "2022-06-28")
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil
-	}
-	res := Clients{}
-	if err := json.Unmarshal(body, &res); err != nil {
-		return nil
-	}
 	projects := []*project.Project{}
-	for _, client := range res.Results {
-		if client.Type == "child_page" {
-			projects = append(projects, loadProject(client.ID)...)
+	for _, dashboard := range blocks {
+		if dashboard.Type == "child_page" {
+			projects = append(projects, loadProject(ctx, dashboard.ID)...)
 		}
 	}
 	return projects
 }
 
-func loadProject(dashboard_id string) []*project.Project { // 1f92aa7a00954137b88117d0c8330b50
-	url := "https://api.notion.com/v1/blocks/" + dashboard_id + "/children"
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil
-	}
-	req.Header.Set("Authorization", "Bearer "+os.Getenv("NOTION_SECRET"))
-	req.Header.Set("Notion-Version", "2022-06-28")
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
+func loadProject(ctx context.Context, dashboard_id string) []*project.Project { // 1f92aa7a00954137b88117d0c8330b50
+	blocks, err := getBlockChildren(ctx, dashboard_id, "")
 	if err != nil {
 		return nil
 	}
-	res := Dashboard{}
-	if err := json.Unmarshal(body, &res); err != nil {
-		return nil
-	}
 	projects := []*project.Project{}
 	tasksDBID := ""
 	workersDBID := ""
 	timesDBID := ""
-	for _, r := range res.Results {
+	for _, r := range blocks {
 		switch r.ChildDatabase.Title {
 		case "Проекты":
-			rows, err := SearchPages(r.ID, map[string]interface{}{})
-			if err != nil {
-				continue
-			}
-			raw := ProjectRaw{}
-			if err := json.Unmarshal(rows, &raw); err != nil {
-				continue
-			}
-			for _, p := range raw.Results {
-				if len(p.Properties.Name.Title) == 0 || len(p.Properties.Internal.Relation) == 0 {
-					continue
-				}
-				project := project.Project{}
-				project.ProjectsDBID = r.ID
-				project.ProjectID = p.ID
-				project.Name = p.Properties.Name.Title[0].PlainText
-				project.InternalID = p.Properties.Internal.Relation[0].ID
-				projects = append(projects, &project)
-			}
+			projects = append(projects, loadClientProjects(ctx, r.ID, "")...)
 		case "Задачи":
 			tasksDBID = r.ID
 		case "Время":
@@ -149,3 +87,57 @@ func loadProject(dashboard_id string) []*project.Project { // 1f92aa7a00954137b8
 
 	return projects
 }
+
+// loadClientProjects reads the rows of a client "Проекты" database that are linked to an internal project.
+func loadClientProjects(ctx context.Context, dbid string, cursor string) []*project.Project {
+	req := map[string]interface{}{}
+	if cursor != "" {
+		req["start_cursor"] = cursor
+	}
+	rows, err := client.SearchPages(ctx, dbid, req)
+	if err != nil {
+		return nil
+	}
+	raw := ProjectRaw{}
+	if err := json.Unmarshal(rows, &raw); err != nil {
+		return nil
+	}
+
+	projects := []*project.Project{}
+	for _, p := range raw.Results {
+		if len(p.Properties.Name.Title) == 0 || len(p.Properties.Internal.Relation) == 0 {
+			continue
+		}
+		project := project.Project{}
+		project.ProjectsDBID = dbid
+		project.ProjectID = p.ID
+		project.Name = p.Properties.Name.Title[0].PlainText
+		project.InternalID = p.Properties.Internal.Relation[0].ID
+		projects = append(projects, &project)
+	}
+
+	if raw.HasMore {
+		projects = append(projects, loadClientProjects(ctx, dbid, raw.NextCursor)...)
+	}
+	return projects
+}
+
+func getBlockChildren(ctx context.Context, blockID string, cursor string) ([]Block, error) {
+	body, err := client.GetBlockChildren(ctx, blockID, cursor)
+	if err != nil {
+		return nil, err
+	}
+	res := Dashboard{}
+	if err := json.Unmarshal(body, &res); err != nil {
+		return nil, err
+	}
+
+	if res.HasMore {
+		more, err := getBlockChildren(ctx, blockID, res.NextCursor)
+		if err != nil {
+			return nil, err
+		}
+		return append(res.Results, more...), nil
+	}
+	return res.Results, nil
+}
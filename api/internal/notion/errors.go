@@ -0,0 +1,46 @@
+package notion
+
+import "time"
+
+// Severities of saved errors.
+const (
+	SeverityWarning  = "warning"  // the sync went on, e.g. a client edit was not pulled
+	SeverityError    = "error"    // a page failed to sync
+	SeverityCritical = "critical" // a whole project failed to sync
+)
+
+// ErrorRecord is an error saved by a sync. The same unacknowledged error is saved once
+// and counted every time it happens again.
+type ErrorRecord struct {
+	ID             int64      `json:"id" db:"id"`
+	RunID          int64      `json:"run_id" db:"run_id"`                   // Run where the error happened last, 0 outside of a run
+	ProjectID      string     `json:"project_id" db:"project_id"`           // ID of project
+	Type           string     `json:"type" db:"type"`                       // Type of database
+	PageID         string     `json:"page_id" db:"page_id"`                 // ID of page in internal dashboard, empty for project errors
+	Message        string     `json:"message" db:"message"`                 // Error message
+	Severity       string     `json:"severity" db:"severity"`               // One of Severity* constants
+	Count          int        `json:"count" db:"count"`                     // How many times the error happened
+	CreatedAt      time.Time  `json:"created_at" db:"created_at"`           // When the error happened first
+	LastSeenAt     time.Time  `json:"last_seen_at" db:"last_seen_at"`       // When the error happened last
+	AcknowledgedAt *time.Time `json:"acknowledged_at" db:"acknowledged_at"` // When the error was acknowledged, nil if it wasn't
+}
+
+// ErrorFilter selects saved errors. Empty fields match everything.
+type ErrorFilter struct {
+	ProjectID    string
+	Type         string
+	Severity     string
+	Since        time.Time // errors seen at or after this time
+	Acknowledged *bool
+	Limit        int
+	Offset       int
+}
+
+// ErrorSummary groups saved errors by message.
+type ErrorSummary struct {
+	Message     string    `json:"message" db:"message"`
+	Errors      int       `json:"errors" db:"errors"`           // Number of error records
+	Occurrences int       `json:"occurrences" db:"occurrences"` // Number of times the errors happened
+	Projects    int       `json:"projects" db:"projects"`       // Number of projects affected
+	LastSeenAt  time.Time `json:"last_seen_at" db:"last_seen_at"`
+}
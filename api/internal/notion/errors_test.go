@@ -0,0 +1,51 @@
+package notion_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Corray333/notion-manager/internal/notion"
+)
+
+func TestSyncCountsRepeatedErrors(t *testing.T) {
+	e := newEnv(t)
+	timeID := e.addTime("No task", "", 1)
+	e.fake.SetPage(timeID, map[string]interface{}{"Задача": map[string]interface{}{"relation": []interface{}{}}})
+	e.sync(t)
+	e.fake.SetPage(timeID, map[string]interface{}{"Всего ч": map[string]interface{}{"number": 2}})
+	e.sync(t)
+
+	unacknowledged := false
+	filter := notion.ErrorFilter{Type: "time", Acknowledged: &unacknowledged}
+	records, total, err := e.store.GetErrors(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	runs, _ := e.store.GetSyncRuns(1)
+	if total != 1 || records[0].Count != 2 || records[0].RunID != runs[0].ID || records[0].Severity != notion.SeverityError {
+		t.Fatalf("expected one error seen twice in the last run, got %d %+v", total, records)
+	}
+
+	summary, err := e.store.GetErrorSummary(filter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(summary) != 1 || summary[0].Occurrences != 2 || summary[0].LastSeenAt.IsZero() {
+		t.Errorf("unexpected summary %+v", summary)
+	}
+
+	// Once acknowledged the error is saved again as a new one.
+	if err := e.store.AckError(records[0].ID); err != nil {
+		t.Fatal(err)
+	}
+	e.fake.SetPage(timeID, map[string]interface{}{"Всего ч": map[string]interface{}{"number": 3}})
+	e.sync(t)
+	if records, _, _ = e.store.GetErrors(filter); len(records) != 1 || records[0].Count != 1 {
+		t.Errorf("expected a new error, got %+v", records)
+	}
+
+	filter.Since = time.Now().Add(time.Hour)
+	if _, total, _ := e.store.GetErrors(filter); total != 0 {
+		t.Errorf("expected no errors seen in the future, got %d", total)
+	}
+}
@@ -0,0 +1,121 @@
+package notion
+
+import (
+	"sync"
+	"time"
+)
+
+// Types of sync events.
+const (
+	EventRunStarted       = "run_started"
+	EventProjectStarted   = "project_started"
+	EventPageCreated      = "page_created"
+	EventPageUpdated      = "page_updated"
+	EventValidationFailed = "validation_failed"
+	EventError            = "error"
+	EventProjectFinished  = "project_finished"
+	EventRunFinished      = "run_finished"
+)
+
+// SyncEvent describes a step of a sync run.
+type SyncEvent struct {
+	Seq         int64         `json:"seq"`                    // Number of the event, increasing
+	Type        string        `json:"type"`                   // One of Event* constants
+	RunID       int64         `json:"run_id"`                 // ID of the run, 0 for pages fixed outside of a run
+	Time        time.Time     `json:"time"`                   // When the event happened
+	ProjectID   string        `json:"project_id,omitempty"`   // ID of project
+	ProjectName string        `json:"project_name,omitempty"` // Name of project
+	PageID      string        `json:"page_id,omitempty"`      // ID of page in internal dashboard
+	Title       string        `json:"title,omitempty"`        // Title of page
+	ClientURL   string        `json:"client_url,omitempty"`   // URL of page copy in client dashboard
+	Message     string        `json:"message,omitempty"`      // Error or validation failures
+	Stats       *ProjectStats `json:"stats,omitempty"`        // Counts of the finished project
+	Status      string        `json:"status,omitempty"`       // Status of the finished run
+}
+
+const (
+	// eventBufferSize is the number of events a slow subscriber may fall behind before events are dropped for it.
+	eventBufferSize = 256
+	// eventReplaySize is the number of the latest events of the current run replayed to new subscribers.
+	eventReplaySize = 1000
+)
+
+// events delivers sync events to subscribers. The latest events of the current run are
+// kept so that a subscriber connected in the middle of a run sees what happened before.
+var events struct {
+	mu          sync.Mutex
+	seq         int64
+	current     []SyncEvent
+	subscribers map[chan SyncEvent]struct{}
+}
+
+// SubscribeEvents returns a channel of sync events, starting with the events of the
+// current run, and a function that unsubscribes and closes the channel.
+func SubscribeEvents() (<-chan SyncEvent, func()) {
+	events.mu.Lock()
+	defer events.mu.Unlock()
+
+	ch := make(chan SyncEvent, eventBufferSize+len(events.current))
+	for _, e := range events.current {
+		ch <- e
+	}
+	if events.subscribers == nil {
+		events.subscribers = map[chan SyncEvent]struct{}{}
+	}
+	events.subscribers[ch] = struct{}{}
+
+	return ch, func() {
+		events.mu.Lock()
+		defer events.mu.Unlock()
+		if _, ok := events.subscribers[ch]; ok {
+			delete(events.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// publish sends the event to all subscribers without blocking the sync.
+func publish(e SyncEvent) {
+	events.mu.Lock()
+	defer events.mu.Unlock()
+
+	events.seq++
+	e.Seq = events.seq
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if e.Type == EventRunStarted {
+		events.current = nil
+	}
+	if e.RunID != 0 {
+		events.current = append(events.current, e)
+		if len(events.current) > eventReplaySize {
+			events.current = events.current[len(events.current)-eventReplaySize:]
+		}
+	}
+
+	for ch := range events.subscribers {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// publishValidation publishes the failures of a page saved to to_be_updated.
+func publishValidation(v Validation) {
+	publish(SyncEvent{
+		Type:      EventValidationFailed,
+		RunID:     RunningSync(),
+		ProjectID: v.ProjectID,
+		PageID:    v.InternalID,
+		Title:     v.Title,
+		ClientURL: pageURL(v.ClientID),
+		Message:   v.Errors,
+	})
+}
+
+// pageURL returns the URL of a page in the Notion app.
+func pageURL(id string) string {
+	return "https://www.notion.so/" + normalizeID(id)
+}
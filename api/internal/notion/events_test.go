@@ -0,0 +1,64 @@
+package notion_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Corray333/notion-manager/internal/notion"
+)
+
+func TestSyncPublishesEvents(t *testing.T) {
+	e := newEnv(t)
+	task := e.addTask("Task", internalProject, "")
+	e.fake.AddPage(tasksDB, map[string]interface{}{
+		"Task":    title("No deadline"),
+		"Продукт": relation(internalProject),
+	})
+
+	events, unsubscribe := notion.SubscribeEvents()
+	defer unsubscribe()
+	// Skip the replay of runs of other tests.
+	for drained := false; !drained; {
+		select {
+		case <-events:
+		default:
+			drained = true
+		}
+	}
+	e.sync(t)
+
+	types := []string{}
+	var created notion.SyncEvent
+	var invalid notion.SyncEvent
+	for done := false; !done; {
+		event := <-events
+		types = append(types, event.Type)
+		switch event.Type {
+		case notion.EventPageCreated:
+			if event.PageID == task {
+				created = event
+			}
+		case notion.EventValidationFailed:
+			invalid = event
+		case notion.EventRunFinished:
+			done = true
+		}
+	}
+
+	if types[0] != notion.EventRunStarted || types[1] != notion.EventProjectStarted || types[len(types)-2] != notion.EventProjectFinished {
+		t.Errorf("unexpected order of events %v", types)
+	}
+	if created.Title != "Task" || !strings.HasSuffix(created.ClientURL, strings.ReplaceAll(e.clientID(t, task), "-", "")) {
+		t.Errorf("unexpected page event %+v", created)
+	}
+	if invalid.Title != "No deadline" || !strings.Contains(invalid.Message, notion.ErrTaskNoDeadline) {
+		t.Errorf("unexpected validation event %+v", invalid)
+	}
+
+	// A late subscriber gets the events of the last run.
+	replay, unsubscribeReplay := notion.SubscribeEvents()
+	defer unsubscribeReplay()
+	if first := <-replay; first.Type != notion.EventRunStarted {
+		t.Errorf("expected the run to be replayed, got %+v", first)
+	}
+}
@@ -0,0 +1,134 @@
+package notion
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Corray333/notion-manager/internal/project"
+)
+
+// FixResult is what happened to a page of to_be_updated during FixBroken.
+type FixResult struct {
+	InternalID string `json:"internal_id"`       // ID of page in internal dashboard
+	ProjectID  string `json:"project_id"`        // ID of project
+	Type       string `json:"type"`              // Type of database
+	Title      string `json:"title"`             // Title of page
+	Message    string `json:"message,omitempty"` // Issues left or the error
+}
+
+// FixReport is the result of FixBroken.
+type FixReport struct {
+	Fixed       []FixResult `json:"fixed"`        // pages that pass validation now
+	StillBroken []FixResult `json:"still_broken"` // pages that were synced again but still have issues
+	Errored     []FixResult `json:"errored"`      // pages that couldn't be synced
+}
+
+// FixBroken syncs again every page saved to to_be_updated because it failed validation,
+// so that pages fixed in the internal dashboard leave the queue. A failing page doesn't
+// stop the others, it is reported as errored. Pages with conflicting edits are left to PullClientChanges.
+// Like ProcessJobs it doesn't run alongside a sync and leaves the sync cursors as they are.
+// Pages of paused projects are left in the queue.
+func FixBroken(ctx context.Context, store Storage) (*FixReport, error) {
+	ctx, unlock, err := lockRunner(ctx, WorkFix)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	projects, err := store.GetProjects()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx = withWorkerCache(ctx)
+	report := &FixReport{Fixed: []FixResult{}, StillBroken: []FixResult{}, Errored: []FixResult{}}
+	for _, project := range projects {
+		if project.Paused {
+			continue
+		}
+		pages, err := store.GetRowsToBeUpdatedByProject(project.ProjectID)
+		if err != nil {
+			return report, err
+		}
+		clientLastSynced := project.ClientLastSynced
+
+		for _, page := range pages {
+			if err := ctx.Err(); err != nil {
+				return report, err
+			}
+			if page.Type != string(TaskTable) && page.Type != string(TimeTable) {
+				continue
+			}
+			result := FixResult{
+				InternalID: page.InternalID,
+				ProjectID:  page.ProjectID,
+				Type:       page.Type,
+				Title:      page.Title,
+			}
+
+			err := fixPage(ctx, store, &project, page)
+			var validationErr *ValidationError
+			switch {
+			case errors.As(err, &validationErr):
+				result.Message = validationErr.Issues.Messages()
+				report.StillBroken = append(report.StillBroken, result)
+			case err != nil:
+				result.Message = err.Error()
+				report.Errored = append(report.Errored, result)
+			default:
+				if left := remainingIssues(store, &project, page.InternalID); left != nil {
+					result.Message = left.Messages()
+					report.StillBroken = append(report.StillBroken, result)
+				} else {
+					report.Fixed = append(report.Fixed, result)
+				}
+			}
+		}
+
+		// The edits of the client pages made by the uploads must not be pulled back.
+		if project.ClientLastSynced > clientLastSynced {
+			if err := store.SetClientLastSynced(project.ProjectID, project.ClientLastSynced); err != nil {
+				return report, err
+			}
+		}
+	}
+	return report, nil
+}
+
+// fixPage fetches the page again and uploads it, which validates it on the way.
+func fixPage(ctx context.Context, store Storage, project *project.Project, page Validation) error {
+	switch page.Type {
+	case string(TaskTable):
+		task, err := GetTask(ctx, page.InternalID)
+		if err != nil {
+			return err
+		}
+		project.Schema, _ = GetSchema(ctx, project.TasksDBID)
+		return task.Upload(ctx, store, project)
+	case string(TimeTable):
+		time, err := GetTime(ctx, page.InternalID)
+		if err != nil {
+			return err
+		}
+		project.Schema, _ = GetSchema(ctx, project.TimeDBID)
+		return time.Upload(ctx, store, project)
+	}
+	return nil
+}
+
+// remainingIssues returns the issues of the page left in to_be_updated, nil if it was removed.
+func remainingIssues(store Storage, project *project.Project, internalID string) ValidationIssues {
+	rows, err := store.GetRowsToBeUpdatedByProject(project.ProjectID)
+	if err != nil {
+		return nil
+	}
+	for _, row := range rows {
+		if row.InternalID == internalID {
+			if row.Issues == nil {
+				return ValidationIssues{}
+			}
+			return row.Issues
+		}
+	}
+	return nil
+}
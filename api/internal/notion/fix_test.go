@@ -0,0 +1,78 @@
+package notion_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Corray333/notion-manager/internal/notion"
+)
+
+func TestFixBroken(t *testing.T) {
+	e := newEnv(t)
+	notion.SetValidation(notion.ValidationConfig{Default: notion.ValidationRules{
+		Task: []notion.ValidationRule{{Property: "Дедлайн", Check: notion.CheckRequired, Severity: notion.SeverityError}},
+	}})
+	t.Cleanup(func() { notion.SetValidation(notion.ValidationConfig{}) })
+
+	noDeadline := map[string]interface{}{"Дедлайн": map[string]interface{}{"date": nil}}
+	fixed, broken, deleted := e.addTask("Fixed", internalProject, ""), e.addTask("Broken", internalProject, ""), e.addTask("Deleted", internalProject, "")
+	for _, id := range []string{fixed, broken, deleted} {
+		e.fake.SetPage(id, noDeadline)
+	}
+	e.sync(t)
+
+	e.fake.SetPage(fixed, map[string]interface{}{"Дедлайн": map[string]interface{}{"date": map[string]interface{}{"start": "2024-07-01"}}})
+	e.fake.Delete(deleted)
+	before, err := e.store.GetProjects()
+	if err != nil {
+		t.Fatal(err)
+	}
+	report, err := notion.FixBroken(context.Background(), e.store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Fixed) != 1 || report.Fixed[0].InternalID != fixed {
+		t.Errorf("expected the fixed task to be fixed, got %+v", report.Fixed)
+	}
+	if len(report.StillBroken) != 1 || report.StillBroken[0].InternalID != broken {
+		t.Errorf("expected the broken task to stay broken, got %+v", report.StillBroken)
+	}
+	if len(report.Errored) != 1 || report.Errored[0].InternalID != deleted {
+		t.Errorf("expected the deleted task to fail, got %+v", report.Errored)
+	}
+	e.clientID(t, fixed)
+	if rows, _ := e.store.GetRowsToBeUpdated(); len(rows) != 2 {
+		t.Errorf("expected 2 rows left, got %+v", rows)
+	}
+	if after, _ := e.store.GetProjects(); after[0].TasksLastSynced != before[0].TasksLastSynced {
+		t.Errorf("expected the tasks cursor to stay at %d, got %d", before[0].TasksLastSynced, after[0].TasksLastSynced)
+	}
+}
+
+func TestFixBrokenSkipsPausedProjects(t *testing.T) {
+	e := newEnv(t)
+	notion.SetValidation(notion.ValidationConfig{Default: notion.ValidationRules{
+		Task: []notion.ValidationRule{{Property: "Дедлайн", Check: notion.CheckRequired, Severity: notion.SeverityError}},
+	}})
+	t.Cleanup(func() { notion.SetValidation(notion.ValidationConfig{}) })
+
+	task := e.addTask("Task", internalProject, "")
+	e.fake.SetPage(task, map[string]interface{}{"Дедлайн": map[string]interface{}{"date": nil}})
+	e.sync(t)
+	e.pause(t)
+
+	e.fake.SetPage(task, map[string]interface{}{"Дедлайн": map[string]interface{}{"date": map[string]interface{}{"start": "2024-07-01"}}})
+	report, err := notion.FixBroken(context.Background(), e.store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Fixed)+len(report.StillBroken)+len(report.Errored) != 0 {
+		t.Errorf("expected the paused project to be skipped, got %+v", report)
+	}
+	if _, err := e.store.GetClientID(task); err == nil {
+		t.Error("page of a paused project was copied")
+	}
+	if rows, _ := e.store.GetRowsToBeUpdated(); len(rows) != 1 {
+		t.Errorf("expected the page to stay in the queue, got %+v", rows)
+	}
+}
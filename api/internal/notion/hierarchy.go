@@ -0,0 +1,191 @@
+package notion
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Corray333/notion-manager/internal/project"
+)
+
+// uploadingKey keeps the IDs of the pages being uploaded in the context, so that
+// uploading related pages first stops at pages that depend on each other.
+type uploadingKey struct{}
+
+// withUploading returns a context that marks the page as being uploaded.
+func withUploading(ctx context.Context, pageID string) context.Context {
+	uploading, _ := ctx.Value(uploadingKey{}).(map[string]bool)
+	next := make(map[string]bool, len(uploading)+1)
+	for id := range uploading {
+		next[id] = true
+	}
+	next[normalizeID(pageID)] = true
+	return context.WithValue(ctx, uploadingKey{}, next)
+}
+
+func isUploading(ctx context.Context, pageID string) bool {
+	uploading, _ := ctx.Value(uploadingKey{}).(map[string]bool)
+	return uploading[normalizeID(pageID)]
+}
+
+// dependencies returns the IDs of the pages a task must be uploaded after:
+// the pages of its relations with MissingUpload, e.g. the parent task.
+func dependencies(rules []PropertyMapping, task *Task) []string {
+	ids := []string{}
+	for _, rule := range rules {
+		if rule.Type != MapRelation || rule.Missing != MissingUpload {
+			continue
+		}
+		for _, rel := range task.Raw[rule.Source].Relation {
+			if normalizeID(rel.ID) != normalizeID(task.ID) {
+				ids = append(ids, normalizeID(rel.ID))
+			}
+		}
+	}
+	return ids
+}
+
+// orderTasks sorts the tasks so that every task comes after the tasks it depends on,
+// keeping the original order otherwise. Tasks depending on each other in a cycle can't
+// be ordered, they are put at the end and the cycles are returned.
+func orderTasks(rules []PropertyMapping, tasks []Task) ([]Task, [][]Task) {
+	index := map[string]int{}
+	for i, task := range tasks {
+		index[normalizeID(task.ID)] = i
+	}
+
+	// Dependencies outside of the batch are uploaded on demand, see PropertyMapping.relation.
+	blockers := make([]int, len(tasks))
+	dependents := make([][]int, len(tasks))
+	for i := range tasks {
+		for _, id := range dependencies(rules, &tasks[i]) {
+			if j, ok := index[id]; ok {
+				blockers[i]++
+				dependents[j] = append(dependents[j], i)
+			}
+		}
+	}
+
+	ordered := make([]Task, 0, len(tasks))
+	done := make([]bool, len(tasks))
+	for progress := true; progress; {
+		progress = false
+		for i := range tasks {
+			if done[i] || blockers[i] > 0 {
+				continue
+			}
+			done[i], progress = true, true
+			ordered = append(ordered, tasks[i])
+			for _, j := range dependents[i] {
+				blockers[j]--
+			}
+		}
+	}
+
+	// What is left are cycles and the tasks depending on them. Following the dependencies
+	// of a left task always leads to a cycle, walks reaching a visited task found it already.
+	cycles := [][]Task{}
+	visited := make([]bool, len(tasks))
+	for i := range tasks {
+		if done[i] || visited[i] {
+			continue
+		}
+		path := []int{}
+		onPath := map[int]int{}
+		for j := i; j >= 0 && !visited[j]; {
+			visited[j] = true
+			onPath[j] = len(path)
+			path = append(path, j)
+
+			next := -1
+			for _, id := range dependencies(rules, &tasks[j]) {
+				if k, ok := index[id]; ok && !done[k] {
+					next = k
+					break
+				}
+			}
+			if start, ok := onPath[next]; ok {
+				cycle := []Task{}
+				for _, k := range path[start:] {
+					cycle = append(cycle, tasks[k])
+				}
+				cycles = append(cycles, cycle)
+				break
+			}
+			j = next
+		}
+	}
+	for i := range tasks {
+		if !done[i] {
+			ordered = append(ordered, tasks[i])
+		}
+	}
+	return ordered, cycles
+}
+
+// cycleError describes the cycle as a chain of task titles.
+func cycleError(cycle []Task) error {
+	titles := []string{}
+	for _, task := range cycle {
+		titles = append(titles, fmt.Sprintf("%q", task.Raw.title()))
+	}
+	titles = append(titles, titles[0])
+	return fmt.Errorf("tasks depend on each other: %s", strings.Join(titles, " → "))
+}
+
+// relinkTasks sets the relations between the tasks that couldn't be set when they were
+// uploaded because the related task came later, e.g. the subtasks of a parent task
+// or the tasks of a cycle.
+func relinkTasks(ctx context.Context, store Storage, project *project.Project, tasks []Task) {
+	position := map[string]int{}
+	for i, task := range tasks {
+		position[normalizeID(task.ID)] = i
+	}
+
+	for i, task := range tasks {
+		if ctx.Err() != nil {
+			return
+		}
+		clientID, err := store.GetClientID(task.ID)
+		if err != nil {
+			continue
+		}
+
+		req := map[string]interface{}{}
+		for _, rule := range MappingFor(project).Task {
+			if rule.Type != MapRelation || len(project.Schema) > 0 && !slices.Contains(project.Schema, rule.Target) {
+				continue
+			}
+			later := slices.ContainsFunc(task.Raw[rule.Source].Relation, func(rel Reference) bool {
+				j, ok := position[normalizeID(rel.ID)]
+				return ok && j > i
+			})
+			if !later {
+				continue
+			}
+			// The related tasks are copied by now, nothing has to be uploaded.
+			rule.Missing = MissingSkip
+			value, err := rule.relation(ctx, store, project, task.ID, task.Raw[rule.Source])
+			if err != nil || value == nil {
+				continue
+			}
+			req[rule.Target] = value
+		}
+		if len(req) == 0 {
+			continue
+		}
+
+		resp, err := client.UpdatePage(ctx, clientID, req)
+		if err != nil {
+			store.SaveError(Error{
+				err:        fmt.Errorf("error while linking related tasks: %w", err),
+				table_type: TaskTable,
+				project:    *project,
+				id:         task.ID,
+			})
+			continue
+		}
+		clientEdited(project, resp)
+	}
+}
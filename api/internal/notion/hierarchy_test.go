@@ -0,0 +1,76 @@
+package notion_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Corray333/notion-manager/internal/notion"
+)
+
+func TestSyncSubtasks(t *testing.T) {
+	e := newEnv(t)
+	e.fake.AddProperty(clientTasksDB, "Подзадачи", "relation")
+
+	parent := e.addTask("Parent", internalProject, "")
+	child := e.addTask("Child", internalProject, parent)
+	// Edited last, the parent comes after its subtask in the batch.
+	e.fake.SetPage(parent, map[string]interface{}{"Подзадачи": relation(child)})
+	e.sync(t)
+
+	pages := e.fake.Pages(clientTasksDB)
+	if len(pages) != 2 || pages[0].ID != e.clientID(t, parent) {
+		t.Fatalf("expected the parent to be created first and once, got %+v", pages)
+	}
+	clientParent, clientChild := pages[0], pages[1]
+	if got := relationOf(clientChild, "Родительская задача"); got != clientParent.ID {
+		t.Errorf("expected the parent of the subtask to be %s, got %q", clientParent.ID, got)
+	}
+	if got := relationOf(clientParent, "Подзадачи"); got != clientChild.ID {
+		t.Errorf("expected the subtask of the parent to be %s, got %q", clientChild.ID, got)
+	}
+}
+
+func TestSyncReportsParentCycles(t *testing.T) {
+	e := newEnv(t)
+	first := e.addTask("First", internalProject, "")
+	second := e.addTask("Second", internalProject, first)
+	e.fake.SetPage(first, map[string]interface{}{"Родительская задача": relation(second)})
+	e.sync(t)
+
+	clientFirst, _ := e.fake.Page(e.clientID(t, first))
+	clientSecond, _ := e.fake.Page(e.clientID(t, second))
+	if got := relationOf(clientFirst, "Родительская задача"); got != clientSecond.ID {
+		t.Errorf("expected the parent of the first task to be set, got %q", got)
+	}
+	if got := relationOf(clientSecond, "Родительская задача"); got != clientFirst.ID {
+		t.Errorf("expected the parent of the second task to be set, got %q", got)
+	}
+
+	records, _, err := e.store.GetErrors(notion.ErrorFilter{Type: "task"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || !strings.Contains(records[0].Message, `"First" → "Second" → "First"`) {
+		t.Errorf("expected the cycle to be reported, got %+v", records)
+	}
+}
+
+func TestUploadFailsWithoutParent(t *testing.T) {
+	e := newEnv(t)
+	parent := e.addTask("Parent", internalProject, "")
+	child := e.addTask("Child", internalProject, parent)
+	e.fake.Delete(parent)
+
+	task, err := notion.GetTask(context.Background(), child)
+	if err != nil {
+		t.Fatal(err)
+	}
+	projects := notion.LoadProjects(context.Background())
+	if err := task.Upload(context.Background(), e.store, projects[0]); err == nil {
+		t.Fatal("expected an error when the parent task can't be loaded")
+	}
+	if pages := e.fake.Pages(clientTasksDB); len(pages) != 0 {
+		t.Errorf("expected no client tasks, got %d", len(pages))
+	}
+}
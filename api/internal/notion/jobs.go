@@ -0,0 +1,456 @@
+package notion
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/Corray333/notion-manager/internal/project"
+)
+
+// Statuses of a job.
+const (
+	JobPending   = "pending"   // waiting for a worker, retries wait for NextRunAt
+	JobRunning   = "running"   // being uploaded
+	JobDone      = "done"      // uploaded or skipped by validation
+	JobFailed    = "failed"    // out of attempts, see LastError
+	JobCancelled = "cancelled" // the run was cancelled or a newer job uploads the page
+)
+
+var (
+	// ErrPageLocked is returned when another upload of the page doesn't finish in time.
+	ErrPageLocked = errors.New("page is being uploaded by another worker")
+	// ErrPageConflicted cancels the job of a page with a flagged conflict, PullClientChanges resolves it.
+	ErrPageConflicted = errors.New("page has a flagged conflict")
+	// ErrProjectPaused cancels the jobs of a paused project. Retries don't move the cursors,
+	// so the pages are uploaded by the first sync after the project is resumed.
+	ErrProjectPaused = errors.New("project is paused")
+)
+
+// MaxJobAttempts is how many times a failing page is uploaded before its job fails.
+const MaxJobAttempts = 5
+
+// Job is the upload of an internal page to the dashboard of a project. Jobs are saved,
+// so uploads interrupted by a restart and failed uploads are retried by ProcessJobs.
+type Job struct {
+	ID        int64     `json:"id" db:"id"`
+	RunID     int64     `json:"run_id" db:"run_id"`           // Run that created the job
+	ProjectID string    `json:"project_id" db:"project_id"`   // ID of project
+	PageID    string    `json:"page_id" db:"page_id"`         // ID of page in internal dashboard
+	Type      string    `json:"type" db:"type"`               // Type of database
+	Status    string    `json:"status" db:"status"`           // One of Job* constants
+	Attempts  int       `json:"attempts" db:"attempts"`       // Uploads tried so far
+	NextRunAt time.Time `json:"next_run_at" db:"next_run_at"` // When a pending job may run
+	LastError string    `json:"last_error" db:"last_error"`   // Error of the last attempt
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+}
+
+// jobWorkers is the number of pages uploaded at the same time. All workers share
+// the client, so together they stay within its rate limit.
+var jobWorkers = 4
+
+// SetJobWorkers sets the number of pages uploaded at the same time.
+func SetJobWorkers(n int) {
+	jobWorkers = max(n, 1)
+}
+
+// jobBackoff returns the delay before the next attempt of a job that failed attempts times.
+func jobBackoff(attempts int) time.Duration {
+	return time.Minute << min(attempts-1, 10)
+}
+
+// pageJob is a job with the page it uploads.
+type pageJob struct {
+	Job
+	title  string
+	after  []int // indexes of the jobs that must finish first, e.g. the parent task
+	upload func(ctx context.Context, store Storage, project *project.Project) error
+	// load fetches the page of a saved job before its upload, nil if the page is already loaded.
+	load func(ctx context.Context) error
+}
+
+func taskJob(project *project.Project, task *Task) *pageJob {
+	return &pageJob{
+		Job:    Job{ProjectID: project.ProjectID, PageID: task.ID, Type: string(TaskTable)},
+		title:  task.Raw.title(),
+		upload: task.Upload,
+	}
+}
+
+func timeJob(project *project.Project, time *Time) *pageJob {
+	return &pageJob{
+		Job:    Job{ProjectID: project.ProjectID, PageID: time.ID, Type: string(TimeTable)},
+		title:  time.Raw.title(),
+		upload: time.Upload,
+	}
+}
+
+// taskJobs returns the jobs uploading the tasks. A task waits for the tasks it depends on
+// that come before it, see orderTasks.
+func taskJobs(project *project.Project, tasks []Task) []*pageJob {
+	jobs := make([]*pageJob, len(tasks))
+	index := map[string]int{}
+	rules := MappingFor(project).Task
+	for i := range tasks {
+		jobs[i] = taskJob(project, &tasks[i])
+		for _, id := range dependencies(rules, &tasks[i]) {
+			if j, ok := index[id]; ok {
+				jobs[i].after = append(jobs[i].after, j)
+			}
+		}
+		index[normalizeID(tasks[i].ID)] = i
+	}
+	return jobs
+}
+
+// projectRun is a project shared by the workers uploading its pages. Every worker uploads
+// with its own copy of the project and merges the moved cursors and the counts back.
+// Uploads only move the cursors of the copy, they are saved by merge.
+type projectRun struct {
+	mu       sync.Mutex
+	store    Storage
+	project  *project.Project
+	stats    *ProjectStats
+	recreate bool
+	// conflicted are the internal IDs of the pages with flagged conflicts, their jobs are cancelled.
+	conflicted map[string]bool
+	// persist saves the cursors after every page. Otherwise only the pull cursor is moved,
+	// e.g. for retries: other pages edited before the retried ones must not be skipped by the next sync.
+	persist bool
+}
+
+func (r *projectRun) snapshot() project.Project {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return *r.project
+}
+
+func (r *projectRun) merge(p *project.Project, stats *ProjectStats) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	pulled := p.ClientLastSynced > r.project.ClientLastSynced
+	r.project.TasksLastSynced = max(r.project.TasksLastSynced, p.TasksLastSynced)
+	r.project.TimeLastSynced = max(r.project.TimeLastSynced, p.TimeLastSynced)
+	r.project.ClientLastSynced = max(r.project.ClientLastSynced, p.ClientLastSynced)
+	r.stats.Created += stats.Created
+	r.stats.Updated += stats.Updated
+	r.stats.Failed += stats.Failed
+	r.stats.Skipped += stats.Skipped
+
+	var err error
+	if r.persist {
+		err = r.store.SetLastSynced(r.project)
+	} else if pulled {
+		// The edits of the client pages made by the upload must not be pulled back.
+		err = r.store.SetClientLastSynced(r.project.ProjectID, r.project.ClientLastSynced)
+	}
+	if err != nil {
+		r.store.SaveError(Error{
+			err:        err,
+			table_type: ProjectTable,
+			project:    *r.project,
+		})
+	}
+	if r.stats.RunID != 0 {
+		saveProgress(r.store, r.stats)
+	}
+}
+
+// runJobs saves the jobs and uploads their pages with the worker pool. It returns once every
+// job finished or, if ctx is cancelled, once the running ones did. Jobs that failed are left
+// pending for ProcessJobs until they are out of attempts.
+func runJobs(ctx context.Context, r *projectRun, jobs []*pageJob) {
+	for _, job := range jobs {
+		job.RunID, job.Status, job.NextRunAt = r.stats.RunID, JobPending, time.Now()
+		if err := r.store.NewJob(&job.Job); err != nil {
+			slog.Error("error while saving job: " + err.Error())
+		}
+	}
+
+	workers := make(chan struct{}, jobWorkers)
+	finished := make([]chan struct{}, len(jobs))
+	for i := range finished {
+		finished[i] = make(chan struct{})
+	}
+	var wg sync.WaitGroup
+	for i, job := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer close(finished[i])
+			for _, j := range job.after {
+				<-finished[j]
+			}
+			select {
+			case workers <- struct{}{}:
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				job.Status = JobCancelled
+				r.store.UpdateJob(&job.Job)
+				return
+			}
+			defer func() { <-workers }()
+			runJob(ctx, r, job)
+		}()
+	}
+	wg.Wait()
+}
+
+// runJob uploads the page of the job, counts the result and saves the job.
+func runJob(ctx context.Context, r *projectRun, job *pageJob) {
+	if r.conflicted[job.PageID] {
+		job.Status, job.LastError = JobCancelled, ErrPageConflicted.Error()
+		r.store.UpdateJob(&job.Job)
+		r.merge(r.project, &ProjectStats{Skipped: 1})
+		return
+	}
+
+	unlock, ok := lockPage(ctx, job.PageID)
+	if !ok {
+		job.Status, job.LastError = JobPending, ErrPageLocked.Error()
+		if ctx.Err() != nil {
+			job.Status = JobCancelled
+		}
+		job.NextRunAt = time.Now().Add(jobBackoff(1))
+		r.store.UpdateJob(&job.Job)
+		return
+	}
+	defer unlock()
+
+	job.Status = JobRunning
+	job.Attempts++
+	r.store.UpdateJob(&job.Job)
+
+	p := r.snapshot()
+	stats := &ProjectStats{RunID: r.stats.RunID, ProjectID: p.ProjectID, Name: p.Name}
+	var err error
+	if job.load != nil {
+		if err = job.load(ctx); err != nil {
+			stats.Failed++
+		}
+	}
+	if err == nil {
+		err = countUpload(r.store, &p, stats, job.PageID, job.title, func() error {
+			return reupload(r.store, job.PageID, r.recreate, func() error {
+				return job.upload(ctx, r.store, &p)
+			})
+		})
+	}
+	r.merge(&p, stats)
+
+	switch {
+	case err == nil:
+		job.Status, job.LastError = JobDone, ""
+	case errors.Is(err, context.Canceled):
+		job.Status, job.LastError = JobCancelled, err.Error()
+	case job.Attempts >= MaxJobAttempts:
+		job.Status, job.LastError = JobFailed, err.Error()
+	default:
+		job.Status, job.LastError = JobPending, err.Error()
+		job.NextRunAt = time.Now().Add(jobBackoff(job.Attempts))
+	}
+	if err := r.store.UpdateJob(&job.Job); err != nil {
+		slog.Error("error while saving job: " + err.Error())
+	}
+
+	if err != nil {
+		r.store.SaveError(Error{
+			err:        err,
+			table_type: TableType(job.Type),
+			project:    p,
+			id:         job.PageID,
+		})
+	}
+}
+
+// ProcessJobs retries the jobs that are due: failed uploads and uploads interrupted by a restart.
+// The pages are fetched again, so the latest version is uploaded. The sync cursors are left as they are.
+// It doesn't run alongside a sync, ErrSyncRunning is returned while one is running.
+// Jobs of paused projects are cancelled.
+func ProcessJobs(ctx context.Context, store Storage) error {
+	ctx, unlock, err := lockRunner(ctx, WorkJobs)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	due, err := store.GetDueJobs(time.Now(), 100)
+	if err != nil || len(due) == 0 {
+		return err
+	}
+	projects, err := store.GetProjects()
+	if err != nil {
+		return err
+	}
+
+	byProject := map[string][]*pageJob{}
+	for _, job := range due {
+		job := &pageJob{Job: job}
+		switch job.Type {
+		case string(TaskTable):
+			job.load = func(ctx context.Context) error {
+				task, err := GetTask(ctx, job.PageID)
+				if err != nil {
+					return err
+				}
+				job.title, job.upload = task.Raw.title(), task.Upload
+				return nil
+			}
+		case string(TimeTable):
+			job.load = func(ctx context.Context) error {
+				time, err := GetTime(ctx, job.PageID)
+				if err != nil {
+					return err
+				}
+				job.title, job.upload = time.Raw.title(), time.Upload
+				return nil
+			}
+		default:
+			continue
+		}
+		byProject[job.ProjectID] = append(byProject[job.ProjectID], job)
+	}
+
+	ctx = withWorkerCache(ctx)
+	for _, project := range projects {
+		jobs := byProject[project.ProjectID]
+		delete(byProject, project.ProjectID)
+		if len(jobs) == 0 {
+			continue
+		}
+		if project.Paused {
+			cancelJobs(store, jobs, ErrProjectPaused)
+			continue
+		}
+		r := &projectRun{
+			store:      store,
+			project:    &project,
+			stats:      &ProjectStats{ProjectID: project.ProjectID, Name: project.Name},
+			conflicted: conflictedPages(store, &project),
+		}
+		// Tasks are retried before time rows, which relate to them.
+		for _, typ := range []TableType{TaskTable, TimeTable} {
+			batch := []*pageJob{}
+			for _, job := range jobs {
+				if job.Type == string(typ) {
+					batch = append(batch, job)
+				}
+			}
+			if len(batch) == 0 {
+				continue
+			}
+			project.Schema, _ = GetSchema(ctx, dbOf(&project, typ))
+			retryJobs(ctx, r, batch)
+		}
+	}
+
+	// Jobs of removed projects can't run anymore.
+	for _, jobs := range byProject {
+		cancelJobs(store, jobs, ErrProjectNotFound)
+	}
+	return ctx.Err()
+}
+
+// cancelJobs cancels the saved jobs with the reason.
+func cancelJobs(store Storage, jobs []*pageJob, reason error) {
+	for _, job := range jobs {
+		job.Status, job.LastError = JobCancelled, reason.Error()
+		if err := store.UpdateJob(&job.Job); err != nil {
+			slog.Error("error while saving job: " + err.Error())
+		}
+	}
+}
+
+// retryJobs runs saved jobs with the worker pool.
+func retryJobs(ctx context.Context, r *projectRun, jobs []*pageJob) {
+	workers := make(chan struct{}, jobWorkers)
+	var wg sync.WaitGroup
+	for _, job := range jobs {
+		select {
+		case workers <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-workers }()
+			runJob(ctx, r, job)
+		}()
+	}
+	wg.Wait()
+}
+
+func dbOf(project *project.Project, typ TableType) string {
+	if typ == TimeTable {
+		return project.TimeDBID
+	}
+	return project.TasksDBID
+}
+
+// RecoverJobs makes the jobs left running by a restart pending again, so that ProcessJobs retries them.
+// It must be called on startup, before any sync.
+func RecoverJobs(store Storage) error {
+	return store.ResetRunningJobs()
+}
+
+// pageLockTimeout is how long an upload waits for another upload of the same page.
+var pageLockTimeout = time.Minute
+
+// pageLocks keeps one upload of a page at a time, e.g. a worker uploading a parent task
+// and another one uploading it first for its subtask.
+var pageLocks = struct {
+	mu    sync.Mutex
+	locks map[string]chan struct{}
+}{locks: map[string]chan struct{}{}}
+
+// lockPage waits for other uploads of the page and returns the function releasing it.
+// It gives up after pageLockTimeout, which also breaks waits of pages depending on each other.
+func lockPage(ctx context.Context, pageID string) (func(), bool) {
+	key := normalizeID(pageID)
+	pageLocks.mu.Lock()
+	lock, ok := pageLocks.locks[key]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		pageLocks.locks[key] = lock
+	}
+	pageLocks.mu.Unlock()
+
+	timer := time.NewTimer(pageLockTimeout)
+	defer timer.Stop()
+	select {
+	case lock <- struct{}{}:
+		return func() { <-lock }, true
+	case <-timer.C:
+		return nil, false
+	case <-ctx.Done():
+		return nil, false
+	}
+}
+
+// uploadRelated uploads a related task that isn't copied yet and returns the ID of its copy.
+// Workers uploading subtasks of the same parent wait for each other, so the parent is copied once.
+func uploadRelated(ctx context.Context, store Storage, project *project.Project, task *Task) (string, error) {
+	unlock, ok := lockPage(ctx, task.ID)
+	if !ok {
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		return "", ErrPageLocked
+	}
+	defer unlock()
+
+	if clientID, err := store.GetClientID(task.ID); err == nil {
+		return clientID, nil
+	}
+	if err := task.Upload(ctx, store, project); err != nil {
+		return "", err
+	}
+	return store.GetClientID(task.ID)
+}
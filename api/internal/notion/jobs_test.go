@@ -0,0 +1,190 @@
+package notion_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Corray333/notion-manager/internal/notion"
+)
+
+func TestSyncRecordsJobs(t *testing.T) {
+	e := newEnv(t)
+	parent := e.addTask("Parent", internalProject, "")
+	e.addTask("Child", internalProject, parent)
+	e.addTask("Other", internalProject, "")
+
+	if err := notion.Sync(context.Background(), e.store, notion.SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := e.store.GetJobs(notion.JobDone, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 3 {
+		t.Fatalf("expected 3 done jobs, got %d", len(jobs))
+	}
+	if pages := e.fake.Pages(clientTasksDB); len(pages) != 3 {
+		t.Fatalf("expected 3 client tasks, got %d", len(pages))
+	}
+}
+
+func TestProcessJobsRetriesFailedUploads(t *testing.T) {
+	e := newEnv(t)
+	if err := notion.Sync(context.Background(), e.store, notion.SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	projects, err := e.store.GetProjects()
+	if err != nil || len(projects) != 1 {
+		t.Fatalf("expected the project to be saved, got %v %v", projects, err)
+	}
+
+	task := e.addTask("Task", internalProject, "")
+	job := &notion.Job{
+		ProjectID: projects[0].ProjectID,
+		PageID:    task,
+		Type:      "task",
+		Status:    notion.JobPending,
+		NextRunAt: time.Now(),
+	}
+	if err := e.store.NewJob(job); err != nil {
+		t.Fatal(err)
+	}
+
+	// The schema and the page can't be read.
+	e.fake.FailNext(2, http.StatusBadRequest, 0)
+	if err := notion.ProcessJobs(context.Background(), e.store); err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := e.store.GetJobs(notion.JobPending, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].Attempts != 1 || jobs[0].LastError == "" || !jobs[0].NextRunAt.After(time.Now()) {
+		t.Fatalf("expected the job to wait for a retry, got %+v", jobs)
+	}
+	if _, err := e.store.GetClientID(task); err == nil {
+		t.Fatal("expected the task not to be copied")
+	}
+
+	// Not due yet.
+	if err := notion.ProcessJobs(context.Background(), e.store); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.store.GetClientID(task); err == nil {
+		t.Fatal("expected the retry to wait for its time")
+	}
+
+	jobs[0].NextRunAt = time.Now().Add(-time.Second)
+	if err := e.store.UpdateJob(&jobs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := notion.ProcessJobs(context.Background(), e.store); err != nil {
+		t.Fatal(err)
+	}
+	e.clientID(t, task)
+	jobs, err = e.store.GetJobs(notion.JobDone, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].Attempts != 2 || jobs[0].LastError != "" {
+		t.Fatalf("expected the job to be done on the second attempt, got %+v", jobs)
+	}
+	retried, err := e.store.GetProjects()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if retried[0].TasksLastSynced != projects[0].TasksLastSynced {
+		t.Errorf("expected the retry to leave the tasks cursor at %d, got %d", projects[0].TasksLastSynced, retried[0].TasksLastSynced)
+	}
+}
+
+func TestRecoverJobs(t *testing.T) {
+	e := newEnv(t)
+	job := &notion.Job{ProjectID: "project", PageID: "page", Type: "task", Status: notion.JobPending, NextRunAt: time.Now()}
+	if err := e.store.NewJob(job); err != nil {
+		t.Fatal(err)
+	}
+	job.Status = notion.JobRunning
+	if err := e.store.UpdateJob(job); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := notion.RecoverJobs(e.store); err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := e.store.GetJobs(notion.JobPending, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != job.ID {
+		t.Fatalf("expected the running job to be pending again, got %+v", jobs)
+	}
+}
+
+func TestProcessJobsCancelsConflictedPages(t *testing.T) {
+	e := newEnv(t)
+	e.twoWay(t, notion.ConflictFlag)
+	task := e.addTask("Task", internalProject, "")
+	e.sync(t)
+
+	clientTask := e.clientID(t, task)
+	setStatus(e, task, "Готово")
+	setStatus(e, clientTask, "На проверке")
+	e.sync(t)
+
+	projects, err := e.store.GetProjects()
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := &notion.Job{ProjectID: projects[0].ProjectID, PageID: task, Type: "task", Status: notion.JobPending, NextRunAt: time.Now()}
+	if err := e.store.NewJob(job); err != nil {
+		t.Fatal(err)
+	}
+	if err := notion.ProcessJobs(context.Background(), e.store); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := e.store.GetJobs(notion.JobCancelled, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != job.ID || jobs[0].LastError != notion.ErrPageConflicted.Error() {
+		t.Fatalf("expected the job to be cancelled, got %+v", jobs)
+	}
+	if page, _ := e.fake.Page(clientTask); statusOf(page) != "На проверке" {
+		t.Errorf("flagged page was uploaded, client status %q", statusOf(page))
+	}
+}
+
+func TestProcessJobsCancelsJobsOfPausedProjects(t *testing.T) {
+	e := newEnv(t)
+	e.sync(t)
+	e.pause(t)
+
+	task := e.addTask("Task", internalProject, "")
+	projects, err := e.store.GetProjects()
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := &notion.Job{ProjectID: projects[0].ProjectID, PageID: task, Type: "task", Status: notion.JobPending, NextRunAt: time.Now()}
+	if err := e.store.NewJob(job); err != nil {
+		t.Fatal(err)
+	}
+	if err := notion.ProcessJobs(context.Background(), e.store); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := e.store.GetJobs(notion.JobCancelled, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].LastError != notion.ErrProjectPaused.Error() {
+		t.Fatalf("expected the job to be cancelled, got %+v", jobs)
+	}
+	if _, err := e.store.GetClientID(task); err == nil {
+		t.Error("page of a paused project was copied")
+	}
+}
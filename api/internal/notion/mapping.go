@@ -0,0 +1,446 @@
+package notion
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/Corray333/notion-manager/internal/project"
+	"github.com/spf13/viper"
+)
+
+// Target types of a property mapping. Besides the Notion property types there are
+// three conversions specific to client dashboards:
+//   - relation: related internal pages are replaced with their client copies from the ids table;
+//   - worker: people are replaced with their rows in the client "Ставки" database;
+//   - project: a relation to the client project page, the source property is ignored.
+const (
+	MapTitle       = "title"
+	MapRichText    = "rich_text"
+	MapNumber      = "number"
+	MapSelect      = "select"
+	MapStatus      = "status"
+	MapMultiSelect = "multi_select"
+	MapDate        = "date"
+	MapCheckbox    = "checkbox"
+	MapURL         = "url"
+	MapRelation    = "relation"
+	MapWorker      = "worker"
+	MapProject     = "project"
+)
+
+// What to do with a related page that has no client copy yet.
+const (
+	MissingSkip   = "skip"   // drop it from the relation
+	MissingError  = "error"  // fail the page
+	MissingUpload = "upload" // upload the related task first
+)
+
+// Direction of a property mapping.
+const (
+	DirectionPush = "push" // internal to client only
+	DirectionBoth = "both" // client edits are also copied back, see PullClientChanges
+)
+
+// How PullClientChanges resolves a property edited on both sides since the last pull.
+const (
+	ConflictLastWriterWins = "last_writer_wins" // the page edited last wins
+	ConflictInternalWins   = "internal_wins"    // the client edit is discarded
+	ConflictFlag           = "flag"             // both are kept and the page is saved to to_be_updated
+)
+
+// PropertyMapping copies one property of an internal page to a property of its client copy.
+type PropertyMapping struct {
+	Source string `mapstructure:"source"` // property in the internal database
+	Target string `mapstructure:"target"` // property in the client database
+	Type   string `mapstructure:"type"`   // type of the target property, one of Map* constants
+	// Default is written when the source property is empty. Without it empty properties are not sent.
+	Default interface{} `mapstructure:"default"`
+	// Values renames select, status and text values, e.g. {"Высокий": "High"}. Keys are case-insensitive.
+	Values map[string]string `mapstructure:"values"`
+	// Transform is applied to text values in order: trim, upper, lower.
+	Transform []string `mapstructure:"transform"`
+	// Required fails the page when the source property is empty.
+	Required bool `mapstructure:"required"`
+	// Missing is one of Missing* constants, used by relation mappings. Defaults to MissingSkip.
+	Missing string `mapstructure:"missing"`
+	// Direction is one of Direction* constants. Defaults to DirectionPush.
+	// Two-way properties must have the same type in both databases.
+	Direction string `mapstructure:"direction"`
+}
+
+// Mapping lists the properties copied for tasks and time rows.
+type Mapping struct {
+	Task []PropertyMapping `mapstructure:"task"`
+	Time []PropertyMapping `mapstructure:"time"`
+	// TwoWay enables copying client edits of DirectionBoth properties back to the internal databases.
+	TwoWay bool `mapstructure:"two_way"`
+	// Conflict is one of Conflict* constants. Defaults to ConflictLastWriterWins.
+	Conflict string `mapstructure:"conflict"`
+	// Content configures copying the body of tasks, nil doesn't copy it.
+	Content *ContentMapping `mapstructure:"content"`
+	// Comments mirrors comments of tasks between the internal page and its client copy, see syncComments.
+	Comments bool `mapstructure:"comments"`
+}
+
+// ProjectMapping overrides the default mapping for a project. Fields left unset keep the default,
+// so two_way and comments can be turned off for a project as well as on.
+type ProjectMapping struct {
+	Task     []PropertyMapping `mapstructure:"task"`
+	Time     []PropertyMapping `mapstructure:"time"`
+	TwoWay   *bool             `mapstructure:"two_way"`
+	Conflict string            `mapstructure:"conflict"`
+	Content  *ContentMapping   `mapstructure:"content"`
+	Comments *bool             `mapstructure:"comments"`
+}
+
+// MappingConfig is the default mapping and the per-project overrides keyed by client project ID.
+// A project override replaces the whole task or time list it defines.
+type MappingConfig struct {
+	Default  Mapping                   `mapstructure:"default"`
+	Projects map[string]ProjectMapping `mapstructure:"projects"`
+}
+
+// DefaultMapping reproduces the layout of the standard client dashboard.
+var DefaultMapping = Mapping{
+	Task: []PropertyMapping{
+		{Source: "Task", Target: "Name", Type: MapTitle},
+		{Target: "Проект", Type: MapProject},
+		{Source: "Оценка", Target: "Оценка", Type: MapNumber},
+		{Source: "Статус", Target: "Статус", Type: MapStatus},
+		{Source: "Приоритет", Target: "Приоритет", Type: MapSelect},
+		{Source: "Родительская задача", Target: "Родительская задача", Type: MapRelation, Missing: MissingUpload},
+		{Source: "Подзадачи", Target: "Подзадачи", Type: MapRelation},
+		{Source: "Дедлайн", Target: "Дедлайн", Type: MapDate},
+		{Source: "Исполнитель", Target: "Исполнитель", Type: MapWorker},
+	},
+	Time: []PropertyMapping{
+		{Source: "Всего ч", Target: "Всего ч", Type: MapNumber},
+		{Source: "Задача", Target: "Задача", Type: MapRelation, Required: true, Missing: MissingError},
+		{Source: "Что делали", Target: "Name", Type: MapTitle},
+	},
+}
+
+var mappings = MappingConfig{Default: DefaultMapping}
+
+// SetMappings replaces the mapping configuration used by the package.
+func SetMappings(cfg MappingConfig) {
+	if len(cfg.Default.Task) == 0 {
+		cfg.Default.Task = DefaultMapping.Task
+	}
+	if len(cfg.Default.Time) == 0 {
+		cfg.Default.Time = DefaultMapping.Time
+	}
+	projects := map[string]ProjectMapping{}
+	for id, m := range cfg.Projects {
+		projects[normalizeID(id)] = m
+	}
+	cfg.Projects = projects
+	mappings = cfg
+}
+
+// LoadMappings reads the mapping configuration from a YAML file.
+// A missing file is not an error: the default mapping is used.
+func LoadMappings(path string) error {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		slog.Info("no mapping config found, using the default mapping")
+		SetMappings(MappingConfig{})
+		return nil
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return err
+	}
+	cfg := MappingConfig{}
+	if err := v.Unmarshal(&cfg); err != nil {
+		return err
+	}
+	overrides := []ProjectMapping{{Task: cfg.Default.Task, Time: cfg.Default.Time, Conflict: cfg.Default.Conflict}}
+	for _, m := range append(overrides, mapValues(cfg.Projects)...) {
+		if err := validateMappings(append(m.Task, m.Time...)); err != nil {
+			return err
+		}
+		switch m.Conflict {
+		case "", ConflictLastWriterWins, ConflictInternalWins, ConflictFlag:
+		default:
+			return fmt.Errorf("unknown conflict policy %q", m.Conflict)
+		}
+	}
+	SetMappings(cfg)
+	return nil
+}
+
+// MappingFor returns the mapping of a project.
+func MappingFor(project *project.Project) Mapping {
+	m := mappings.Default
+	if override, ok := mappings.Projects[normalizeID(project.ProjectID)]; ok {
+		if len(override.Task) > 0 {
+			m.Task = override.Task
+		}
+		if len(override.Time) > 0 {
+			m.Time = override.Time
+		}
+		if override.TwoWay != nil {
+			m.TwoWay = *override.TwoWay
+		}
+		if override.Comments != nil {
+			m.Comments = *override.Comments
+		}
+		if override.Conflict != "" {
+			m.Conflict = override.Conflict
+		}
+		if override.Content != nil {
+			m.Content = override.Content
+		}
+	}
+	if m.Conflict == "" {
+		m.Conflict = ConflictLastWriterWins
+	}
+	return m
+}
+
+func validateMappings(rules []PropertyMapping) error {
+	for _, rule := range rules {
+		if rule.Target == "" {
+			return fmt.Errorf("mapping of %q has no target", rule.Source)
+		}
+		if rule.Source == "" && rule.Type != MapProject {
+			return fmt.Errorf("mapping to %q has no source", rule.Target)
+		}
+		switch rule.Type {
+		case MapTitle, MapRichText, MapNumber, MapSelect, MapStatus, MapMultiSelect, MapDate, MapCheckbox, MapURL, MapRelation, MapWorker, MapProject:
+		default:
+			return fmt.Errorf("mapping to %q has unknown type %q", rule.Target, rule.Type)
+		}
+		switch rule.Missing {
+		case "", MissingSkip, MissingError, MissingUpload:
+		default:
+			return fmt.Errorf("mapping to %q has unknown missing policy %q", rule.Target, rule.Missing)
+		}
+		switch rule.Direction {
+		case "", DirectionPush:
+		case DirectionBoth:
+			if rule.Type == MapWorker || rule.Type == MapProject {
+				return fmt.Errorf("mapping to %q of type %q can't be two-way", rule.Target, rule.Type)
+			}
+		default:
+			return fmt.Errorf("mapping to %q has unknown direction %q", rule.Target, rule.Direction)
+		}
+	}
+	return nil
+}
+
+// buildProperties converts the properties of internal page pageID into a client page request.
+// Properties absent from the client database schema are skipped, except the title.
+func buildProperties(ctx context.Context, store Storage, project *project.Project, rules []PropertyMapping, pageID string, props Properties) (map[string]interface{}, error) {
+	req := map[string]interface{}{}
+	for _, rule := range rules {
+		if rule.Type != MapTitle && len(project.Schema) > 0 && !slices.Contains(project.Schema, rule.Target) {
+			continue
+		}
+
+		value, err := rule.convert(ctx, store, project, pageID, props)
+		if err != nil {
+			return req, err
+		}
+		if value == nil {
+			if rule.Required {
+				return req, fmt.Errorf("%s is empty, page_id = %s", rule.Source, pageID)
+			}
+			continue
+		}
+		req[rule.Target] = value
+	}
+	return req, nil
+}
+
+// convert returns the request value of the target property or nil if there is nothing to write.
+func (m PropertyMapping) convert(ctx context.Context, store Storage, project *project.Project, pageID string, props Properties) (interface{}, error) {
+	prop := props[m.Source]
+	if m.Type == MapProject {
+		return relationValue([]string{project.ProjectID}), nil
+	}
+	if m.Default != nil && isEmpty(prop) {
+		prop = propertyFromDefault(m.Default)
+	}
+
+	switch m.Type {
+	case MapTitle, MapRichText:
+		text := m.text(prop.Text())
+		if text == "" {
+			return nil, nil
+		}
+		return textValue(m.Type, text), nil
+	case MapNumber:
+		if n, ok := prop.NumberValue(); ok {
+			return map[string]interface{}{"number": n}, nil
+		}
+	case MapSelect, MapStatus:
+		if name := m.text(prop.Text()); name != "" {
+			return map[string]interface{}{m.Type: map[string]interface{}{"name": name}}, nil
+		}
+	case MapMultiSelect:
+		options := []map[string]interface{}{}
+		for _, o := range prop.MultiSelect {
+			options = append(options, map[string]interface{}{"name": m.text(o.Name)})
+		}
+		if len(options) == 0 && prop.Select != nil {
+			options = append(options, map[string]interface{}{"name": m.text(prop.Select.Name)})
+		}
+		if len(options) > 0 {
+			return map[string]interface{}{"multi_select": options}, nil
+		}
+	case MapDate:
+		if date := prop.DateValue(); date != nil {
+			value := map[string]interface{}{"start": date.Start}
+			if date.End != nil {
+				value["end"] = date.End
+			}
+			return map[string]interface{}{"date": value}, nil
+		}
+	case MapCheckbox:
+		if b, ok := prop.BoolValue(); ok {
+			return map[string]interface{}{"checkbox": b}, nil
+		}
+	case MapURL:
+		if url := m.text(prop.Text()); url != "" {
+			return map[string]interface{}{"url": url}, nil
+		}
+	case MapRelation:
+		return m.relation(ctx, store, project, pageID, prop)
+	case MapWorker:
+		ids, err := clientWorkers(ctx, project, prop.People, props[workerDirection].Text())
+		if err != nil || len(ids) == 0 {
+			return nil, err
+		}
+		return relationValue(ids), nil
+	}
+	return nil, nil
+}
+
+// relation replaces related internal pages with their client copies.
+func (m PropertyMapping) relation(ctx context.Context, store Storage, project *project.Project, pageID string, prop Property) (interface{}, error) {
+	ids := []string{}
+	for _, rel := range prop.Relation {
+		if rel.ID == pageID {
+			continue
+		}
+		clientID, err := store.GetClientID(rel.ID)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, err
+		}
+		if err == sql.ErrNoRows {
+			switch m.Missing {
+			case MissingError:
+				return nil, fmt.Errorf("%s %s is not copied yet: %w", m.Source, rel.ID, err)
+			case MissingUpload:
+				// The related task is waiting for this one, e.g. parent tasks forming a cycle.
+				if isUploading(ctx, rel.ID) {
+					continue
+				}
+				task, err := GetTask(ctx, rel.ID)
+				if err != nil {
+					return nil, err
+				}
+				if task.Archived || task.InTrash {
+					continue
+				}
+				if clientID, err = uploadRelated(withUploading(ctx, pageID), store, project, task); err != nil {
+					return nil, err
+				}
+			default:
+				continue
+			}
+		}
+		ids = append(ids, clientID)
+	}
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	return relationValue(ids), nil
+}
+
+func (m PropertyMapping) text(s string) string {
+	for _, t := range m.Transform {
+		switch t {
+		case "trim":
+			s = strings.TrimSpace(s)
+		case "upper":
+			s = strings.ToUpper(s)
+		case "lower":
+			s = strings.ToLower(s)
+		}
+	}
+	for from, to := range m.Values {
+		if strings.EqualFold(from, s) {
+			return to
+		}
+	}
+	return s
+}
+
+// textValue is a title or rich_text request value. An empty text clears the property.
+func textValue(typ string, text string) map[string]interface{} {
+	items := []map[string]interface{}{}
+	if text != "" {
+		items = append(items, map[string]interface{}{
+			"type": "text",
+			"text": map[string]interface{}{
+				"content": text,
+			},
+		})
+	}
+	value := map[string]interface{}{typ: items}
+	if typ == MapTitle {
+		value["type"] = "title"
+	}
+	return value
+}
+
+func relationValue(ids []string) map[string]interface{} {
+	relation := []map[string]interface{}{}
+	for _, id := range ids {
+		relation = append(relation, map[string]interface{}{"id": id})
+	}
+	return map[string]interface{}{"relation": relation}
+}
+
+func isEmpty(p Property) bool {
+	_, hasNumber := p.NumberValue()
+	_, hasBool := p.BoolValue()
+	return p.Text() == "" && !hasNumber && !hasBool && p.DateValue() == nil && len(p.People) == 0 && len(p.Relation) == 0
+}
+
+func propertyFromDefault(def interface{}) Property {
+	switch v := def.(type) {
+	case string:
+		return Property{RichText: []RichText{{PlainText: v}}, Select: &SelectOption{Name: v}, Date: &DateValue{Start: v}}
+	case int:
+		n := float64(v)
+		return Property{Number: &n}
+	case float64:
+		return Property{Number: &v}
+	case bool:
+		return Property{Checkbox: &v}
+	}
+	return Property{}
+}
+
+func normalizeID(id string) string {
+	return strings.ToLower(strings.ReplaceAll(id, "-", ""))
+}
+
+func mapValues[T any](m map[string]T) []T {
+	res := []T{}
+	for _, v := range m {
+		res = append(res, v)
+	}
+	return res
+}
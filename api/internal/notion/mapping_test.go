@@ -0,0 +1,132 @@
+package notion_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Corray333/notion-manager/internal/notion"
+	"github.com/Corray333/notion-manager/internal/project"
+)
+
+func TestSyncUsesProjectMapping(t *testing.T) {
+	e := newEnv(t)
+	e.fake.AddProperty(clientTasksDB, "Priority", "select")
+	e.fake.AddProperty(clientTasksDB, "Tags", "multi_select")
+	e.fake.AddProperty(clientTasksDB, "Due", "date")
+
+	notion.SetMappings(notion.MappingConfig{Projects: map[string]notion.ProjectMapping{
+		e.clientProject: {Task: []notion.PropertyMapping{
+			{Source: "Task", Target: "Name", Type: notion.MapTitle, Transform: []string{"trim", "upper"}},
+			{Source: "Приоритет", Target: "Priority", Type: notion.MapSelect, Values: map[string]string{"высокий": "High"}},
+			{Source: "Теги", Target: "Tags", Type: notion.MapMultiSelect, Default: "General"},
+			{Source: "Дедлайн", Target: "Due", Type: notion.MapDate},
+		}},
+	}})
+	t.Cleanup(func() { notion.SetMappings(notion.MappingConfig{}) })
+
+	task := e.addTask("  English  ", internalProject, "")
+	if err := notion.Sync(context.Background(), e.store, notion.SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	page, _ := e.fake.Page(e.clientID(t, task))
+	if got := titleOf(page, "Name"); got != "ENGLISH" {
+		t.Errorf("title = %q, want ENGLISH", got)
+	}
+	if got := page.Properties["Priority"].(map[string]interface{})["select"].(map[string]interface{})["name"]; got != "High" {
+		t.Errorf("priority = %v, want High", got)
+	}
+	tags := page.Properties["Tags"].(map[string]interface{})["multi_select"].([]interface{})
+	if len(tags) != 1 || tags[0].(map[string]interface{})["name"] != "General" {
+		t.Errorf("tags = %v, want the default", tags)
+	}
+	if got := page.Properties["Due"].(map[string]interface{})["date"].(map[string]interface{})["start"]; got != "2024-07-01" {
+		t.Errorf("due = %v, want 2024-07-01", got)
+	}
+	if _, ok := page.Properties["Статус"]; ok {
+		t.Error("status is not mapped for the project but was copied")
+	}
+}
+
+func TestRequiredMappingFailsPage(t *testing.T) {
+	e := newEnv(t)
+	timeID := e.fake.AddPage(timesDB, map[string]interface{}{
+		"Что делали": title("No task"),
+		"Всего ч":    map[string]interface{}{"number": 1},
+	})
+
+	time, err := notion.GetTime(context.Background(), timeID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	projects := notion.LoadProjects(context.Background())
+	if err := time.Upload(context.Background(), e.store, projects[0]); err == nil {
+		t.Fatal("expected an error for a time row without a task")
+	}
+	if pages := e.fake.Pages(clientTimesDB); len(pages) != 0 {
+		t.Errorf("expected no client time rows, got %d", len(pages))
+	}
+}
+
+func TestLoadMappings(t *testing.T) {
+	t.Cleanup(func() { notion.SetMappings(notion.MappingConfig{}) })
+
+	path := filepath.Join(t.TempDir(), "mappings.yml")
+	yml := `
+projects:
+  1f92aa7a-0095-4137-b881-17d0c8330b50:
+    time:
+      - { source: Что делали, target: Description, type: rich_text }
+      - { source: Всего ч, target: Hours, type: number, default: 0 }
+`
+	if err := os.WriteFile(path, []byte(yml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := notion.LoadMappings(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(path, []byte("projects:\n  x:\n    task:\n      - { source: A, target: B, type: formula }\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := notion.LoadMappings(path); err == nil {
+		t.Error("expected an error for an unknown mapping type")
+	}
+
+	if err := notion.LoadMappings(filepath.Join(t.TempDir(), "missing.yml")); err != nil {
+		t.Errorf("a missing config should fall back to the default mapping, got %v", err)
+	}
+}
+
+func TestProjectMappingTurnsOffDefaults(t *testing.T) {
+	t.Cleanup(func() { notion.SetMappings(notion.MappingConfig{}) })
+
+	path := filepath.Join(t.TempDir(), "mappings.yml")
+	yml := `
+default:
+  two_way: true
+  comments: true
+projects:
+  off-project:
+    two_way: false
+  other-project:
+    conflict: flag
+`
+	if err := os.WriteFile(path, []byte(yml), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := notion.LoadMappings(path); err != nil {
+		t.Fatal(err)
+	}
+
+	off := notion.MappingFor(&project.Project{ProjectID: "off-project"})
+	if off.TwoWay || !off.Comments {
+		t.Errorf("expected two_way off and comments kept, got two_way %v comments %v", off.TwoWay, off.Comments)
+	}
+	other := notion.MappingFor(&project.Project{ProjectID: "other-project"})
+	if !other.TwoWay || !other.Comments || other.Conflict != notion.ConflictFlag {
+		t.Errorf("expected the defaults with the flag policy, got %+v", other)
+	}
+}
@@ -1,20 +1,20 @@
 package notion
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log/slog"
 	"os"
 
 	"github.com/Corray333/notion-manager/internal/mindmap"
-	"github.com/Corray333/notion-manager/pkg/notion"
 )
 
 type PageCreated struct {
 	ID string `json:"id"`
 }
 
-func CreateMindmapTask(projectID string, task *mindmap.Task, parentID string, level int) error {
+func CreateMindmapTask(ctx context.Context, projectID string, task *mindmap.Task, parentID string, level int) error {
 	fmt.Printf("Creating task: %s\n", task.Title)
 
 	// Основная структура для страницы задачи
@@ -62,7 +62,7 @@ func CreateMindmapTask(projectID string, task *mindmap.Task, parentID string, le
 	}
 
 	// Создаем страницу задачи в Notion
-	resp, err := notion.CreatePage(os.Getenv("TASKS_DB"), req, content, "")
+	resp, err := client.CreatePage(ctx, os.Getenv("TASKS_DB"), req, content, "")
 	if err != nil {
 		slog.Error("Notion error while creating task: " + err.Error())
 		return err
@@ -77,7 +77,7 @@ func CreateMindmapTask(projectID string, task *mindmap.Task, parentID string, le
 	if level == 0 {
 		// Рекурсивно создаем подзадачи
 		for _, subtask := range task.Subtasks {
-			if err := CreateMindmapTask(projectID, &subtask, page.ID, level+1); err != nil {
+			if err := CreateMindmapTask(ctx, projectID, &subtask, page.ID, level+1); err != nil {
 				return err
 			}
 		}
@@ -110,7 +110,7 @@ func CreateCheckboxes(tasks []mindmap.Task) []map[string]interface{} {
 	return content
 }
 
-func CreateMindmapTasks(projectName string, tasks []mindmap.Task) error {
+func CreateMindmapTasks(ctx context.Context, projectName string, tasks []mindmap.Task) error {
 	fmt.Println("Creating tasks for project:", projectName)
 
 	fmt.Println(projectName)
@@ -123,7 +123,7 @@ func CreateMindmapTasks(projectName string, tasks []mindmap.Task) error {
 			},
 		},
 	}
-	projectsResp, err := notion.SearchPages(os.Getenv("PROJECTS_DB"), projectFilter)
+	projectsResp, err := client.SearchPages(ctx, os.Getenv("PROJECTS_DB"), projectFilter)
 	if err != nil {
 		slog.Error("Notion error while searching projects: " + err.Error())
 		return err
@@ -143,7 +143,7 @@ func CreateMindmapTasks(projectName string, tasks []mindmap.Task) error {
 
 	// Создаем задачи для проекта
 	for _, task := range tasks {
-		if err := CreateMindmapTask(projectID, &task, "", 0); err != nil {
+		if err := CreateMindmapTask(ctx, projectID, &task, "", 0); err != nil {
 			return err
 		}
 	}
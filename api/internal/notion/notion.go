@@ -1,15 +1,17 @@
 package notion
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"net/http"
+	"log/slog"
 	"os"
+	"slices"
+	"time"
 
 	"github.com/Corray333/notion-manager/internal/project"
+	"github.com/Corray333/notion-manager/pkg/notion"
 )
 
 const TIME_LAYOUT = "2006-01-02T15:04:05.000-07:00"
@@ -17,7 +19,14 @@ const TIME_LAYOUT_IN = "2006-01-02T15:04:05.999Z07:00"
 
 type TableType string
 
-var IsSyncing = false
+// client is the Notion API client used by the whole package.
+var client = notion.NewClient("")
+
+// SetClient replaces the Notion API client used by the package.
+// It must be called once the environment is loaded, before any sync is started.
+func SetClient(c *notion.Client) {
+	client = c
+}
 
 const (
 	TimeTable    TableType = "time"
@@ -30,6 +39,8 @@ type Error struct {
 	project    project.Project
 	table_type TableType
 	id         string
+	severity   string
+	runID      int64
 }
 
 func (e Error) String() string {
@@ -43,347 +54,404 @@ func (err Error) Unpack() (string, string, string, string) {
 		err.id
 }
 
+// Severity returns one of Severity* constants, SeverityError by default.
+func (err Error) Severity() string {
+	if err.severity == "" {
+		return SeverityError
+	}
+	return err.severity
+}
+
+// RunID returns the ID of the run the error happened in, 0 outside of a run.
+func (err Error) RunID() int64 {
+	return err.runID
+}
+
 // Task
 type Storage interface {
 	NewProject(proj *project.Project) error
 	GetProjects() ([]project.Project, error)
 	SetLastSynced(project *project.Project) error
+	SetClientLastSynced(projectID string, clientLastSynced int64) error
 	GetClientID(internalID string) (string, error)
 	GetInternalID(clientID string) (string, error)
 	SetClientID(internalID, clientID string) error
+	GetClientIDs() (map[string]string, error)
+	RemoveClientID(internalID string) error
+	GetContentHash(internalID string) (string, error)
+	SetContentHash(internalID, hash string) error
+	SaveCommentLink(link CommentLink) error
+	GetCommentLinks(pageID string) ([]CommentLink, error)
 	SaveRowsToBeUpdated(Validation)
 	GetRowsToBeUpdated() ([]Validation, error)
 	GetRowsToBeUpdatedByProject(projectID string) ([]Validation, error)
 	RemoveRowToBeUpdated(internalID string) error
 	SaveError(errSave Error) error
+	SaveArchivedPage(page ArchivedPage) error
+	GetArchivedPages() ([]ArchivedPage, error)
+	SetArchivedPageRemoved(internalID string) error
+	RemoveArchivedPage(internalID string) error
+	NewSyncRun(run *SyncRun) error
+	FinishSyncRun(run *SyncRun) error
+	InterruptSyncRuns() error
+	SaveSyncRunProject(stats ProjectStats) error
+	SaveSyncRunError(runErr RunError) error
+	GetSyncRun(id int64) (*SyncRun, error)
+	GetSyncRuns(limit int) ([]SyncRun, error)
+	NewJob(job *Job) error
+	UpdateJob(job *Job) error
+	GetDueJobs(now time.Time, limit int) ([]Job, error)
+	ResetRunningJobs() error
 }
 
 type Validation struct {
-	Title      string `json:"title" db:"title"`             // Title of page in database
-	Type       string `json:"type" db:"type"`               // Type of database
-	InternalID string `json:"internal_id" db:"internal_id"` // ID of page in internal dashboard
-	ClientID   string `json:"client_id" db:"client_id"`     // ID of page in client dashboard
-	Errors     string `json:"errors" db:"errors"`           // Errors encountered while validating
-	ProjectID  string `json:"project_id" db:"project_id"`   // ID of project
+	Title       string           `json:"title" db:"title"`                 // Title of page in database
+	Type        string           `json:"type" db:"type"`                   // Type of database
+	InternalID  string           `json:"internal_id" db:"internal_id"`     // ID of page in internal dashboard
+	ClientID    string           `json:"client_id" db:"client_id"`         // ID of page in client dashboard
+	Errors      string           `json:"errors" db:"errors"`               // Errors encountered while validating, joined
+	Issues      ValidationIssues `json:"issues" db:"issues"`               // Failed rules
+	ProjectID   string           `json:"project_id" db:"project_id"`       // ID of project
+	InternalURL string           `json:"internal_url" db:"internal_url"`   // URL of page in internal dashboard
+	ClientURL   string           `json:"client_url" db:"client_url"`       // URL of page in client dashboard, empty if it isn't copied
+	Employee    string           `json:"employee" db:"employee"`           // Names of the people responsible for the page
+	FirstSeenAt time.Time        `json:"first_seen_at" db:"first_seen_at"` // When the page was saved first
+	LastSeenAt  time.Time        `json:"last_seen_at" db:"last_seen_at"`   // When the page was checked last
 }
 
-func StartSync(store Storage) error {
-	if IsSyncing {
-		return errors.New("is already syncing")
-	} else {
-		IsSyncing = true
-	}
+// FixFilter selects rows of to_be_updated. Empty fields match everything.
+type FixFilter struct {
+	ProjectID string
+	Employee  string // one of the names in Validation.Employee
+	Type      string
+}
 
-	go func() {
+// SyncOptions narrows down a sync run.
+type SyncOptions struct {
+	ProjectID string `json:"project_id,omitempty"` // Sync only the client project with this ID
+	PageID    string `json:"page_id,omitempty"`    // Sync only the internal task or time page with this ID
+	// Full ignores TasksLastSynced and TimeLastSynced and copies all pages again,
+	// recreating client copies that were deleted or archived.
+	Full bool `json:"full,omitempty"`
+}
 
-		defer func() {
-			IsSyncing = false
-		}()
+var ErrPageNotSyncable = errors.New("page is not a task or a time row of a synced project")
 
-		for _, proj := range LoadProjects() {
+// syncProjects copies changed pages of the projects selected by opts and records the progress in the run.
+func syncProjects(ctx context.Context, store Storage, run *SyncRun, opts SyncOptions) error {
+	// A page sync uses the saved projects, the crawl of the dashboard would take longer than the upload.
+	if opts.PageID == "" {
+		for _, proj := range LoadProjects(ctx) {
 			store.NewProject(proj)
 		}
+	}
+
+	projects, err := store.GetProjects()
+	if err != nil {
+		return err
+	}
+	if opts.ProjectID != "" {
+		found, err := FindProject(store, opts.ProjectID)
+		if err != nil {
+			return err
+		}
+		projects = []project.Project{*found}
+	}
+	if opts.PageID != "" {
+		return syncPage(ctx, store, run, projects, opts)
+	}
+
+	for _, project := range projects {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if project.Paused && opts.ProjectID == "" {
+			continue
+		}
+		stats := startProject(run, &project)
+
+		// Comments are checked on the client pages edited since the last run, the pull moves the cursor past them.
+		commentsSince := project.ClientLastSynced
+		if opts.Full {
+			commentsSince = 0
+		}
+		if err := PullClientChanges(ctx, store, &project); err != nil {
+			store.SaveError(Error{
+				err:        errors.Join(errors.New("error while pulling client changes: "), err),
+				table_type: ProjectTable,
+				project:    project,
+				severity:   SeverityWarning,
+			})
+		}
+		conflicted := conflictedPages(store, &project)
+
+		since := project
+		if opts.Full {
+			since.TasksLastSynced, since.TimeLastSynced = 0, 0
+		}
 
-		projects, err := store.GetProjects()
+		project.Schema, _ = GetSchema(ctx, project.TasksDBID)
+		tasks, err := GetTasks(ctx, store, since, "")
 		if err != nil {
-			// return err
+			store.SaveError(Error{
+				err:        errors.Join(errors.New("error while getting tasks: "), err),
+				table_type: TaskTable,
+				project:    project,
+				severity:   SeverityCritical,
+			})
+		}
+		// Parents are uploaded before their subtasks, so that the relations can be set right away.
+		tasks, cycles := orderTasks(MappingFor(&project).Task, tasks)
+		for _, cycle := range cycles {
+			store.SaveError(Error{
+				err:        cycleError(cycle),
+				table_type: TaskTable,
+				project:    project,
+				id:         cycle[0].ID,
+			})
+		}
+		synced := []Task{}
+		for _, task := range tasks {
+			if conflicted[task.ID] {
+				stats.Skipped++
+				continue
+			}
+			synced = append(synced, task)
+		}
+		pool := &projectRun{store: store, project: &project, stats: stats, recreate: opts.Full, persist: true}
+		runJobs(ctx, pool, taskJobs(&project, synced))
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		relinkTasks(ctx, store, &project, synced)
+		if err := syncComments(ctx, store, &project, commentsSince, synced); err != nil {
+			store.SaveError(Error{
+				err:        errors.Join(errors.New("error while syncing comments: "), err),
+				table_type: ProjectTable,
+				project:    project,
+				severity:   SeverityWarning,
+			})
 		}
 
-		for _, project := range projects {
-			project.Schema, _ = GetSchema(project.TasksDBID)
-			tasks, err := GetTasks(store, project, "")
+		if project.TimeDBID != "" {
+			project.Schema, _ = GetSchema(ctx, project.TimeDBID)
+			times, err := GetTimes(ctx, since.TimeLastSynced, project.InternalID, "")
 			if err != nil {
 				store.SaveError(Error{
-					err:        errors.Join(errors.New("error while getting tasks: "), err),
-					table_type: TaskTable,
+					err:        errors.Join(errors.New("error while getting time rows: "), err),
+					table_type: TimeTable,
 					project:    project,
+					severity:   SeverityCritical,
 				})
 			}
-			fmt.Printf("Loaded %d tasks.\n", len(tasks))
-			for _, task := range tasks {
-				err := task.Upload(store, &project)
-				if err != nil {
-					fmt.Println(err)
-					store.SaveError(Error{
-						err:        err,
-						table_type: TaskTable,
-						project:    project,
-						id:         task.ID,
-					})
-				}
-				if err := store.SetLastSynced(&project); err != nil {
-					store.SaveError(Error{
-						err:        err,
-						table_type: ProjectTable,
-						project:    project,
-					})
+			jobs := []*pageJob{}
+			for _, time := range times {
+				if conflicted[time.ID] {
+					stats.Skipped++
+					continue
 				}
+				jobs = append(jobs, timeJob(&project, &time))
 			}
-
-			if project.TimeDBID != "" {
-				project.Schema, _ = GetSchema(project.TimeDBID)
-				times, err := GetTimes(project.TasksLastSynced, project.InternalID, "")
-				if err != nil {
-					store.SaveError(Error{
-						err:        errors.Join(errors.New("error while getting time rows: "), err),
-						table_type: TimeTable,
-						project:    project,
-					})
-				}
-				fmt.Printf("Loaded %d times.", len(times))
-				for _, time := range times {
-					if err := time.Upload(store, &project); err != nil {
-						store.SaveError(Error{
-							err:        err,
-							table_type: TaskTable,
-							project:    project,
-							id:         time.ID,
-						})
-					}
-					if err := store.SetLastSynced(&project); err != nil {
-						store.SaveError(Error{
-							err:        err,
-							table_type: ProjectTable,
-							project:    project,
-						})
-					}
-				}
+			runJobs(ctx, pool, jobs)
+			if err := ctx.Err(); err != nil {
+				return err
 			}
 		}
-	}()
-	return nil
-}
-
-func SearchPages(dbid string, filter map[string]interface{}) ([]byte, error) {
-	urlStr := "https://api.notion.com/v1/databases/" + dbid + "/query"
-
-	data, err := json.Marshal(filter)
-	if err != nil {
-		return nil, err
-	}
 
-	req, err := http.NewRequest("POST", urlStr, bytes.NewBuffer(data))
-	if err != nil {
-		return nil, err
+		finishProject(store, run, &project, stats)
 	}
-	req.Header.Set("Authorization", "Bearer "+os.Getenv("NOTION_SECRET"))
-	req.Header.Set("Notion-Version", "2022-06-28")
-	req.Header.Set("Content-Type", "application/json")
 
-	client := &http.Client{
-		// Transport: transport,
-	}
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("notion error %s while searching pages with body %s", string(body), string(data))
+	if opts.ProjectID == "" {
+		report, err := RemoveArchived(ctx, store)
+		if err != nil {
+			slog.Error("error while removing archived pages: " + err.Error())
+		} else if len(report.Detected)+len(report.Removed)+len(report.Restored) > 0 {
+			slog.Info("archived pages", "detected", len(report.Detected), "removed", len(report.Removed), "restored", len(report.Restored))
+		}
 	}
-
-	return body, nil
+	return ctx.Err()
 }
 
-func GetPage(pageid string) ([]byte, error) {
-	url := "https://api.notion.com/v1/pages/" + pageid
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Authorization", "Bearer "+os.Getenv("NOTION_SECRET"))
-	req.Header.Set("Notion-Version", "2022-06-28")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+// syncPage copies a single internal page to every project it belongs to.
+func syncPage(ctx context.Context, store Storage, run *SyncRun, projects []project.Project, opts SyncOptions) error {
+	task, time, related, err := getSyncPage(ctx, opts.PageID)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("notion error while getting page: %s", string(body))
+	pageID := opts.PageID
+	if task != nil {
+		pageID = task.ID
+	} else if time != nil {
+		pageID = time.ID
 	}
 
-	return body, nil
-}
-
-func CreatePage(dbid string, properties interface{}, icon string) ([]byte, error) {
-	url := "https://api.notion.com/v1/pages"
-
-	reqBody := map[string]interface{}{
-		"parent": map[string]interface{}{
-			"type":        "database_id",
-			"database_id": dbid,
-		},
-		"properties": properties,
-	}
-	if icons[icon] != "" {
-		reqBody["icon"] = map[string]interface{}{
-			"type": "external",
-			"external": map[string]interface{}{
-				"url": icons[icon],
-			},
+	synced := false
+	for _, project := range projects {
+		if project.Paused && opts.ProjectID == "" {
+			continue
 		}
+		if !belongsTo(&project, related) {
+			continue
+		}
+		synced = true
+		stats := startProject(run, &project)
+		// Like in a full sync, pages with flagged conflicts wait for PullClientChanges.
+		if conflictedPages(store, &project)[pageID] {
+			stats.Skipped++
+			finishProject(store, run, &project, stats)
+			continue
+		}
+		// The cursors are not saved, other pages edited before this one must not be skipped by the next sync.
+		pool := &projectRun{store: store, project: &project, stats: stats, recreate: opts.Full}
+		if task != nil {
+			project.Schema, _ = GetSchema(ctx, project.TasksDBID)
+			runJobs(ctx, pool, []*pageJob{taskJob(&project, task)})
+		} else if project.TimeDBID != "" {
+			project.Schema, _ = GetSchema(ctx, project.TimeDBID)
+			runJobs(ctx, pool, []*pageJob{timeJob(&project, time)})
+		}
+		finishProject(store, run, &project, stats)
 	}
-
-	data, err := json.Marshal(reqBody)
-	if err != nil {
-		return nil, err
-	}
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(data))
-	if err != nil {
-		return nil, err
+	if !synced {
+		return ErrPageNotSyncable
 	}
+	return ctx.Err()
+}
 
-	req.Header.Set("Authorization", "Bearer "+os.Getenv("NOTION_SECRET"))
-	req.Header.Set("Notion-Version", "2022-06-28")
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// getSyncPage reads an internal task or time row and returns the internal projects it belongs to.
+func getSyncPage(ctx context.Context, pageID string) (*Task, *Time, []string, error) {
+	resp, err := client.GetPage(ctx, pageID)
 	if err != nil {
-		return nil, err
+		return nil, nil, nil, err
 	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	page := struct {
+		Parent struct {
+			DatabaseID string `json:"database_id"`
+		} `json:"parent"`
+	}{}
+	if err := json.Unmarshal(resp, &page); err != nil {
+		return nil, nil, nil, err
 	}
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("notion error %s while creating page with properties %s", string(body), string(data))
+	var related []string
+	switch normalizeID(page.Parent.DatabaseID) {
+	case normalizeID(os.Getenv("TASKS_DB")):
+		task := &Task{}
+		if err := json.Unmarshal(resp, task); err != nil {
+			return nil, nil, nil, err
+		}
+		for _, rel := range task.Properties.Product.Relation {
+			related = append(related, rel.ID)
+		}
+		return task, nil, related, nil
+	case normalizeID(os.Getenv("TIMES_DB")):
+		time := &Time{}
+		if err := json.Unmarshal(resp, time); err != nil {
+			return nil, nil, nil, err
+		}
+		for _, item := range time.Properties.Project.Rollup.Array {
+			for _, rel := range item.Relation {
+				related = append(related, rel.ID)
+			}
+		}
+		return nil, time, related, nil
 	}
-
-	return body, nil
+	return nil, nil, nil, ErrPageNotSyncable
 }
 
-func UpdatePage(pageid string, properties interface{}) ([]byte, error) {
-	url := "https://api.notion.com/v1/pages/" + pageid
-
-	reqBody := map[string]interface{}{
-		"properties": properties,
-	}
-
-	data, err := json.Marshal(reqBody)
-	if err != nil {
-		return nil, err
-	}
+// belongsTo reports whether the internal project is one of the related pages.
+func belongsTo(project *project.Project, related []string) bool {
+	return slices.ContainsFunc(related, func(id string) bool { return normalizeID(id) == normalizeID(project.InternalID) })
+}
 
-	req, err := http.NewRequest("PATCH", url, bytes.NewBuffer(data))
-	if err != nil {
-		return nil, err
+func startProject(run *SyncRun, project *project.Project) *ProjectStats {
+	publish(SyncEvent{Type: EventProjectStarted, RunID: run.ID, ProjectID: project.ProjectID, ProjectName: project.Name})
+	return &ProjectStats{
+		RunID:     run.ID,
+		ProjectID: project.ProjectID,
+		Name:      project.Name,
 	}
+}
 
-	req.Header.Set("Authorization", "Bearer "+os.Getenv("NOTION_SECRET"))
-	req.Header.Set("Notion-Version", "2022-06-28")
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+func finishProject(store Storage, run *SyncRun, project *project.Project, stats *ProjectStats) {
+	saveProgress(store, stats)
+	run.Projects = append(run.Projects, *stats)
+	publish(SyncEvent{Type: EventProjectFinished, RunID: run.ID, ProjectID: project.ProjectID, ProjectName: project.Name, Stats: stats})
+}
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+// reupload runs upload and, if recreate is set and the client copy is gone, forgets the copy and uploads the page again.
+func reupload(store Storage, internalID string, recreate bool, upload func() error) error {
+	err := upload()
+	if !recreate || !isGone(err) {
+		return err
 	}
-
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("notion error %s while updating page with properties %s", string(body), string(data))
+	if err := store.RemoveClientID(internalID); err != nil {
+		return err
 	}
-
-	return body, nil
-
+	return upload()
 }
 
-func FixBroken(store Storage) error {
-	projects, err := store.GetProjects()
-	if err != nil {
-		panic(err)
-	}
-
-	for _, project := range projects {
-		pages, err := store.GetRowsToBeUpdatedByProject(project.ProjectID)
-		if err != nil {
-			return err
-		}
-		for _, page := range pages {
-			if page.Type == "task" {
-				task, err := GetTask(page.InternalID)
-				if err != nil {
-					return err
-				}
-				if err := task.Update(store, &project); err != nil {
-					return err
-				}
-			} else if page.Type == "time" {
-				time, err := GetTime(page.InternalID)
-				if err != nil {
-					return err
-				}
-				if err := time.Update(store, &project); err != nil {
-					return err
-				}
-			}
+// countUpload runs upload of the internal page, counts its result and publishes it.
+func countUpload(store Storage, project *project.Project, stats *ProjectStats, internalID, title string, upload func() error) error {
+	_, err := store.GetClientID(internalID)
+	copied := err == nil
+
+	if err := upload(); err != nil {
+		// Pages failing validation are already saved to to_be_updated.
+		var validationErr *ValidationError
+		if errors.As(err, &validationErr) {
+			stats.Skipped++
+			return nil
 		}
-	}
-
+		stats.Failed++
+		return err
+	}
+
+	event := SyncEvent{
+		RunID:       stats.RunID,
+		ProjectID:   project.ProjectID,
+		ProjectName: project.Name,
+		PageID:      internalID,
+		Title:       title,
+	}
+	clientID, err := store.GetClientID(internalID)
+	switch {
+	case err != nil:
+		stats.Skipped++
+		return nil
+	case copied:
+		stats.Updated++
+		event.Type = EventPageUpdated
+	default:
+		stats.Created++
+		event.Type = EventPageCreated
+	}
+	event.ClientURL = pageURL(clientID)
+	publish(event)
 	return nil
-
 }
 
-func getWorker(dbid, workerId string) (*Worker, error) {
-	filter := map[string]interface{}{
-		"filter": map[string]interface{}{
-			"property": "Ссылка",
-			"people": map[string]interface{}{
-				"contains": workerId,
-			},
-		},
+func saveProgress(store Storage, stats *ProjectStats) {
+	if err := store.SaveSyncRunProject(*stats); err != nil {
+		slog.Error("error while saving sync run progress: " + err.Error())
 	}
+}
 
-	resp, err := SearchPages(dbid, filter)
+// conflictedPages returns internal IDs of the project pages with flagged conflicts.
+func conflictedPages(store Storage, project *project.Project) map[string]bool {
+	conflicted := map[string]bool{}
+	rows, err := store.GetRowsToBeUpdatedByProject(project.ProjectID)
 	if err != nil {
-		return nil, err
+		slog.Error("error while getting conflicts: " + err.Error())
+		return conflicted
 	}
-	worker := struct {
-		Results []Worker `json:"results"`
-	}{}
-	json.Unmarshal(resp, &worker)
-	if len(worker.Results) == 0 {
-		return nil, fmt.Errorf("worker not found: %s", string(resp))
+	for _, row := range rows {
+		if row.Type == conflictType(TaskTable) || row.Type == conflictType(TimeTable) {
+			conflicted[row.InternalID] = true
+		}
 	}
-	return &worker.Results[0], nil
-}
-
-var icons = map[string]string{
-	"iOS":     "https://i.postimg.cc/kGZPbxtx/ios.png",
-	"Flutter": "https://i.postimg.cc/0QVs8gkX/flutter.png",
-	"Android": "https://i.postimg.cc/0NqxndXn/android.png",
-	"Иерархическая задача": "https://i.postimg.cc/yYgHzrwn/queen.png",
-	"Дизайн":     "https://i.postimg.cc/hjDnW4B7/design.png",
-	"Backend":    "https://i.postimg.cc/6QLKm2DX/backend.png",
-	"Web":        "https://i.postimg.cc/t4FGsnRx/web.png",
-	"Менеджмент": "https://i.postimg.cc/FFn48Qn7/management.png",
-	"Sprint":     "https://i.postimg.cc/Qx2rNJDD/Vector.png",
-	"Meeting":    "https://i.postimg.cc/brdjr6dy/Group-5272.png",
+	return conflicted
 }
 
 // Worker
@@ -405,9 +473,9 @@ type Worker struct {
 			} `json:"people"`
 		} `json:"Ссылка"`
 		Salary struct {
-			ID     string `json:"id"`
-			Type   string `json:"type"`
-			Number int    `json:"number"`
+			ID     string  `json:"id"`
+			Type   string  `json:"type"`
+			Number float64 `json:"number"`
 		} `json:"Ставка в час"`
 		Direction struct {
 			ID     string `json:"id"`
@@ -442,44 +510,6 @@ type Worker struct {
 	}
 }
 
-type Schema struct {
-	Properties map[string]interface{} `json:"properties"`
-}
-
-func GetSchema(dbid string) ([]string, error) {
-	url := "https://api.notion.com/v1/databases/" + dbid
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Authorization", "Bearer "+os.Getenv("NOTION_SECRET"))
-	req.Header.Set("Notion-Version", "2022-06-28")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("notion error while getting page: %s", string(body))
-	}
-
-	schema := Schema{}
-	if err := json.Unmarshal(body, &schema); err != nil {
-		return nil, err
-	}
-
-	res := []string{}
-	for k := range schema.Properties {
-		res = append(res, k)
-	}
-	return res, nil
+func GetSchema(ctx context.Context, dbid string) ([]string, error) {
+	return client.GetSchema(ctx, dbid)
 }
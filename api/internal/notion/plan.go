@@ -0,0 +1,356 @@
+package notion
+
+import (
+	"context"
+	"database/sql"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Corray333/notion-manager/internal/project"
+)
+
+// SyncPlan is what a sync would change, see PlanSync.
+type SyncPlan struct {
+	Projects []ProjectPlan `json:"projects"`
+}
+
+// ProjectPlan lists the pages of a project a sync would change.
+type ProjectPlan struct {
+	ProjectID string        `json:"project_id"` // ID of project
+	Name      string        `json:"name"`       // Name of project
+	New       bool          `json:"new"`        // The project is not saved yet, all its pages are new
+	Create    []PlannedPage `json:"create"`     // Pages that would be copied to the client dashboard
+	Update    []PlannedPage `json:"update"`     // Client copies whose properties would change
+	Unchanged int           `json:"unchanged"`  // Client copies that would be updated with the values they already have
+	Archive   []PlannedPage `json:"archive"`    // Client copies that would be archived, their internal pages are gone
+	Invalid   []PlannedPage `json:"invalid"`    // Pages failing blocking validation rules, they would not be copied
+	Skipped   []PlannedPage `json:"skipped"`    // Pages with flagged conflicts
+	Errors    []PlannedPage `json:"errors"`     // Pages that couldn't be planned, see Error
+}
+
+// PlannedPage is a page a sync would change.
+type PlannedPage struct {
+	InternalID string           `json:"internal_id"`         // ID of page in internal dashboard
+	ClientID   string           `json:"client_id,omitempty"` // ID of page in client dashboard, empty if it isn't copied
+	Type       string           `json:"type"`                // Type of database
+	Title      string           `json:"title"`               // Title of the internal page
+	Changes    []PropertyChange `json:"changes,omitempty"`   // Properties of the client copy that would change
+	Issues     ValidationIssues `json:"issues,omitempty"`    // Failed validation rules
+	Reason     string           `json:"reason,omitempty"`    // Why the client copy would be archived
+	Error      string           `json:"error,omitempty"`     // Why the page couldn't be planned
+}
+
+// PropertyChange is a property of a client page a sync would change.
+type PropertyChange struct {
+	Property string `json:"property"` // Property in the client database
+	From     string `json:"from"`     // Current value of the client copy
+	To       string `json:"to"`       // Value the sync would write
+}
+
+// PlanSync computes what Sync with the same options would do: the pages it would create, the client
+// copies it would update with the properties that would change, the client copies it would archive
+// and the pages it would skip because of validation or conflicts. Nothing is written: Notion is only
+// read and the database is left as it is, the sync cursors included. Client edits PullClientChanges
+// would copy back are not planned.
+//
+// Relations and workers are compared by the IDs of the client pages. A worker or a related page that
+// doesn't exist yet is shown as "new: " followed by the name or the internal ID.
+func PlanSync(ctx context.Context, store Storage, opts SyncOptions) (*SyncPlan, error) {
+	projects, err := store.GetProjects()
+	if err != nil {
+		return nil, err
+	}
+	saved := map[string]bool{}
+	for _, p := range projects {
+		saved[normalizeID(p.ProjectID)] = true
+	}
+	for _, p := range LoadProjects(ctx) {
+		if !saved[normalizeID(p.ProjectID)] {
+			projects = append(projects, *p)
+		}
+	}
+	if opts.ProjectID != "" {
+		i := slices.IndexFunc(projects, func(p project.Project) bool { return normalizeID(p.ProjectID) == normalizeID(opts.ProjectID) })
+		if i < 0 {
+			return nil, ErrProjectNotFound
+		}
+		projects = projects[i : i+1]
+	}
+
+	var task *Task
+	var time *Time
+	var related []string
+	if opts.PageID != "" {
+		if task, time, related, err = getSyncPage(ctx, opts.PageID); err != nil {
+			return nil, err
+		}
+	}
+
+	plan := &SyncPlan{Projects: []ProjectPlan{}}
+	for _, project := range projects {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if project.Paused && opts.ProjectID == "" {
+			continue
+		}
+		if opts.PageID != "" && !belongsTo(&project, related) {
+			continue
+		}
+		p := ProjectPlan{
+			ProjectID: project.ProjectID,
+			Name:      project.Name,
+			New:       !saved[normalizeID(project.ProjectID)],
+			Create:    []PlannedPage{},
+			Update:    []PlannedPage{},
+			Archive:   []PlannedPage{},
+			Invalid:   []PlannedPage{},
+			Skipped:   []PlannedPage{},
+			Errors:    []PlannedPage{},
+		}
+		conflicted := conflictedPages(store, &project)
+		if opts.Full {
+			project.TasksLastSynced, project.TimeLastSynced = 0, 0
+		}
+
+		tasks := []Task{}
+		if task != nil {
+			tasks = append(tasks, *task)
+		} else if opts.PageID == "" {
+			if tasks, err = GetTasks(ctx, store, project, ""); err != nil {
+				return nil, err
+			}
+		}
+		project.Schema, _ = GetSchema(ctx, project.TasksDBID)
+		for _, task := range tasks {
+			issues, err := task.Validate(ctx, &project)
+			planPage(ctx, store, &project, &p, opts, TaskTable, MappingFor(&project).Task, conflicted, task.ID, task.Raw, issues, err)
+		}
+
+		if project.TimeDBID != "" {
+			times := []Time{}
+			if time != nil {
+				times = append(times, *time)
+			} else if opts.PageID == "" {
+				if times, err = GetTimes(ctx, project.TimeLastSynced, project.InternalID, ""); err != nil {
+					return nil, err
+				}
+			}
+			project.Schema, _ = GetSchema(ctx, project.TimeDBID)
+			for _, time := range times {
+				issues, err := time.Validate(ctx, &project)
+				planPage(ctx, store, &project, &p, opts, TimeTable, MappingFor(&project).Time, conflicted, time.ID, time.Raw, issues, err)
+			}
+		}
+		plan.Projects = append(plan.Projects, p)
+	}
+
+	if opts.ProjectID == "" && opts.PageID == "" {
+		if err := planArchived(ctx, store, plan); err != nil {
+			return nil, err
+		}
+	}
+	return plan, ctx.Err()
+}
+
+// planPage adds the internal page to the plan of its project.
+func planPage(ctx context.Context, store Storage, project *project.Project, plan *ProjectPlan, opts SyncOptions, table TableType, rules []PropertyMapping, conflicted map[string]bool, internalID string, props Properties, issues ValidationIssues, err error) {
+	page := PlannedPage{InternalID: internalID, Type: string(table), Title: props.title()}
+	if err != nil {
+		page.Error = err.Error()
+		plan.Errors = append(plan.Errors, page)
+		return
+	}
+	page.Issues = issues
+	if conflicted[internalID] {
+		plan.Skipped = append(plan.Skipped, page)
+		return
+	}
+	if issues.Blocking() {
+		plan.Invalid = append(plan.Invalid, page)
+		return
+	}
+
+	clientID, err := store.GetClientID(internalID)
+	if err == sql.ErrNoRows {
+		plan.Create = append(plan.Create, page)
+		return
+	}
+	if err != nil {
+		page.Error = err.Error()
+		plan.Errors = append(plan.Errors, page)
+		return
+	}
+	page.ClientID = clientID
+
+	clientPage, err := getPageState(ctx, clientID)
+	if opts.Full && isGone(err) {
+		// The copy would be recreated.
+		plan.Create = append(plan.Create, page)
+		return
+	}
+	if err != nil {
+		page.Error = err.Error()
+		plan.Errors = append(plan.Errors, page)
+		return
+	}
+	if page.Changes, err = planChanges(ctx, store, project, rules, internalID, props, clientPage.Properties); err != nil {
+		page.Error = err.Error()
+		plan.Errors = append(plan.Errors, page)
+		return
+	}
+	if len(page.Changes) == 0 {
+		plan.Unchanged++
+		return
+	}
+	plan.Update = append(plan.Update, page)
+}
+
+// planChanges compares the values the sync would write with the properties of the client copy.
+// It only reads, missing workers and related pages are not created.
+func planChanges(ctx context.Context, store Storage, project *project.Project, rules []PropertyMapping, internalID string, props, clientProps Properties) ([]PropertyChange, error) {
+	changes := []PropertyChange{}
+	for _, rule := range rules {
+		if rule.Type == MapProject || rule.Type != MapTitle && len(project.Schema) > 0 && !slices.Contains(project.Schema, rule.Target) {
+			continue
+		}
+
+		clientProp := clientProps[rule.Target]
+		var to, from string
+		switch rule.Type {
+		case MapWorker:
+			ids, err := plannedWorkers(ctx, project, props[rule.Source].People)
+			if err != nil {
+				return nil, err
+			}
+			if len(ids) == 0 {
+				continue
+			}
+			to = strings.Join(ids, ", ")
+			// Workers are written as a relation.
+			from = PropertyMapping{Type: MapRelation}.key(clientProp, func(s string) string { return s }, func(id string) string { return id })
+		default:
+			internalProp := rule.pushed(props[rule.Source])
+			to = rule.key(internalProp, rule.text, func(id string) string {
+				if id == internalID {
+					return ""
+				}
+				clientID, err := store.GetClientID(id)
+				if err != nil && rule.Missing == MissingUpload {
+					return "new: " + id
+				}
+				return clientID
+			})
+			from = rule.key(clientProp, func(s string) string { return s }, func(id string) string { return id })
+			// The sync leaves properties without a value as they are.
+			if to == "" || rule.Type == MapCheckbox && !hasBool(internalProp) {
+				continue
+			}
+		}
+		if to != from {
+			changes = append(changes, PropertyChange{Property: rule.Target, From: from, To: to})
+		}
+	}
+	return changes, nil
+}
+
+// plannedWorkers returns the sorted IDs of the client workers of the people, as compared by PropertyMapping.key.
+func plannedWorkers(ctx context.Context, project *project.Project, people []Person) ([]string, error) {
+	ids := []string{}
+	if project.WorkersDBID == "" {
+		return ids, nil
+	}
+	for _, person := range people {
+		worker, err := getWorker(ctx, project.WorkersDBID, person.ID)
+		if err != nil {
+			return nil, err
+		}
+		id := "new: " + person.Name
+		if worker != nil {
+			id = normalizeID(worker.ID)
+		}
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+func hasBool(prop Property) bool {
+	_, ok := prop.BoolValue()
+	return ok
+}
+
+// planArchived adds the client copies RemoveArchived would archive to the plans of their projects:
+// pages gone for longer than the grace period, including pages it would detect right now if there
+// is no grace period.
+func planArchived(ctx context.Context, store Storage, plan *SyncPlan) error {
+	ids, err := store.GetClientIDs()
+	if err != nil {
+		return err
+	}
+	live := map[string]bool{}
+	for _, dbid := range []string{os.Getenv("TASKS_DB"), os.Getenv("TIMES_DB")} {
+		pages, err := getPageIDs(ctx, dbid, "")
+		if err != nil {
+			return err
+		}
+		for _, id := range pages {
+			live[normalizeID(id)] = true
+		}
+	}
+	archived, err := store.GetArchivedPages()
+	if err != nil {
+		return err
+	}
+	pending := map[string]ArchivedPage{}
+	for _, page := range archived {
+		if page.RemovedAt == nil {
+			pending[page.InternalID] = page
+		}
+	}
+	projects, err := store.GetProjects()
+	if err != nil {
+		return err
+	}
+
+	for internalID, clientID := range ids {
+		if live[normalizeID(internalID)] {
+			continue
+		}
+		page, ok := pending[internalID]
+		if !ok {
+			if archiveGracePeriod > 0 {
+				continue
+			}
+			reason, title, err := archivedReason(ctx, internalID)
+			if err != nil {
+				return err
+			}
+			if reason == "" {
+				continue
+			}
+			page = ArchivedPage{InternalID: internalID, ClientID: clientID, Title: title, Reason: reason, DetectedAt: time.Now()}
+			page.ProjectID, page.Type = clientPageOwner(ctx, clientID, projects)
+		}
+		if time.Since(page.DetectedAt) < archiveGracePeriod {
+			continue
+		}
+
+		for i := range plan.Projects {
+			if normalizeID(plan.Projects[i].ProjectID) == normalizeID(page.ProjectID) {
+				plan.Projects[i].Archive = append(plan.Projects[i].Archive, PlannedPage{
+					InternalID: page.InternalID,
+					ClientID:   page.ClientID,
+					Type:       page.Type,
+					Title:      page.Title,
+					Reason:     page.Reason,
+				})
+			}
+		}
+	}
+	return nil
+}
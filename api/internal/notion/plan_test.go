@@ -0,0 +1,77 @@
+package notion_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Corray333/notion-manager/internal/notion"
+	"github.com/Corray333/notion-manager/pkg/notion/notiontest"
+)
+
+// writes returns the requests that change something in Notion.
+func writes(requests []notiontest.Request) []notiontest.Request {
+	res := []notiontest.Request{}
+	for _, req := range requests {
+		if req.Method == "GET" || req.Method == "POST" && strings.HasSuffix(req.Path, "/query") {
+			continue
+		}
+		res = append(res, req)
+	}
+	return res
+}
+
+func TestPlanSyncWritesNothing(t *testing.T) {
+	e := newEnv(t)
+	notion.SetValidation(notion.ValidationConfig{Default: notion.ValidationRules{
+		Task: []notion.ValidationRule{{Property: "Дедлайн", Check: notion.CheckRequired, Severity: notion.SeverityError}},
+	}})
+	t.Cleanup(func() { notion.SetValidation(notion.ValidationConfig{}) })
+
+	task := e.addTask("Task", internalProject, "")
+	if err := notion.Sync(context.Background(), e.store, notion.SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	projects, err := e.store.GetProjects()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	e.fake.SetPage(task, map[string]interface{}{"Оценка": map[string]interface{}{"number": 5}})
+	created := e.addTask("New", internalProject, "")
+	invalid := e.addTask("Invalid", internalProject, "")
+	e.fake.SetPage(invalid, map[string]interface{}{"Дедлайн": map[string]interface{}{"date": nil}})
+
+	before := len(e.fake.Requests())
+	plan, err := notion.PlanSync(context.Background(), e.store, notion.SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := writes(e.fake.Requests()[before:]); len(w) != 0 {
+		t.Fatalf("expected a dry run to only read, got %+v", w)
+	}
+	if after, err := e.store.GetProjects(); err != nil || after[0].TasksLastSynced != projects[0].TasksLastSynced || after[0].ClientLastSynced != projects[0].ClientLastSynced {
+		t.Fatalf("expected the project to be left as it is, got %+v", after)
+	}
+	if _, err := e.store.GetClientID(created); err == nil {
+		t.Fatal("expected the new task not to be copied")
+	}
+
+	if len(plan.Projects) != 1 {
+		t.Fatalf("expected 1 project, got %d", len(plan.Projects))
+	}
+	p := plan.Projects[0]
+	if len(p.Create) != 1 || p.Create[0].InternalID != created {
+		t.Errorf("expected the new task to be created, got %+v", p.Create)
+	}
+	if len(p.Invalid) != 1 || p.Invalid[0].InternalID != invalid {
+		t.Errorf("expected the invalid task to be reported, got %+v", p.Invalid)
+	}
+	if len(p.Update) != 1 || p.Update[0].ClientID != e.clientID(t, task) {
+		t.Fatalf("expected the edited task to be updated, got %+v", p.Update)
+	}
+	want := []notion.PropertyChange{{Property: "Оценка", From: "3", To: "5"}}
+	if changes := p.Update[0].Changes; len(changes) != 1 || changes[0] != want[0] {
+		t.Errorf("expected %+v, got %+v", want, changes)
+	}
+}
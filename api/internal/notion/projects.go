@@ -0,0 +1,119 @@
+package notion
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/Corray333/notion-manager/internal/project"
+)
+
+var ErrProjectNotFound = errors.New("project not found")
+
+// ProjectError lists what is wrong with the databases of a project.
+type ProjectError struct {
+	Problems []string
+}
+
+func (e *ProjectError) Error() string {
+	return "invalid project: " + strings.Join(e.Problems, "; ")
+}
+
+// FindProject returns the project with the given client project ID.
+func FindProject(store Storage, projectID string) (*project.Project, error) {
+	projects, err := store.GetProjects()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range projects {
+		if normalizeID(p.ProjectID) == normalizeID(projectID) {
+			return &p, nil
+		}
+	}
+	return nil, ErrProjectNotFound
+}
+
+// ResetProject resets the task and time cursors of the project, so that the next sync copies all
+// of its pages again. The cursor of client edits is kept. A running sync would save its cursors
+// over the reset, ErrSyncRunning is returned instead.
+func ResetProject(ctx context.Context, store Storage, projectID string) (*project.Project, error) {
+	_, unlock, err := lockRunner(ctx, WorkReset)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	proj, err := FindProject(store, projectID)
+	if err != nil {
+		return nil, err
+	}
+	proj.TasksLastSynced, proj.TimeLastSynced = 0, 0
+	if err := store.SetLastSynced(proj); err != nil {
+		return nil, err
+	}
+	return proj, nil
+}
+
+// ValidateProject checks that the client databases of the project exist and have the properties
+// the sync can't do without: the title, the project relation and the required properties of its
+// mapping, and "Ссылка" in the workers database. Other mapped properties are optional, they are
+// skipped when missing. A *ProjectError is returned if anything is wrong with the databases.
+func ValidateProject(ctx context.Context, project *project.Project) error {
+	problems := []string{}
+	if project.ProjectID == "" {
+		problems = append(problems, "project_id is empty")
+	}
+	if project.InternalID == "" {
+		problems = append(problems, "internal_id is empty")
+	}
+	if project.TasksDBID == "" {
+		problems = append(problems, "tasks_db_id is empty")
+	}
+
+	mapping := MappingFor(project)
+	databases := []struct {
+		name     string
+		dbid     string
+		required []string
+	}{
+		{"tasks", project.TasksDBID, requiredTargets(mapping.Task)},
+		{"time", project.TimeDBID, requiredTargets(mapping.Time)},
+		{"workers", project.WorkersDBID, []string{"Ссылка"}},
+	}
+	for _, db := range databases {
+		if db.dbid == "" {
+			continue
+		}
+		schema, err := GetSchema(ctx, db.dbid)
+		if isNotFound(err) {
+			problems = append(problems, fmt.Sprintf("%s database %s not found", db.name, db.dbid))
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, property := range db.required {
+			if !slices.Contains(schema, property) {
+				problems = append(problems, fmt.Sprintf("%s database has no property %q", db.name, property))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ProjectError{Problems: problems}
+	}
+	return nil
+}
+
+// requiredTargets returns the client properties of the rules that are never skipped.
+func requiredTargets(rules []PropertyMapping) []string {
+	targets := []string{}
+	for _, rule := range rules {
+		if rule.Type == MapTitle || rule.Type == MapProject || rule.Required {
+			targets = append(targets, rule.Target)
+		}
+	}
+	return targets
+}
@@ -0,0 +1,97 @@
+package notion_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Corray333/notion-manager/internal/notion"
+	"github.com/Corray333/notion-manager/internal/project"
+)
+
+func TestValidateProject(t *testing.T) {
+	e := newEnv(t)
+	proj := &project.Project{
+		ProjectID:   e.clientProject,
+		InternalID:  internalProject,
+		TasksDBID:   clientTasksDB,
+		TimeDBID:    clientTimesDB,
+		WorkersDBID: clientWorkersDB,
+	}
+	if err := notion.ValidateProject(context.Background(), proj); err != nil {
+		t.Fatalf("expected the dashboard to be valid, got %v", err)
+	}
+
+	e.fake.AddDatabase("44444444-0000-0000-0000-000000000001", "Задачи", map[string]string{"Name": "title"})
+	proj.TasksDBID = "44444444-0000-0000-0000-000000000001"
+	proj.TimeDBID = "44444444-0000-0000-0000-000000000002"
+	err := notion.ValidateProject(context.Background(), proj)
+	var projectErr *notion.ProjectError
+	if !errors.As(err, &projectErr) || len(projectErr.Problems) != 2 {
+		t.Fatalf("expected a missing property and a missing database, got %v", err)
+	}
+}
+
+// pause pauses the client project, it must be saved by a sync first.
+func (e *env) pause(t *testing.T) {
+	t.Helper()
+	proj, err := notion.FindProject(e.store, e.clientProject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proj.Paused = true
+	if err := e.store.UpdateProject(proj); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPausedProjectIsSkipped(t *testing.T) {
+	e := newEnv(t)
+	e.sync(t)
+	e.pause(t)
+
+	task := e.addTask("Task", internalProject, "")
+	e.sync(t)
+	if _, err := e.store.GetClientID(task); err == nil {
+		t.Fatal("paused project was synced")
+	}
+
+	// Syncing the project on its own ignores the pause.
+	if err := notion.Sync(context.Background(), e.store, notion.SyncOptions{ProjectID: e.clientProject}); err != nil {
+		t.Fatal(err)
+	}
+	e.clientID(t, task)
+}
+
+func TestResetProject(t *testing.T) {
+	e := newEnv(t)
+	e.addTask("Task", internalProject, "")
+	e.sync(t)
+
+	proj, err := notion.ResetProject(context.Background(), e.store, e.clientProject)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved, _ := notion.FindProject(e.store, e.clientProject)
+	if saved.TasksLastSynced != 0 || saved.TimeLastSynced != 0 || saved.ClientLastSynced != proj.ClientLastSynced {
+		t.Errorf("expected the task and time cursors to be reset, got %+v", saved)
+	}
+
+	// A running sync would save its cursors over the reset.
+	e.fake.FailNext(1, http.StatusTooManyRequests, 60)
+	id, err := notion.StartSync(context.Background(), e.store, notion.SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		notion.CancelSync(id)
+		for notion.RunningSync() != 0 {
+			time.Sleep(10 * time.Millisecond)
+		}
+	})
+	if _, err := notion.ResetProject(context.Background(), e.store, e.clientProject); !errors.Is(err, notion.ErrSyncRunning) {
+		t.Errorf("expected the reset to be refused during a sync, got %v", err)
+	}
+}
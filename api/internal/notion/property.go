@@ -0,0 +1,152 @@
+package notion
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+// Property is a property value of a page in any of the types the sync engine can copy.
+type Property struct {
+	Type        string         `json:"type"`
+	Title       []RichText     `json:"title"`
+	RichText    []RichText     `json:"rich_text"`
+	Number      *float64       `json:"number"`
+	Select      *SelectOption  `json:"select"`
+	Status      *SelectOption  `json:"status"`
+	MultiSelect []SelectOption `json:"multi_select"`
+	Date        *DateValue     `json:"date"`
+	Checkbox    *bool          `json:"checkbox"`
+	URL         *string        `json:"url"`
+	People      []Person       `json:"people"`
+	Relation    []Reference    `json:"relation"`
+	Formula     *FormulaValue  `json:"formula"`
+}
+
+type RichText struct {
+	PlainText string `json:"plain_text"`
+}
+
+type SelectOption struct {
+	Name string `json:"name"`
+}
+
+type DateValue struct {
+	Start string      `json:"start"`
+	End   interface{} `json:"end"`
+}
+
+type Person struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type Reference struct {
+	ID string `json:"id"`
+}
+
+type FormulaValue struct {
+	Type    string     `json:"type"`
+	String  *string    `json:"string"`
+	Number  *float64   `json:"number"`
+	Boolean *bool      `json:"boolean"`
+	Date    *DateValue `json:"date"`
+}
+
+// Properties are the raw properties of a page by name.
+type Properties map[string]Property
+
+// rawPage is used to read the properties of a page by name alongside its typed representation.
+type rawPage struct {
+	Properties Properties `json:"properties"`
+}
+
+func parseProperties(data []byte) (Properties, error) {
+	raw := rawPage{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	return raw.Properties, nil
+}
+
+// Text returns the value of the property as plain text.
+func (p Property) Text() string {
+	switch {
+	case len(p.Title) > 0:
+		return joinText(p.Title)
+	case len(p.RichText) > 0:
+		return joinText(p.RichText)
+	case p.Select != nil:
+		return p.Select.Name
+	case p.Status != nil:
+		return p.Status.Name
+	case p.Number != nil:
+		return strconv.FormatFloat(*p.Number, 'f', -1, 64)
+	case p.URL != nil:
+		return *p.URL
+	case p.Date != nil:
+		return p.Date.Start
+	case len(p.MultiSelect) > 0:
+		names := make([]string, len(p.MultiSelect))
+		for i, o := range p.MultiSelect {
+			names[i] = o.Name
+		}
+		return strings.Join(names, ", ")
+	case p.Formula != nil && p.Formula.String != nil:
+		return *p.Formula.String
+	case p.Formula != nil && p.Formula.Number != nil:
+		return strconv.FormatFloat(*p.Formula.Number, 'f', -1, 64)
+	}
+	return ""
+}
+
+// NumberValue returns the number of a number or formula property.
+func (p Property) NumberValue() (float64, bool) {
+	if p.Number != nil {
+		return *p.Number, true
+	}
+	if p.Formula != nil && p.Formula.Number != nil {
+		return *p.Formula.Number, true
+	}
+	return 0, false
+}
+
+// DateValue returns the date of a date or formula property.
+func (p Property) DateValue() *DateValue {
+	if p.Date != nil && p.Date.Start != "" {
+		return p.Date
+	}
+	if p.Formula != nil && p.Formula.Date != nil && p.Formula.Date.Start != "" {
+		return p.Formula.Date
+	}
+	return nil
+}
+
+// BoolValue returns the value of a checkbox or formula property.
+func (p Property) BoolValue() (bool, bool) {
+	if p.Checkbox != nil {
+		return *p.Checkbox, true
+	}
+	if p.Formula != nil && p.Formula.Boolean != nil {
+		return *p.Formula.Boolean, true
+	}
+	return false, false
+}
+
+// title returns the text of the title property.
+func (p Properties) title() string {
+	for _, prop := range p {
+		if prop.Type == MapTitle {
+			return prop.Text()
+		}
+	}
+	return ""
+}
+
+func joinText(texts []RichText) string {
+	res := ""
+	for _, t := range texts {
+		res += t.PlainText
+	}
+	return res
+}
@@ -0,0 +1,403 @@
+package notion
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Corray333/notion-manager/internal/project"
+)
+
+// pageState is a page with the properties needed to compare both copies of it.
+type pageState struct {
+	ID             string     `json:"id"`
+	LastEditedTime string     `json:"last_edited_time"`
+	Properties     Properties `json:"properties"`
+}
+
+type pageStateList struct {
+	Results    []pageState `json:"results"`
+	HasMore    bool        `json:"has_more"`
+	NextCursor string      `json:"next_cursor"`
+}
+
+func (p pageState) edited() time.Time {
+	edited, _ := time.Parse(TIME_LAYOUT_IN, p.LastEditedTime)
+	return edited
+}
+
+// conflictType is the to_be_updated type of pages with conflicting edits.
+func conflictType(table TableType) string {
+	return string(table) + "_conflict"
+}
+
+// PullClientChanges copies edits of two-way properties made in the client dashboard of
+// the project back to the internal databases. It only reads client pages edited since
+// the previous pull and pages with unresolved conflicts.
+//
+// A page whose internal copy was also edited since the previous pull is a conflict
+// resolved by the project conflict policy. Flagged conflicts are saved to to_be_updated
+// and are not synced in either direction until both copies have the same values.
+func PullClientChanges(ctx context.Context, store Storage, project *project.Project) error {
+	m := MappingFor(project)
+	if !m.TwoWay {
+		return nil
+	}
+
+	conflicts, err := store.GetRowsToBeUpdatedByProject(project.ProjectID)
+	if err != nil {
+		return err
+	}
+
+	// The cursor stops before the earliest page that failed, so that it is pulled again next time.
+	latest, failed := project.ClientLastSynced, int64(0)
+	for _, table := range []struct {
+		typ   TableType
+		dbid  string
+		rules []PropertyMapping
+	}{
+		{TaskTable, project.TasksDBID, m.Task},
+		{TimeTable, project.TimeDBID, m.Time},
+	} {
+		rules := twoWayRules(table.rules)
+		if table.dbid == "" || len(rules) == 0 {
+			continue
+		}
+
+		pages, err := getEditedPages(ctx, table.dbid, project.ClientLastSynced, "")
+		if err != nil {
+			return err
+		}
+		conflicted := map[string]bool{}
+		for _, row := range conflicts {
+			if row.Type != conflictType(table.typ) {
+				continue
+			}
+			conflicted[row.InternalID] = true
+			if slices.ContainsFunc(pages, func(p pageState) bool { return p.ID == row.ClientID }) {
+				continue
+			}
+			page, err := getPageState(ctx, row.ClientID)
+			if err != nil {
+				return err
+			}
+			pages = append(pages, *page)
+		}
+
+		for _, page := range pages {
+			edited, err := pullPage(ctx, store, project, table.typ, rules, m.Conflict, conflicted, page)
+			if err != nil {
+				store.SaveError(Error{
+					err:        err,
+					table_type: table.typ,
+					project:    *project,
+					id:         page.ID,
+					severity:   SeverityWarning,
+				})
+				if edited := page.edited().Unix(); failed == 0 || edited < failed {
+					failed = edited
+				}
+				continue
+			}
+			if edited.Unix() > latest {
+				latest = edited.Unix()
+			}
+		}
+	}
+
+	if failed != 0 && latest >= failed {
+		latest = max(failed-1, project.ClientLastSynced)
+	}
+	project.ClientLastSynced = latest
+	return store.SetLastSynced(project)
+}
+
+// pullPage copies the two-way properties of a client page to its internal copy.
+// It returns the latest edit time of both copies seen.
+func pullPage(ctx context.Context, store Storage, project *project.Project, table TableType, rules []PropertyMapping, policy string, conflicted map[string]bool, page pageState) (time.Time, error) {
+	edited := page.edited()
+	internalID, err := store.GetInternalID(page.ID)
+	if err == sql.ErrNoRows {
+		// Created in the client dashboard, there is nothing to update.
+		return edited, nil
+	}
+	if err != nil {
+		return edited, err
+	}
+	internal, err := getPageState(ctx, internalID)
+	if err != nil {
+		return edited, err
+	}
+
+	req := map[string]interface{}{}
+	diffs := []string{}
+	issues := ValidationIssues{}
+	for _, rule := range rules {
+		internalProp, clientProp := internal.Properties[rule.Source], page.Properties[rule.Target]
+		internalKey := rule.key(rule.pushed(internalProp), rule.text, func(id string) string {
+			if id == internalID {
+				return ""
+			}
+			clientID, _ := store.GetClientID(id)
+			return clientID
+		})
+		clientKey := rule.key(clientProp, func(s string) string { return s }, func(id string) string { return id })
+		if internalKey == clientKey {
+			continue
+		}
+
+		value, err := rule.pulled(store, internalProp, clientProp)
+		if err != nil {
+			return edited, err
+		}
+		if value == nil {
+			continue
+		}
+		req[rule.Source] = value
+		diff := fmt.Sprintf("%s is %q internally and %q in the client dashboard", rule.Source, internalKey, clientKey)
+		diffs = append(diffs, diff)
+		issues = append(issues, ValidationIssue{Field: rule.Source, Code: CodeConflict, Message: diff, Severity: SeverityWarning})
+	}
+
+	if len(req) == 0 {
+		return edited, resolveConflict(store, conflicted, internalID)
+	}
+
+	if conflicted[internalID] || internal.edited().Unix() > project.ClientLastSynced {
+		switch policy {
+		case ConflictInternalWins:
+			return edited, nil
+		case ConflictFlag:
+			val := newValidation(project, conflictType(table), internalID, page.ID, internal.Properties)
+			val.Errors = "conflict: " + strings.Join(diffs, ", ")
+			val.Issues = issues
+			store.SaveRowsToBeUpdated(val)
+			return edited, nil
+		default:
+			if !edited.After(internal.edited()) {
+				return edited, nil
+			}
+		}
+	}
+
+	resp, err := client.UpdatePage(ctx, internalID, req)
+	if err != nil {
+		return edited, err
+	}
+	updated := pageState{}
+	if err := json.Unmarshal(resp, &updated); err != nil {
+		return edited, err
+	}
+	if updated.edited().After(edited) {
+		edited = updated.edited()
+	}
+	return edited, resolveConflict(store, conflicted, internalID)
+}
+
+// clientEdited moves the pull cursor past an edit of a client page made by the push,
+// so that the next pull neither reads it back nor takes it for a conflict.
+func clientEdited(project *project.Project, resp []byte) {
+	page := pageState{}
+	if err := json.Unmarshal(resp, &page); err != nil {
+		return
+	}
+	if edited := page.edited().Unix(); edited > project.ClientLastSynced {
+		project.ClientLastSynced = edited
+	}
+}
+
+func resolveConflict(store Storage, conflicted map[string]bool, internalID string) error {
+	if !conflicted[internalID] {
+		return nil
+	}
+	return store.RemoveRowToBeUpdated(internalID)
+}
+
+func getEditedPages(ctx context.Context, dbid string, since int64, cursor string) ([]pageState, error) {
+	req := map[string]interface{}{
+		"filter": map[string]interface{}{
+			"timestamp": "last_edited_time",
+			"last_edited_time": map[string]interface{}{
+				"after": time.Unix(since, 0).Format(TIME_LAYOUT),
+			},
+		},
+	}
+	if cursor != "" {
+		req["start_cursor"] = cursor
+	}
+
+	resp, err := client.SearchPages(ctx, dbid, req)
+	if err != nil {
+		return nil, err
+	}
+	pages := pageStateList{}
+	if err := json.Unmarshal(resp, &pages); err != nil {
+		return nil, err
+	}
+
+	if pages.HasMore {
+		more, err := getEditedPages(ctx, dbid, since, pages.NextCursor)
+		if err != nil {
+			return nil, err
+		}
+		return append(pages.Results, more...), nil
+	}
+	return pages.Results, nil
+}
+
+func getPageState(ctx context.Context, id string) (*pageState, error) {
+	resp, err := client.GetPage(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	page := pageState{}
+	if err := json.Unmarshal(resp, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+func twoWayRules(rules []PropertyMapping) []PropertyMapping {
+	res := []PropertyMapping{}
+	for _, rule := range rules {
+		if rule.Direction == DirectionBoth && rule.Type != MapWorker && rule.Type != MapProject {
+			res = append(res, rule)
+		}
+	}
+	return res
+}
+
+func (p pageState) title() string {
+	return p.Properties.title()
+}
+
+// pushed returns the internal property as it is copied to the client, with the default applied.
+func (m PropertyMapping) pushed(prop Property) Property {
+	if m.Default != nil && isEmpty(prop) {
+		return propertyFromDefault(m.Default)
+	}
+	return prop
+}
+
+// key is a comparable representation of a property value. names converts select options
+// and texts, ids converts related page IDs, an empty ID is dropped.
+func (m PropertyMapping) key(prop Property, names func(string) string, ids func(string) string) string {
+	switch m.Type {
+	case MapMultiSelect:
+		options := []string{}
+		for _, o := range prop.MultiSelect {
+			options = append(options, names(o.Name))
+		}
+		if len(options) == 0 && prop.Select != nil {
+			options = append(options, names(prop.Select.Name))
+		}
+		slices.Sort(options)
+		return strings.Join(options, ", ")
+	case MapRelation:
+		related := []string{}
+		for _, rel := range prop.Relation {
+			if id := ids(rel.ID); id != "" {
+				related = append(related, normalizeID(id))
+			}
+		}
+		slices.Sort(related)
+		return strings.Join(related, ", ")
+	case MapDate:
+		date := prop.DateValue()
+		if date == nil {
+			return ""
+		}
+		if date.End != nil {
+			return fmt.Sprintf("%s - %v", date.Start, date.End)
+		}
+		return date.Start
+	case MapCheckbox:
+		b, _ := prop.BoolValue()
+		return strconv.FormatBool(b)
+	case MapNumber:
+		return prop.Text()
+	}
+	return names(prop.Text())
+}
+
+// pulled converts the client property into a request value of the internal property.
+// Transforms can't be reversed and are not applied, renamed values are renamed back.
+func (m PropertyMapping) pulled(store Storage, internal, prop Property) (interface{}, error) {
+	switch m.Type {
+	case MapTitle, MapRichText:
+		text := m.untext(prop.Text())
+		if text == "" && m.Type == MapTitle {
+			return nil, nil
+		}
+		return textValue(m.Type, text), nil
+	case MapNumber:
+		return map[string]interface{}{"number": prop.Number}, nil
+	case MapSelect, MapStatus:
+		name := m.untext(prop.Text())
+		if name == "" {
+			if m.Type == MapStatus {
+				return nil, nil
+			}
+			return map[string]interface{}{"select": nil}, nil
+		}
+		return map[string]interface{}{m.Type: map[string]interface{}{"name": name}}, nil
+	case MapMultiSelect:
+		options := []map[string]interface{}{}
+		for _, o := range prop.MultiSelect {
+			options = append(options, map[string]interface{}{"name": m.untext(o.Name)})
+		}
+		return map[string]interface{}{"multi_select": options}, nil
+	case MapDate:
+		date := prop.DateValue()
+		if date == nil {
+			return map[string]interface{}{"date": nil}, nil
+		}
+		value := map[string]interface{}{"start": date.Start}
+		if date.End != nil {
+			value["end"] = date.End
+		}
+		return map[string]interface{}{"date": value}, nil
+	case MapCheckbox:
+		b, _ := prop.BoolValue()
+		return map[string]interface{}{"checkbox": b}, nil
+	case MapURL:
+		return map[string]interface{}{"url": prop.URL}, nil
+	case MapRelation:
+		ids := []string{}
+		// Related pages without a client copy are not visible to the client, keep them.
+		for _, rel := range internal.Relation {
+			if _, err := store.GetClientID(rel.ID); err == sql.ErrNoRows {
+				ids = append(ids, rel.ID)
+			} else if err != nil {
+				return nil, err
+			}
+		}
+		for _, rel := range prop.Relation {
+			internalID, err := store.GetInternalID(rel.ID)
+			if err == sql.ErrNoRows {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			ids = append(ids, internalID)
+		}
+		return relationValue(ids), nil
+	}
+	return nil, nil
+}
+
+// untext renames a client value back to the internal one.
+func (m PropertyMapping) untext(s string) string {
+	for from, to := range m.Values {
+		if strings.EqualFold(to, s) {
+			return from
+		}
+	}
+	return s
+}
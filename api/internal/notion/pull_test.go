@@ -0,0 +1,173 @@
+package notion_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Corray333/notion-manager/internal/notion"
+	"github.com/Corray333/notion-manager/pkg/notion/notiontest"
+)
+
+// twoWay enables two-way sync of task statuses and deadlines for the client project.
+func (e *env) twoWay(t *testing.T, conflict string) {
+	rules := []notion.PropertyMapping{}
+	for _, rule := range notion.DefaultMapping.Task {
+		if rule.Source == "Статус" || rule.Source == "Дедлайн" {
+			rule.Direction = notion.DirectionBoth
+		}
+		rules = append(rules, rule)
+	}
+	notion.SetMappings(notion.MappingConfig{Projects: map[string]notion.ProjectMapping{
+		e.clientProject: {Task: rules, TwoWay: ptr(true), Conflict: conflict},
+	}})
+	t.Cleanup(func() { notion.SetMappings(notion.MappingConfig{}) })
+}
+
+func (e *env) sync(t *testing.T) {
+	t.Helper()
+	if err := notion.Sync(context.Background(), e.store, notion.SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func setStatus(e *env, id, status string) {
+	e.fake.SetPage(id, map[string]interface{}{
+		"Статус": map[string]interface{}{"status": map[string]interface{}{"name": status}},
+	})
+}
+
+func statusOf(page notiontest.Page) string {
+	prop, _ := page.Properties["Статус"].(map[string]interface{})
+	status, _ := prop["status"].(map[string]interface{})
+	name, _ := status["name"].(string)
+	return name
+}
+
+func TestPullCopiesClientEdits(t *testing.T) {
+	e := newEnv(t)
+	e.twoWay(t, notion.ConflictFlag)
+	task := e.addTask("Task", internalProject, "")
+	e.sync(t)
+
+	clientTask := e.clientID(t, task)
+	setStatus(e, clientTask, "На проверке")
+	e.fake.SetPage(clientTask, map[string]interface{}{
+		"Дедлайн": map[string]interface{}{"date": map[string]interface{}{"start": "2024-08-01"}},
+	})
+	e.sync(t)
+
+	page, _ := e.fake.Page(task)
+	if got := statusOf(page); got != "На проверке" {
+		t.Errorf("internal status = %q, want the client edit", got)
+	}
+	deadline := page.Properties["Дедлайн"].(map[string]interface{})["date"].(map[string]interface{})
+	if deadline["start"] != "2024-08-01" {
+		t.Errorf("internal deadline = %v, want the client edit", deadline["start"])
+	}
+	if rows, _ := e.store.GetRowsToBeUpdated(); len(rows) != 0 {
+		t.Errorf("expected no conflicts, got %+v", rows)
+	}
+
+	// One-way properties are not pulled.
+	e.fake.SetPage(clientTask, map[string]interface{}{"Оценка": map[string]interface{}{"number": 10}})
+	e.sync(t)
+	page, _ = e.fake.Page(task)
+	if got := page.Properties["Оценка"].(map[string]interface{})["number"]; got != float64(3) {
+		t.Errorf("internal estimate = %v, one-way property was pulled", got)
+	}
+}
+
+func TestPullFlagsConflicts(t *testing.T) {
+	e := newEnv(t)
+	e.twoWay(t, notion.ConflictFlag)
+	task := e.addTask("Task", internalProject, "")
+	e.sync(t)
+
+	clientTask := e.clientID(t, task)
+	setStatus(e, task, "Готово")
+	setStatus(e, clientTask, "На проверке")
+	e.sync(t)
+
+	rows, err := e.store.GetRowsToBeUpdated()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].Type != "task_conflict" || rows[0].InternalID != task {
+		t.Fatalf("expected the task to be flagged, got %+v", rows)
+	}
+	internal, _ := e.fake.Page(task)
+	client, _ := e.fake.Page(clientTask)
+	if statusOf(internal) != "Готово" || statusOf(client) != "На проверке" {
+		t.Errorf("flagged page was synced: internal %q, client %q", statusOf(internal), statusOf(client))
+	}
+
+	// The conflict is resolved once both copies agree.
+	setStatus(e, task, "На проверке")
+	e.sync(t)
+	if rows, _ := e.store.GetRowsToBeUpdated(); len(rows) != 0 {
+		t.Errorf("expected the conflict to be resolved, got %+v", rows)
+	}
+}
+
+func TestPullConflictPolicies(t *testing.T) {
+	for _, tc := range []struct {
+		policy string
+		want   string
+	}{
+		{notion.ConflictLastWriterWins, "На проверке"},
+		{notion.ConflictInternalWins, "Готово"},
+	} {
+		t.Run(tc.policy, func(t *testing.T) {
+			e := newEnv(t)
+			e.twoWay(t, tc.policy)
+			task := e.addTask("Task", internalProject, "")
+			e.sync(t)
+
+			// The client edits last.
+			clientTask := e.clientID(t, task)
+			setStatus(e, task, "Готово")
+			setStatus(e, clientTask, "На проверке")
+			e.sync(t)
+
+			internal, _ := e.fake.Page(task)
+			client, _ := e.fake.Page(clientTask)
+			if statusOf(internal) != tc.want || statusOf(client) != tc.want {
+				t.Errorf("internal %q, client %q, want both %q", statusOf(internal), statusOf(client), tc.want)
+			}
+		})
+	}
+}
+
+func TestPullRetriesFailedPages(t *testing.T) {
+	e := newEnv(t)
+	e.twoWay(t, notion.ConflictLastWriterWins)
+	now := time.Date(2024, 7, 1, 10, 0, 0, 0, time.UTC)
+	e.fake.SetClock(func() time.Time { return now })
+	failing := e.addTask("Failing", internalProject, "")
+	pulled := e.addTask("Pulled", internalProject, "")
+	e.sync(t)
+
+	// The older edit can't be pulled, its internal page is gone.
+	now = now.Add(time.Hour)
+	setStatus(e, e.clientID(t, failing), "На проверке")
+	failedAt := now
+	now = now.Add(time.Hour)
+	setStatus(e, e.clientID(t, pulled), "На проверке")
+	e.fake.Delete(failing)
+
+	projects, err := e.store.GetProjects()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := notion.PullClientChanges(context.Background(), e.store, &projects[0]); err != nil {
+		t.Fatal(err)
+	}
+	if page, _ := e.fake.Page(pulled); statusOf(page) != "На проверке" {
+		t.Errorf("expected the newer edit to be pulled, got %q", statusOf(page))
+	}
+	projects, _ = e.store.GetProjects()
+	if got := projects[0].ClientLastSynced; got >= failedAt.Unix() {
+		t.Errorf("expected the cursor before the failed page (%d), got %d", failedAt.Unix(), got)
+	}
+}
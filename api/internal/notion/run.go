@@ -0,0 +1,230 @@
+package notion
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// Statuses of a sync run.
+const (
+	RunRunning   = "running"
+	RunFinished  = "finished"
+	RunFailed    = "failed"
+	RunCancelled = "cancelled"
+)
+
+// Work that holds the run lock without being a run.
+const (
+	WorkJobs  = "jobs"  // ProcessJobs retries jobs
+	WorkFix   = "fix"   // FixBroken uploads the pages that failed validation
+	WorkReset = "reset" // ResetProject resets the cursors of a project
+)
+
+var (
+	ErrSyncRunning    = errors.New("is already syncing")
+	ErrSyncNotRunning = errors.New("sync run is not running")
+)
+
+// SyncRun is a single execution of Sync.
+type SyncRun struct {
+	ID         int64          `json:"id" db:"id"`
+	Status     string         `json:"status" db:"status"`           // One of Run* constants
+	StartedAt  time.Time      `json:"started_at" db:"started_at"`   // When the run was started
+	FinishedAt *time.Time     `json:"finished_at" db:"finished_at"` // When the run ended, nil while it is running
+	Error      string         `json:"error" db:"error"`             // Error that stopped the run
+	ProjectID  string         `json:"project_id" db:"project_id"`   // Client project the run was limited to
+	PageID     string         `json:"page_id" db:"page_id"`         // Internal page the run was limited to
+	Full       bool           `json:"full" db:"full"`               // Whether the sync cursors were ignored
+	Projects   []ProjectStats `json:"projects" db:"-"`              // Progress of every project synced so far
+	Errors     []RunError     `json:"errors,omitempty" db:"-"`      // Errors saved during the run
+}
+
+// ProjectStats counts the pages of a project processed by a run.
+type ProjectStats struct {
+	RunID     int64  `json:"-" db:"run_id"`
+	ProjectID string `json:"project_id" db:"project_id"` // ID of project
+	Name      string `json:"name" db:"name"`             // Name of project
+	Created   int    `json:"created" db:"created"`       // Pages copied to the client dashboard
+	Updated   int    `json:"updated" db:"updated"`       // Client copies updated
+	Failed    int    `json:"failed" db:"failed"`         // Pages that failed to sync
+	Skipped   int    `json:"skipped" db:"skipped"`       // Pages left as they are, e.g. with a flagged conflict
+}
+
+// RunError is an error saved during a run.
+type RunError struct {
+	RunID     int64     `json:"-" db:"run_id"`
+	ProjectID string    `json:"project_id" db:"project_id"`
+	Type      string    `json:"type" db:"type"`
+	PageID    string    `json:"page_id" db:"page_id"`
+	Message   string    `json:"message" db:"message"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// runner makes sure only one sync runs at a time and allows to cancel it.
+var runner struct {
+	mu     sync.Mutex
+	id     int64
+	work   string // one of Work* constants while the lock is held by work that isn't a run
+	cancel context.CancelFunc
+}
+
+// StartSync runs Sync in the background and returns the ID of the run.
+// Only one sync can run at a time, ErrSyncRunning is returned otherwise.
+func StartSync(ctx context.Context, store Storage, opts SyncOptions) (int64, error) {
+	run, ctx, err := beginRun(ctx, store, opts)
+	if err != nil {
+		return 0, err
+	}
+
+	go func() {
+		if err := finishRun(ctx, store, run, opts); err != nil {
+			slog.Error("error while syncing: " + err.Error())
+		}
+	}()
+	return run.ID, nil
+}
+
+// Sync copies tasks and time rows changed since the last sync from the internal
+// databases to the dashboards of all projects. For two-way projects client edits
+// are pulled first, see PullClientChanges. The run is recorded like one started by StartSync.
+func Sync(ctx context.Context, store Storage, opts SyncOptions) error {
+	run, ctx, err := beginRun(ctx, store, opts)
+	if err != nil {
+		return err
+	}
+	return finishRun(ctx, store, run, opts)
+}
+
+// RunningSync returns the ID of the running sync or 0 if there is none.
+func RunningSync() int64 {
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+	return runner.id
+}
+
+// RunningWork returns the work holding the run lock instead of a sync, one of Work* constants,
+// or "" if there is none.
+func RunningWork() string {
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+	return runner.work
+}
+
+// CancelSync stops the running sync with the given ID.
+func CancelSync(id int64) error {
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+	if runner.cancel == nil || runner.id != id {
+		return ErrSyncNotRunning
+	}
+	runner.cancel()
+	return nil
+}
+
+// lockRunner keeps syncs from starting while work that isn't a run, e.g. ProcessJobs, uploads pages.
+// It returns ErrSyncRunning if a sync or such work is running, otherwise the function releasing the lock.
+func lockRunner(ctx context.Context, work string) (context.Context, func(), error) {
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+	if runner.cancel != nil {
+		return nil, nil, ErrSyncRunning
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	runner.work, runner.cancel = work, cancel
+	return ctx, func() {
+		runner.mu.Lock()
+		runner.cancel()
+		runner.work, runner.cancel = "", nil
+		runner.mu.Unlock()
+	}, nil
+}
+
+func beginRun(ctx context.Context, store Storage, opts SyncOptions) (*SyncRun, context.Context, error) {
+	runner.mu.Lock()
+	defer runner.mu.Unlock()
+	if runner.cancel != nil {
+		return nil, nil, ErrSyncRunning
+	}
+
+	// Nothing else runs in this process, so runs left running were interrupted by a restart.
+	if err := store.InterruptSyncRuns(); err != nil {
+		return nil, nil, err
+	}
+	run := &SyncRun{
+		Status:    RunRunning,
+		StartedAt: time.Now(),
+		ProjectID: opts.ProjectID,
+		PageID:    opts.PageID,
+		Full:      opts.Full,
+	}
+	if err := store.NewSyncRun(run); err != nil {
+		return nil, nil, err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	runner.id, runner.cancel = run.ID, cancel
+	publish(SyncEvent{Type: EventRunStarted, RunID: run.ID, Status: run.Status})
+	return run, ctx, nil
+}
+
+func finishRun(ctx context.Context, store Storage, run *SyncRun, opts SyncOptions) error {
+	err := syncProjects(withWorkerCache(ctx), runStore{Storage: store, run: run}, run, opts)
+
+	finished := time.Now()
+	run.FinishedAt = &finished
+	switch {
+	case errors.Is(err, context.Canceled):
+		run.Status = RunCancelled
+	case err != nil:
+		run.Status = RunFailed
+	default:
+		run.Status = RunFinished
+	}
+	if err != nil {
+		run.Error = err.Error()
+	}
+	if err := store.FinishSyncRun(run); err != nil {
+		slog.Error("error while saving sync run: " + err.Error())
+	}
+	publish(SyncEvent{Type: EventRunFinished, RunID: run.ID, Status: run.Status, Message: run.Error})
+
+	runner.mu.Lock()
+	runner.cancel()
+	runner.id, runner.cancel = 0, nil
+	runner.mu.Unlock()
+	return err
+}
+
+// runStore saves errors to the history of the run besides the errors table.
+type runStore struct {
+	Storage
+	run *SyncRun
+}
+
+func (s runStore) SaveError(errSave Error) error {
+	projectID, typ, message, pageID := errSave.Unpack()
+	if err := s.Storage.SaveSyncRunError(RunError{
+		RunID:     s.run.ID,
+		ProjectID: projectID,
+		Type:      typ,
+		PageID:    pageID,
+		Message:   message,
+		CreatedAt: time.Now(),
+	}); err != nil {
+		slog.Error("error while saving sync run error: " + err.Error())
+	}
+	publish(SyncEvent{
+		Type:        EventError,
+		RunID:       s.run.ID,
+		ProjectID:   projectID,
+		ProjectName: errSave.project.Name,
+		PageID:      pageID,
+		Message:     message,
+	})
+	errSave.runID = s.run.ID
+	return s.Storage.SaveError(errSave)
+}
@@ -0,0 +1,132 @@
+package notion_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Corray333/notion-manager/internal/notion"
+)
+
+func TestSyncRecordsRun(t *testing.T) {
+	e := newEnv(t)
+	task := e.addTask("Task", internalProject, "")
+	e.addTask("Other", internalProject, "")
+	e.addTime("Did the task", task, 2)
+	e.sync(t)
+
+	runs, err := e.store.GetSyncRuns(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 1 || runs[0].Status != notion.RunFinished || runs[0].FinishedAt == nil {
+		t.Fatalf("expected a finished run, got %+v", runs)
+	}
+	if stats := runs[0].Projects; len(stats) != 1 || stats[0].Created != 3 || stats[0].Failed != 0 {
+		t.Errorf("unexpected project stats %+v", stats)
+	}
+
+	setStatus(e, task, "Готово")
+	e.sync(t)
+	runs, _ = e.store.GetSyncRuns(1)
+	if len(runs) != 1 || runs[0].Projects[0].Updated == 0 || runs[0].Projects[0].Created != 0 {
+		t.Errorf("expected the latest run to update pages, got %+v", runs)
+	}
+}
+
+func TestSyncRecordsErrors(t *testing.T) {
+	e := newEnv(t)
+	timeID := e.addTime("No task", "", 1)
+	e.fake.SetPage(timeID, map[string]interface{}{"Задача": map[string]interface{}{"relation": []interface{}{}}})
+	e.sync(t)
+
+	runs, _ := e.store.GetSyncRuns(1)
+	run, err := e.store.GetSyncRun(runs[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(run.Errors) == 0 || run.Projects[0].Failed == 0 {
+		t.Errorf("expected the failed time row to be recorded, got %+v", run)
+	}
+}
+
+func TestSyncIsSingleFlightAndCancellable(t *testing.T) {
+	e := newEnv(t)
+	e.addTask("Task", internalProject, "")
+	e.fake.FailNext(1, http.StatusTooManyRequests, 60)
+
+	id, err := notion.StartSync(context.Background(), e.store, notion.SyncOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := notion.StartSync(context.Background(), e.store, notion.SyncOptions{}); !errors.Is(err, notion.ErrSyncRunning) {
+		t.Errorf("expected the second sync to be refused, got %v", err)
+	}
+	if err := notion.Sync(context.Background(), e.store, notion.SyncOptions{}); !errors.Is(err, notion.ErrSyncRunning) {
+		t.Errorf("expected the blocking sync to be refused, got %v", err)
+	}
+	if notion.RunningSync() != id {
+		t.Errorf("running sync = %d, want %d", notion.RunningSync(), id)
+	}
+	if err := notion.CancelSync(id + 1); !errors.Is(err, notion.ErrSyncNotRunning) {
+		t.Errorf("expected an unknown run not to be cancelled, got %v", err)
+	}
+	if err := notion.CancelSync(id); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for notion.RunningSync() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("the sync was not cancelled")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	run, err := e.store.GetSyncRun(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Status != notion.RunCancelled {
+		t.Errorf("status = %q, want %q", run.Status, notion.RunCancelled)
+	}
+}
+
+func TestProcessJobsBlocksSyncs(t *testing.T) {
+	e := newEnv(t)
+	e.sync(t)
+	task := e.addTask("Task", internalProject, "")
+	projects, err := e.store.GetProjects()
+	if err != nil {
+		t.Fatal(err)
+	}
+	job := &notion.Job{ProjectID: projects[0].ProjectID, PageID: task, Type: "task", Status: notion.JobPending, NextRunAt: time.Now()}
+	if err := e.store.NewJob(job); err != nil {
+		t.Fatal(err)
+	}
+	e.fake.FailNext(1, http.StatusTooManyRequests, 60)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- notion.ProcessJobs(ctx, e.store) }()
+	deadline := time.Now().Add(5 * time.Second)
+	for notion.RunningWork() != notion.WorkJobs {
+		if time.Now().After(deadline) {
+			t.Fatal("the jobs did not start")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := notion.StartSync(context.Background(), e.store, notion.SyncOptions{}); !errors.Is(err, notion.ErrSyncRunning) {
+		t.Errorf("expected the sync to be refused while jobs run, got %v", err)
+	}
+	if id := notion.RunningSync(); id != 0 {
+		t.Errorf("running sync = %d, want none", id)
+	}
+	cancel()
+	<-done
+	if work := notion.RunningWork(); work != "" {
+		t.Errorf("running work = %q after the jobs returned", work)
+	}
+}
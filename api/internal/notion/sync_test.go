@@ -0,0 +1,292 @@
+package notion_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Corray333/notion-manager/internal/notion"
+	"github.com/Corray333/notion-manager/internal/storage"
+	"github.com/Corray333/notion-manager/internal/storage/storagetest"
+	notionclient "github.com/Corray333/notion-manager/pkg/notion"
+	"github.com/Corray333/notion-manager/pkg/notion/notiontest"
+)
+
+const (
+	tasksDB         = "11111111-0000-0000-0000-000000000001"
+	timesDB         = "11111111-0000-0000-0000-000000000002"
+	dashboardsPage  = "11111111-0000-0000-0000-000000000003"
+	internalProject = "11111111-0000-0000-0000-000000000004"
+	otherProject    = "11111111-0000-0000-0000-000000000005"
+
+	clientProjectsDB = "22222222-0000-0000-0000-000000000001"
+	clientTasksDB    = "22222222-0000-0000-0000-000000000002"
+	clientTimesDB    = "22222222-0000-0000-0000-000000000003"
+	clientWorkersDB  = "22222222-0000-0000-0000-000000000004"
+
+	workerUser = "33333333-0000-0000-0000-000000000001"
+)
+
+// env is an internal workspace with one client dashboard, served by a fake Notion API.
+type env struct {
+	fake          *notiontest.Server
+	store         *storage.Storage
+	clientProject string
+	clientWorker  string
+}
+
+func newEnv(t *testing.T) *env {
+	t.Helper()
+
+	fake := notiontest.NewServer()
+	t.Cleanup(fake.Close)
+
+	clock := time.Date(2024, 6, 1, 10, 0, 0, 0, time.UTC)
+	fake.SetClock(func() time.Time {
+		clock = clock.Add(time.Minute)
+		return clock
+	})
+
+	notion.SetClient(notionclient.NewClient("secret",
+		notionclient.WithBaseURL(fake.URL()),
+		notionclient.WithRateLimit(1000, 1000),
+		notionclient.WithRetries(3, time.Millisecond, 10*time.Millisecond),
+	))
+	t.Setenv("TASKS_DB", tasksDB)
+	t.Setenv("TIMES_DB", timesDB)
+	t.Setenv("DASHBOARDS_PAGE", dashboardsPage)
+
+	fake.AddDatabase(tasksDB, "Задачи", map[string]string{
+		"Task":                "title",
+		"Продукт":             "relation",
+		"Исполнитель":         "people",
+		"Статус":              "status",
+		"Приоритет":           "select",
+		"Оценка":              "number",
+		"Дедлайн":             "date",
+		"Родительская задача": "relation",
+		"Подзадачи":           "relation",
+		"Теги":                "multi_select",
+	})
+	fake.AddDatabase(timesDB, "Время", map[string]string{
+		"Что делали":  "title",
+		"Всего ч":     "number",
+		"Задача":      "relation",
+		"Проект":      "rollup",
+		"Исполнитель": "people",
+	})
+
+	dashboard := fake.AddChildPage(dashboardsPage, "Client")
+	fake.AddChildDatabase(dashboard, clientProjectsDB, "Проекты", map[string]string{
+		"Name":     "title",
+		"internal": "relation",
+	})
+	fake.AddChildDatabase(dashboard, clientTasksDB, "Задачи", map[string]string{
+		"Name":                "title",
+		"Проект":              "relation",
+		"Оценка":              "number",
+		"Статус":              "status",
+		"Приоритет":           "select",
+		"Родительская задача": "relation",
+		"Дедлайн":             "date",
+		"Исполнитель":         "relation",
+	})
+	fake.AddChildDatabase(dashboard, clientTimesDB, "Время", map[string]string{
+		"Name":    "title",
+		"Всего ч": "number",
+		"Задача":  "relation",
+	})
+	fake.AddChildDatabase(dashboard, clientWorkersDB, "Ставки", map[string]string{
+		"Name":   "title",
+		"Ссылка": "people",
+	})
+
+	return &env{
+		fake:  fake,
+		store: storagetest.New(t),
+		clientProject: fake.AddPage(clientProjectsDB, map[string]interface{}{
+			"Name":     title("Client project"),
+			"internal": relation(internalProject),
+		}),
+		clientWorker: fake.AddPage(clientWorkersDB, map[string]interface{}{
+			"Name":   title("Mark"),
+			"Ссылка": map[string]interface{}{"people": []map[string]interface{}{{"id": workerUser}}},
+		}),
+	}
+}
+
+func (e *env) addTask(name, project, parent string) string {
+	props := map[string]interface{}{
+		"Task":        title(name),
+		"Продукт":     relation(project),
+		"Исполнитель": map[string]interface{}{"people": []map[string]interface{}{{"id": workerUser, "name": "Mark"}}},
+		"Статус":      map[string]interface{}{"status": map[string]interface{}{"name": "В работе"}},
+		"Приоритет":   map[string]interface{}{"select": map[string]interface{}{"name": "Высокий"}},
+		"Оценка":      map[string]interface{}{"number": 3},
+		"Дедлайн":     map[string]interface{}{"date": map[string]interface{}{"start": "2024-07-01"}},
+	}
+	if parent != "" {
+		props["Родительская задача"] = relation(parent)
+	}
+	return e.fake.AddPage(tasksDB, props)
+}
+
+func (e *env) addTime(name, task string, hours float64) string {
+	return e.fake.AddPage(timesDB, map[string]interface{}{
+		"Что делали": title(name),
+		"Всего ч":    map[string]interface{}{"number": hours},
+		"Задача":     relation(task),
+		"Проект": map[string]interface{}{"rollup": map[string]interface{}{
+			"type":  "array",
+			"array": []map[string]interface{}{{"type": "relation", "relation": []map[string]interface{}{{"id": internalProject}}}},
+		}},
+	})
+}
+
+func (e *env) clientID(t *testing.T, internalID string) string {
+	t.Helper()
+	id, err := e.store.GetClientID(internalID)
+	if err != nil {
+		t.Fatalf("page %s was not copied: %v", internalID, err)
+	}
+	return id
+}
+
+func TestSyncCopiesTasksAndTimes(t *testing.T) {
+	e := newEnv(t)
+	parent := e.addTask("Parent", internalProject, "")
+	child := e.addTask("Child", internalProject, parent)
+	e.addTask("Foreign", otherProject, "")
+	timeID := e.addTime("Did the child", child, 1.5)
+
+	if err := notion.Sync(context.Background(), e.store, notion.SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if pages := e.fake.Pages(clientTasksDB); len(pages) != 2 {
+		t.Fatalf("expected 2 client tasks, got %d", len(pages))
+	}
+
+	clientChild, _ := e.fake.Page(e.clientID(t, child))
+	if got := titleOf(clientChild, "Name"); got != "Child" {
+		t.Errorf("client task title = %q, want %q", got, "Child")
+	}
+	if got := relationOf(clientChild, "Родительская задача"); got != e.clientID(t, parent) {
+		t.Errorf("client parent = %q, want %q", got, e.clientID(t, parent))
+	}
+	if got := relationOf(clientChild, "Проект"); got != e.clientProject {
+		t.Errorf("client project = %q, want %q", got, e.clientProject)
+	}
+	if got := relationOf(clientChild, "Исполнитель"); got != e.clientWorker {
+		t.Errorf("client worker = %q, want %q", got, e.clientWorker)
+	}
+
+	clientTime, ok := e.fake.Page(e.clientID(t, timeID))
+	if !ok {
+		t.Fatal("client time page not found")
+	}
+	if got := relationOf(clientTime, "Задача"); got != e.clientID(t, child) {
+		t.Errorf("client time task = %q, want %q", got, e.clientID(t, child))
+	}
+
+	projects, err := e.store.GetProjects()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(projects) != 1 || projects[0].TasksLastSynced == 0 {
+		t.Errorf("expected one project with advanced cursor, got %+v", projects)
+	}
+}
+
+func TestSyncUpdatesExistingPages(t *testing.T) {
+	e := newEnv(t)
+	task := e.addTask("Task", internalProject, "")
+
+	if err := notion.Sync(context.Background(), e.store, notion.SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	e.fake.SetPage(task, map[string]interface{}{
+		"Статус": map[string]interface{}{"status": map[string]interface{}{"name": "Готово"}},
+	})
+	if err := notion.Sync(context.Background(), e.store, notion.SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if pages := e.fake.Pages(clientTasksDB); len(pages) != 1 {
+		t.Fatalf("expected the client task to be updated in place, got %d pages", len(pages))
+	}
+	page, _ := e.fake.Page(e.clientID(t, task))
+	status, _ := page.Properties["Статус"].(map[string]interface{})["status"].(map[string]interface{})
+	if status["name"] != "Готово" {
+		t.Errorf("client status = %v, want Готово", status["name"])
+	}
+}
+
+func TestSyncPaginatesAndSurvivesRateLimits(t *testing.T) {
+	e := newEnv(t)
+	e.fake.PageSize = 1
+	for _, name := range []string{"One", "Two", "Three"} {
+		e.addTask(name, internalProject, "")
+	}
+	e.fake.FailNext(2, http.StatusTooManyRequests, 0)
+
+	if err := notion.Sync(context.Background(), e.store, notion.SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	if pages := e.fake.Pages(clientTasksDB); len(pages) != 3 {
+		t.Fatalf("expected 3 client tasks, got %d", len(pages))
+	}
+}
+
+func TestSyncSavesInvalidRows(t *testing.T) {
+	e := newEnv(t)
+	task := e.fake.AddPage(tasksDB, map[string]interface{}{
+		"Task":    title("No deadline"),
+		"Продукт": relation(internalProject),
+	})
+
+	if err := notion.Sync(context.Background(), e.store, notion.SyncOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	rows, err := e.store.GetRowsToBeUpdated()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].InternalID != task || rows[0].ClientID != e.clientID(t, task) {
+		t.Fatalf("expected the task to be queued for fixing, got %+v", rows)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func title(s string) map[string]interface{} {
+	return map[string]interface{}{"title": []map[string]interface{}{{"text": map[string]interface{}{"content": s}}}}
+}
+
+func relation(id string) map[string]interface{} {
+	return map[string]interface{}{"relation": []map[string]interface{}{{"id": id}}}
+}
+
+func titleOf(page notiontest.Page, name string) string {
+	prop, _ := page.Properties[name].(map[string]interface{})
+	items, _ := prop["title"].([]interface{})
+	res := ""
+	for _, item := range items {
+		res += item.(map[string]interface{})["plain_text"].(string)
+	}
+	return res
+}
+
+func relationOf(page notiontest.Page, name string) string {
+	prop, _ := page.Properties[name].(map[string]interface{})
+	items, _ := prop["relation"].([]interface{})
+	if len(items) == 0 {
+		return ""
+	}
+	return items[0].(map[string]interface{})["id"].(string)
+}
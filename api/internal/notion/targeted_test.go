@@ -0,0 +1,99 @@
+package notion_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Corray333/notion-manager/internal/notion"
+)
+
+func TestSyncSinglePage(t *testing.T) {
+	e := newEnv(t)
+	task := e.addTask("Task", internalProject, "")
+	e.sync(t)
+
+	setStatus(e, task, "Готово")
+	other := e.addTask("Other", internalProject, "")
+	if err := notion.Sync(context.Background(), e.store, notion.SyncOptions{PageID: task}); err != nil {
+		t.Fatal(err)
+	}
+	if page, _ := e.fake.Page(e.clientID(t, task)); statusOf(page) != "Готово" {
+		t.Errorf("page was not synced, status %q", statusOf(page))
+	}
+	if _, err := e.store.GetClientID(other); err == nil {
+		t.Error("a page sync copied another page")
+	}
+
+	// The page sync must not move the cursors past pages it didn't copy.
+	e.sync(t)
+	e.clientID(t, other)
+
+	err := notion.Sync(context.Background(), e.store, notion.SyncOptions{PageID: e.clientProject})
+	if !errors.Is(err, notion.ErrPageNotSyncable) {
+		t.Errorf("expected ErrPageNotSyncable, got %v", err)
+	}
+}
+
+func TestSyncPageSkipsConflicts(t *testing.T) {
+	e := newEnv(t)
+	e.twoWay(t, notion.ConflictFlag)
+	task := e.addTask("Task", internalProject, "")
+	e.sync(t)
+
+	clientTask := e.clientID(t, task)
+	setStatus(e, task, "Готово")
+	setStatus(e, clientTask, "На проверке")
+	e.sync(t)
+
+	if err := notion.Sync(context.Background(), e.store, notion.SyncOptions{PageID: task}); err != nil {
+		t.Fatal(err)
+	}
+	if page, _ := e.fake.Page(clientTask); statusOf(page) != "На проверке" {
+		t.Errorf("flagged page was synced, client status %q", statusOf(page))
+	}
+	runs, _ := e.store.GetSyncRuns(1)
+	if len(runs) != 1 || runs[0].Projects[0].Skipped != 1 {
+		t.Errorf("expected the page to be skipped, got %+v", runs)
+	}
+}
+
+func TestSyncProject(t *testing.T) {
+	e := newEnv(t)
+	e.addTask("Task", internalProject, "")
+
+	err := notion.Sync(context.Background(), e.store, notion.SyncOptions{ProjectID: "unknown"})
+	if !errors.Is(err, notion.ErrProjectNotFound) {
+		t.Errorf("expected ErrProjectNotFound, got %v", err)
+	}
+
+	if err := notion.Sync(context.Background(), e.store, notion.SyncOptions{ProjectID: e.clientProject}); err != nil {
+		t.Fatal(err)
+	}
+	runs, _ := e.store.GetSyncRuns(1)
+	if len(runs) != 1 || runs[0].ProjectID != e.clientProject || runs[0].Projects[0].Created != 1 {
+		t.Errorf("unexpected run %+v", runs)
+	}
+}
+
+func TestFullSyncRecreatesDeletedCopies(t *testing.T) {
+	e := newEnv(t)
+	deleted := e.addTask("Deleted", internalProject, "")
+	archived := e.addTask("Archived", internalProject, "")
+	e.sync(t)
+	e.fake.Delete(e.clientID(t, deleted))
+	e.fake.Archive(e.clientID(t, archived))
+
+	if err := notion.Sync(context.Background(), e.store, notion.SyncOptions{Full: true}); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{deleted, archived} {
+		page, ok := e.fake.Page(e.clientID(t, id))
+		if !ok || page.Archived {
+			t.Errorf("client copy of %s was not recreated", id)
+		}
+	}
+	if pages := e.fake.Pages(clientTasksDB); len(pages) != 3 {
+		t.Errorf("expected 2 live copies and 1 archived, got %d pages", len(pages))
+	}
+}
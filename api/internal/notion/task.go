@@ -1,11 +1,11 @@
 package notion
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
 	"os"
-	"slices"
 	"time"
 
 	"github.com/Corray333/notion-manager/internal/project"
@@ -21,6 +21,8 @@ var (
 type Task struct {
 	ID          string `json:"id"`
 	CreatedTime string `json:"created_time"`
+	Archived    bool   `json:"archived"`
+	InTrash     bool   `json:"in_trash"`
 	Properties  struct {
 		Tags struct {
 			MultiSelect []struct {
@@ -74,42 +76,25 @@ type Task struct {
 			} `json:"title"`
 		} `json:"Task"`
 	} `json:"properties"`
+	Raw Properties `json:"-"`
 }
 
-func (t *Task) Validate(store Storage, client_id string, project_id string) {
-	errs := ""
-	title := ""
-	if t.Properties.Task.Title == nil || len(t.Properties.Task.Title) == 0 {
-		errs += ErrTaskNoTitle + ", "
-	} else {
-		title = t.Properties.Task.Title[0].PlainText
-	}
-	if t.Properties.Product.Relation == nil || len(t.Properties.Product.Relation) == 0 {
-		errs += ErrTaskNoProduct + ", "
-	}
-	if t.Properties.Worker.People == nil || len(t.Properties.Worker.People) == 0 {
-		errs += ErrTaskNoWorker + ", "
-	}
-	if t.Properties.Deadline.Date.Start == "" {
-		errs += ErrTaskNoDeadline + ", "
+func (t *Task) UnmarshalJSON(data []byte) error {
+	type task Task
+	if err := json.Unmarshal(data, (*task)(t)); err != nil {
+		return err
 	}
-	if t.Properties.Priority.Select.Name == "" {
-		errs += "task priority is empty, "
+	raw, err := parseProperties(data)
+	if err != nil {
+		return err
 	}
+	t.Raw = raw
+	return nil
+}
 
-	if len(errs) > 0 {
-		errs = errs[:len(errs)-2]
-		store.SaveRowsToBeUpdated(Validation{
-			ClientID:   client_id,
-			InternalID: t.ID,
-			Title:      title,
-			Errors:     errs,
-			Type:       "task",
-			ProjectID:  project_id,
-		})
-	} else {
-		store.RemoveRowToBeUpdated(t.ID)
-	}
+// Validate checks the task against the validation rules of the project.
+func (t *Task) Validate(ctx context.Context, project *project.Project) (ValidationIssues, error) {
+	return validatePage(ctx, RulesFor(project).Task, t.ID, t.Raw)
 }
 
 type GetTasksResponse struct {
@@ -118,7 +103,7 @@ type GetTasksResponse struct {
 	NextCursor string `json:"next_cursor"`
 }
 
-func GetTasks(store Storage, project project.Project, cursor string) ([]Task, error) {
+func GetTasks(ctx context.Context, store Storage, project project.Project, cursor string) ([]Task, error) {
 	projectID := project.InternalID
 
 	req := map[string]interface{}{
@@ -150,7 +135,7 @@ func GetTasks(store Storage, project project.Project, cursor string) ([]Task, er
 		req["start_cursor"] = cursor
 	}
 
-	resp, err := SearchPages(os.Getenv("TASKS_DB"), req)
+	resp, err := client.SearchPages(ctx, os.Getenv("TASKS_DB"), req)
 	if err != nil {
 		return nil, err
 	}
@@ -163,7 +148,7 @@ func GetTasks(store Storage, project project.Project, cursor string) ([]Task, er
 	}
 
 	if tasks.HasMore {
-		moreTasks, err := GetTasks(store, project, tasks.NextCursor)
+		moreTasks, err := GetTasks(ctx, store, project, tasks.NextCursor)
 		if err != nil {
 			return nil, err
 		}
@@ -174,8 +159,8 @@ func GetTasks(store Storage, project project.Project, cursor string) ([]Task, er
 
 }
 
-func GetTask(id string) (*Task, error) {
-	resp, err := GetPage(id)
+func GetTask(ctx context.Context, id string) (*Task, error) {
+	resp, err := client.GetPage(ctx, id)
 	if err != nil {
 		return nil, err
 	}
@@ -189,140 +174,29 @@ func GetTask(id string) (*Task, error) {
 	return &task, nil
 }
 
-func (t *Task) ConstructRequest(store Storage, project *project.Project) (map[string]interface{}, error) {
-	var worker *Worker
-	if len(t.Properties.Worker.People) != 0 && slices.Contains(project.Schema, "Исполнитель") {
-		// TODO: create worker if not exists
-		worker, _ = getWorker(project.WorkersDBID, t.Properties.Worker.People[0].ID)
-	}
-
-	parentTask := []struct {
-		ID string `json:"id"`
-	}{}
-
-	// Find parent task
-	if len(t.Properties.ParentTask.Relation) > 0 && t.Properties.ParentTask.Relation[0].ID != t.ID {
-		parentId, err := store.GetClientID(t.Properties.ParentTask.Relation[0].ID)
-		if err != nil {
-			if err != sql.ErrNoRows {
-				return nil, err
-			}
-			resp, err := GetPage(t.Properties.ParentTask.Relation[0].ID)
-			if err != nil {
-				return nil, err
-			}
-			var task Task
-			if err := json.Unmarshal(resp, &task); err != nil {
-				return nil, err
-			}
-
-			if err := task.Upload(store, project); err != nil {
-				return nil, err
-			}
-
-			parentId, err = store.GetClientID(t.Properties.ParentTask.Relation[0].ID)
-			if err != nil {
-				return nil, err
-			}
-		}
-		parentTask = append(parentTask, struct {
-			ID string `json:"id"`
-		}{
-			ID: parentId,
-		})
-	}
-
-	// TODO: add request constructorПип
-	title := ""
-	for _, t := range t.Properties.Task.Title {
-		title += t.PlainText
-	}
-
-	req := map[string]interface{}{
-		"Name": map[string]interface{}{
-			"type": "title",
-			"title": []map[string]interface{}{
-				{
-					"type": "text",
-					"text": map[string]interface{}{
-						"content": title,
-					},
-				},
-			},
-		},
-	}
-	if slices.Contains(project.Schema, "Проект") {
-		req["Проект"] = map[string]interface{}{
-			"relation": []map[string]interface{}{
-				{
-					"id": project.ProjectID,
-				},
-			},
-		}
-	}
-	if slices.Contains(project.Schema, "Оценка") {
-		req["Оценка"] = map[string]interface{}{
-			"number": t.Properties.Estimated.Number,
-		}
-	}
-	if slices.Contains(project.Schema, "Статус") && t.Properties.Status.Status.Name != "" {
-		req["Статус"] = map[string]interface{}{
-			"status": map[string]interface{}{
-				"name": t.Properties.Status.Status.Name,
-			},
-		}
-	}
-
-	if slices.Contains(project.Schema, "Приоритет") && t.Properties.Priority.Select.Name != "" {
-		req["Приоритет"] = map[string]interface{}{
-			"select": map[string]interface{}{
-				"name": t.Properties.Priority.Select.Name,
-			},
-		}
-	}
-
-	if slices.Contains(project.Schema, "Родительская задача") && len(parentTask) > 0 && parentTask[0].ID != "" {
-		req["Родительская задача"] = map[string]interface{}{
-			"relation": parentTask,
-		}
-	}
-	if slices.Contains(project.Schema, "Дедлайн") {
-		deadline := map[string]interface{}{
-			"date": map[string]interface{}{},
-		}
-		if t.Properties.Deadline.Date.End != nil {
-			deadline["date"].(map[string]interface{})["end"] = t.Properties.Deadline.Date.End
-		}
-		if t.Properties.Deadline.Date.Start != "" {
-			deadline["date"].(map[string]interface{})["start"] = t.Properties.Deadline.Date.Start
-			req["Дедлайн"] = deadline
-		}
-	}
-
-	if slices.Contains(project.Schema, "Исполнитель") && worker != nil {
-		req["Исполнитель"] = map[string]interface{}{
-			"relation": []map[string]interface{}{
-				{
-					"id": worker.ID,
-				},
-			},
-		}
-	}
-
-	return req, nil
-
+func (t *Task) ConstructRequest(ctx context.Context, store Storage, project *project.Project) (map[string]interface{}, error) {
+	return buildProperties(ctx, store, project, MappingFor(project).Task, t.ID, t.Raw)
 }
 
-func (t *Task) Upload(store Storage, project *project.Project) error {
+func (t *Task) Upload(ctx context.Context, store Storage, project *project.Project) error {
 	if _, err := store.GetClientID(t.ID); err != nil && err != sql.ErrNoRows {
 		return err
 	} else if err == nil {
-		return t.Update(store, project)
+		return t.Update(ctx, store, project)
+	}
+
+	issues, err := t.Validate(ctx, project)
+	if err != nil {
+		return err
+	}
+	if issues.Blocking() {
+		saveValidation(store, project, TaskTable, t.ID, "", t.Raw, issues)
+		return &ValidationError{Issues: issues}
 	}
 
-	req, err := t.ConstructRequest(store, project)
+	req, err := t.ConstructRequest(ctx, store, project)
 	if err != nil {
-		return nil
+		return fmt.Errorf("failed to construct task request: %w", err)
 	}
 
 	// Find icon. It depends on tag, but it is "Иерархическая задача" if it has subtasks
@@ -333,10 +207,11 @@ func (t *Task) Upload(store Storage, project *project.Project) error {
 		icon = "Иерархическая задача"
 	}
 
-	resp, err := CreatePage(project.TasksDBID, req, icon)
+	resp, err := client.CreatePage(ctx, project.TasksDBID, req, nil, icon)
 	if err != nil {
 		return err
 	}
+	clientEdited(project, resp)
 
 	var response struct {
 		ID string `json:"id"`
@@ -350,40 +225,50 @@ func (t *Task) Upload(store Storage, project *project.Project) error {
 	if err := store.SetClientID(t.ID, response.ID); err != nil {
 		return fmt.Errorf("failed to save task in db: %w", err)
 	}
+	syncContent(ctx, store, project, t.ID, response.ID, true)
 	created_at, _ := time.Parse(TIME_LAYOUT_IN, t.CreatedTime)
 	if project.TasksLastSynced < created_at.Unix() {
 		project.TasksLastSynced = created_at.Unix()
-		store.SetLastSynced(project)
 	}
 
-	t.Validate(store, response.ID, project.ProjectID)
+	saveValidation(store, project, TaskTable, t.ID, response.ID, t.Raw, issues)
 
 	return err
 }
 
-func (t *Task) Update(store Storage, project *project.Project) error {
+func (t *Task) Update(ctx context.Context, store Storage, project *project.Project) error {
 	clientID, err := store.GetClientID(t.ID)
 	if err != nil {
 		return err
 	}
 
-	req, err := t.ConstructRequest(store, project)
+	issues, err := t.Validate(ctx, project)
+	if err != nil {
+		return err
+	}
+	if issues.Blocking() {
+		saveValidation(store, project, TaskTable, t.ID, clientID, t.Raw, issues)
+		return &ValidationError{Issues: issues}
+	}
+
+	req, err := t.ConstructRequest(ctx, store, project)
 	if err != nil {
 		return err
 	}
 
-	_, err = UpdatePage(clientID, req)
+	resp, err := client.UpdatePage(ctx, clientID, req)
 	if err != nil {
 		return err
 	}
+	clientEdited(project, resp)
+	syncContent(ctx, store, project, t.ID, clientID, false)
 
 	created_at, _ := time.Parse(TIME_LAYOUT_IN, t.CreatedTime)
 	if project.TasksLastSynced < created_at.Unix() {
 		project.TasksLastSynced = created_at.Unix()
-		store.SetLastSynced(project)
 	}
 
-	t.Validate(store, clientID, project.ProjectID)
+	saveValidation(store, project, TaskTable, t.ID, clientID, t.Raw, issues)
 
 	return nil
 }
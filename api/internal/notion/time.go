@@ -1,6 +1,7 @@
 package notion
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
@@ -137,41 +138,29 @@ type Time struct {
 			} `json:"formula"`
 		} `json:"Номер месяца"`
 	} `json:"properties"`
-	URL string `json:"url"`
+	URL string     `json:"url"`
+	Raw Properties `json:"-"`
 }
 
-func (t *Time) Validate(store Storage, client_id string, project_id string) {
-	errs := ""
-	title := ""
-	if len(t.Properties.WhatDid.Title) == 0 {
-		errs += ErrTimeNoTitle + ", "
-	} else {
-		for _, t := range t.Properties.WhatDid.Title {
-			title += t.PlainText
-		}
+func (t *Time) UnmarshalJSON(data []byte) error {
+	type time Time
+	if err := json.Unmarshal(data, (*time)(t)); err != nil {
+		return err
 	}
-	if len(t.Properties.Task.Relation) == 0 {
-		errs += ErrTimeNoTask + ", "
-	}
-	if t.Properties.TotalHours.Number == 0 {
-		errs += ErrTimeNoTotalHours + ", "
-	}
-	if len(errs) > 0 {
-		errs = errs[:len(errs)-2]
-		store.SaveRowsToBeUpdated(Validation{
-			Type:       "time",
-			InternalID: t.ID,
-			ClientID:   client_id,
-			Title:      title,
-			Errors:     errs,
-			ProjectID:  project_id,
-		})
-	} else {
-		store.RemoveRowToBeUpdated(t.ID)
+	raw, err := parseProperties(data)
+	if err != nil {
+		return err
 	}
+	t.Raw = raw
+	return nil
 }
 
-func GetTimes(lastSynced int64, projectID string, cursor string) ([]Time, error) {
+// Validate checks the time row against the validation rules of the project.
+func (t *Time) Validate(ctx context.Context, project *project.Project) (ValidationIssues, error) {
+	return validatePage(ctx, RulesFor(project).Time, t.ID, t.Raw)
+}
+
+func GetTimes(ctx context.Context, lastSynced int64, projectID string, cursor string) ([]Time, error) {
 	req := map[string]interface{}{}
 
 	// TODO: refactor
@@ -226,7 +215,7 @@ func GetTimes(lastSynced int64, projectID string, cursor string) ([]Time, error)
 		req["start_cursor"] = cursor
 	}
 
-	resp, err := SearchPages(os.Getenv("TIMES_DB"), req)
+	resp, err := client.SearchPages(ctx, os.Getenv("TIMES_DB"), req)
 	if err != nil {
 		return nil, err
 	}
@@ -242,7 +231,7 @@ func GetTimes(lastSynced int64, projectID string, cursor string) ([]Time, error)
 	}
 
 	if times.HasMore {
-		moreTimes, err := GetTimes(lastSynced, projectID, times.NextCursor)
+		moreTimes, err := GetTimes(ctx, lastSynced, projectID, times.NextCursor)
 		if err != nil {
 			return nil, err
 		}
@@ -252,8 +241,94 @@ func GetTimes(lastSynced int64, projectID string, cursor string) ([]Time, error)
 	return times.Results, nil
 }
 
-func GetTime(id string) (Time, error) {
-	resp, err := GetPage(id)
+// TimeFilter selects time rows by project and work date, empty fields select everything.
+type TimeFilter struct {
+	ProjectID string // ID of the internal project page
+	From      string // First work date, YYYY-MM-DD
+	To        string // Last work date, YYYY-MM-DD
+}
+
+// FindTimes returns the time rows of the filter, oldest work date first.
+func FindTimes(ctx context.Context, filter TimeFilter, cursor string) ([]Time, error) {
+	conditions := []map[string]interface{}{}
+	if filter.ProjectID != "" {
+		conditions = append(conditions, map[string]interface{}{
+			"property": "Проект",
+			"rollup": map[string]interface{}{
+				"any": map[string]interface{}{
+					"relation": map[string]interface{}{
+						"contains": filter.ProjectID,
+					},
+				},
+			},
+		})
+	}
+	if filter.From != "" {
+		conditions = append(conditions, map[string]interface{}{
+			"property": "Дата работ",
+			"date":     map[string]interface{}{"on_or_after": filter.From},
+		})
+	}
+	if filter.To != "" {
+		conditions = append(conditions, map[string]interface{}{
+			"property": "Дата работ",
+			"date":     map[string]interface{}{"on_or_before": filter.To},
+		})
+	}
+
+	req := map[string]interface{}{
+		"sorts": []map[string]interface{}{
+			{
+				"property":  "Дата работ",
+				"direction": "ascending",
+			},
+		},
+	}
+	if len(conditions) > 0 {
+		req["filter"] = map[string]interface{}{"and": conditions}
+	}
+	if cursor != "" {
+		req["start_cursor"] = cursor
+	}
+
+	resp, err := client.SearchPages(ctx, os.Getenv("TIMES_DB"), req)
+	if err != nil {
+		return nil, err
+	}
+	times := struct {
+		Results    []Time `json:"results"`
+		HasMore    bool   `json:"has_more"`
+		NextCursor string `json:"next_cursor"`
+	}{}
+	if err := json.Unmarshal(resp, &times); err != nil {
+		return nil, err
+	}
+
+	if times.HasMore {
+		more, err := FindTimes(ctx, filter, times.NextCursor)
+		if err != nil {
+			return nil, err
+		}
+		return append(times.Results, more...), nil
+	}
+	return times.Results, nil
+}
+
+// SetTimePaid checks "Оплата" of the internal time row.
+func SetTimePaid(ctx context.Context, id string) error {
+	_, err := client.UpdatePage(ctx, id, map[string]interface{}{
+		"Оплата": map[string]interface{}{"checkbox": true},
+	})
+	return err
+}
+
+// GetTimeIDs returns the IDs of every time row of the internal database, archived rows excluded.
+func GetTimeIDs(ctx context.Context) ([]string, error) {
+	return getPageIDs(ctx, os.Getenv("TIMES_DB"), "")
+}
+
+func GetTime(ctx context.Context, id string) (Time, error) {
+	resp, err := client.GetPage(ctx, id)
 	if err != nil {
 		return Time{}, err
 	}
@@ -267,68 +342,46 @@ func GetTime(id string) (Time, error) {
 	return time, nil
 }
 
-func (t *Time) ConstructRequest(store Storage) (map[string]interface{}, error) {
-	if len(t.Properties.Task.Relation) == 0 {
-		return nil, errors.New("time has no task, time_id = " + t.ID)
-	}
-	task, err := store.GetClientID(t.Properties.Task.Relation[0].ID)
+func (t *Time) ConstructRequest(ctx context.Context, store Storage, project *project.Project) (map[string]interface{}, error) {
+	req, err := buildProperties(ctx, store, project, MappingFor(project).Time, t.ID, t.Raw)
 	if err != nil {
-		return nil, fmt.Errorf("task %s is not copied yet: %w", t.Properties.Task.Relation[0].ID, err)
-	}
-
-	req := map[string]interface{}{
-		"Всего ч": map[string]interface{}{
-			"number": t.Properties.TotalHours.Number,
-		},
-		"Задача": map[string]interface{}{
-			"relation": []map[string]interface{}{
-				{
-					"id": task,
-				},
-			},
-		},
-	}
-	title := ""
-
-	for _, t := range t.Properties.WhatDid.Title {
-		title += t.PlainText
+		return nil, err
 	}
-
-	if len(t.Properties.WhatDid.Title) > 0 {
-		req["Name"] = map[string]interface{}{
-			"type": "title",
-			"title": []map[string]interface{}{
-				{
-					"type": "text",
-					"text": map[string]interface{}{
-						"content": title,
-					},
-				},
-			},
+	for _, rule := range MappingFor(project).Time {
+		if rule.Type == MapTitle && req[rule.Target] == nil {
+			return req, errors.New(ErrTimeNoTitle)
 		}
-		return req, nil
-	} else {
-		return req, errors.New(ErrTimeNoTitle)
 	}
+	return req, nil
 }
 
-func (t *Time) Upload(store Storage, project *project.Project) error {
+func (t *Time) Upload(ctx context.Context, store Storage, project *project.Project) error {
 
 	if _, err := store.GetClientID(t.ID); err != nil && err != sql.ErrNoRows {
 		return err
 	} else if err == nil {
-		return t.Update(store, project)
+		return t.Update(ctx, store, project)
 	}
 
-	req, construct_err := t.ConstructRequest(store)
+	issues, err := t.Validate(ctx, project)
+	if err != nil {
+		return err
+	}
+	if issues.Blocking() {
+		saveValidation(store, project, TimeTable, t.ID, "", t.Raw, issues)
+		return &ValidationError{Issues: issues}
+	}
+
+	req, construct_err := t.ConstructRequest(ctx, store, project)
 	if construct_err != nil && construct_err.Error() != ErrTimeNoTitle {
 		return construct_err
 	}
 
-	body, err := CreatePage(project.TimeDBID, req, "")
+	body, err := client.CreatePage(ctx, project.TimeDBID, req, nil, "")
 	if err != nil {
 		return err
 	}
+	clientEdited(project, body)
 
 	resp := struct {
 		ID string `json:"id"`
@@ -346,27 +399,38 @@ func (t *Time) Upload(store Storage, project *project.Project) error {
 	}
 	if project.TimeLastSynced < created_at.Unix() {
 		project.TimeLastSynced = created_at.Unix()
-		store.SetLastSynced(project)
 	}
 
-	t.Validate(store, resp.ID, project.ProjectID)
+	saveValidation(store, project, TimeTable, t.ID, resp.ID, t.Raw, issues)
 
 	return construct_err
 }
 
-func (t *Time) Update(store Storage, project *project.Project) error {
+func (t *Time) Update(ctx context.Context, store Storage, project *project.Project) error {
 	clientID, err := store.GetClientID(t.ID)
 	if err != nil {
 		return err
 	}
-	req, err := t.ConstructRequest(store)
+
+	issues, err := t.Validate(ctx, project)
+	if err != nil {
+		return err
+	}
+	if issues.Blocking() {
+		saveValidation(store, project, TimeTable, t.ID, clientID, t.Raw, issues)
+		return &ValidationError{Issues: issues}
+	}
+
+	req, err := t.ConstructRequest(ctx, store, project)
 	if err != nil {
 		return err
 	}
 
-	if _, err := UpdatePage(clientID, req); err != nil {
+	body, err := client.UpdatePage(ctx, clientID, req)
+	if err != nil {
 		return err
 	}
+	clientEdited(project, body)
 
 	created_at, err := time.Parse(TIME_LAYOUT_IN, t.CreatedTime)
 	if err != nil {
@@ -374,10 +438,9 @@ func (t *Time) Update(store Storage, project *project.Project) error {
 	}
 	if project.TimeLastSynced < created_at.Unix() {
 		project.TimeLastSynced = created_at.Unix()
-		store.SetLastSynced(project)
 	}
 
-	t.Validate(store, clientID, project.ProjectID)
+	saveValidation(store, project, TimeTable, t.ID, clientID, t.Raw, issues)
 
 	return nil
 }
@@ -0,0 +1,451 @@
+package notion
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Corray333/notion-manager/internal/project"
+	"github.com/spf13/viper"
+)
+
+// Checks of validation rules.
+const (
+	CheckRequired   = "required"    // the property is not empty, numbers are not zero
+	CheckRegex      = "regex"       // the text of the property matches Pattern
+	CheckRange      = "range"       // the number is within Min and Max
+	CheckNotPast    = "not_past"    // the date is not before today
+	CheckNotFuture  = "not_future"  // the date is not after today
+	CheckDailyHours = "daily_hours" // the hours of the worker on the date of the time row are at most Max
+)
+
+// CodeConflict is the code of the issues of pages with conflicting edits, see PullClientChanges.
+const CodeConflict = "conflict"
+
+// ValidationRule checks a property of internal pages.
+type ValidationRule struct {
+	Property string `mapstructure:"property"` // property in the internal database
+	Check    string `mapstructure:"check"`    // one of Check* constants
+	// Pattern is the regular expression of CheckRegex.
+	Pattern string `mapstructure:"pattern"`
+	// Min and Max bound CheckRange, Max also bounds CheckDailyHours.
+	Min *float64 `mapstructure:"min"`
+	Max *float64 `mapstructure:"max"`
+	// Date and Worker are the properties CheckDailyHours groups time rows by.
+	// They default to "Дата работ" and "Исполнитель".
+	Date   string `mapstructure:"date"`
+	Worker string `mapstructure:"worker"`
+	// Severity is SeverityWarning (default) or SeverityError. Pages failing an error rule are not synced.
+	Severity string `mapstructure:"severity"`
+	// Message replaces the default message of the rule.
+	Message string `mapstructure:"message"`
+
+	re *regexp.Regexp // compiled Pattern, see SetValidation
+}
+
+// ValidationRules lists the rules of tasks and time rows.
+type ValidationRules struct {
+	Task []ValidationRule `mapstructure:"task"`
+	Time []ValidationRule `mapstructure:"time"`
+}
+
+// ValidationConfig is the default rules and the per-project overrides keyed by client project ID.
+// A project override replaces the whole task or time list it defines.
+type ValidationConfig struct {
+	Default  ValidationRules            `mapstructure:"default"`
+	Projects map[string]ValidationRules `mapstructure:"projects"`
+}
+
+// DefaultValidation reproduces the checks of the standard dashboard. None of them blocks the sync.
+var DefaultValidation = ValidationRules{
+	Task: []ValidationRule{
+		{Property: "Task", Check: CheckRequired, Message: ErrTaskNoTitle},
+		{Property: "Продукт", Check: CheckRequired, Message: ErrTaskNoProduct},
+		{Property: "Исполнитель", Check: CheckRequired, Message: ErrTaskNoWorker},
+		{Property: "Дедлайн", Check: CheckRequired, Message: ErrTaskNoDeadline},
+		{Property: "Приоритет", Check: CheckRequired, Message: "task priority is empty"},
+	},
+	Time: []ValidationRule{
+		{Property: "Что делали", Check: CheckRequired, Message: ErrTimeNoTitle},
+		{Property: "Задача", Check: CheckRequired, Message: ErrTimeNoTask},
+		{Property: "Всего ч", Check: CheckRequired, Message: ErrTimeNoTotalHours},
+	},
+}
+
+var validation = ValidationConfig{Default: DefaultValidation}
+
+// SetValidation replaces the validation configuration used by the package.
+func SetValidation(cfg ValidationConfig) {
+	if cfg.Default.Task == nil {
+		cfg.Default.Task = DefaultValidation.Task
+	}
+	if cfg.Default.Time == nil {
+		cfg.Default.Time = DefaultValidation.Time
+	}
+	projects := map[string]ValidationRules{}
+	for id, rules := range cfg.Projects {
+		projects[normalizeID(id)] = rules
+	}
+	cfg.Projects = projects
+	for _, rules := range append([]ValidationRules{cfg.Default}, mapValues(cfg.Projects)...) {
+		compilePatterns(rules.Task)
+		compilePatterns(rules.Time)
+	}
+	validation = cfg
+}
+
+// LoadValidation reads the validation configuration from a YAML file.
+// A missing file is not an error: the default rules are used.
+func LoadValidation(path string) error {
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		slog.Info("no validation config found, using the default rules")
+		SetValidation(ValidationConfig{})
+		return nil
+	}
+
+	v := viper.New()
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		return err
+	}
+	cfg := ValidationConfig{}
+	if err := v.Unmarshal(&cfg); err != nil {
+		return err
+	}
+	for _, rules := range append([]ValidationRules{cfg.Default}, mapValues(cfg.Projects)...) {
+		if err := validateRules(append(rules.Task, rules.Time...)); err != nil {
+			return err
+		}
+	}
+	SetValidation(cfg)
+	return nil
+}
+
+// RulesFor returns the validation rules of a project.
+func RulesFor(project *project.Project) ValidationRules {
+	rules := validation.Default
+	if override, ok := validation.Projects[normalizeID(project.ProjectID)]; ok {
+		if override.Task != nil {
+			rules.Task = override.Task
+		}
+		if override.Time != nil {
+			rules.Time = override.Time
+		}
+	}
+	return rules
+}
+
+// compilePatterns compiles the patterns of the regex rules once, instead of for every page.
+// Invalid patterns are left to check, LoadValidation rejects them before.
+func compilePatterns(rules []ValidationRule) {
+	for i := range rules {
+		if rules[i].Check == CheckRegex {
+			rules[i].re, _ = regexp.Compile(rules[i].Pattern)
+		}
+	}
+}
+
+func validateRules(rules []ValidationRule) error {
+	for _, rule := range rules {
+		if rule.Property == "" {
+			return fmt.Errorf("%s rule has no property", rule.Check)
+		}
+		switch rule.Check {
+		case CheckRequired, CheckNotPast, CheckNotFuture:
+		case CheckRegex:
+			if _, err := regexp.Compile(rule.Pattern); err != nil {
+				return fmt.Errorf("regex rule of %q: %w", rule.Property, err)
+			}
+		case CheckRange:
+			if rule.Min == nil && rule.Max == nil {
+				return fmt.Errorf("range rule of %q has neither min nor max", rule.Property)
+			}
+		case CheckDailyHours:
+			if rule.Max == nil {
+				return fmt.Errorf("daily_hours rule of %q has no max", rule.Property)
+			}
+		default:
+			return fmt.Errorf("rule of %q has unknown check %q", rule.Property, rule.Check)
+		}
+		switch rule.Severity {
+		case "", SeverityWarning, SeverityError:
+		default:
+			return fmt.Errorf("rule of %q has unknown severity %q", rule.Property, rule.Severity)
+		}
+	}
+	return nil
+}
+
+// ValidationIssue is a failed rule of a page.
+type ValidationIssue struct {
+	Field    string `json:"field"`    // Property of the page
+	Code     string `json:"code"`     // Check of the rule, one of Check* constants or CodeConflict
+	Message  string `json:"message"`  // What is wrong
+	Severity string `json:"severity"` // SeverityWarning or SeverityError
+}
+
+// ValidationIssues are stored as JSON.
+type ValidationIssues []ValidationIssue
+
+func (v ValidationIssues) Value() (driver.Value, error) {
+	if v == nil {
+		v = ValidationIssues{}
+	}
+	data, err := json.Marshal(v)
+	return string(data), err
+}
+
+func (v *ValidationIssues) Scan(src interface{}) error {
+	// A new slice is decoded every time, the scanned struct may be reused for the next row.
+	issues := ValidationIssues{}
+	switch src := src.(type) {
+	case nil:
+	case string:
+		if err := json.Unmarshal([]byte(src), &issues); err != nil {
+			return err
+		}
+	case []byte:
+		if err := json.Unmarshal(src, &issues); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("can't scan %T into validation issues", src)
+	}
+	*v = issues
+	return nil
+}
+
+// Messages joins the messages of the issues.
+func (v ValidationIssues) Messages() string {
+	messages := make([]string, len(v))
+	for i, issue := range v {
+		messages[i] = issue.Message
+	}
+	return strings.Join(messages, ", ")
+}
+
+// Blocking reports whether any of the issues stops the page from being synced.
+func (v ValidationIssues) Blocking() bool {
+	for _, issue := range v {
+		if issue.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidationError is returned by uploads of pages failing rules with SeverityError.
+type ValidationError struct {
+	Issues ValidationIssues
+}
+
+func (e *ValidationError) Error() string {
+	return "page failed validation: " + e.Issues.Messages()
+}
+
+// validatePage checks the properties of an internal page against the rules.
+func validatePage(ctx context.Context, rules []ValidationRule, pageID string, props Properties) (ValidationIssues, error) {
+	issues := ValidationIssues{}
+	for _, rule := range rules {
+		message, err := rule.check(ctx, pageID, props)
+		if err != nil {
+			return nil, err
+		}
+		if message == "" {
+			continue
+		}
+		if rule.Message != "" {
+			message = rule.Message
+		}
+		severity := rule.Severity
+		if severity == "" {
+			severity = SeverityWarning
+		}
+		issues = append(issues, ValidationIssue{
+			Field:    rule.Property,
+			Code:     rule.Check,
+			Message:  message,
+			Severity: severity,
+		})
+	}
+	return issues, nil
+}
+
+// check returns what is wrong with the property or an empty string.
+// Only CheckRequired fails on empty properties.
+func (r ValidationRule) check(ctx context.Context, pageID string, props Properties) (string, error) {
+	prop := props[r.Property]
+	if r.Check == CheckRequired {
+		if number, ok := prop.NumberValue(); isEmpty(prop) || ok && number == 0 {
+			return fmt.Sprintf("%s is empty", r.Property), nil
+		}
+		return "", nil
+	}
+	if isEmpty(prop) {
+		return "", nil
+	}
+
+	switch r.Check {
+	case CheckRegex:
+		re := r.re
+		if re == nil {
+			var err error
+			if re, err = regexp.Compile(r.Pattern); err != nil {
+				return "", err
+			}
+		}
+		if !re.MatchString(prop.Text()) {
+			return fmt.Sprintf("%s %q doesn't match %s", r.Property, prop.Text(), r.Pattern), nil
+		}
+	case CheckRange:
+		number, ok := prop.NumberValue()
+		if !ok {
+			return "", nil
+		}
+		if r.Min != nil && number < *r.Min || r.Max != nil && number > *r.Max {
+			return fmt.Sprintf("%s %v is out of range %s", r.Property, number, r.bounds()), nil
+		}
+	case CheckNotPast, CheckNotFuture:
+		date := prop.DateValue()
+		if date == nil {
+			return "", nil
+		}
+		day := strings.SplitN(date.Start, "T", 2)[0]
+		today := time.Now().Format(time.DateOnly)
+		if r.Check == CheckNotPast && day < today {
+			return fmt.Sprintf("%s %s is in the past", r.Property, day), nil
+		}
+		if r.Check == CheckNotFuture && day > today {
+			return fmt.Sprintf("%s %s is in the future", r.Property, day), nil
+		}
+	case CheckDailyHours:
+		return r.checkDailyHours(ctx, pageID, props)
+	}
+	return "", nil
+}
+
+func (r ValidationRule) bounds() string {
+	bound := func(b *float64) string {
+		if b == nil {
+			return "…"
+		}
+		return fmt.Sprint(*b)
+	}
+	return "[" + bound(r.Min) + ", " + bound(r.Max) + "]"
+}
+
+// checkDailyHours sums the hours of all internal time rows of the worker on the date of the row.
+func (r ValidationRule) checkDailyHours(ctx context.Context, pageID string, props Properties) (string, error) {
+	dateProp, workerProp := r.Date, r.Worker
+	if dateProp == "" {
+		dateProp = "Дата работ"
+	}
+	if workerProp == "" {
+		workerProp = "Исполнитель"
+	}
+	date := props[dateProp].DateValue()
+	if date == nil || len(props[workerProp].People) == 0 {
+		return "", nil
+	}
+	day := strings.SplitN(date.Start, "T", 2)[0]
+
+	total := 0.0
+	for _, worker := range props[workerProp].People {
+		rows, err := queryPages(ctx, os.Getenv("TIMES_DB"), map[string]interface{}{
+			"and": []map[string]interface{}{
+				{"property": dateProp, "date": map[string]interface{}{"equals": day}},
+				{"property": workerProp, "people": map[string]interface{}{"contains": worker.ID}},
+			},
+		}, "")
+		if err != nil {
+			return "", err
+		}
+		sum := 0.0
+		for _, row := range rows {
+			if normalizeID(row.ID) == normalizeID(pageID) {
+				// The row itself may not be indexed yet, its hours are taken from props.
+				continue
+			}
+			hours, _ := row.Properties[r.Property].NumberValue()
+			sum += hours
+		}
+		hours, _ := props[r.Property].NumberValue()
+		total = max(total, sum+hours)
+	}
+	if total > *r.Max {
+		return fmt.Sprintf("%v hours on %s, more than %v", total, day, *r.Max), nil
+	}
+	return "", nil
+}
+
+// queryPages returns all pages of a database matching the filter.
+func queryPages(ctx context.Context, dbid string, filter map[string]interface{}, cursor string) ([]pageState, error) {
+	req := map[string]interface{}{"filter": filter}
+	if cursor != "" {
+		req["start_cursor"] = cursor
+	}
+	resp, err := client.SearchPages(ctx, dbid, req)
+	if err != nil {
+		return nil, err
+	}
+	pages := pageStateList{}
+	if err := json.Unmarshal(resp, &pages); err != nil {
+		return nil, err
+	}
+	if pages.HasMore {
+		more, err := queryPages(ctx, dbid, filter, pages.NextCursor)
+		if err != nil {
+			return nil, err
+		}
+		return append(pages.Results, more...), nil
+	}
+	return pages.Results, nil
+}
+
+// saveValidation saves the issues of a page to to_be_updated, or removes the page from it if there are none.
+func saveValidation(store Storage, project *project.Project, table TableType, internalID, clientID string, props Properties, issues ValidationIssues) {
+	if len(issues) == 0 {
+		store.RemoveRowToBeUpdated(internalID)
+		return
+	}
+	val := newValidation(project, string(table), internalID, clientID, props)
+	val.Errors = issues.Messages()
+	val.Issues = issues
+	store.SaveRowsToBeUpdated(val)
+	publishValidation(val)
+}
+
+// newValidation returns a to_be_updated row of the page without issues.
+func newValidation(project *project.Project, typ, internalID, clientID string, props Properties) Validation {
+	val := Validation{
+		Title:       props.title(),
+		Type:        typ,
+		InternalID:  internalID,
+		ClientID:    clientID,
+		ProjectID:   project.ProjectID,
+		InternalURL: pageURL(internalID),
+		Employee:    responsible(props),
+	}
+	if clientID != "" {
+		val.ClientURL = pageURL(clientID)
+	}
+	return val
+}
+
+// responsible returns the names of the people assigned to an internal page.
+func responsible(props Properties) string {
+	names := []string{}
+	for _, person := range props["Исполнитель"].People {
+		if person.Name != "" {
+			names = append(names, person.Name)
+		}
+	}
+	return strings.Join(names, ", ")
+}
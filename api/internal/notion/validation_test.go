@@ -0,0 +1,93 @@
+package notion_test
+
+import (
+	"testing"
+
+	"github.com/Corray333/notion-manager/internal/notion"
+)
+
+func TestValidationRules(t *testing.T) {
+	e := newEnv(t)
+	maxEstimate, maxHours := 2.0, 8.0
+	notion.SetValidation(notion.ValidationConfig{Default: notion.ValidationRules{
+		Task: []notion.ValidationRule{
+			{Property: "Task", Check: notion.CheckRegex, Pattern: `^\[[A-Z]+\] `, Severity: notion.SeverityError},
+			{Property: "Оценка", Check: notion.CheckRange, Max: &maxEstimate},
+		},
+		Time: []notion.ValidationRule{
+			{Property: "Всего ч", Check: notion.CheckDailyHours, Max: &maxHours},
+		},
+	}})
+	t.Cleanup(func() { notion.SetValidation(notion.ValidationConfig{}) })
+	e.fake.AddProperty(timesDB, "Дата работ", "date")
+
+	bad := e.addTask("Bad", internalProject, "")
+	good := e.addTask("[A] Good", internalProject, "")
+	day := map[string]interface{}{
+		"Дата работ":  map[string]interface{}{"date": map[string]interface{}{"start": "2024-06-03"}},
+		"Исполнитель": map[string]interface{}{"people": []map[string]interface{}{{"id": workerUser}}},
+	}
+	morning, evening := e.addTime("Morning", good, 5), e.addTime("Evening", good, 5)
+	e.fake.SetPage(morning, day)
+	e.fake.SetPage(evening, day)
+	e.sync(t)
+
+	issues := map[string]notion.ValidationIssues{}
+	rows, err := e.store.GetRowsToBeUpdated()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, row := range rows {
+		issues[row.InternalID] = row.Issues
+	}
+
+	if _, err := e.store.GetClientID(bad); err == nil {
+		t.Error("page failing an error rule was synced")
+	}
+	if got := issues[bad]; len(got) != 2 || got[0].Code != notion.CheckRegex || got[0].Severity != notion.SeverityError {
+		t.Errorf("unexpected issues of the bad task %+v", got)
+	}
+	e.clientID(t, good)
+	if got := issues[good]; len(got) != 1 || got[0].Code != notion.CheckRange || got[0].Severity != notion.SeverityWarning {
+		t.Errorf("unexpected issues of the good task %+v", got)
+	}
+	if got := issues[evening]; len(got) != 1 || got[0].Code != notion.CheckDailyHours {
+		t.Errorf("expected 10 hours a day to be flagged, got %+v", got)
+	}
+
+	// Fixing the page lets it through.
+	e.fake.SetPage(bad, map[string]interface{}{"Task": title("[B] Fixed")})
+	e.sync(t)
+	e.clientID(t, bad)
+}
+
+func TestFixQueue(t *testing.T) {
+	e := newEnv(t)
+	task := e.addTask("No deadline", internalProject, "")
+	e.fake.SetPage(task, map[string]interface{}{"Дедлайн": map[string]interface{}{"date": nil}})
+	other := e.addTask("Other worker", internalProject, "")
+	e.fake.SetPage(other, map[string]interface{}{
+		"Дедлайн":     map[string]interface{}{"date": nil},
+		"Исполнитель": map[string]interface{}{"people": []map[string]interface{}{{"id": "someone", "name": "Anna"}}},
+	})
+	e.sync(t)
+
+	rows, err := e.store.GetFixQueue(notion.FixFilter{ProjectID: e.clientProject, Employee: "Mark", Type: "task"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 1 || rows[0].InternalID != task {
+		t.Fatalf("expected only the task of Mark, got %+v", rows)
+	}
+	row := rows[0]
+	if row.Employee != "Mark" || row.ClientURL == "" || row.InternalURL == "" || row.FirstSeenAt.IsZero() {
+		t.Errorf("row is missing details %+v", row)
+	}
+	if len(row.Issues) != 1 || row.Issues[0].Field != "Дедлайн" || row.Issues[0].Code != notion.CheckRequired {
+		t.Errorf("unexpected issues %+v", row.Issues)
+	}
+
+	if rows, _ := e.store.GetFixQueue(notion.FixFilter{Employee: "Anna"}); len(rows) != 1 || rows[0].InternalID != other {
+		t.Errorf("expected only the task of Anna, got %+v", rows)
+	}
+}
@@ -0,0 +1,169 @@
+package notion
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// Types of webhook events the sync handles.
+const (
+	WebhookPageCreated = "page.created"
+	WebhookPageUpdated = "page.properties_updated"
+	WebhookPageDeleted = "page.deleted"
+)
+
+var (
+	ErrWebhookNotConfigured = errors.New("webhook secret is not set")
+	ErrInvalidSignature     = errors.New("invalid webhook signature")
+)
+
+// WebhookEvent is an event delivered by a Notion webhook subscription.
+type WebhookEvent struct {
+	ID     string `json:"id"`
+	Type   string `json:"type"`
+	Entity struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+	} `json:"entity"`
+	Data struct {
+		Parent struct {
+			ID   string `json:"id"`
+			Type string `json:"type"`
+		} `json:"parent"`
+	} `json:"data"`
+}
+
+// webhookSecret is the verification token of the webhook subscription, used to sign events.
+var webhookSecret string
+
+// SetWebhookSecret sets the verification token Notion signs webhook events with.
+func SetWebhookSecret(secret string) {
+	webhookSecret = secret
+}
+
+// webhookDebounce is how long a page must stay quiet after an event before it is synced.
+var webhookDebounce = 5 * time.Second
+
+// SetWebhookDebounce sets how long a page must stay quiet after a webhook event before it is synced.
+func SetWebhookDebounce(d time.Duration) {
+	webhookDebounce = d
+}
+
+// webhookPages are the pages waiting for their debounce timer.
+var webhookPages = struct {
+	mu     sync.Mutex
+	timers map[string]*time.Timer
+}{timers: map[string]*time.Timer{}}
+
+// VerifyWebhookSignature checks the X-Notion-Signature header of a webhook request:
+// "sha256=" followed by the HMAC-SHA256 of the body keyed with the verification token.
+func VerifyWebhookSignature(body []byte, signature string) error {
+	if webhookSecret == "" {
+		return ErrWebhookNotConfigured
+	}
+	mac := hmac.New(sha256.New, []byte(webhookSecret))
+	mac.Write(body)
+	expected := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// HandleWebhookEvent schedules the sync of the page the event is about, if it is a page of the
+// internal tasks or times databases. Events of the same page are debounced: the page is synced
+// once it had no events for the debounce period. It reports whether the event was scheduled.
+func HandleWebhookEvent(store Storage, event WebhookEvent) bool {
+	switch event.Type {
+	case WebhookPageCreated, WebhookPageUpdated, WebhookPageDeleted:
+	default:
+		return false
+	}
+	switch normalizeID(event.Data.Parent.ID) {
+	case normalizeID(os.Getenv("TASKS_DB")), normalizeID(os.Getenv("TIMES_DB")):
+	default:
+		return false
+	}
+	if event.Entity.Type != "page" || event.Entity.ID == "" {
+		return false
+	}
+
+	scheduleWebhookPage(store, event.Entity.ID, event.Type == WebhookPageDeleted)
+	return true
+}
+
+func scheduleWebhookPage(store Storage, pageID string, deleted bool) {
+	webhookPages.mu.Lock()
+	defer webhookPages.mu.Unlock()
+
+	key := normalizeID(pageID)
+	if timer, ok := webhookPages.timers[key]; ok {
+		timer.Stop()
+	}
+	webhookPages.timers[key] = time.AfterFunc(webhookDebounce, func() {
+		webhookPages.mu.Lock()
+		delete(webhookPages.timers, key)
+		webhookPages.mu.Unlock()
+		syncWebhookPage(store, pageID, deleted)
+	})
+}
+
+// syncWebhookPage saves jobs uploading the page to the projects it belongs to and processes them
+// or, for deleted pages, starts the grace period of their client copies. While a sync is running
+// the jobs wait for the next ProcessJobs.
+func syncWebhookPage(store Storage, pageID string, deleted bool) {
+	ctx := context.Background()
+	if deleted {
+		clientID, err := store.GetClientID(pageID)
+		if err != nil {
+			return
+		}
+		projects, err := store.GetProjects()
+		if err != nil {
+			slog.Error("error while getting projects: " + err.Error())
+			return
+		}
+		if _, err := detectArchived(ctx, store, projects, pageID, clientID); err != nil {
+			slog.Error("error while handling deleted page " + pageID + ": " + err.Error())
+		}
+		return
+	}
+
+	task, row, related, err := getSyncPage(ctx, pageID)
+	if err != nil {
+		slog.Error("error while getting page " + pageID + " from webhook: " + err.Error())
+		return
+	}
+	job := Job{PageID: pageID, Type: string(TaskTable)}
+	if task != nil {
+		job.PageID = task.ID
+	} else if row != nil {
+		job.PageID, job.Type = row.ID, string(TimeTable)
+	}
+	projects, err := store.GetProjects()
+	if err != nil {
+		slog.Error("error while getting projects: " + err.Error())
+		return
+	}
+	for _, project := range projects {
+		if project.Paused || !belongsTo(&project, related) {
+			continue
+		}
+		job := job
+		job.ProjectID, job.Status, job.NextRunAt = project.ProjectID, JobPending, time.Now()
+		if err := store.NewJob(&job); err != nil {
+			slog.Error("error while saving job: " + err.Error())
+		}
+	}
+
+	if err := ProcessJobs(ctx, store); err != nil && !errors.Is(err, ErrSyncRunning) {
+		slog.Error("error while processing jobs of page " + pageID + " from webhook: " + err.Error())
+	}
+}
@@ -0,0 +1,66 @@
+package notion_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+	"time"
+
+	"github.com/Corray333/notion-manager/internal/notion"
+)
+
+func TestVerifyWebhookSignature(t *testing.T) {
+	notion.SetWebhookSecret("secret_token")
+	t.Cleanup(func() { notion.SetWebhookSecret("") })
+
+	body := []byte(`{"type":"page.created"}`)
+	mac := hmac.New(sha256.New, []byte("secret_token"))
+	mac.Write(body)
+	if err := notion.VerifyWebhookSignature(body, "sha256="+hex.EncodeToString(mac.Sum(nil))); err != nil {
+		t.Errorf("valid signature rejected: %v", err)
+	}
+	if err := notion.VerifyWebhookSignature(body, "sha256=00"); err != notion.ErrInvalidSignature {
+		t.Errorf("expected invalid signature, got %v", err)
+	}
+}
+
+func TestWebhookDebouncesPageEvents(t *testing.T) {
+	e := newEnv(t)
+	notion.SetWebhookDebounce(20 * time.Millisecond)
+	t.Cleanup(func() { notion.SetWebhookDebounce(5 * time.Second) })
+
+	e.sync(t)
+	task := e.addTask("Hooked", internalProject, "")
+	event := notion.WebhookEvent{Type: notion.WebhookPageUpdated}
+	event.Entity.ID, event.Entity.Type = task, "page"
+	event.Data.Parent.ID, event.Data.Parent.Type = tasksDB, "database"
+	for i := 0; i < 3; i++ {
+		if !notion.HandleWebhookEvent(e.store, event) {
+			t.Fatal("event of an internal task was ignored")
+		}
+	}
+	other := event
+	other.Data.Parent.ID = clientTasksDB
+	if notion.HandleWebhookEvent(e.store, other) {
+		t.Error("event of a client page was scheduled")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if _, err := e.store.GetClientID(task); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("page was not synced after the webhook")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if jobs, _ := e.store.GetJobs(notion.JobDone, 10); len(jobs) != 1 || jobs[0].PageID != task {
+		t.Errorf("expected one job uploading the page, got %+v", jobs)
+	}
+	if runs, _ := e.store.GetSyncRuns(10); len(runs) != 1 || runs[0].PageID != "" {
+		t.Errorf("expected no runs besides the first sync, got %+v", runs)
+	}
+}
@@ -0,0 +1,174 @@
+package notion
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/Corray333/notion-manager/internal/project"
+)
+
+// Properties of the client "Ставки" database the sync fills when it creates a worker.
+const (
+	workerName      = "Name"
+	workerLink      = "Ссылка"
+	workerDirection = "Направление"
+)
+
+// workersKey keeps the workerCache of a run in the context.
+type workersKey struct{}
+
+// workerCache remembers the client worker pages found or created during a run,
+// so that Notion is queried once per worker and database instead of once per page.
+type workerCache struct {
+	mu      sync.Mutex                   // guards the maps, it is never held during requests
+	workers map[string]*cached[string]   // client worker page ID by database and person ID
+	schemas map[string]*cached[[]string] // schema of the client workers database by ID
+}
+
+// cached is a value of workerCache with the lock held while it is fetched.
+type cached[T any] struct {
+	mu    sync.Mutex
+	value T
+	ok    bool
+}
+
+func newWorkerCache() *workerCache {
+	return &workerCache{workers: map[string]*cached[string]{}, schemas: map[string]*cached[[]string]{}}
+}
+
+// withWorkerCache returns a context that caches worker lookups until it is done.
+func withWorkerCache(ctx context.Context) context.Context {
+	return context.WithValue(ctx, workersKey{}, newWorkerCache())
+}
+
+// cacheGet returns the value of the key, fetching it if it isn't cached yet. Callers of the same key
+// wait for the first one, so a worker is never created twice, callers of other keys don't wait.
+// Failed fetches aren't cached.
+func cacheGet[T any](cache *workerCache, values map[string]*cached[T], key string, fetch func() (T, error)) (T, error) {
+	cache.mu.Lock()
+	entry, ok := values[key]
+	if !ok {
+		entry = &cached[T]{}
+		values[key] = entry
+	}
+	cache.mu.Unlock()
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if !entry.ok {
+		value, err := fetch()
+		if err != nil {
+			return value, err
+		}
+		entry.value, entry.ok = value, true
+	}
+	return entry.value, nil
+}
+
+// clientWorkers returns the client worker pages of the people, creating the missing ones.
+// direction is written to new workers if the client database has the property.
+func clientWorkers(ctx context.Context, project *project.Project, people []Person, direction string) ([]string, error) {
+	if project.WorkersDBID == "" {
+		return nil, nil
+	}
+	cache, _ := ctx.Value(workersKey{}).(*workerCache)
+	if cache == nil {
+		cache = newWorkerCache()
+	}
+
+	ids := []string{}
+	for _, person := range people {
+		key := normalizeID(project.WorkersDBID) + "/" + person.ID
+		id, err := cacheGet(cache, cache.workers, key, func() (string, error) {
+			worker, err := getWorker(ctx, project.WorkersDBID, person.ID)
+			if err != nil {
+				return "", err
+			}
+			if worker != nil {
+				return worker.ID, nil
+			}
+			return createWorker(ctx, cache, project.WorkersDBID, person, direction)
+		})
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(ids, id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+// getWorker finds the worker linked to the Notion user, nil if there is none.
+func getWorker(ctx context.Context, dbid, workerId string) (*Worker, error) {
+	filter := map[string]interface{}{
+		"filter": map[string]interface{}{
+			"property": workerLink,
+			"people": map[string]interface{}{
+				"contains": workerId,
+			},
+		},
+	}
+
+	resp, err := client.SearchPages(ctx, dbid, filter)
+	if err != nil {
+		return nil, err
+	}
+	worker := struct {
+		Results []Worker `json:"results"`
+	}{}
+	if err := json.Unmarshal(resp, &worker); err != nil {
+		return nil, err
+	}
+	if len(worker.Results) == 0 {
+		return nil, nil
+	}
+	return &worker.Results[0], nil
+}
+
+// WorkerRate returns the hourly rate ("Ставка в час") of the person in the client workers database,
+// false if the person has no worker page there.
+func WorkerRate(ctx context.Context, dbid, personID string) (float64, bool, error) {
+	worker, err := getWorker(ctx, dbid, personID)
+	if err != nil || worker == nil {
+		return 0, false, err
+	}
+	return worker.Properties.Salary.Number, true, nil
+}
+
+// createWorker adds the Notion user to the client workers database and returns the new page ID.
+func createWorker(ctx context.Context, cache *workerCache, dbid string, person Person, direction string) (string, error) {
+	schema, err := cacheGet(cache, cache.schemas, normalizeID(dbid), func() ([]string, error) {
+		return GetSchema(ctx, dbid)
+	})
+	if err != nil {
+		return "", err
+	}
+
+	name := person.Name
+	if name == "" {
+		name = person.ID
+	}
+	req := map[string]interface{}{
+		workerName: textValue(MapTitle, name),
+		workerLink: map[string]interface{}{"people": []map[string]interface{}{{"id": person.ID}}},
+	}
+	if direction != "" && slices.Contains(schema, workerDirection) {
+		req[workerDirection] = map[string]interface{}{"select": map[string]interface{}{"name": direction}}
+	}
+
+	resp, err := client.CreatePage(ctx, dbid, req, nil, "")
+	if err != nil {
+		return "", fmt.Errorf("error while creating worker %s: %w", name, err)
+	}
+	page := struct {
+		ID string `json:"id"`
+	}{}
+	if err := json.Unmarshal(resp, &page); err != nil {
+		return "", err
+	}
+	return page.ID, nil
+}
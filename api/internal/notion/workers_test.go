@@ -0,0 +1,54 @@
+package notion_test
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSyncCreatesMissingWorkers(t *testing.T) {
+	e := newEnv(t)
+	e.fake.AddProperty(tasksDB, "Направление", "select")
+	e.fake.AddProperty(clientWorkersDB, "Направление", "select")
+
+	team := map[string]interface{}{
+		"Исполнитель": map[string]interface{}{"people": []map[string]interface{}{
+			{"id": workerUser, "name": "Mark"},
+			{"id": "anna", "name": "Anna"},
+		}},
+		"Направление": map[string]interface{}{"select": map[string]interface{}{"name": "Дизайн"}},
+	}
+	first, second := e.addTask("First", internalProject, ""), e.addTask("Second", internalProject, "")
+	e.fake.SetPage(first, team)
+	e.fake.SetPage(second, team)
+	e.sync(t)
+
+	workers := e.fake.Pages(clientWorkersDB)
+	if len(workers) != 2 {
+		t.Fatalf("expected Anna to be added once, got %d workers", len(workers))
+	}
+	anna := workers[1]
+	if got := titleOf(anna, "Name"); got != "Anna" {
+		t.Errorf("new worker name = %q, want Anna", got)
+	}
+	if direction, _ := anna.Properties["Направление"].(map[string]interface{}); direction == nil {
+		t.Errorf("expected the direction of the new worker to be set, got %+v", anna.Properties)
+	}
+
+	for _, id := range []string{first, second} {
+		page, _ := e.fake.Page(e.clientID(t, id))
+		items, _ := page.Properties["Исполнитель"].(map[string]interface{})["relation"].([]interface{})
+		if len(items) != 2 {
+			t.Errorf("expected both assignees on the client task, got %+v", items)
+		}
+	}
+
+	lookups := 0
+	for _, req := range e.fake.Requests() {
+		if strings.Contains(req.Path, clientWorkersDB) && strings.HasSuffix(req.Path, "/query") {
+			lookups++
+		}
+	}
+	if lookups != 2 {
+		t.Errorf("expected one lookup per worker, got %d", lookups)
+	}
+}
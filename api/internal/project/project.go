@@ -7,16 +7,20 @@ import (
 )
 
 type Project struct {
-	ProjectID       string   `db:"project_id"`
-	InternalID      string   `db:"internal_id"`
-	Name            string   `db:"name"`
-	ProjectsDBID    string   `db:"-"`
-	TimeDBID        string   `db:"time_db_id"`
-	TasksDBID       string   `db:"tasks_db_id"`
-	WorkersDBID     string   `db:"workers_db_id"`
-	TasksLastSynced int64    `db:"tasks_last_synced"`
-	TimeLastSynced  int64    `db:"time_last_synced"`
-	Schema          []string `db:"-"`
+	ProjectID       string `json:"project_id" db:"project_id"`               // ID of project page in client dashboard
+	InternalID      string `json:"internal_id" db:"internal_id"`             // ID of project page in internal dashboard
+	Name            string `json:"name" db:"name"`                           // Project name
+	ProjectsDBID    string `json:"-" db:"-"`                                 // ID of projects database in client dashboard
+	TimeDBID        string `json:"time_db_id" db:"time_db_id"`               // ID of time database in client dashboard
+	TasksDBID       string `json:"tasks_db_id" db:"tasks_db_id"`             // ID of tasks database in client dashboard
+	WorkersDBID     string `json:"workers_db_id" db:"workers_db_id"`         // ID of workers database in client dashboard
+	TasksLastSynced int64  `json:"tasks_last_synced" db:"tasks_last_synced"` // Last edit of internal tasks copied, unix time
+	TimeLastSynced  int64  `json:"time_last_synced" db:"time_last_synced"`   // Last edit of internal time rows copied, unix time
+	// ClientLastSynced is the last edit of the client dashboard seen by the two-way sync.
+	ClientLastSynced int64 `json:"client_last_synced" db:"client_last_synced"`
+	// Paused projects are skipped by the sync unless they are synced on their own.
+	Paused bool     `json:"paused" db:"paused"`
+	Schema []string `json:"-" db:"-"`
 }
 
 func (p *Project) Update(client notionapi.Client) error {
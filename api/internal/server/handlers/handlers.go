@@ -3,130 +3,1759 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/Corray333/notion-manager/internal/export"
 	"github.com/Corray333/notion-manager/internal/gsheets"
+	"github.com/Corray333/notion-manager/internal/invoice"
 	"github.com/Corray333/notion-manager/internal/mindmap"
 	"github.com/Corray333/notion-manager/internal/notion"
 	"github.com/Corray333/notion-manager/internal/project"
+	"github.com/go-chi/chi/v5"
+	"golang.org/x/oauth2"
 )
 
 type Storage interface {
 	NewProject(proj *project.Project) error
 	GetProjects() ([]project.Project, error)
+	UpdateProject(proj *project.Project) error
+	DeleteProject(projectID string) error
 	SetLastSynced(project *project.Project) error
+	SetClientLastSynced(projectID string, clientLastSynced int64) error
 	GetClientID(internalID string) (string, error)
 	GetInternalID(clientID string) (string, error)
 	SetClientID(internalID, clientID string) error
+	GetClientIDs() (map[string]string, error)
+	RemoveClientID(internalID string) error
+	GetContentHash(internalID string) (string, error)
+	SetContentHash(internalID, hash string) error
+	SaveCommentLink(link notion.CommentLink) error
+	GetCommentLinks(pageID string) ([]notion.CommentLink, error)
 	SaveError(err notion.Error) error
 	SaveRowsToBeUpdated(notion.Validation)
 	GetRowsToBeUpdated() ([]notion.Validation, error)
 	GetRowsToBeUpdatedByProject(projectID string) ([]notion.Validation, error)
+	GetFixQueue(filter notion.FixFilter) ([]notion.Validation, error)
 	RemoveRowToBeUpdated(internalID string) error
+	SaveArchivedPage(page notion.ArchivedPage) error
+	GetArchivedPages() ([]notion.ArchivedPage, error)
+	SetArchivedPageRemoved(internalID string) error
+	RemoveArchivedPage(internalID string) error
+	NewSyncRun(run *notion.SyncRun) error
+	FinishSyncRun(run *notion.SyncRun) error
+	InterruptSyncRuns() error
+	SaveSyncRunProject(stats notion.ProjectStats) error
+	SaveSyncRunError(runErr notion.RunError) error
+	GetSyncRun(id int64) (*notion.SyncRun, error)
+	GetSyncRuns(limit int) ([]notion.SyncRun, error)
+	GetErrors(filter notion.ErrorFilter) ([]notion.ErrorRecord, int, error)
+	GetErrorSummary(filter notion.ErrorFilter) ([]notion.ErrorSummary, error)
+	AckError(id int64) error
+	NewJob(job *notion.Job) error
+	UpdateJob(job *notion.Job) error
+	GetDueJobs(now time.Time, limit int) ([]notion.Job, error)
+	ResetRunningJobs() error
+	GetJobs(status string, limit int) ([]notion.Job, error)
+	GetSheetsTargets() ([]gsheets.Target, error)
+	GetSheetsTarget(id int64) (*gsheets.Target, error)
+	NewSheetsTarget(target *gsheets.Target) error
+	UpdateSheetsTarget(target *gsheets.Target) error
+	DeleteSheetsTarget(id int64) error
+	GetGoogleToken() (*oauth2.Token, error)
+	SaveGoogleToken(token *oauth2.Token) error
+	DeleteGoogleToken() error
+	NewInvoice(inv *invoice.Invoice) error
+	GetInvoice(id int64) (*invoice.Invoice, error)
+	GetInvoices(projectID string) ([]invoice.Invoice, error)
+	UpdateInvoice(inv *invoice.Invoice) error
+	DeleteInvoice(id int64) error
+}
+
+type SyncStartedResponse struct {
+	ID      int64  `json:"id,omitempty"`      // ID of the sync run, running or started
+	Running string `json:"running,omitempty"` // Work blocking the sync instead of a run: jobs, fix or reset
+}
+
+type ErrorsResponse struct {
+	Errors []notion.ErrorRecord `json:"errors"` // Page of errors, last seen first
+	Total  int                  `json:"total"`  // Number of errors matching the filter
 }
 
 type NewProjectRequest struct {
-	Name              string `json:"name"`                // Project name
-	ProjectClientId   string `json:"project_client_id"`   // ID of project in internal dashboard
-	ProjectInternalID string `json:"project_internal_id"` // ID of project in client dashboard
-	TimeDBID          string `json:"time_db_id"`          // ID of time database in client dashboard
-	TasksDBID         string `json:"tasks_db_id"`         // ID of tasks database in client dashboard
-	TimeLastSynced    int    `json:"time_last_synced"`    // Time to start searching for updates in time database
-	TasksLastSynced   int    `json:"tasks_last_synced"`   // Time to start searching for updates in tasks database
-	WorkerDBID        string `json:"worker_db_id"`        // ID of worker database in client dashboard
-}
-
-// // NewProject creates a new project
-// // @Summary Create a new project
-// // @Description Create a new project with the given details
-// // @Tags projects
-// // @Accept  json
-// // @Produce  json
-// // @Param   project body NewProjectRequest true "New Project"
-// // @Success 201 {string} string "Created"
-// // @Failure 400 {string} string "Bad Request"
-// // @Failure 500 {string} string "Internal Server Error"
-// // @Router /projects [post]
-// func NewProject(store Storage) http.HandlerFunc {
-// 	return func(w http.ResponseWriter, r *http.Request) {
-// 		var req NewProjectRequest
-// 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-// 			slog.Error("error decoding request: " + err.Error())
-// 			http.Error(w, err.Error(), http.StatusBadRequest)
-// 			return
-// 		}
-// 		proj := project.Project{
-// 			Name:        req.Name,
-// 			ProjectID:   req.ProjectClientId,
-// 			InternalID:  req.ProjectInternalID,
-// 			TimeDBID:    req.TimeDBID,
-// 			TasksDBID:   req.TasksDBID,
-// 			WorkersDBID: req.WorkerDBID,
-// 		}
-// 		if err := store.NewProject(proj); err != nil {
-// 			slog.Error("error creating project: " + err.Error())
-// 			http.Error(w, err.Error(), http.StatusInternalServerError)
-// 			return
-// 		}
-// 		w.WriteHeader(http.StatusCreated)
-// 	}
-// }
+	Name        string `json:"name"`          // Project name
+	ProjectID   string `json:"project_id"`    // ID of project page in client dashboard
+	InternalID  string `json:"internal_id"`   // ID of project page in internal dashboard
+	TimeDBID    string `json:"time_db_id"`    // ID of time database in client dashboard
+	TasksDBID   string `json:"tasks_db_id"`   // ID of tasks database in client dashboard
+	WorkersDBID string `json:"workers_db_id"` // ID of workers database in client dashboard
+	Paused      bool   `json:"paused"`        // Create the project without syncing it
+}
+
+// UpdateProjectRequest changes the fields that are set.
+type UpdateProjectRequest struct {
+	Name        *string `json:"name"`          // Project name
+	InternalID  *string `json:"internal_id"`   // ID of project page in internal dashboard
+	TimeDBID    *string `json:"time_db_id"`    // ID of time database in client dashboard
+	TasksDBID   *string `json:"tasks_db_id"`   // ID of tasks database in client dashboard
+	WorkersDBID *string `json:"workers_db_id"` // ID of workers database in client dashboard
+	Paused      *bool   `json:"paused"`        // Skip the project when syncing all projects
+}
+
+// GetProjects retrieves all projects
+// @Summary Get projects
+// @Description Retrieve all projects with their databases, pause and sync cursors
+// @Tags projects
+// @Produce  json
+// @Success 200 {array} project.Project "OK"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /projects [get]
+func GetProjects(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		projects, err := store.GetProjects()
+		if err != nil {
+			slog.Error("error getting projects: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if projects == nil {
+			projects = []project.Project{}
+		}
+		if err := json.NewEncoder(w).Encode(projects); err != nil {
+			slog.Error("error encoding response: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// GetProject retrieves a project
+// @Summary Get project
+// @Description Retrieve a project with its databases, pause and sync cursors
+// @Tags projects
+// @Produce  json
+// @Param   projectID path string true "Client project ID"
+// @Success 200 {object} project.Project "OK"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /projects/{projectID} [get]
+func GetProject(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		project, ok := findProject(w, r, store)
+		if !ok {
+			return
+		}
+		if err := json.NewEncoder(w).Encode(project); err != nil {
+			slog.Error("error encoding response: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// NewProject creates a new project
+// @Summary Create a new project
+// @Description Create a new project with the given details. The client databases must exist and have the properties the sync needs.
+// @Tags projects
+// @Accept  json
+// @Produce  json
+// @Param   project body NewProjectRequest true "New Project"
+// @Success 201 {object} project.Project "Created"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 409 {string} string "Project already exists"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /projects [post]
+func NewProject(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var req NewProjectRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			slog.Error("error decoding request: " + err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		proj := project.Project{
+			Name:        req.Name,
+			ProjectID:   req.ProjectID,
+			InternalID:  req.InternalID,
+			TimeDBID:    req.TimeDBID,
+			TasksDBID:   req.TasksDBID,
+			WorkersDBID: req.WorkersDBID,
+			Paused:      req.Paused,
+		}
+
+		projects, err := store.GetProjects()
+		if err != nil {
+			slog.Error("error getting projects: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, p := range projects {
+			if sameID(p.ProjectID, proj.ProjectID) || sameID(p.InternalID, proj.InternalID) {
+				http.Error(w, "project "+p.ProjectID+" already exists", http.StatusConflict)
+				return
+			}
+		}
+		if !validProject(w, r, &proj) {
+			return
+		}
+
+		if err := store.NewProject(&proj); err != nil {
+			slog.Error("error creating project: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(proj)
+	}
+}
+
+// UpdateProject updates a project
+// @Summary Update project
+// @Description Change the name, the databases or the pause of a project. Changed databases are validated like on creation.
+// @Tags projects
+// @Accept  json
+// @Produce  json
+// @Param   projectID path string true "Client project ID"
+// @Param   project body UpdateProjectRequest true "Fields to change"
+// @Success 200 {object} project.Project "OK"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /projects/{projectID} [patch]
+func UpdateProject(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		proj, ok := findProject(w, r, store)
+		if !ok {
+			return
+		}
+		var req UpdateProjectRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			slog.Error("error decoding request: " + err.Error())
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if req.Name != nil {
+			proj.Name = *req.Name
+		}
+		if req.Paused != nil {
+			proj.Paused = *req.Paused
+		}
+		changed := false
+		for _, field := range []struct {
+			value *string
+			dst   *string
+		}{
+			{req.InternalID, &proj.InternalID},
+			{req.TimeDBID, &proj.TimeDBID},
+			{req.TasksDBID, &proj.TasksDBID},
+			{req.WorkersDBID, &proj.WorkersDBID},
+		} {
+			if field.value != nil && *field.value != *field.dst {
+				*field.dst = *field.value
+				changed = true
+			}
+		}
+		if changed && !validProject(w, r, proj) {
+			return
+		}
+
+		if err := store.UpdateProject(proj); err != nil {
+			slog.Error("error updating project: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(proj); err != nil {
+			slog.Error("error encoding response: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// DeleteProject deletes a project
+// @Summary Delete project
+// @Description Stop syncing a project and forget it. Client copies are kept.
+// @Description Projects linked on the dashboards page are found again by the next sync, pause them instead.
+// @Tags projects
+// @Param   projectID path string true "Client project ID"
+// @Success 204 "No Content"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /projects/{projectID} [delete]
+func DeleteProject(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		proj, ok := findProject(w, r, store)
+		if !ok {
+			return
+		}
+		if err := store.DeleteProject(proj.ProjectID); err != nil {
+			slog.Error("error deleting project: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// ResetProject resets the sync cursors of a project
+// @Summary Reset project cursors
+// @Description Reset the task and time cursors so that the next sync copies all pages of the project again.
+// @Description The cursor of client edits is kept, so client edits are not pulled twice.
+// @Tags projects
+// @Produce  json
+// @Param   projectID path string true "Client project ID"
+// @Success 200 {object} project.Project "OK"
+// @Failure 404 {string} string "Not Found"
+// @Failure 409 {string} string "A sync is running"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /projects/{projectID}/reset [post]
+func ResetProject(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		proj, err := notion.ResetProject(r.Context(), store, chi.URLParam(r, "projectID"))
+		switch {
+		case errors.Is(err, notion.ErrProjectNotFound):
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		case errors.Is(err, notion.ErrSyncRunning):
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		case err != nil:
+			slog.Error("error resetting project: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(proj); err != nil {
+			slog.Error("error encoding response: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// findProject returns the project of the projectID URL parameter or responds with an error.
+func findProject(w http.ResponseWriter, r *http.Request, store Storage) (*project.Project, bool) {
+	proj, err := notion.FindProject(store, chi.URLParam(r, "projectID"))
+	if errors.Is(err, notion.ErrProjectNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		slog.Error("error getting project: " + err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return proj, true
+}
+
+// validProject checks the databases of the project or responds with an error.
+func validProject(w http.ResponseWriter, r *http.Request, proj *project.Project) bool {
+	err := notion.ValidateProject(r.Context(), proj)
+	var projectErr *notion.ProjectError
+	if errors.As(err, &projectErr) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if err != nil {
+		slog.Error("error validating project: " + err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+func sameID(a, b string) bool {
+	return a != "" && strings.ReplaceAll(a, "-", "") == strings.ReplaceAll(b, "-", "")
+}
 
 // UpdateDatabases triggers the update of databases
 // @Summary Update databases
-// @Description Start the process of updating the databases
+// @Description Start the process of updating the databases. Only one sync can run at a time.
 // @Tags databases
-// @Success 202 {string} string "Accepted"
+// @Produce  json
+// @Param   full query bool false "Ignore the sync cursors and copy all pages again, recreating deleted client copies"
+// @Param   dry_run query bool false "Respond with what the sync would change instead of running it, nothing is written"
+// @Success 200 {object} notion.SyncPlan "Dry run"
+// @Success 202 {object} SyncStartedResponse "Accepted"
+// @Failure 409 {object} SyncStartedResponse "Another sync, the job retries or the fix of broken pages are running"
 // @Failure 500 {string} string "Internal Server Error"
 // @Router /sync [patch]
 func UpdateDatabases(store Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// TODO: forbid multiple updates at the same time
-		if err := notion.StartSync(store); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
+		startSync(w, r, store, notion.SyncOptions{})
+	}
+}
+
+// SyncProject triggers the update of a single project
+// @Summary Sync project
+// @Description Start the process of updating the dashboard of a single project. Only one sync can run at a time.
+// @Tags databases
+// @Produce  json
+// @Param   projectID path string true "Client project ID"
+// @Param   full query bool false "Ignore the sync cursors and copy all pages again, recreating deleted client copies"
+// @Param   dry_run query bool false "Respond with what the sync would change instead of running it, nothing is written"
+// @Success 200 {object} notion.SyncPlan "Dry run"
+// @Success 202 {object} SyncStartedResponse "Accepted"
+// @Failure 404 {string} string "Not Found"
+// @Failure 409 {object} SyncStartedResponse "Another sync, the job retries or the fix of broken pages are running"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /projects/{projectID}/sync [patch]
+func SyncProject(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		project, ok := findProject(w, r, store)
+		if !ok {
 			return
 		}
-		w.WriteHeader(http.StatusAccepted)
+		startSync(w, r, store, notion.SyncOptions{ProjectID: project.ProjectID})
 	}
 }
 
-// GetToBeUpdated retrieves the rows that need to be updated
-// @Summary Get rows to be updated
-// @Description Retrieve the rows that need to be updated
-// @Tags updates
+// SyncPage triggers the update of a single page
+// @Summary Sync page
+// @Description Start the process of copying a single internal task or time row to the dashboards of its projects.
+// @Description Errors about the page itself are reported by the sync run. Only one sync can run at a time.
+// @Tags databases
 // @Produce  json
-// @Success 200 {array} notion.Validation "OK"
+// @Param   internalID path string true "ID of page in internal dashboard"
+// @Param   full query bool false "Recreate the client copy if it was deleted"
+// @Param   dry_run query bool false "Respond with what the sync would change instead of running it, nothing is written"
+// @Success 200 {object} notion.SyncPlan "Dry run"
+// @Success 202 {object} SyncStartedResponse "Accepted"
+// @Failure 409 {object} SyncStartedResponse "Another sync, the job retries or the fix of broken pages are running"
 // @Failure 500 {string} string "Internal Server Error"
-// @Router /fix [get]
-func GetToBeUpdated(store Storage) http.HandlerFunc {
+// @Router /pages/{internalID}/sync [patch]
+func SyncPage(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		startSync(w, r, store, notion.SyncOptions{PageID: chi.URLParam(r, "internalID")})
+	}
+}
+
+// NotionWebhook receives events of the Notion webhook subscription
+// @Summary Notion webhook
+// @Description Receive page events of the internal tasks and times databases and sync the changed pages shortly after.
+// @Description Events of the same page are debounced. Requests must be signed with the verification token in X-Notion-Signature,
+// @Description except the verification request Notion sends when the subscription is created: its token is logged.
+// @Tags databases
+// @Accept  json
+// @Param   X-Notion-Signature header string true "sha256=HMAC of the body"
+// @Success 200 "OK"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 401 {string} string "Invalid signature"
+// @Failure 503 {string} string "Webhook secret is not set"
+// @Router /webhooks/notion [post]
+func NotionWebhook(store Storage) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		rows, err := store.GetRowsToBeUpdated()
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
 		if err != nil {
-			slog.Error("error getting rows to be updated: " + err.Error())
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		verification := struct {
+			VerificationToken string `json:"verification_token"`
+		}{}
+		if json.Unmarshal(body, &verification) == nil && verification.VerificationToken != "" {
+			slog.Info("notion webhook verification token received, set NOTION_WEBHOOK_SECRET to it", "token", verification.VerificationToken)
+			return
+		}
+
+		if err := notion.VerifyWebhookSignature(body, r.Header.Get("X-Notion-Signature")); err != nil {
+			status := http.StatusUnauthorized
+			if errors.Is(err, notion.ErrWebhookNotConfigured) {
+				status = http.StatusServiceUnavailable
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+
+		event := notion.WebhookEvent{}
+		if err := json.Unmarshal(body, &event); err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		notion.HandleWebhookEvent(store, event)
+	}
+}
+
+// startSync starts a sync run with the options and the full query parameter and responds with its ID.
+func startSync(w http.ResponseWriter, r *http.Request, store Storage, opts notion.SyncOptions) {
+	if full := r.URL.Query().Get("full"); full != "" {
+		var err error
+		if opts.Full, err = strconv.ParseBool(full); err != nil {
+			http.Error(w, "full must be true or false", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if dryRun := r.URL.Query().Get("dry_run"); dryRun != "" {
+		plan, err := strconv.ParseBool(dryRun)
+		if err != nil {
+			http.Error(w, "dry_run must be true or false", http.StatusBadRequest)
+			return
+		}
+		if plan {
+			planSync(w, r, store, opts)
+			return
+		}
+	}
+
+	id, err := notion.StartSync(context.Background(), store, opts)
+	if errors.Is(err, notion.ErrSyncRunning) {
+		w.WriteHeader(http.StatusConflict)
+		if work := notion.RunningWork(); work != "" {
+			json.NewEncoder(w).Encode(SyncStartedResponse{Running: work})
+			return
+		}
+		json.NewEncoder(w).Encode(SyncStartedResponse{ID: notion.RunningSync()})
+		return
+	}
+	if err != nil {
+		slog.Error("error starting sync: " + err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(SyncStartedResponse{ID: id})
+}
+
+// planSync responds with what the sync would change instead of running it.
+func planSync(w http.ResponseWriter, r *http.Request, store Storage, opts notion.SyncOptions) {
+	plan, err := notion.PlanSync(r.Context(), store, opts)
+	switch {
+	case errors.Is(err, notion.ErrProjectNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, notion.ErrPageNotSyncable):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		slog.Error("error planning sync: " + err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(plan); err != nil {
+		slog.Error("error encoding response: " + err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// GetJobs retrieves the latest upload jobs
+// @Summary Get jobs
+// @Description Retrieve the latest page upload jobs, newest first. Failed uploads are retried with a growing delay until they run out of attempts.
+// @Tags databases
+// @Produce  json
+// @Param   status query string false "Filter by status: pending, running, done, failed or cancelled"
+// @Param   limit query int false "Number of jobs, 50 by default, at most 500"
+// @Success 200 {array} notion.Job "OK"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /jobs [get]
+func GetJobs(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := 50
+		if l := r.URL.Query().Get("limit"); l != "" {
+			n, err := strconv.Atoi(l)
+			if err != nil || n < 1 {
+				http.Error(w, "limit must be a positive number", http.StatusBadRequest)
+				return
+			}
+			limit = min(n, 500)
+		}
+		status := r.URL.Query().Get("status")
+		switch status {
+		case "", notion.JobPending, notion.JobRunning, notion.JobDone, notion.JobFailed, notion.JobCancelled:
+		default:
+			http.Error(w, "unknown job status", http.StatusBadRequest)
+			return
+		}
+
+		jobs, err := store.GetJobs(status, limit)
+		if err != nil {
+			slog.Error("error getting jobs: " + err.Error())
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		if err := json.NewEncoder(w).Encode(rows); err != nil {
+		if err := json.NewEncoder(w).Encode(jobs); err != nil {
+			slog.Error("error encoding response: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// GetSyncRuns retrieves the latest sync runs
+// @Summary Get sync runs
+// @Description Retrieve the latest sync runs with per-project counts, newest first
+// @Tags databases
+// @Produce  json
+// @Param   limit query int false "Number of runs, 20 by default, at most 100"
+// @Success 200 {array} notion.SyncRun "OK"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /sync [get]
+func GetSyncRuns(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limit := 20
+		if l := r.URL.Query().Get("limit"); l != "" {
+			n, err := strconv.Atoi(l)
+			if err != nil || n < 1 {
+				http.Error(w, "limit must be a positive number", http.StatusBadRequest)
+				return
+			}
+			limit = min(n, 100)
+		}
+
+		runs, err := store.GetSyncRuns(limit)
+		if err != nil {
+			slog.Error("error getting sync runs: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(runs); err != nil {
 			slog.Error("error encoding response: " + err.Error())
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
+		}
+	}
+}
+
+// GetSyncRun retrieves a sync run
+// @Summary Get sync run
+// @Description Retrieve the status, per-project counts and errors of a sync run
+// @Tags databases
+// @Produce  json
+// @Param   id path int true "Sync run ID"
+// @Success 200 {object} notion.SyncRun "OK"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /sync/{id} [get]
+func GetSyncRun(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid sync run id", http.StatusBadRequest)
+			return
+		}
 
+		run, err := store.GetSyncRun(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "sync run not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.Error("error getting sync run: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(run); err != nil {
+			slog.Error("error encoding response: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
 	}
 }
 
-func UpdateGoogleSheets(w http.ResponseWriter, r *http.Request) {
-	err := gsheets.UpdateGoogleSheets()
+// CancelSync stops a running sync
+// @Summary Cancel sync run
+// @Description Cancel the running sync. Pages already copied stay copied.
+// @Tags databases
+// @Param   id path int true "Sync run ID"
+// @Success 202 {string} string "Accepted"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 409 {string} string "The run is not running"
+// @Router /sync/{id} [delete]
+func CancelSync(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		slog.Error(err.Error())
+		http.Error(w, "invalid sync run id", http.StatusBadRequest)
+		return
+	}
+	if err := notion.CancelSync(id); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
 		return
 	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// syncEventsPing is how often a comment is sent to keep an idle event stream open.
+const syncEventsPing = 15 * time.Second
+
+// SyncEvents streams the progress of sync runs
+// @Summary Stream sync events
+// @Description Stream events of sync runs as Server-Sent Events. The event name is the event type,
+// @Description the data is a notion.SyncEvent. Events of the current run are replayed on connect.
+// @Tags databases
+// @Produce  text/event-stream
+// @Success 200 {object} notion.SyncEvent "OK"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /sync/events [get]
+func SyncEvents(w http.ResponseWriter, r *http.Request) {
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// nginx buffers proxied responses, which would hold the events back.
+	w.Header().Set("X-Accel-Buffering", "no")
 	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		slog.Error("event stream is not supported: " + err.Error())
+		return
+	}
 
+	events, unsubscribe := notion.SubscribeEvents()
+	defer unsubscribe()
+	ping := time.NewTicker(syncEventsPing)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ping.C:
+			if _, err := io.WriteString(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-events:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				slog.Error("error encoding sync event: " + err.Error())
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", event.Seq, event.Type, data); err != nil {
+				return
+			}
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// GetToBeUpdated retrieves the rows that need to be updated
+// @Summary Get rows to be updated
+// @Description Retrieve the pages that failed validation or have conflicting edits, oldest first.
+// @Description With format=csv every issue is a line of a CSV file, so that each employee can get their own list.
+// @Tags updates
+// @Produce  json
+// @Produce  text/csv
+// @Param   project query string false "Client project ID"
+// @Param   employee query string false "Name of the responsible employee"
+// @Param   type query string false "task, time, task_conflict or time_conflict"
+// @Param   format query string false "json (default) or csv"
+// @Success 200 {array} notion.Validation "OK"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /fix [get]
+func GetToBeUpdated(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		rows, err := store.GetFixQueue(notion.FixFilter{
+			ProjectID: query.Get("project"),
+			Employee:  query.Get("employee"),
+			Type:      query.Get("type"),
+		})
+		if err != nil {
+			slog.Error("error getting rows to be updated: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		switch query.Get("format") {
+		case "", "json":
+		case "csv":
+			w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+			w.Header().Set("Content-Disposition", `attachment; filename="to_be_updated.csv"`)
+			if err := writeFixCSV(w, rows); err != nil {
+				slog.Error("error writing csv: " + err.Error())
+			}
+			return
+		default:
+			http.Error(w, "format must be json or csv", http.StatusBadRequest)
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(rows); err != nil {
+			slog.Error("error encoding response: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+
+		}
+	}
+}
+
+// writeFixCSV writes a line for every issue of the rows, rows saved without issues get a line with their errors.
+func writeFixCSV(w io.Writer, rows []notion.Validation) error {
+	out := csv.NewWriter(w)
+	if err := out.Write([]string{"employee", "project_id", "type", "title", "field", "code", "severity", "message", "internal_url", "client_url", "first_seen_at", "last_seen_at"}); err != nil {
+		return err
+	}
+	for _, row := range rows {
+		issues := row.Issues
+		if len(issues) == 0 {
+			issues = notion.ValidationIssues{{Message: row.Errors}}
+		}
+		for _, issue := range issues {
+			// Titles and messages come from the pages, they must not be opened as formulas.
+			if err := out.Write(export.EscapeCSV([]string{
+				row.Employee,
+				row.ProjectID,
+				row.Type,
+				row.Title,
+				issue.Field,
+				issue.Code,
+				issue.Severity,
+				issue.Message,
+				row.InternalURL,
+				row.ClientURL,
+				row.FirstSeenAt.Format(time.RFC3339),
+				row.LastSeenAt.Format(time.RFC3339),
+			})); err != nil {
+				return err
+			}
+		}
+	}
+	out.Flush()
+	return out.Error()
+}
+
+// GetErrors retrieves the errors saved by syncs
+// @Summary Get errors
+// @Description Retrieve the errors saved by syncs, last seen first. Acknowledged errors are left out by default.
+// @Tags errors
+// @Produce  json
+// @Param   project query string false "Client project ID"
+// @Param   type query string false "Type of database: task, time or project"
+// @Param   severity query string false "warning, error or critical"
+// @Param   since query string false "Errors seen at or after this time, RFC 3339 or YYYY-MM-DD"
+// @Param   acknowledged query string false "false (default), true or all"
+// @Param   limit query int false "Number of errors, 50 by default, at most 500"
+// @Param   offset query int false "Number of errors to skip"
+// @Success 200 {object} ErrorsResponse "OK"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /errors [get]
+func GetErrors(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := errorFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		filter.Limit = 50
+		for _, param := range []struct {
+			name string
+			dst  *int
+			min  int
+		}{
+			{"limit", &filter.Limit, 1},
+			{"offset", &filter.Offset, 0},
+		} {
+			if v := r.URL.Query().Get(param.name); v != "" {
+				n, err := strconv.Atoi(v)
+				if err != nil || n < param.min {
+					http.Error(w, "invalid "+param.name, http.StatusBadRequest)
+					return
+				}
+				*param.dst = n
+			}
+		}
+		filter.Limit = min(filter.Limit, 500)
+
+		records, total, err := store.GetErrors(filter)
+		if err != nil {
+			slog.Error("error getting errors: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(ErrorsResponse{Errors: records, Total: total}); err != nil {
+			slog.Error("error encoding response: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// GetErrorSummary retrieves the errors grouped by message
+// @Summary Get error summary
+// @Description Retrieve the errors grouped by message, most frequent first. Takes the same filters as /errors.
+// @Tags errors
+// @Produce  json
+// @Param   project query string false "Client project ID"
+// @Param   type query string false "Type of database: task, time or project"
+// @Param   severity query string false "warning, error or critical"
+// @Param   since query string false "Errors seen at or after this time, RFC 3339 or YYYY-MM-DD"
+// @Param   acknowledged query string false "false (default), true or all"
+// @Success 200 {array} notion.ErrorSummary "OK"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /errors/summary [get]
+func GetErrorSummary(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		filter, err := errorFilter(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		summary, err := store.GetErrorSummary(filter)
+		if err != nil {
+			slog.Error("error getting error summary: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(summary); err != nil {
+			slog.Error("error encoding response: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// AckError acknowledges an error
+// @Summary Acknowledge error
+// @Description Mark an error as handled. If it happens again it is saved as a new error.
+// @Tags errors
+// @Param   id path int true "Error ID"
+// @Success 204 "No Content"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /errors/{id}/ack [post]
+func AckError(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid error id", http.StatusBadRequest)
+			return
+		}
+		err = store.AckError(id)
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "error not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.Error("error acknowledging error: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// errorFilter reads the filter of the errors endpoints from the query.
+func errorFilter(r *http.Request) (notion.ErrorFilter, error) {
+	query := r.URL.Query()
+	filter := notion.ErrorFilter{
+		ProjectID: query.Get("project"),
+		Type:      query.Get("type"),
+		Severity:  query.Get("severity"),
+	}
+	if since := query.Get("since"); since != "" {
+		var err error
+		if filter.Since, err = time.Parse(time.RFC3339, since); err != nil {
+			if filter.Since, err = time.Parse(time.DateOnly, since); err != nil {
+				return filter, errors.New("since must be RFC 3339 time or YYYY-MM-DD date")
+			}
+		}
+	}
+	switch query.Get("acknowledged") {
+	case "", "false":
+		filter.Acknowledged = new(bool)
+	case "true":
+		acknowledged := true
+		filter.Acknowledged = &acknowledged
+	case "all":
+	default:
+		return filter, errors.New("acknowledged must be true, false or all")
+	}
+	return filter, nil
+}
+
+// FixBroken syncs the rows that need to be updated again
+// @Summary Fix broken pages
+// @Description Sync every page that failed validation again. Pages fixed in the internal dashboard leave the queue.
+// @Description A failing page doesn't stop the others. Can't run during a sync.
+// @Tags updates
+// @Produce  json
+// @Success 200 {object} notion.FixReport "OK"
+// @Failure 409 {string} string "A sync is running"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /fix/run [post]
+func FixBroken(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report, err := notion.FixBroken(r.Context(), store)
+		if errors.Is(err, notion.ErrSyncRunning) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			slog.Error("error fixing broken pages: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			slog.Error("error encoding response: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// GetArchivedPages retrieves the pages archived in the internal dashboard
+// @Summary Get archived pages
+// @Description Retrieve internal pages found archived or deleted and whether their client copies were removed
+// @Tags updates
+// @Produce  json
+// @Success 200 {array} notion.ArchivedPage "OK"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /archived [get]
+func GetArchivedPages(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		pages, err := store.GetArchivedPages()
+		if err != nil {
+			slog.Error("error getting archived pages: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(pages); err != nil {
+			slog.Error("error encoding response: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// UpdateGoogleSheets exports time rows to Google Sheets
+// @Summary Update Google Sheets
+// @Description Export the time rows edited since the last export to every enabled target, or to a single target.
+// @Tags sheets
+// @Param   target query int false "ID of the target to export to, enabled or not"
+// @Success 200 "OK"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Failure 503 {string} string "Google authorization is required, see /google/status"
+// @Router /sheets [patch]
+func UpdateGoogleSheets(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var err error
+		if target := r.URL.Query().Get("target"); target != "" {
+			id, parseErr := strconv.ParseInt(target, 10, 64)
+			if parseErr != nil {
+				http.Error(w, "invalid target id", http.StatusBadRequest)
+				return
+			}
+			t, getErr := store.GetSheetsTarget(id)
+			if errors.Is(getErr, gsheets.ErrTargetNotFound) {
+				http.Error(w, getErr.Error(), http.StatusNotFound)
+				return
+			}
+			if getErr != nil {
+				slog.Error("error getting sheets target: " + getErr.Error())
+				http.Error(w, getErr.Error(), http.StatusInternalServerError)
+				return
+			}
+			err = gsheets.ExportTargets(r.Context(), store, []gsheets.Target{*t})
+		} else {
+			err = gsheets.UpdateGoogleSheets(r.Context(), store)
+		}
+		if err != nil {
+			sheetsError(w, "error updating google sheets", err)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+// GetSheetsTargets retrieves the Google Sheets targets
+// @Summary Get sheets targets
+// @Description Retrieve the sheets the time rows are exported to with their column layouts
+// @Tags sheets
+// @Produce  json
+// @Success 200 {array} gsheets.Target "OK"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /sheets/targets [get]
+func GetSheetsTargets(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		targets, err := store.GetSheetsTargets()
+		if err != nil {
+			slog.Error("error getting sheets targets: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(targets); err != nil {
+			slog.Error("error encoding response: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// NewSheetsTarget creates a Google Sheets target
+// @Summary Create sheets target
+// @Description Add a sheet to export the time rows to. Sheet, key_column, last_synced_cell and first_row default to
+// @Description "Sheet1", "W", "X2" and 3. Every column value is a property name or a template with {placeholders}.
+// @Tags sheets
+// @Accept  json
+// @Produce  json
+// @Param   target body gsheets.Target true "Target"
+// @Success 201 {object} gsheets.Target "Created"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 409 {string} string "Conflict"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /sheets/targets [post]
+func NewSheetsTarget(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		target := gsheets.Target{Enabled: true}
+		if !decodeSheetsTarget(w, r, store, &target) {
+			return
+		}
+		if err := store.NewSheetsTarget(&target); err != nil {
+			slog.Error("error creating sheets target: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(target)
+	}
+}
+
+// UpdateSheetsTarget replaces a Google Sheets target
+// @Summary Update sheets target
+// @Description Replace the settings and the columns of a target
+// @Tags sheets
+// @Accept  json
+// @Produce  json
+// @Param   id path int true "Target ID"
+// @Param   target body gsheets.Target true "Target"
+// @Success 200 {object} gsheets.Target "OK"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 404 {string} string "Not Found"
+// @Failure 409 {string} string "Conflict"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /sheets/targets/{id} [put]
+func UpdateSheetsTarget(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid target id", http.StatusBadRequest)
+			return
+		}
+		target := gsheets.Target{Enabled: true}
+		if !decodeSheetsTarget(w, r, store, &target, id) {
+			return
+		}
+		target.ID = id
+		err = store.UpdateSheetsTarget(&target)
+		if errors.Is(err, gsheets.ErrTargetNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.Error("error updating sheets target: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(target)
+	}
+}
+
+// DeleteSheetsTarget deletes a Google Sheets target
+// @Summary Delete sheets target
+// @Description Stop exporting to a target. The sheet itself is left as it is.
+// @Tags sheets
+// @Param   id path int true "Target ID"
+// @Success 204 "No Content"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /sheets/targets/{id} [delete]
+func DeleteSheetsTarget(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid target id", http.StatusBadRequest)
+			return
+		}
+		err = store.DeleteSheetsTarget(id)
+		if errors.Is(err, gsheets.ErrTargetNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.Error("error deleting sheets target: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// GetStaleRows previews the stale rows of a Google Sheets target
+// @Summary Preview stale sheet rows
+// @Description List the rows of the target whose time row was deleted, archived or moved out of the target, and
+// @Description the duplicates of rows above. Nothing is changed.
+// @Tags sheets
+// @Produce  json
+// @Param   id path int true "Target ID"
+// @Success 200 {array} gsheets.StaleRow "OK"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 404 {string} string "Not Found"
+// @Failure 409 {string} string "No time rows found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Failure 503 {string} string "Google authorization is required, see /google/status"
+// @Router /sheets/targets/{id}/stale [get]
+func GetStaleRows(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		target, ok := findSheetsTarget(w, r, store)
+		if !ok {
+			return
+		}
+		rows, err := gsheets.FindStaleRows(r.Context(), store, target)
+		if err != nil {
+			sheetsError(w, "error finding stale rows", err)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(rows); err != nil {
+			slog.Error("error encoding response: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// RemoveStaleRows deletes or marks the stale rows of a Google Sheets target
+// @Summary Remove stale sheet rows
+// @Description Delete the stale rows of the target or write STALE in its mark column, see /sheets/targets/{id}/stale
+// @Tags sheets
+// @Produce  json
+// @Param   id path int true "Target ID"
+// @Param   mode query string false "delete or mark, the reconcile mode of the target or delete by default"
+// @Success 200 {array} gsheets.StaleRow "Removed rows, numbered as before the removal"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 404 {string} string "Not Found"
+// @Failure 409 {string} string "No time rows found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Failure 503 {string} string "Google authorization is required, see /google/status"
+// @Router /sheets/targets/{id}/reconcile [post]
+func RemoveStaleRows(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		target, ok := findSheetsTarget(w, r, store)
+		if !ok {
+			return
+		}
+		mode := r.URL.Query().Get("mode")
+		if mode == "" {
+			mode = target.Reconcile
+		}
+		if mode == "" {
+			mode = gsheets.ReconcileDelete
+		}
+		if mode != gsheets.ReconcileDelete && mode != gsheets.ReconcileMark {
+			http.Error(w, "mode must be delete or mark", http.StatusBadRequest)
+			return
+		}
+		rows, err := gsheets.RemoveStaleRows(r.Context(), store, target, mode)
+		if err != nil {
+			sheetsError(w, "error removing stale rows", err)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(rows); err != nil {
+			slog.Error("error encoding response: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// findSheetsTarget returns the target of the id URL parameter. It writes the error response and returns false if there is none.
+func findSheetsTarget(w http.ResponseWriter, r *http.Request, store Storage) (*gsheets.Target, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid target id", http.StatusBadRequest)
+		return nil, false
+	}
+	target, err := store.GetSheetsTarget(id)
+	if errors.Is(err, gsheets.ErrTargetNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		slog.Error("error getting sheets target: " + err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return target, true
+}
+
+// sheetsError writes the response of a failed call to Google Sheets.
+func sheetsError(w http.ResponseWriter, msg string, err error) {
+	switch {
+	case errors.Is(err, gsheets.ErrAuthRequired) || errors.Is(err, gsheets.ErrNotConfigured):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	case errors.Is(err, gsheets.ErrNoTimeRows):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		slog.Error(msg + ": " + err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// ExportTimes exports time rows to a file
+// @Summary Export times
+// @Description Download the time rows as an XLSX or CSV file with the columns of the default Google Sheets target,
+// @Description or of the target given. Task links are hyperlinks in XLSX.
+// @Tags export
+// @Produce  application/vnd.openxmlformats-officedocument.spreadsheetml.sheet
+// @Produce  text/csv
+// @Param   from query string false "First work date, YYYY-MM-DD"
+// @Param   to query string false "Last work date, YYYY-MM-DD"
+// @Param   project query string false "Internal project ID"
+// @Param   employee query string false "Name of the employee"
+// @Param   format query string false "xlsx (default) or csv"
+// @Param   target query int false "ID of the sheets target whose columns are exported"
+// @Success 200 {file} file "OK"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /export/times [get]
+func ExportTimes(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		format := query.Get("format")
+		if format == "" {
+			format = export.FormatXLSX
+		}
+		if format != export.FormatXLSX && format != export.FormatCSV {
+			http.Error(w, export.ErrUnknownFormat.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, param := range []string{"from", "to"} {
+			if date := query.Get(param); date != "" {
+				if _, err := time.Parse("2006-01-02", date); err != nil {
+					http.Error(w, param+" must be YYYY-MM-DD", http.StatusBadRequest)
+					return
+				}
+			}
+		}
+
+		columns := gsheets.DefaultTarget.Columns
+		if id := query.Get("target"); id != "" {
+			targetID, err := strconv.ParseInt(id, 10, 64)
+			if err != nil {
+				http.Error(w, "invalid target id", http.StatusBadRequest)
+				return
+			}
+			target, err := store.GetSheetsTarget(targetID)
+			if errors.Is(err, gsheets.ErrTargetNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				slog.Error("error getting sheets target: " + err.Error())
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			columns = target.Columns
+		}
+
+		times, err := export.GetTimes(r.Context(), export.Filter{
+			TimeFilter: notion.TimeFilter{
+				ProjectID: query.Get("project"),
+				From:      query.Get("from"),
+				To:        query.Get("to"),
+			},
+			Employee: query.Get("employee"),
+		})
+		if err != nil {
+			slog.Error("error getting times: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", export.ContentType(format))
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="times.%s"`, format))
+		if err := export.Write(w, format, columns, times); err != nil {
+			slog.Error("error writing export: " + err.Error())
+		}
+	}
+}
+
+// GoogleAuth redirects to the Google consent screen
+// @Summary Authorize Google Sheets
+// @Description Redirect to the Google consent screen. Google redirects back to /google/callback, which saves the token.
+// @Tags google
+// @Success 302 "Found"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /google/auth [get]
+func GoogleAuth(w http.ResponseWriter, r *http.Request) {
+	url, err := gsheets.AuthURL()
+	if errors.Is(err, gsheets.ErrNotConfigured) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.Error("error building google auth url: " + err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// GoogleCallback saves the Google token
+// @Summary Google OAuth callback
+// @Description Exchange the code Google redirected with for a token and save it
+// @Tags google
+// @Param   state query string true "State of the consent screen"
+// @Param   code query string true "Authorization code"
+// @Success 200 {string} string "OK"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /google/callback [get]
+func GoogleCallback(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		if e := query.Get("error"); e != "" {
+			http.Error(w, "google authorization failed: "+e, http.StatusBadRequest)
+			return
+		}
+		err := gsheets.Callback(r.Context(), store, query.Get("state"), query.Get("code"))
+		if errors.Is(err, gsheets.ErrInvalidState) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			slog.Error("error saving google token: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("Google Sheets is authorized, you can close this page."))
+	}
+}
+
+// GetGoogleStatus reports whether Google Sheets can be reached
+// @Summary Google authorization status
+// @Description Report the credentials in use, the expiry of the token and whether a new consent is needed
+// @Tags google
+// @Produce  json
+// @Success 200 {object} gsheets.AuthStatus "OK"
+// @Router /google/status [get]
+func GetGoogleStatus(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewEncoder(w).Encode(gsheets.GetStatus(store)); err != nil {
+			slog.Error("error encoding response: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// DeleteGoogleToken forgets the Google token
+// @Summary Forget Google token
+// @Description Delete the saved token. The export stops until Google Sheets is authorized again.
+// @Tags google
+// @Success 204 "No Content"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /google/token [delete]
+func DeleteGoogleToken(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := gsheets.Forget(store); err != nil {
+			slog.Error("error deleting google token: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// decodeSheetsTarget reads and validates the target of the request. Names must be unique,
+// except for the target being replaced. It writes the error response and returns false on failure.
+func decodeSheetsTarget(w http.ResponseWriter, r *http.Request, store Storage, target *gsheets.Target, replaced ...int64) bool {
+	if err := json.NewDecoder(r.Body).Decode(target); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if err := target.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	targets, err := store.GetSheetsTargets()
+	if err != nil {
+		slog.Error("error getting sheets targets: " + err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	for _, t := range targets {
+		if t.Name == target.Name && !slices.Contains(replaced, t.ID) {
+			http.Error(w, gsheets.ErrTargetExists.Error(), http.StatusConflict)
+			return false
+		}
+	}
+	return true
+}
+
+// GetInvoices returns the invoices
+// @Summary Get invoices
+// @Description Get the invoices of a project or of all projects, newest first
+// @Tags invoices
+// @Produce  json
+// @Param   project query string false "Client project ID"
+// @Success 200 {array} invoice.Invoice "OK"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /invoices [get]
+func GetInvoices(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		invoices, err := store.GetInvoices(r.URL.Query().Get("project"))
+		if err != nil {
+			slog.Error("error getting invoices: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := json.NewEncoder(w).Encode(invoices); err != nil {
+			slog.Error("error encoding response: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// GetInvoice returns an invoice
+// @Summary Get invoice
+// @Description Get an invoice with its lines and time rows
+// @Tags invoices
+// @Produce  json
+// @Param   id path int true "Invoice ID"
+// @Success 200 {object} invoice.Invoice "OK"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /invoices/{id} [get]
+func GetInvoice(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		inv, ok := findInvoice(w, r, store)
+		if !ok {
+			return
+		}
+		if err := json.NewEncoder(w).Encode(inv); err != nil {
+			slog.Error("error encoding response: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+}
+
+// NewInvoice computes a draft invoice
+// @Summary Create invoice
+// @Description Sum the payable hours of the project in the period by employee and direction and multiply them by
+// @Description the rates of the invoicing config or of the workers. Time rows of issued invoices are left out,
+// @Description so are paid ones unless include_paid is set.
+// @Tags invoices
+// @Accept  json
+// @Produce  json
+// @Param   request body invoice.Request true "Project and period"
+// @Success 201 {object} invoice.Invoice "Created"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 404 {string} string "Project not found"
+// @Failure 422 {string} string "No time rows to invoice"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /invoices [post]
+func NewInvoice(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req := invoice.Request{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := req.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		inv, err := invoice.Create(r.Context(), store, req)
+		if err != nil {
+			invoiceError(w, "error creating invoice", err)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(inv)
+	}
+}
+
+// DeleteInvoice deletes a draft invoice
+// @Summary Delete invoice
+// @Description Delete a draft. Issued invoices are kept.
+// @Tags invoices
+// @Param   id path int true "Invoice ID"
+// @Success 204 "No Content"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 404 {string} string "Not Found"
+// @Failure 409 {string} string "Invoice is issued"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /invoices/{id} [delete]
+func DeleteInvoice(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid invoice id", http.StatusBadRequest)
+			return
+		}
+		if err := invoice.Delete(store, id); err != nil {
+			invoiceError(w, "error deleting invoice", err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// IssueInvoice issues a draft invoice
+// @Summary Issue invoice
+// @Description Issue a draft. Its time rows are not invoiced again.
+// @Tags invoices
+// @Produce  json
+// @Param   id path int true "Invoice ID"
+// @Success 200 {object} invoice.Invoice "OK"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 404 {string} string "Not Found"
+// @Failure 409 {string} string "Invoice is already issued or its time rows are billed by another invoice"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /invoices/{id}/issue [post]
+func IssueInvoice(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid invoice id", http.StatusBadRequest)
+			return
+		}
+		inv, err := invoice.Issue(store, id)
+		if err != nil {
+			invoiceError(w, "error issuing invoice", err)
+			return
+		}
+		json.NewEncoder(w).Encode(inv)
+	}
+}
+
+// PayInvoice marks the time rows of an invoice as paid
+// @Summary Mark invoice paid
+// @Description Check "Оплата" of the time rows of an issued invoice in Notion. The invoice stays issued if a time row
+// @Description can't be updated and can be marked again.
+// @Tags invoices
+// @Produce  json
+// @Param   id path int true "Invoice ID"
+// @Success 200 {object} invoice.Invoice "OK"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 404 {string} string "Not Found"
+// @Failure 409 {string} string "Invoice is not issued"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /invoices/{id}/paid [post]
+func PayInvoice(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+		if err != nil {
+			http.Error(w, "invalid invoice id", http.StatusBadRequest)
+			return
+		}
+		inv, err := invoice.MarkPaid(r.Context(), store, id)
+		if err != nil {
+			invoiceError(w, "error marking invoice paid", err)
+			return
+		}
+		json.NewEncoder(w).Encode(inv)
+	}
+}
+
+// GetInvoiceDocument renders an invoice
+// @Summary Download invoice
+// @Description Render the invoice as an HTML page or a PDF file
+// @Tags invoices
+// @Produce  text/html
+// @Produce  application/pdf
+// @Param   id path int true "Invoice ID"
+// @Param   format query string false "html (default) or pdf"
+// @Success 200 {file} file "OK"
+// @Failure 400 {string} string "Bad Request"
+// @Failure 404 {string} string "Not Found"
+// @Failure 500 {string} string "Internal Server Error"
+// @Router /invoices/{id}/document [get]
+func GetInvoiceDocument(store Storage) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = invoice.FormatHTML
+		}
+		if format != invoice.FormatHTML && format != invoice.FormatPDF {
+			http.Error(w, invoice.ErrUnknownFormat.Error(), http.StatusBadRequest)
+			return
+		}
+		inv, ok := findInvoice(w, r, store)
+		if !ok {
+			return
+		}
+
+		// Rendered first, so that a failure is still reported with an error status.
+		var buf bytes.Buffer
+		if err := invoice.Render(&buf, format, inv); err != nil {
+			slog.Error("error rendering invoice: " + err.Error())
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", invoice.ContentType(format))
+		if format == invoice.FormatPDF {
+			w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="invoice-%d.pdf"`, inv.ID))
+		}
+		w.Write(buf.Bytes())
+	}
+}
+
+// findInvoice returns the invoice of the id URL parameter. It writes the error response and returns false if there is none.
+func findInvoice(w http.ResponseWriter, r *http.Request, store Storage) (*invoice.Invoice, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid invoice id", http.StatusBadRequest)
+		return nil, false
+	}
+	inv, err := store.GetInvoice(id)
+	if errors.Is(err, invoice.ErrInvoiceNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		slog.Error("error getting invoice: " + err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return inv, true
+}
+
+// invoiceError writes the response of a failed invoice operation.
+func invoiceError(w http.ResponseWriter, msg string, err error) {
+	switch {
+	case errors.Is(err, invoice.ErrInvoiceNotFound) || errors.Is(err, notion.ErrProjectNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, invoice.ErrNotDraft) || errors.Is(err, invoice.ErrNotIssued) || errors.Is(err, invoice.ErrTimesBilled):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, invoice.ErrNoTimes):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		slog.Error(msg + ": " + err.Error())
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
 }
 
 func ParseMindmap(w http.ResponseWriter, r *http.Request) {
@@ -151,7 +1780,7 @@ func ParseMindmap(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := notion.CreateMindmapTasks(projectName, tasks); err != nil {
+	if err := notion.CreateMindmapTasks(r.Context(), projectName, tasks); err != nil {
 		slog.Error(err.Error())
 		w.WriteHeader(http.StatusInternalServerError)
 		return
@@ -19,10 +19,11 @@ import (
 
 type App struct {
 	NotionClient *notionapi.Client
+	store        *storage.Storage
 }
 
-func NewApp() *App {
-	return &App{}
+func NewApp(store *storage.Storage) *App {
+	return &App{store: store}
 }
 
 func (a *App) Run() {
@@ -32,18 +33,54 @@ func (a *App) Run() {
 	// TODO: get allowed origins, headers and methods from cfg
 	router.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{"http://*", "https://*"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
 		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "Set-Cookie", "Refresh", "X-CSRF-Token"},
 		AllowCredentials: true,
 		MaxAge:           300, // Максимальное время кеширования предзапроса (в секундах)
 	}))
 
-	store := storage.NewStorage()
+	store := a.store
 
-	// router.Post("/projects", handlers.NewProject(store))
+	router.Get("/api/projects", handlers.GetProjects(store))
+	router.Post("/api/projects", handlers.NewProject(store))
+	router.Get("/api/projects/{projectID}", handlers.GetProject(store))
+	router.Patch("/api/projects/{projectID}", handlers.UpdateProject(store))
+	router.Delete("/api/projects/{projectID}", handlers.DeleteProject(store))
+	router.Post("/api/projects/{projectID}/reset", handlers.ResetProject(store))
 	router.Patch("/api/sync", handlers.UpdateDatabases(store))
-	router.Patch("/api/sheets", handlers.UpdateGoogleSheets)
+	router.Get("/api/sync", handlers.GetSyncRuns(store))
+	router.Get("/api/sync/events", handlers.SyncEvents)
+	router.Get("/api/sync/{id}", handlers.GetSyncRun(store))
+	router.Get("/api/jobs", handlers.GetJobs(store))
+	router.Delete("/api/sync/{id}", handlers.CancelSync)
+	router.Patch("/api/projects/{projectID}/sync", handlers.SyncProject(store))
+	router.Patch("/api/pages/{internalID}/sync", handlers.SyncPage(store))
+	router.Post("/api/webhooks/notion", handlers.NotionWebhook(store))
+	router.Patch("/api/sheets", handlers.UpdateGoogleSheets(store))
+	router.Get("/api/sheets/targets", handlers.GetSheetsTargets(store))
+	router.Post("/api/sheets/targets", handlers.NewSheetsTarget(store))
+	router.Put("/api/sheets/targets/{id}", handlers.UpdateSheetsTarget(store))
+	router.Delete("/api/sheets/targets/{id}", handlers.DeleteSheetsTarget(store))
+	router.Get("/api/sheets/targets/{id}/stale", handlers.GetStaleRows(store))
+	router.Post("/api/sheets/targets/{id}/reconcile", handlers.RemoveStaleRows(store))
+	router.Get("/api/export/times", handlers.ExportTimes(store))
+	router.Get("/api/invoices", handlers.GetInvoices(store))
+	router.Post("/api/invoices", handlers.NewInvoice(store))
+	router.Get("/api/invoices/{id}", handlers.GetInvoice(store))
+	router.Delete("/api/invoices/{id}", handlers.DeleteInvoice(store))
+	router.Get("/api/invoices/{id}/document", handlers.GetInvoiceDocument(store))
+	router.Post("/api/invoices/{id}/issue", handlers.IssueInvoice(store))
+	router.Post("/api/invoices/{id}/paid", handlers.PayInvoice(store))
+	router.Get("/api/google/auth", handlers.GoogleAuth)
+	router.Get("/api/google/callback", handlers.GoogleCallback(store))
+	router.Get("/api/google/status", handlers.GetGoogleStatus(store))
+	router.Delete("/api/google/token", handlers.DeleteGoogleToken(store))
 	router.Get("/api/fix", handlers.GetToBeUpdated(store))
+	router.Post("/api/fix/run", handlers.FixBroken(store))
+	router.Get("/api/archived", handlers.GetArchivedPages(store))
+	router.Get("/api/errors", handlers.GetErrors(store))
+	router.Get("/api/errors/summary", handlers.GetErrorSummary(store))
+	router.Post("/api/errors/{id}/ack", handlers.AckError(store))
 	router.Post("/api/mindmap", handlers.ParseMindmap)
 
 	// Swagger
@@ -1,12 +1,18 @@
 package storage
 
 import (
+	dbsql "database/sql"
+	"encoding/json"
 	"fmt"
+	"time"
 
+	"github.com/Corray333/notion-manager/internal/gsheets"
+	"github.com/Corray333/notion-manager/internal/invoice"
 	"github.com/Corray333/notion-manager/internal/notion"
 	"github.com/Corray333/notion-manager/internal/project"
 	"github.com/Masterminds/squirrel"
 	"github.com/jmoiron/sqlx"
+	"golang.org/x/oauth2"
 )
 
 type Storage struct {
@@ -19,11 +25,22 @@ func NewStorage() *Storage {
 
 func (s *Storage) NewProject(proj *project.Project) error {
 
-	_, err := s.DB.Exec("INSERT OR IGNORE INTO projects (name, project_id, internal_id, workers_db_id, time_db_id, tasks_db_id, tasks_last_synced, time_last_synced) VALUES (?, ?, ?, ?, ?, ?, ?, ?)", proj.Name, proj.ProjectID, proj.InternalID, proj.WorkersDBID, proj.TimeDBID, proj.TasksDBID, 0, 0)
+	_, err := s.DB.Exec("INSERT OR IGNORE INTO projects (name, project_id, internal_id, workers_db_id, time_db_id, tasks_db_id, tasks_last_synced, time_last_synced, paused) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)", proj.Name, proj.ProjectID, proj.InternalID, proj.WorkersDBID, proj.TimeDBID, proj.TasksDBID, 0, 0, proj.Paused)
 
 	return err
 }
 
+// UpdateProject saves the name, the databases and the pause of the project.
+func (s *Storage) UpdateProject(proj *project.Project) error {
+	_, err := s.DB.Exec("UPDATE projects SET name = ?, internal_id = ?, workers_db_id = ?, time_db_id = ?, tasks_db_id = ?, paused = ? WHERE project_id = ?", proj.Name, proj.InternalID, proj.WorkersDBID, proj.TimeDBID, proj.TasksDBID, proj.Paused, proj.ProjectID)
+	return err
+}
+
+func (s *Storage) DeleteProject(projectID string) error {
+	_, err := s.DB.Exec("DELETE FROM projects WHERE project_id = ?", projectID)
+	return err
+}
+
 func (s *Storage) GetProject(projectID string) (project.Project, error) {
 	var project project.Project
 	err := s.DB.Get(&project, "SELECT * FROM projects WHERE project_id = ?", projectID)
@@ -53,13 +70,65 @@ func (s *Storage) SetClientID(internalID, clientID string) error {
 	return err
 }
 
+// GetClientIDs returns client IDs of all copied pages by their internal IDs.
+func (s *Storage) GetClientIDs() (map[string]string, error) {
+	rows, err := s.DB.Query("SELECT internal_id, client_id FROM ids")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	ids := map[string]string{}
+	for rows.Next() {
+		var internalID, clientID string
+		if err := rows.Scan(&internalID, &clientID); err != nil {
+			return nil, err
+		}
+		ids[internalID] = clientID
+	}
+	return ids, rows.Err()
+}
+
+// GetContentHash returns the hash of the body last copied to the client copy of the page.
+func (s *Storage) GetContentHash(internalID string) (string, error) {
+	var hash string
+	err := s.DB.Get(&hash, "SELECT content_hash FROM ids WHERE internal_id = ?", internalID)
+	return hash, err
+}
+
+func (s *Storage) SetContentHash(internalID, hash string) error {
+	_, err := s.DB.Exec("UPDATE ids SET content_hash = ? WHERE internal_id = ?", hash, internalID)
+	return err
+}
+
+func (s *Storage) RemoveClientID(internalID string) error {
+	_, err := s.DB.Exec("DELETE FROM ids WHERE internal_id = ?", internalID)
+	return err
+}
+
 func (s *Storage) SetLastSynced(project *project.Project) error {
-	_, err := s.DB.Exec("UPDATE projects SET tasks_last_synced = ?, time_last_synced = ? WHERE project_id = ?", project.TasksLastSynced, project.TimeLastSynced, project.ProjectID)
+	_, err := s.DB.Exec("UPDATE projects SET tasks_last_synced = ?, time_last_synced = ?, client_last_synced = ? WHERE project_id = ?", project.TasksLastSynced, project.TimeLastSynced, project.ClientLastSynced, project.ProjectID)
+	return err
+}
+
+// SetClientLastSynced moves the pull cursor of the project forward, it is never moved back.
+func (s *Storage) SetClientLastSynced(projectID string, clientLastSynced int64) error {
+	_, err := s.DB.Exec("UPDATE projects SET client_last_synced = MAX(client_last_synced, ?) WHERE project_id = ?", clientLastSynced, projectID)
 	return err
 }
 
+// SaveError saves the error or, if the same error is saved and not acknowledged yet, counts it again.
 func (s *Storage) SaveError(errSave notion.Error) error {
-	query := squirrel.Insert("errors").Columns("project_id", "type", "message", "page_id").Values(errSave.Unpack())
+	projectID, typ, message, pageID := errSave.Unpack()
+	now := time.Now().UTC()
+	res, err := s.DB.Exec("UPDATE errors SET count = count + 1, last_seen_at = ?, run_id = ?, severity = ? WHERE project_id = ? AND type = ? AND page_id = ? AND message = ? AND acknowledged_at IS NULL", now, errSave.RunID(), errSave.Severity(), projectID, typ, pageID, message)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+
+	query := squirrel.Insert("errors").Columns("run_id", "project_id", "type", "page_id", "message", "severity", "created_at", "last_seen_at").Values(errSave.RunID(), projectID, typ, pageID, message, errSave.Severity(), now, now)
 	sql, args, err := query.ToSql()
 	if err != nil {
 		return err
@@ -68,8 +137,119 @@ func (s *Storage) SaveError(errSave notion.Error) error {
 	return err
 }
 
+// GetErrors returns a page of the errors matching the filter, last seen first, and the number of all matching errors.
+func (s *Storage) GetErrors(filter notion.ErrorFilter) ([]notion.ErrorRecord, int, error) {
+	where := errorsWhere(filter)
+
+	var total int
+	sql, args, err := squirrel.Select("COUNT(*)").From("errors").Where(where).ToSql()
+	if err != nil {
+		return nil, 0, err
+	}
+	if err := s.DB.Get(&total, sql, args...); err != nil {
+		return nil, 0, err
+	}
+
+	query := squirrel.Select("*").From("errors").Where(where).OrderBy("last_seen_at DESC", "id DESC")
+	if filter.Limit > 0 {
+		query = query.Limit(uint64(filter.Limit)).Offset(uint64(filter.Offset))
+	}
+	sql, args, err = query.ToSql()
+	if err != nil {
+		return nil, 0, err
+	}
+	records := []notion.ErrorRecord{}
+	if err := s.DB.Select(&records, sql, args...); err != nil {
+		return nil, 0, err
+	}
+	return records, total, nil
+}
+
+// GetErrorSummary groups the errors matching the filter by message, most frequent first.
+func (s *Storage) GetErrorSummary(filter notion.ErrorFilter) ([]notion.ErrorSummary, error) {
+	sql, args, err := squirrel.Select("message", "COUNT(*) AS errors", "SUM(count) AS occurrences", "COUNT(DISTINCT project_id) AS projects", "MAX(last_seen_at) AS last_seen_at").
+		From("errors").Where(errorsWhere(filter)).GroupBy("message").OrderBy("occurrences DESC", "message").ToSql()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := s.DB.Queryx(sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summary := []notion.ErrorSummary{}
+	for rows.Next() {
+		// MAX() loses the column type, so the time comes back as text.
+		var group notion.ErrorSummary
+		var lastSeen string
+		if err := rows.Scan(&group.Message, &group.Errors, &group.Occurrences, &group.Projects, &lastSeen); err != nil {
+			return nil, err
+		}
+		if group.LastSeenAt, err = parseTimestamp(lastSeen); err != nil {
+			return nil, err
+		}
+		summary = append(summary, group)
+	}
+	return summary, rows.Err()
+}
+
+// AckError marks the error as acknowledged, sql.ErrNoRows is returned if there is no such error.
+func (s *Storage) AckError(id int64) error {
+	res, err := s.DB.Exec("UPDATE errors SET acknowledged_at = COALESCE(acknowledged_at, ?) WHERE id = ?", time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return dbsql.ErrNoRows
+	}
+	return nil
+}
+
+func errorsWhere(filter notion.ErrorFilter) squirrel.And {
+	where := squirrel.And{}
+	if filter.ProjectID != "" {
+		where = append(where, squirrel.Eq{"project_id": filter.ProjectID})
+	}
+	if filter.Type != "" {
+		where = append(where, squirrel.Eq{"type": filter.Type})
+	}
+	if filter.Severity != "" {
+		where = append(where, squirrel.Eq{"severity": filter.Severity})
+	}
+	if !filter.Since.IsZero() {
+		where = append(where, squirrel.GtOrEq{"last_seen_at": filter.Since.UTC()})
+	}
+	if filter.Acknowledged != nil {
+		if *filter.Acknowledged {
+			where = append(where, squirrel.NotEq{"acknowledged_at": nil})
+		} else {
+			where = append(where, squirrel.Eq{"acknowledged_at": nil})
+		}
+	}
+	return where
+}
+
+// parseTimestamp parses a time stored by the sqlite driver or by CURRENT_TIMESTAMP.
+func parseTimestamp(s string) (time.Time, error) {
+	for _, layout := range []string{"2006-01-02 15:04:05.999999999-07:00", "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid timestamp %q", s)
+}
+
 func (s *Storage) SaveRowsToBeUpdated(val notion.Validation) {
-	query := squirrel.Insert("to_be_updated").Columns("title", "type", "internal_id", "client_id", "errors", "project_id").Values(val.Title, val.Type, val.InternalID, val.ClientID, val.Errors, val.ProjectID).Suffix("ON CONFLICT(internal_id) DO UPDATE SET title = excluded.title, type = excluded.type, client_id = excluded.client_id, errors = excluded.errors")
+	now := time.Now().UTC()
+	query := squirrel.Insert("to_be_updated").
+		Columns("title", "type", "internal_id", "client_id", "errors", "issues", "project_id", "internal_url", "client_url", "employee", "first_seen_at", "last_seen_at").
+		Values(val.Title, val.Type, val.InternalID, val.ClientID, val.Errors, val.Issues, val.ProjectID, val.InternalURL, val.ClientURL, val.Employee, now, now).
+		Suffix("ON CONFLICT(internal_id) DO UPDATE SET title = excluded.title, type = excluded.type, client_id = excluded.client_id, errors = excluded.errors, issues = excluded.issues, internal_url = excluded.internal_url, client_url = excluded.client_url, employee = excluded.employee, last_seen_at = excluded.last_seen_at")
 	sql, args, err := query.ToSql()
 	if err != nil {
 		return
@@ -113,7 +293,335 @@ func (s *Storage) GetRowsToBeUpdatedByProject(projectID string) ([]notion.Valida
 	return pages, nil
 }
 
+// GetFixQueue returns the rows of to_be_updated matching the filter, oldest first.
+func (s *Storage) GetFixQueue(filter notion.FixFilter) ([]notion.Validation, error) {
+	query := squirrel.Select("*").From("to_be_updated").OrderBy("first_seen_at", "internal_id")
+	if filter.ProjectID != "" {
+		query = query.Where(squirrel.Eq{"project_id": filter.ProjectID})
+	}
+	if filter.Type != "" {
+		query = query.Where(squirrel.Eq{"type": filter.Type})
+	}
+	if filter.Employee != "" {
+		// Employee holds the names joined with ", ", the filter matches one of them.
+		query = query.Where("(', ' || employee || ', ') LIKE ?", "%, "+filter.Employee+", %")
+	}
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	pages := []notion.Validation{}
+	err = s.DB.Select(&pages, sql, args...)
+	return pages, err
+}
+
 func (s *Storage) RemoveRowToBeUpdated(internalID string) error {
 	_, err := s.DB.Exec("DELETE FROM to_be_updated WHERE internal_id = ?", internalID)
 	return err
 }
+
+// SaveArchivedPage records a page found archived. A page that is already recorded keeps its detection time.
+func (s *Storage) SaveArchivedPage(page notion.ArchivedPage) error {
+	query := squirrel.Insert("archived_pages").Columns("internal_id", "client_id", "project_id", "type", "title", "reason", "detected_at").Values(page.InternalID, page.ClientID, page.ProjectID, page.Type, page.Title, page.Reason, page.DetectedAt).Suffix("ON CONFLICT(internal_id) DO NOTHING")
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = s.DB.Exec(sql, args...)
+	return err
+}
+
+func (s *Storage) GetArchivedPages() ([]notion.ArchivedPage, error) {
+	pages := []notion.ArchivedPage{}
+	err := s.DB.Select(&pages, "SELECT * FROM archived_pages ORDER BY detected_at DESC")
+	return pages, err
+}
+
+func (s *Storage) SetArchivedPageRemoved(internalID string) error {
+	_, err := s.DB.Exec("UPDATE archived_pages SET removed_at = ? WHERE internal_id = ?", time.Now(), internalID)
+	return err
+}
+
+func (s *Storage) RemoveArchivedPage(internalID string) error {
+	_, err := s.DB.Exec("DELETE FROM archived_pages WHERE internal_id = ?", internalID)
+	return err
+}
+
+func (s *Storage) SaveCommentLink(link notion.CommentLink) error {
+	_, err := s.DB.Exec("INSERT INTO comments (internal_id, client_id, page_id, created_at) VALUES (?, ?, ?, ?)", link.InternalID, link.ClientID, link.PageID, link.CreatedAt)
+	return err
+}
+
+// GetCommentLinks returns the synced comments of the internal page.
+func (s *Storage) GetCommentLinks(pageID string) ([]notion.CommentLink, error) {
+	links := []notion.CommentLink{}
+	err := s.DB.Select(&links, "SELECT * FROM comments WHERE page_id = ?", pageID)
+	return links, err
+}
+
+func (s *Storage) NewSyncRun(run *notion.SyncRun) error {
+	res, err := s.DB.Exec("INSERT INTO sync_runs (status, started_at, project_id, page_id, full) VALUES (?, ?, ?, ?, ?)", run.Status, run.StartedAt, run.ProjectID, run.PageID, run.Full)
+	if err != nil {
+		return err
+	}
+	run.ID, err = res.LastInsertId()
+	return err
+}
+
+func (s *Storage) FinishSyncRun(run *notion.SyncRun) error {
+	_, err := s.DB.Exec("UPDATE sync_runs SET status = ?, finished_at = ?, error = ? WHERE id = ?", run.Status, run.FinishedAt, run.Error, run.ID)
+	return err
+}
+
+// InterruptSyncRuns marks runs that are still running as failed.
+func (s *Storage) InterruptSyncRuns() error {
+	_, err := s.DB.Exec("UPDATE sync_runs SET status = ?, finished_at = ?, error = ? WHERE status = ?", notion.RunFailed, time.Now(), "interrupted", notion.RunRunning)
+	return err
+}
+
+func (s *Storage) SaveSyncRunProject(stats notion.ProjectStats) error {
+	query := squirrel.Insert("sync_run_projects").Columns("run_id", "project_id", "name", "created", "updated", "failed", "skipped").Values(stats.RunID, stats.ProjectID, stats.Name, stats.Created, stats.Updated, stats.Failed, stats.Skipped).Suffix("ON CONFLICT(run_id, project_id) DO UPDATE SET created = excluded.created, updated = excluded.updated, failed = excluded.failed, skipped = excluded.skipped")
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return err
+	}
+	_, err = s.DB.Exec(sql, args...)
+	return err
+}
+
+func (s *Storage) SaveSyncRunError(runErr notion.RunError) error {
+	_, err := s.DB.Exec("INSERT INTO sync_run_errors (run_id, project_id, type, page_id, message, created_at) VALUES (?, ?, ?, ?, ?, ?)", runErr.RunID, runErr.ProjectID, runErr.Type, runErr.PageID, runErr.Message, runErr.CreatedAt)
+	return err
+}
+
+// GetSyncRun returns a run with its progress and errors.
+func (s *Storage) GetSyncRun(id int64) (*notion.SyncRun, error) {
+	run := notion.SyncRun{}
+	if err := s.DB.Get(&run, "SELECT * FROM sync_runs WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+	run.Projects = []notion.ProjectStats{}
+	if err := s.DB.Select(&run.Projects, "SELECT * FROM sync_run_projects WHERE run_id = ?", id); err != nil {
+		return nil, err
+	}
+	run.Errors = []notion.RunError{}
+	if err := s.DB.Select(&run.Errors, "SELECT run_id, project_id, type, page_id, message, created_at FROM sync_run_errors WHERE run_id = ? ORDER BY id", id); err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// GetSyncRuns returns the latest runs with their progress, without errors.
+func (s *Storage) GetSyncRuns(limit int) ([]notion.SyncRun, error) {
+	runs := []notion.SyncRun{}
+	if err := s.DB.Select(&runs, "SELECT * FROM sync_runs ORDER BY id DESC LIMIT ?", limit); err != nil {
+		return nil, err
+	}
+	for i := range runs {
+		runs[i].Projects = []notion.ProjectStats{}
+		if err := s.DB.Select(&runs[i].Projects, "SELECT * FROM sync_run_projects WHERE run_id = ?", runs[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return runs, nil
+}
+
+// NewJob saves a pending job and cancels the older pending jobs uploading the same page to the project.
+func (s *Storage) NewJob(job *notion.Job) error {
+	now := time.Now().UTC()
+	if _, err := s.DB.Exec("UPDATE jobs SET status = ?, updated_at = ? WHERE project_id = ? AND page_id = ? AND status = ?", notion.JobCancelled, now, job.ProjectID, job.PageID, notion.JobPending); err != nil {
+		return err
+	}
+	job.CreatedAt, job.UpdatedAt = now, now
+	res, err := s.DB.Exec("INSERT INTO jobs (run_id, project_id, page_id, type, status, attempts, next_run_at, last_error, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		job.RunID, job.ProjectID, job.PageID, job.Type, job.Status, job.Attempts, job.NextRunAt.UTC(), job.LastError, job.CreatedAt, job.UpdatedAt)
+	if err != nil {
+		return err
+	}
+	job.ID, err = res.LastInsertId()
+	return err
+}
+
+func (s *Storage) UpdateJob(job *notion.Job) error {
+	job.UpdatedAt = time.Now().UTC()
+	_, err := s.DB.Exec("UPDATE jobs SET status = ?, attempts = ?, next_run_at = ?, last_error = ?, updated_at = ? WHERE id = ?", job.Status, job.Attempts, job.NextRunAt.UTC(), job.LastError, job.UpdatedAt, job.ID)
+	return err
+}
+
+// GetDueJobs returns the oldest pending jobs that may run at now.
+func (s *Storage) GetDueJobs(now time.Time, limit int) ([]notion.Job, error) {
+	jobs := []notion.Job{}
+	if err := s.DB.Select(&jobs, "SELECT * FROM jobs WHERE status = ? AND next_run_at <= ? ORDER BY id LIMIT ?", notion.JobPending, now.UTC(), limit); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// ResetRunningJobs makes the jobs left running pending again.
+func (s *Storage) ResetRunningJobs() error {
+	_, err := s.DB.Exec("UPDATE jobs SET status = ?, updated_at = ? WHERE status = ?", notion.JobPending, time.Now().UTC(), notion.JobRunning)
+	return err
+}
+
+// GetJobs returns the latest jobs with the status, or with any status if it is empty.
+func (s *Storage) GetJobs(status string, limit int) ([]notion.Job, error) {
+	query := squirrel.Select("*").From("jobs").OrderBy("id DESC").Limit(uint64(limit))
+	if status != "" {
+		query = query.Where(squirrel.Eq{"status": status})
+	}
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	jobs := []notion.Job{}
+	if err := s.DB.Select(&jobs, sql, args...); err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (s *Storage) GetSheetsTargets() ([]gsheets.Target, error) {
+	targets := []gsheets.Target{}
+	if err := s.DB.Select(&targets, "SELECT * FROM sheets_targets ORDER BY id"); err != nil {
+		return nil, err
+	}
+	return targets, nil
+}
+
+func (s *Storage) GetSheetsTarget(id int64) (*gsheets.Target, error) {
+	target := gsheets.Target{}
+	err := s.DB.Get(&target, "SELECT * FROM sheets_targets WHERE id = ?", id)
+	if err == dbsql.ErrNoRows {
+		return nil, gsheets.ErrTargetNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &target, nil
+}
+
+func (s *Storage) NewSheetsTarget(target *gsheets.Target) error {
+	res, err := s.DB.Exec("INSERT INTO sheets_targets (name, spreadsheet_id, sheet, key_column, last_synced_cell, first_row, project_id, month, columns, enabled, reconcile, mark_column) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		target.Name, target.SpreadsheetID, target.Sheet, target.KeyColumn, target.LastSyncedCell, target.FirstRow, target.ProjectID, target.Month, target.Columns, target.Enabled, target.Reconcile, target.MarkColumn)
+	if err != nil {
+		return err
+	}
+	target.ID, err = res.LastInsertId()
+	return err
+}
+
+func (s *Storage) UpdateSheetsTarget(target *gsheets.Target) error {
+	res, err := s.DB.Exec("UPDATE sheets_targets SET name = ?, spreadsheet_id = ?, sheet = ?, key_column = ?, last_synced_cell = ?, first_row = ?, project_id = ?, month = ?, columns = ?, enabled = ?, reconcile = ?, mark_column = ? WHERE id = ?",
+		target.Name, target.SpreadsheetID, target.Sheet, target.KeyColumn, target.LastSyncedCell, target.FirstRow, target.ProjectID, target.Month, target.Columns, target.Enabled, target.Reconcile, target.MarkColumn, target.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return gsheets.ErrTargetNotFound
+	}
+	return nil
+}
+
+func (s *Storage) DeleteSheetsTarget(id int64) error {
+	res, err := s.DB.Exec("DELETE FROM sheets_targets WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return gsheets.ErrTargetNotFound
+	}
+	return nil
+}
+
+// GetGoogleToken returns the OAuth token of the Google Sheets export, gsheets.ErrNoToken if there is none.
+func (s *Storage) GetGoogleToken() (*oauth2.Token, error) {
+	var data string
+	err := s.DB.Get(&data, "SELECT token FROM google_tokens WHERE id = 1")
+	if err == dbsql.ErrNoRows {
+		return nil, gsheets.ErrNoToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	token := &oauth2.Token{}
+	if err := json.Unmarshal([]byte(data), token); err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (s *Storage) SaveGoogleToken(token *oauth2.Token) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	_, err = s.DB.Exec("INSERT INTO google_tokens (id, token, updated_at) VALUES (1, ?, ?) ON CONFLICT(id) DO UPDATE SET token = excluded.token, updated_at = excluded.updated_at", string(data), time.Now().UTC())
+	return err
+}
+
+func (s *Storage) DeleteGoogleToken() error {
+	_, err := s.DB.Exec("DELETE FROM google_tokens")
+	return err
+}
+
+func (s *Storage) NewInvoice(inv *invoice.Invoice) error {
+	res, err := s.DB.Exec("INSERT INTO invoices (project_id, project_name, period_from, period_to, currency, lines, hours, total, time_ids, status, created_at, issued_at, paid_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		inv.ProjectID, inv.ProjectName, inv.From, inv.To, inv.Currency, inv.Lines, inv.Hours, inv.Total, inv.TimeIDs, inv.Status, inv.CreatedAt, inv.IssuedAt, inv.PaidAt)
+	if err != nil {
+		return err
+	}
+	inv.ID, err = res.LastInsertId()
+	return err
+}
+
+func (s *Storage) GetInvoice(id int64) (*invoice.Invoice, error) {
+	inv := invoice.Invoice{}
+	err := s.DB.Get(&inv, "SELECT * FROM invoices WHERE id = ?", id)
+	if err == dbsql.ErrNoRows {
+		return nil, invoice.ErrInvoiceNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &inv, nil
+}
+
+// GetInvoices returns the invoices of the project, or of all projects if it is empty, newest first.
+func (s *Storage) GetInvoices(projectID string) ([]invoice.Invoice, error) {
+	query := squirrel.Select("*").From("invoices").OrderBy("id DESC")
+	if projectID != "" {
+		query = query.Where(squirrel.Eq{"project_id": projectID})
+	}
+	sql, args, err := query.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	invoices := []invoice.Invoice{}
+	if err := s.DB.Select(&invoices, sql, args...); err != nil {
+		return nil, err
+	}
+	return invoices, nil
+}
+
+func (s *Storage) UpdateInvoice(inv *invoice.Invoice) error {
+	res, err := s.DB.Exec("UPDATE invoices SET lines = ?, hours = ?, total = ?, time_ids = ?, status = ?, issued_at = ?, paid_at = ? WHERE id = ?",
+		inv.Lines, inv.Hours, inv.Total, inv.TimeIDs, inv.Status, inv.IssuedAt, inv.PaidAt, inv.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return invoice.ErrInvoiceNotFound
+	}
+	return nil
+}
+
+func (s *Storage) DeleteInvoice(id int64) error {
+	res, err := s.DB.Exec("DELETE FROM invoices WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return invoice.ErrInvoiceNotFound
+	}
+	return nil
+}
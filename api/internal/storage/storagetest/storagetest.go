@@ -0,0 +1,60 @@
+// Package storagetest creates throwaway SQLite storages for tests.
+package storagetest
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/Corray333/notion-manager/internal/storage"
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// New returns a storage backed by a fresh database in a temporary directory
+// with every migration from api/migrations applied.
+func New(t testing.TB) *storage.Storage {
+	t.Helper()
+
+	db, err := sqlx.Connect("sqlite3", filepath.Join(t.TempDir(), "notion.db")+"?_busy_timeout=5000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if err := migrate(db); err != nil {
+		t.Fatal(err)
+	}
+
+	return &storage.Storage{DB: db}
+}
+
+// migrate executes the "goose Up" part of every migration in order.
+func migrate(db *sqlx.DB) error {
+	_, file, _, _ := runtime.Caller(0)
+	dir := filepath.Join(filepath.Dir(file), "..", "..", "..", "migrations")
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	for _, f := range files {
+		data, err := os.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		up := string(data)
+		if i := strings.Index(up, "-- +goose Down"); i != -1 {
+			up = up[:i]
+		}
+		if _, err := db.Exec(up); err != nil {
+			return err
+		}
+	}
+	return nil
+}
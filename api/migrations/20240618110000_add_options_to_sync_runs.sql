@@ -0,0 +1,25 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE sync_runs ADD COLUMN project_id TEXT NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE sync_runs ADD COLUMN page_id TEXT NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE sync_runs ADD COLUMN full BOOLEAN NOT NULL DEFAULT FALSE;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sync_runs DROP COLUMN full;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE sync_runs DROP COLUMN page_id;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE sync_runs DROP COLUMN project_id;
+-- +goose StatementEnd
@@ -0,0 +1,58 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE errors_new(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    run_id INTEGER NOT NULL DEFAULT 0,
+    project_id TEXT NOT NULL,
+    type TEXT NOT NULL,
+    page_id TEXT NOT NULL,
+    message TEXT NOT NULL,
+    severity TEXT NOT NULL DEFAULT 'error',
+    count INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP NOT NULL,
+    last_seen_at TIMESTAMP NOT NULL,
+    acknowledged_at TIMESTAMP
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+INSERT INTO errors_new (project_id, type, page_id, message, created_at, last_seen_at)
+SELECT project_id, type, page_id, message, created_at, created_at FROM errors;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE errors;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE errors_new RENAME TO errors;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE INDEX errors_last_seen_at ON errors(last_seen_at);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+CREATE TABLE errors_old(
+    project_id TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    type TEXT NOT NULL,
+    message TEXT NOT NULL,
+    page_id TEXT NOT NULL,
+    PRIMARY KEY (project_id, page_id)
+);
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+INSERT OR IGNORE INTO errors_old (project_id, created_at, type, message, page_id)
+SELECT project_id, created_at, type, message, page_id FROM errors ORDER BY last_seen_at DESC;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+DROP TABLE errors;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE errors_old RENAME TO errors;
+-- +goose StatementEnd
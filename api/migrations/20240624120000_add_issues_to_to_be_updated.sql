@@ -0,0 +1,9 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE to_be_updated ADD COLUMN issues TEXT NOT NULL DEFAULT '[]';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE to_be_updated DROP COLUMN issues;
+-- +goose StatementEnd
@@ -0,0 +1,49 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE to_be_updated ADD COLUMN internal_url TEXT NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE to_be_updated ADD COLUMN client_url TEXT NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE to_be_updated ADD COLUMN employee TEXT NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE to_be_updated ADD COLUMN first_seen_at TIMESTAMP;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE to_be_updated ADD COLUMN last_seen_at TIMESTAMP;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+UPDATE to_be_updated SET
+    internal_url = 'https://www.notion.so/' || REPLACE(internal_id, '-', ''),
+    client_url = CASE WHEN client_id = '' THEN '' ELSE 'https://www.notion.so/' || REPLACE(client_id, '-', '') END,
+    first_seen_at = CURRENT_TIMESTAMP,
+    last_seen_at = CURRENT_TIMESTAMP;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE to_be_updated DROP COLUMN last_seen_at;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE to_be_updated DROP COLUMN first_seen_at;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE to_be_updated DROP COLUMN employee;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE to_be_updated DROP COLUMN client_url;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE to_be_updated DROP COLUMN internal_url;
+-- +goose StatementEnd
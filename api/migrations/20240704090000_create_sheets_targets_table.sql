@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+CREATE TABLE IF NOT EXISTS sheets_targets(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL UNIQUE,
+    spreadsheet_id TEXT NOT NULL,
+    sheet TEXT NOT NULL,
+    key_column TEXT NOT NULL,
+    last_synced_cell TEXT NOT NULL,
+    first_row INTEGER NOT NULL,
+    project_id TEXT NOT NULL DEFAULT '',
+    month TEXT NOT NULL DEFAULT '',
+    columns TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE sheets_targets;
+-- +goose StatementEnd
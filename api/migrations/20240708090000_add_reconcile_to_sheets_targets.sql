@@ -0,0 +1,17 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE sheets_targets ADD COLUMN reconcile TEXT NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE sheets_targets ADD COLUMN mark_column TEXT NOT NULL DEFAULT '';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE sheets_targets DROP COLUMN mark_column;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+ALTER TABLE sheets_targets DROP COLUMN reconcile;
+-- +goose StatementEnd
@@ -0,0 +1,281 @@
+package notion
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultBaseURL = "https://api.notion.com/v1"
+	DefaultVersion = "2022-06-28"
+
+	// Notion allows an average of three requests per second per integration.
+	DefaultRequestsPerSecond = 3
+	DefaultBurst             = 3
+
+	DefaultTimeout    = 30 * time.Second
+	DefaultMaxRetries = 5
+	DefaultMinBackoff = 500 * time.Millisecond
+	DefaultMaxBackoff = 30 * time.Second
+)
+
+// Client is a Notion API client shared by all callers of a service.
+// It is safe for concurrent use: every request waits for the rate limiter
+// and is retried with exponential backoff on 429, 409 and 5xx responses.
+// Requests creating pages, comments or blocks are only retried when they surely
+// didn't reach Notion, so that a lost response doesn't create them twice.
+type Client struct {
+	token      string
+	baseURL    string
+	version    string
+	httpClient *http.Client
+	limiter    *Limiter
+	maxRetries int
+	minBackoff time.Duration
+	maxBackoff time.Duration
+}
+
+type Option func(*Client)
+
+// WithBaseURL overrides the API root, e.g. to point the client at a fake server.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = baseURL
+	}
+}
+
+// WithVersion overrides the Notion-Version header.
+func WithVersion(version string) Option {
+	return func(c *Client) {
+		c.version = version
+	}
+}
+
+// WithTransport sets the transport of the underlying http.Client.
+func WithTransport(transport http.RoundTripper) Option {
+	return func(c *Client) {
+		c.httpClient.Transport = transport
+	}
+}
+
+// WithTimeout sets the timeout of a single HTTP request (not of the whole retry loop).
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.httpClient.Timeout = timeout
+	}
+}
+
+// WithRateLimit replaces the default ~3 req/s token bucket.
+func WithRateLimit(requestsPerSecond float64, burst int) Option {
+	return func(c *Client) {
+		c.limiter = NewLimiter(requestsPerSecond, burst)
+	}
+}
+
+// WithRetries sets how many times a retryable request is repeated and the backoff bounds.
+func WithRetries(maxRetries int, minBackoff, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = maxRetries
+		c.minBackoff = minBackoff
+		c.maxBackoff = maxBackoff
+	}
+}
+
+func NewClient(token string, opts ...Option) *Client {
+	c := &Client{
+		token:      token,
+		baseURL:    DefaultBaseURL,
+		version:    DefaultVersion,
+		httpClient: &http.Client{Timeout: DefaultTimeout},
+		limiter:    NewLimiter(DefaultRequestsPerSecond, DefaultBurst),
+		maxRetries: DefaultMaxRetries,
+		minBackoff: DefaultMinBackoff,
+		maxBackoff: DefaultMaxBackoff,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// NewClientFromEnv creates a client authorized with NOTION_SECRET.
+// NOTION_API_URL overrides the API root and, if NOTION_PROXY is set, all requests go through that proxy.
+func NewClientFromEnv() *Client {
+	opts := []Option{}
+	if baseURL := os.Getenv("NOTION_API_URL"); baseURL != "" {
+		opts = append(opts, WithBaseURL(baseURL))
+	}
+	if proxy := os.Getenv("NOTION_PROXY"); proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil {
+			slog.Error("invalid NOTION_PROXY, ignoring it: " + err.Error())
+		} else {
+			opts = append(opts, WithTransport(&http.Transport{Proxy: http.ProxyURL(proxyURL)}))
+		}
+	}
+	return NewClient(os.Getenv("NOTION_SECRET"), opts...)
+}
+
+// APIError is a non-2xx response returned by Notion.
+type APIError struct {
+	StatusCode int    `json:"status"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("notion error %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// Retryable reports whether the request may succeed if repeated later.
+func (e *APIError) Retryable() bool {
+	switch e.StatusCode {
+	case http.StatusTooManyRequests, http.StatusConflict,
+		http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// Do sends a request to path (relative to the base URL) with body encoded as JSON
+// and returns the raw response body.
+func (c *Client) Do(ctx context.Context, method, path string, body interface{}) ([]byte, error) {
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		if err := c.limiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+
+		resp, err := c.do(ctx, method, path, data)
+		if err == nil {
+			return resp, nil
+		}
+
+		var apiErr *APIError
+		retryable := errors.As(err, &apiErr) && apiErr.Retryable() || isTemporary(err) || notSent(err)
+		if !idempotent(method, path) {
+			retryable = apiErr != nil && apiErr.StatusCode == http.StatusTooManyRequests || notSent(err)
+		}
+		if !retryable || attempt >= c.maxRetries || ctx.Err() != nil {
+			return nil, err
+		}
+
+		wait := c.backoff(attempt)
+		if apiErr != nil && apiErr.RetryAfter > wait {
+			wait = apiErr.RetryAfter
+		}
+		slog.Warn(fmt.Sprintf("notion request %s %s failed, retrying in %s: %s", method, path, wait, err.Error()))
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) do(ctx context.Context, method, path string, data []byte) ([]byte, error) {
+	var reqBody io.Reader
+	if data != nil {
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reqBody)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	req.Header.Set("Notion-Version", c.version)
+	if data != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		apiErr := &APIError{}
+		if err := json.Unmarshal(body, apiErr); err != nil || apiErr.Message == "" {
+			apiErr.Message = string(body)
+		}
+		apiErr.StatusCode = resp.StatusCode
+		if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			apiErr.RetryAfter = time.Duration(seconds) * time.Second
+		}
+		return nil, apiErr
+	}
+
+	return body, nil
+}
+
+// backoff returns the exponential delay for the given attempt, randomized by up to a half.
+func (c *Client) backoff(attempt int) time.Duration {
+	wait := c.minBackoff << attempt
+	if wait <= 0 || wait > c.maxBackoff {
+		wait = c.maxBackoff
+	}
+	return wait/2 + time.Duration(rand.Int63n(int64(wait/2)+1))
+}
+
+// idempotent reports whether repeating the request can't create anything twice.
+// Database queries and searches are POSTs that only read, appending block children is a PATCH that creates.
+func idempotent(method, path string) bool {
+	path, _, _ = strings.Cut(path, "?")
+	switch method {
+	case http.MethodPost:
+		return strings.HasSuffix(path, "/query") || path == "/search"
+	case http.MethodPatch:
+		return !strings.HasSuffix(path, "/children")
+	}
+	return true
+}
+
+// notSent reports whether err proves the request never reached Notion: the connection wasn't made.
+func notSent(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+// isTemporary reports whether err is a network failure worth retrying.
+func isTemporary(err error) bool {
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	var netErr interface{ Timeout() bool }
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	return errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
@@ -0,0 +1,105 @@
+package notion_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Corray333/notion-manager/pkg/notion"
+	"github.com/Corray333/notion-manager/pkg/notion/notiontest"
+)
+
+func newTestClient(fake *notiontest.Server, retries int) *notion.Client {
+	return notion.NewClient("secret",
+		notion.WithBaseURL(fake.URL()),
+		notion.WithRateLimit(1000, 1000),
+		notion.WithRetries(retries, time.Millisecond, 10*time.Millisecond),
+	)
+}
+
+func TestClientRetriesRetryableErrors(t *testing.T) {
+	fake := notiontest.NewServer()
+	defer fake.Close()
+	fake.AddDatabase("db", "Tasks", map[string]string{"Name": "title"})
+
+	fake.FailNext(1, http.StatusTooManyRequests, 0)
+	fake.FailNext(1, http.StatusBadGateway, 0)
+
+	if _, err := newTestClient(fake, 3).GetSchema(context.Background(), "db"); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(fake.Requests()); n != 3 {
+		t.Errorf("expected 3 requests, got %d", n)
+	}
+}
+
+func TestClientDoesNotRepeatCreates(t *testing.T) {
+	fake := notiontest.NewServer()
+	defer fake.Close()
+	fake.AddDatabase("db", "Tasks", map[string]string{"Name": "title"})
+	client := newTestClient(fake, 3)
+	props := map[string]interface{}{"Name": map[string]interface{}{"title": []interface{}{}}}
+
+	// The page may have been created before the gateway failed.
+	fake.FailNext(1, http.StatusBadGateway, 0)
+	if _, err := client.CreatePage(context.Background(), "db", props, nil, ""); err == nil {
+		t.Fatal("expected the 502 to be returned")
+	}
+	if n := len(fake.Requests()); n != 1 {
+		t.Errorf("expected a single request, got %d", n)
+	}
+
+	// Rate limited requests were not processed.
+	fake.FailNext(1, http.StatusTooManyRequests, 0)
+	if _, err := client.CreatePage(context.Background(), "db", props, nil, ""); err != nil {
+		t.Fatal(err)
+	}
+	if pages := fake.Pages("db"); len(pages) != 1 {
+		t.Errorf("expected a single page, got %d", len(pages))
+	}
+}
+
+func TestClientGivesUpAfterMaxRetries(t *testing.T) {
+	fake := notiontest.NewServer()
+	defer fake.Close()
+	fake.FailNext(3, http.StatusServiceUnavailable, 0)
+
+	_, err := newTestClient(fake, 2).GetPage(context.Background(), "page")
+	var apiErr *notion.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("expected 503 error, got %v", err)
+	}
+}
+
+func TestClientDoesNotRetryClientErrors(t *testing.T) {
+	fake := notiontest.NewServer()
+	defer fake.Close()
+
+	_, err := newTestClient(fake, 3).GetPage(context.Background(), "missing")
+	var apiErr *notion.APIError
+	if !errors.As(err, &apiErr) || apiErr.Code != "object_not_found" {
+		t.Fatalf("expected object_not_found, got %v", err)
+	}
+	if n := len(fake.Requests()); n != 1 {
+		t.Errorf("expected a single request, got %d", n)
+	}
+}
+
+func TestClientHonoursContext(t *testing.T) {
+	fake := notiontest.NewServer()
+	defer fake.Close()
+	fake.FailNext(1, http.StatusTooManyRequests, 60)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := newTestClient(fake, 3).GetPage(ctx, "page"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("Retry-After was waited out despite the context deadline")
+	}
+}
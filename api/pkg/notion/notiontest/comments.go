@@ -0,0 +1,114 @@
+package notiontest
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// BotUserID is the user the integration acts as: comments created through the API are written by it.
+const BotUserID = "99999999-0000-0000-0000-000000000000"
+
+// Comment is a comment on a page.
+type Comment struct {
+	ID          string
+	PageID      string
+	AuthorID    string
+	Text        string
+	CreatedTime time.Time
+}
+
+// AddUser registers a workspace user returned by the users endpoint.
+func (s *Server) AddUser(id, name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.users[id] = name
+}
+
+// AddComment adds a comment written by authorID to a page and returns its ID.
+func (s *Server) AddComment(pageID, authorID, text string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addComment(pageID, authorID, text).ID
+}
+
+// Comments returns the comments of a page in creation order.
+func (s *Server) Comments(pageID string) []Comment {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Comment{}, s.comments[normalizeID(pageID)]...)
+}
+
+func (s *Server) addComment(pageID, authorID, text string) Comment {
+	c := Comment{ID: newID(), PageID: pageID, AuthorID: authorID, Text: text, CreatedTime: s.now()}
+	s.comments[normalizeID(pageID)] = append(s.comments[normalizeID(pageID)], c)
+	return c
+}
+
+func commentJSON(c Comment) map[string]interface{} {
+	return map[string]interface{}{
+		"object":       "comment",
+		"id":           c.ID,
+		"parent":       map[string]interface{}{"type": "page_id", "page_id": c.PageID},
+		"created_time": c.CreatedTime.Format(timeLayout),
+		"created_by":   map[string]interface{}{"object": "user", "id": c.AuthorID},
+		"rich_text": []interface{}{map[string]interface{}{
+			"type":       "text",
+			"text":       map[string]interface{}{"content": c.Text},
+			"plain_text": c.Text,
+		}},
+	}
+}
+
+func (s *Server) getComments(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := normalizeID(r.URL.Query().Get("block_id"))
+	if _, ok := s.pages[id]; !ok {
+		writeError(w, http.StatusNotFound, "object_not_found", "Could not find block with ID: "+r.URL.Query().Get("block_id")+".")
+		return
+	}
+	comments := s.comments[id]
+	items := make([]interface{}, len(comments))
+	ids := make([]string, len(comments))
+	for i, c := range comments {
+		items[i] = commentJSON(c)
+		ids[i] = c.ID
+	}
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+	s.writeList(w, items, ids, r.URL.Query().Get("start_cursor"), pageSize)
+}
+
+func (s *Server) createComment(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	body := bodyFrom(r.Context())
+	parent, _ := body["parent"].(map[string]interface{})
+	pageID := stringValue(parent["page_id"])
+	if _, ok := s.pages[normalizeID(pageID)]; !ok {
+		writeError(w, http.StatusNotFound, "object_not_found", "Could not find page with ID: "+pageID+".")
+		return
+	}
+	text := ""
+	items, _ := body["rich_text"].([]interface{})
+	for _, item := range items {
+		rt, _ := item.(map[string]interface{})
+		content, _ := rt["text"].(map[string]interface{})
+		text += stringValue(content["content"])
+	}
+	writeJSON(w, commentJSON(s.addComment(pageID, BotUserID, text)))
+}
+
+func (s *Server) getUser(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name, ok := s.users[r.PathValue("id")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "object_not_found", "Could not find user with ID: "+r.PathValue("id")+".")
+		return
+	}
+	writeJSON(w, map[string]interface{}{"object": "user", "id": r.PathValue("id"), "name": name})
+}
@@ -0,0 +1,212 @@
+package notiontest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type bodyKey struct{}
+
+func withBody(ctx context.Context, body map[string]interface{}) context.Context {
+	return context.WithValue(ctx, bodyKey{}, body)
+}
+
+func bodyFrom(ctx context.Context) map[string]interface{} {
+	body, _ := ctx.Value(bodyKey{}).(map[string]interface{})
+	return body
+}
+
+// toJSONMap makes a deep copy of v made only of JSON types, so that values built
+// from typed Go literals can be inspected the same way as decoded request bodies.
+func toJSONMap(v map[string]interface{}) map[string]interface{} {
+	data, _ := json.Marshal(v)
+	res := map[string]interface{}{}
+	json.Unmarshal(data, &res)
+	return res
+}
+
+// matchFilter evaluates a database query filter against a page.
+// Compound (and/or), timestamp and the property filters used by the services are supported.
+func matchFilter(page *Page, filter map[string]interface{}) (bool, error) {
+	if and, ok := filter["and"].([]interface{}); ok {
+		for _, raw := range and {
+			sub, _ := raw.(map[string]interface{})
+			match, err := matchFilter(page, sub)
+			if err != nil || !match {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+	if or, ok := filter["or"].([]interface{}); ok {
+		for _, raw := range or {
+			sub, _ := raw.(map[string]interface{})
+			match, err := matchFilter(page, sub)
+			if err != nil || match {
+				return match, err
+			}
+		}
+		return false, nil
+	}
+
+	if timestamp := stringValue(filter["timestamp"]); timestamp != "" {
+		condition, _ := filter[timestamp].(map[string]interface{})
+		switch timestamp {
+		case "created_time":
+			return matchDate(page.CreatedTime, condition)
+		case "last_edited_time":
+			return matchDate(page.LastEditedTime, condition)
+		}
+		return false, fmt.Errorf("unsupported timestamp filter %s", timestamp)
+	}
+
+	name := stringValue(filter["property"])
+	if name == "" {
+		return false, fmt.Errorf("body.filter should define property, timestamp, and or or")
+	}
+	prop, _ := page.Properties[name].(map[string]interface{})
+	for typ, raw := range filter {
+		if typ == "property" {
+			continue
+		}
+		condition, _ := raw.(map[string]interface{})
+		return matchProperty(prop, typ, condition)
+	}
+	return false, fmt.Errorf("filter on %s has no condition", name)
+}
+
+func matchProperty(prop map[string]interface{}, typ string, condition map[string]interface{}) (bool, error) {
+	switch typ {
+	case "relation", "people":
+		items, _ := prop[typ].([]interface{})
+		if id, ok := condition["contains"].(string); ok {
+			return containsID(items, id), nil
+		}
+		if id, ok := condition["does_not_contain"].(string); ok {
+			return !containsID(items, id), nil
+		}
+		if empty, ok := condition["is_empty"].(bool); ok {
+			return (len(items) == 0) == empty, nil
+		}
+		if notEmpty, ok := condition["is_not_empty"].(bool); ok {
+			return (len(items) != 0) == notEmpty, nil
+		}
+	case "rollup":
+		rollup, _ := prop["rollup"].(map[string]interface{})
+		array, _ := rollup["array"].([]interface{})
+		for quantifier, raw := range condition {
+			sub, _ := raw.(map[string]interface{})
+			matched := 0
+			for _, item := range array {
+				value, _ := item.(map[string]interface{})
+				for itemType, itemCondition := range sub {
+					c, _ := itemCondition.(map[string]interface{})
+					if ok, err := matchProperty(value, itemType, c); err != nil {
+						return false, err
+					} else if ok {
+						matched++
+					}
+				}
+			}
+			switch quantifier {
+			case "any":
+				return matched > 0, nil
+			case "every":
+				return matched == len(array), nil
+			case "none":
+				return matched == 0, nil
+			}
+		}
+	case "title", "rich_text":
+		text := plainText(prop)
+		if s, ok := condition["contains"].(string); ok {
+			return strings.Contains(strings.ToLower(text), strings.ToLower(s)), nil
+		}
+		if s, ok := condition["equals"].(string); ok {
+			return text == s, nil
+		}
+		if empty, ok := condition["is_empty"].(bool); ok {
+			return (text == "") == empty, nil
+		}
+	case "select", "status":
+		value, _ := prop[stringValue(prop["type"])].(map[string]interface{})
+		name := stringValue(value["name"])
+		if s, ok := condition["equals"].(string); ok {
+			return name == s, nil
+		}
+		if s, ok := condition["does_not_equal"].(string); ok {
+			return name != s, nil
+		}
+	case "checkbox":
+		value, _ := prop["checkbox"].(bool)
+		if b, ok := condition["equals"].(bool); ok {
+			return value == b, nil
+		}
+	case "number":
+		value, _ := prop["number"].(float64)
+		if n, ok := condition["equals"].(float64); ok {
+			return value == n, nil
+		}
+	case "date":
+		value, _ := prop["date"].(map[string]interface{})
+		date, err := parseTime(stringValue(value["start"]))
+		if err != nil {
+			return false, nil
+		}
+		return matchDate(date, condition)
+	}
+	return false, fmt.Errorf("unsupported %s filter %v", typ, condition)
+}
+
+func matchDate(t time.Time, condition map[string]interface{}) (bool, error) {
+	for op, raw := range condition {
+		value, err := parseTime(stringValue(raw))
+		if err != nil {
+			return false, fmt.Errorf("invalid date %v: %w", raw, err)
+		}
+		switch op {
+		case "after":
+			return t.After(value), nil
+		case "on_or_after":
+			return !t.Before(value), nil
+		case "before":
+			return t.Before(value), nil
+		case "on_or_before":
+			return !t.After(value), nil
+		case "equals":
+			return t.Equal(value), nil
+		}
+		return false, fmt.Errorf("unsupported date condition %s", op)
+	}
+	return false, fmt.Errorf("empty date condition")
+}
+
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", s)
+}
+
+func containsID(items []interface{}, id string) bool {
+	for _, raw := range items {
+		item, _ := raw.(map[string]interface{})
+		if normalizeID(stringValue(item["id"])) == normalizeID(id) {
+			return true
+		}
+	}
+	return false
+}
+
+func plainText(prop map[string]interface{}) string {
+	items, _ := prop[stringValue(prop["type"])].([]interface{})
+	text := ""
+	for _, raw := range items {
+		item, _ := raw.(map[string]interface{})
+		text += stringValue(item["plain_text"])
+	}
+	return text
+}
@@ -0,0 +1,751 @@
+// Package notiontest provides an in-process fake of the Notion API for tests.
+//
+// It keeps databases, pages and blocks in memory and implements the subset of
+// the API used by the sync engine: database schemas and queries (with
+// filters, sorts and cursor pagination), page create/get/update, block
+// children, comments and users. Point a notion.Client at Server.URL() to use it.
+package notiontest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const timeLayout = "2006-01-02T15:04:05.000Z"
+
+// Page is a page stored in the fake workspace, in Notion's read format.
+type Page struct {
+	ID             string                 `json:"id"`
+	CreatedTime    time.Time              `json:"-"`
+	LastEditedTime time.Time              `json:"-"`
+	Archived       bool                   `json:"archived"`
+	InTrash        bool                   `json:"in_trash"`
+	ParentID       string                 `json:"-"`
+	Properties     map[string]interface{} `json:"properties"`
+	Icon           interface{}            `json:"icon"`
+}
+
+// Block is a child block of a page.
+type Block map[string]interface{}
+
+// Request is a request received by the server.
+type Request struct {
+	Method string
+	Path   string
+	Body   map[string]interface{}
+}
+
+type database struct {
+	id     string
+	title  string
+	schema map[string]interface{}
+	pages  []string
+}
+
+type injectedError struct {
+	status     int
+	retryAfter int
+}
+
+// Server is a fake Notion API. Its zero value is not usable, create it with NewServer.
+type Server struct {
+	// PageSize is the maximum number of results returned by a list endpoint.
+	PageSize int
+	// Token, if set, is required in the Authorization header of every request.
+	Token string
+
+	mu        sync.Mutex
+	srv       *httptest.Server
+	now       func() time.Time
+	databases map[string]*database
+	pages     map[string]*Page
+	blocks    map[string][]Block
+	comments  map[string][]Comment
+	users     map[string]string
+	errors    []injectedError
+	requests  []Request
+}
+
+func NewServer() *Server {
+	s := &Server{
+		PageSize:  100,
+		now:       func() time.Time { return time.Now().UTC() },
+		databases: map[string]*database{},
+		pages:     map[string]*Page{},
+		blocks:    map[string][]Block{},
+		comments:  map[string][]Comment{},
+		users:     map[string]string{BotUserID: "Notion Manager"},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/databases/{id}", s.getDatabase)
+	mux.HandleFunc("POST /v1/databases/{id}/query", s.queryDatabase)
+	mux.HandleFunc("POST /v1/pages", s.createPage)
+	mux.HandleFunc("GET /v1/pages/{id}", s.getPage)
+	mux.HandleFunc("PATCH /v1/pages/{id}", s.updatePage)
+	mux.HandleFunc("GET /v1/blocks/{id}/children", s.getBlockChildren)
+	mux.HandleFunc("PATCH /v1/blocks/{id}/children", s.appendBlockChildren)
+	mux.HandleFunc("DELETE /v1/blocks/{id}", s.deleteBlock)
+	mux.HandleFunc("GET /v1/comments", s.getComments)
+	mux.HandleFunc("POST /v1/comments", s.createComment)
+	mux.HandleFunc("GET /v1/users/{id}", s.getUser)
+
+	s.srv = httptest.NewServer(s.middleware(mux))
+	return s
+}
+
+// URL returns the API root to pass to notion.WithBaseURL.
+func (s *Server) URL() string {
+	return s.srv.URL + "/v1"
+}
+
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// SetClock replaces the function used for created_time and last_edited_time.
+func (s *Server) SetClock(now func() time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.now = now
+}
+
+// FailNext makes the next n requests fail with status, setting Retry-After if retryAfter > 0.
+func (s *Server) FailNext(n int, status int, retryAfter int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := 0; i < n; i++ {
+		s.errors = append(s.errors, injectedError{status: status, retryAfter: retryAfter})
+	}
+}
+
+// Requests returns every request received so far.
+func (s *Server) Requests() []Request {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Request{}, s.requests...)
+}
+
+// AddDatabase registers a database with the given property schema,
+// e.g. {"Name": "title", "Статус": "status"}.
+func (s *Server) AddDatabase(id, title string, schema map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addDatabase(id, title, schema)
+}
+
+func (s *Server) addDatabase(id, title string, schema map[string]string) {
+	properties := map[string]interface{}{}
+	for name, typ := range schema {
+		properties[name] = map[string]interface{}{
+			"id":   name,
+			"name": name,
+			"type": typ,
+			typ:    map[string]interface{}{},
+		}
+	}
+	s.databases[normalizeID(id)] = &database{id: id, title: title, schema: properties}
+}
+
+// AddProperty adds a property to the schema of an existing database.
+func (s *Server) AddProperty(dbID, name, typ string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.databases[normalizeID(dbID)].schema[name] = map[string]interface{}{
+		"id":   name,
+		"name": name,
+		"type": typ,
+		typ:    map[string]interface{}{},
+	}
+}
+
+// AddChildPage adds a child_page block titled title to parentID and returns the new page ID.
+func (s *Server) AddChildPage(parentID, title string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id := newID()
+	s.blocks[normalizeID(parentID)] = append(s.blocks[normalizeID(parentID)], Block{
+		"object":     "block",
+		"id":         id,
+		"type":       "child_page",
+		"child_page": map[string]interface{}{"title": title},
+	})
+	return id
+}
+
+// AddChildDatabase adds a child_database block to parentID and registers the database.
+func (s *Server) AddChildDatabase(parentID, id, title string, schema map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.addDatabase(id, title, schema)
+	s.blocks[normalizeID(parentID)] = append(s.blocks[normalizeID(parentID)], Block{
+		"object":         "block",
+		"id":             id,
+		"type":           "child_database",
+		"child_database": map[string]interface{}{"title": title},
+	})
+}
+
+// AddBlock appends a block to the children of a page or block and returns the new block ID.
+// The block is given in the write format, e.g. {"paragraph": {"rich_text": [...]}}.
+func (s *Server) AddBlock(parentID string, block map[string]interface{}) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	b := newBlock(toJSONMap(block))
+	s.blocks[normalizeID(parentID)] = append(s.blocks[normalizeID(parentID)], b)
+	return stringValue(b["id"])
+}
+
+// AddPage creates a page in database dbID. Properties may be given in the
+// write format accepted by the API; they are stored in the read format.
+func (s *Server) AddPage(dbID string, properties map[string]interface{}) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	page, _ := s.insertPage(dbID, properties, nil)
+	return page.ID
+}
+
+// SetPage overwrites properties of an existing page and bumps its last_edited_time.
+func (s *Server) SetPage(id string, properties map[string]interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	page := s.pages[normalizeID(id)]
+	for name, value := range toJSONMap(properties) {
+		page.Properties[name] = normalizeProperty(name, value)
+	}
+	page.LastEditedTime = s.now()
+}
+
+// Archive marks a page as archived and moves it to trash.
+func (s *Server) Archive(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	page := s.pages[normalizeID(id)]
+	page.Archived = true
+	page.InTrash = true
+	page.LastEditedTime = s.now()
+}
+
+// Restore moves an archived page out of trash.
+func (s *Server) Restore(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	page := s.pages[normalizeID(id)]
+	page.Archived = false
+	page.InTrash = false
+	page.LastEditedTime = s.now()
+}
+
+// Delete removes a page permanently, as if it was deleted from trash.
+func (s *Server) Delete(id string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	id = normalizeID(id)
+	page, ok := s.pages[id]
+	if !ok {
+		return
+	}
+	if db, ok := s.databases[normalizeID(page.ParentID)]; ok {
+		db.pages = slices.DeleteFunc(db.pages, func(p string) bool { return p == id })
+	}
+	delete(s.pages, id)
+}
+
+// Page returns a copy of the page with the given ID.
+func (s *Server) Page(id string) (Page, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	page, ok := s.pages[normalizeID(id)]
+	if !ok {
+		return Page{}, false
+	}
+	return *page, true
+}
+
+// Pages returns all pages of a database, archived included, in creation order.
+func (s *Server) Pages(dbID string) []Page {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	db, ok := s.databases[normalizeID(dbID)]
+	if !ok {
+		return nil
+	}
+	pages := []Page{}
+	for _, id := range db.pages {
+		pages = append(pages, *s.pages[id])
+	}
+	return pages
+}
+
+// Children returns child blocks of a page or block.
+func (s *Server) Children(id string) []Block {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Block{}, s.blocks[normalizeID(id)]...)
+}
+
+func (s *Server) insertPage(dbID string, properties map[string]interface{}, children []interface{}) (*Page, error) {
+	db, ok := s.databases[normalizeID(dbID)]
+	if !ok {
+		return nil, fmt.Errorf("Could not find database with ID: %s.", dbID)
+	}
+
+	page := &Page{
+		ID:         newID(),
+		ParentID:   db.id,
+		Properties: map[string]interface{}{},
+	}
+	page.CreatedTime = s.now()
+	page.LastEditedTime = page.CreatedTime
+	for name, value := range toJSONMap(properties) {
+		if _, ok := db.schema[name]; !ok {
+			return nil, fmt.Errorf("%s is not a property that exists.", name)
+		}
+		page.Properties[name] = normalizeProperty(name, value)
+	}
+
+	key := normalizeID(page.ID)
+	s.pages[key] = page
+	db.pages = append(db.pages, key)
+	for _, child := range children {
+		if block, ok := child.(map[string]interface{}); ok {
+			s.blocks[key] = append(s.blocks[key], newBlock(block))
+		}
+	}
+	return page, nil
+}
+
+func (s *Server) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := map[string]interface{}{}
+		if r.Body != nil {
+			json.NewDecoder(r.Body).Decode(&body)
+		}
+
+		s.mu.Lock()
+		s.requests = append(s.requests, Request{Method: r.Method, Path: r.URL.Path, Body: body})
+		var injected *injectedError
+		if len(s.errors) > 0 {
+			injected = &s.errors[0]
+			s.errors = s.errors[1:]
+		}
+		s.mu.Unlock()
+
+		if s.Token != "" && r.Header.Get("Authorization") != "Bearer "+s.Token {
+			writeError(w, http.StatusUnauthorized, "unauthorized", "API token is invalid.")
+			return
+		}
+		if r.Header.Get("Notion-Version") == "" {
+			writeError(w, http.StatusBadRequest, "missing_version", "Notion-Version header failed validation.")
+			return
+		}
+		if injected != nil {
+			if injected.retryAfter > 0 {
+				w.Header().Set("Retry-After", strconv.Itoa(injected.retryAfter))
+			}
+			writeError(w, injected.status, errorCode(injected.status), "Injected error.")
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(withBody(r.Context(), body)))
+	})
+}
+
+func (s *Server) getDatabase(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	db, ok := s.databases[normalizeID(r.PathValue("id"))]
+	if !ok {
+		writeError(w, http.StatusNotFound, "object_not_found", "Could not find database with ID: "+r.PathValue("id")+".")
+		return
+	}
+	writeJSON(w, map[string]interface{}{
+		"object": "database",
+		"id":     db.id,
+		"title": []map[string]interface{}{
+			{"type": "text", "text": map[string]interface{}{"content": db.title}, "plain_text": db.title},
+		},
+		"properties": db.schema,
+	})
+}
+
+func (s *Server) queryDatabase(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	db, ok := s.databases[normalizeID(r.PathValue("id"))]
+	if !ok {
+		writeError(w, http.StatusNotFound, "object_not_found", "Could not find database with ID: "+r.PathValue("id")+".")
+		return
+	}
+	body := bodyFrom(r.Context())
+
+	results := []*Page{}
+	for _, id := range db.pages {
+		page := s.pages[id]
+		if page.Archived || page.InTrash {
+			continue
+		}
+		if filter, ok := body["filter"].(map[string]interface{}); ok {
+			match, err := matchFilter(page, filter)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, "validation_error", err.Error())
+				return
+			}
+			if !match {
+				continue
+			}
+		}
+		results = append(results, page)
+	}
+
+	if sorts, ok := body["sorts"].([]interface{}); ok {
+		sortPages(results, sorts)
+	}
+
+	items := make([]interface{}, len(results))
+	ids := make([]string, len(results))
+	for i, page := range results {
+		items[i] = pageJSON(page)
+		ids[i] = page.ID
+	}
+	s.writeList(w, items, ids, stringValue(body["start_cursor"]), intValue(body["page_size"]))
+}
+
+func (s *Server) createPage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	body := bodyFrom(r.Context())
+	parent, _ := body["parent"].(map[string]interface{})
+	properties, _ := body["properties"].(map[string]interface{})
+	children, _ := body["children"].([]interface{})
+
+	page, err := s.insertPage(stringValue(parent["database_id"]), properties, children)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "validation_error", err.Error())
+		return
+	}
+	if icon, ok := body["icon"]; ok {
+		page.Icon = icon
+	}
+	writeJSON(w, pageJSON(page))
+}
+
+func (s *Server) getPage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	page, ok := s.pages[normalizeID(r.PathValue("id"))]
+	if !ok {
+		writeError(w, http.StatusNotFound, "object_not_found", "Could not find page with ID: "+r.PathValue("id")+".")
+		return
+	}
+	writeJSON(w, pageJSON(page))
+}
+
+func (s *Server) updatePage(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	page, ok := s.pages[normalizeID(r.PathValue("id"))]
+	if !ok {
+		writeError(w, http.StatusNotFound, "object_not_found", "Could not find page with ID: "+r.PathValue("id")+".")
+		return
+	}
+	body := bodyFrom(r.Context())
+	if page.Archived && body["archived"] != false && body["in_trash"] != false {
+		writeError(w, http.StatusBadRequest, "validation_error", "Can't edit block that is archived. You must unarchive the block before editing.")
+		return
+	}
+
+	db := s.databases[normalizeID(page.ParentID)]
+	properties, _ := body["properties"].(map[string]interface{})
+	for name, value := range properties {
+		if _, ok := db.schema[name]; !ok {
+			writeError(w, http.StatusBadRequest, "validation_error", name+" is not a property that exists.")
+			return
+		}
+		page.Properties[name] = normalizeProperty(name, value)
+	}
+	if archived, ok := body["archived"].(bool); ok {
+		page.Archived = archived
+		page.InTrash = archived
+	}
+	if inTrash, ok := body["in_trash"].(bool); ok {
+		page.Archived = inTrash
+		page.InTrash = inTrash
+	}
+	if icon, ok := body["icon"]; ok {
+		page.Icon = icon
+	}
+	page.LastEditedTime = s.now()
+	writeJSON(w, pageJSON(page))
+}
+
+func (s *Server) getBlockChildren(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := normalizeID(r.PathValue("id"))
+	_, isPage := s.pages[id]
+	children, hasChildren := s.blocks[id]
+	if !isPage && !hasChildren {
+		writeError(w, http.StatusNotFound, "object_not_found", "Could not find block with ID: "+r.PathValue("id")+".")
+		return
+	}
+
+	items := make([]interface{}, len(children))
+	ids := make([]string, len(children))
+	for i, block := range children {
+		item := Block{}
+		for k, v := range block {
+			item[k] = v
+		}
+		item["has_children"] = len(s.blocks[normalizeID(stringValue(block["id"]))]) > 0
+		items[i] = item
+		ids[i] = stringValue(block["id"])
+	}
+	pageSize, _ := strconv.Atoi(r.URL.Query().Get("page_size"))
+	s.writeList(w, items, ids, r.URL.Query().Get("start_cursor"), pageSize)
+}
+
+func (s *Server) appendBlockChildren(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := normalizeID(r.PathValue("id"))
+	children, _ := bodyFrom(r.Context())["children"].([]interface{})
+	if len(children) > 100 {
+		writeError(w, http.StatusBadRequest, "validation_error", "body.children.length should be ≤ 100.")
+		return
+	}
+	added := []interface{}{}
+	for _, child := range children {
+		if block, ok := child.(map[string]interface{}); ok {
+			b := newBlock(block)
+			s.blocks[id] = append(s.blocks[id], b)
+			added = append(added, b)
+		}
+	}
+	writeJSON(w, map[string]interface{}{"object": "list", "results": added, "has_more": false, "next_cursor": nil})
+}
+
+func (s *Server) deleteBlock(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := normalizeID(r.PathValue("id"))
+	for parent, children := range s.blocks {
+		i := slices.IndexFunc(children, func(b Block) bool { return normalizeID(stringValue(b["id"])) == id })
+		if i < 0 {
+			continue
+		}
+		block := children[i]
+		s.blocks[parent] = slices.Delete(children, i, i+1)
+		delete(s.blocks, id)
+		block["archived"] = true
+		writeJSON(w, block)
+		return
+	}
+	writeError(w, http.StatusNotFound, "object_not_found", "Could not find block with ID: "+r.PathValue("id")+".")
+}
+
+// writeList writes a paginated list response. The cursor is the ID of the first item of the next page.
+func (s *Server) writeList(w http.ResponseWriter, items []interface{}, ids []string, cursor string, pageSize int) {
+	if pageSize <= 0 || pageSize > s.PageSize {
+		pageSize = s.PageSize
+	}
+
+	start := 0
+	if cursor != "" {
+		start = -1
+		for i, id := range ids {
+			if normalizeID(id) == normalizeID(cursor) {
+				start = i
+				break
+			}
+		}
+		if start == -1 {
+			writeError(w, http.StatusBadRequest, "validation_error", "start_cursor provided is invalid: "+cursor)
+			return
+		}
+	}
+
+	end := start + pageSize
+	if end > len(items) {
+		end = len(items)
+	}
+	resp := map[string]interface{}{
+		"object":      "list",
+		"results":     items[start:end],
+		"has_more":    end < len(items),
+		"next_cursor": nil,
+	}
+	if end < len(items) {
+		resp["next_cursor"] = ids[end]
+	}
+	writeJSON(w, resp)
+}
+
+func pageJSON(page *Page) map[string]interface{} {
+	return map[string]interface{}{
+		"object":           "page",
+		"id":               page.ID,
+		"created_time":     page.CreatedTime.Format(timeLayout),
+		"last_edited_time": page.LastEditedTime.Format(timeLayout),
+		"archived":         page.Archived,
+		"in_trash":         page.InTrash,
+		"parent":           map[string]interface{}{"type": "database_id", "database_id": page.ParentID},
+		"icon":             page.Icon,
+		"properties":       page.Properties,
+		"url":              "https://www.notion.so/" + normalizeID(page.ID),
+	}
+}
+
+func newBlock(block map[string]interface{}) Block {
+	b := Block{}
+	for k, v := range block {
+		b[k] = v
+	}
+	b["object"] = "block"
+	b["id"] = newID()
+	if _, ok := b["type"]; !ok {
+		for k := range block {
+			if k != "object" {
+				b["type"] = k
+			}
+		}
+	}
+	return b
+}
+
+// normalizeProperty converts a property value from the write format to the read format:
+// it adds "id" and "type" and fills plain_text of rich text items.
+func normalizeProperty(name string, value interface{}) interface{} {
+	prop, ok := value.(map[string]interface{})
+	if !ok {
+		return value
+	}
+	res := map[string]interface{}{"id": name}
+	typ := stringValue(prop["type"])
+	for k, v := range prop {
+		if k == "type" || k == "id" {
+			continue
+		}
+		if typ == "" {
+			typ = k
+		}
+		res[k] = v
+	}
+	res["type"] = typ
+
+	if items, ok := res[typ].([]interface{}); ok && (typ == "title" || typ == "rich_text") {
+		for _, item := range items {
+			text, ok := item.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if _, ok := text["plain_text"]; !ok {
+				content, _ := text["text"].(map[string]interface{})
+				text["plain_text"] = stringValue(content["content"])
+			}
+			if _, ok := text["type"]; !ok {
+				text["type"] = "text"
+			}
+		}
+	}
+	return res
+}
+
+func sortPages(pages []*Page, sorts []interface{}) {
+	sort.SliceStable(pages, func(i, j int) bool {
+		for _, raw := range sorts {
+			s, _ := raw.(map[string]interface{})
+			var a, b time.Time
+			switch stringValue(s["timestamp"]) {
+			case "created_time":
+				a, b = pages[i].CreatedTime, pages[j].CreatedTime
+			case "last_edited_time":
+				a, b = pages[i].LastEditedTime, pages[j].LastEditedTime
+			default:
+				continue
+			}
+			if a.Equal(b) {
+				continue
+			}
+			if stringValue(s["direction"]) == "descending" {
+				return a.After(b)
+			}
+			return a.Before(b)
+		}
+		return false
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"object":  "error",
+		"status":  status,
+		"code":    code,
+		"message": message,
+	})
+}
+
+func errorCode(status int) string {
+	switch status {
+	case http.StatusTooManyRequests:
+		return "rate_limited"
+	case http.StatusConflict:
+		return "conflict_error"
+	case http.StatusServiceUnavailable:
+		return "service_unavailable"
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return "gateway_timeout"
+	case http.StatusNotFound:
+		return "object_not_found"
+	}
+	if status >= 500 {
+		return "internal_server_error"
+	}
+	return "validation_error"
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	h := hex.EncodeToString(b)
+	return h[0:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:32]
+}
+
+func normalizeID(id string) string {
+	return strings.ReplaceAll(id, "-", "")
+}
+
+func stringValue(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+func intValue(v interface{}) int {
+	f, _ := v.(float64)
+	return int(f)
+}
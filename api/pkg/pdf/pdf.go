@@ -0,0 +1,247 @@
+// Package pdf writes simple PDF documents: text in embedded TrueType fonts and lines on A4 pages.
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode/utf16"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/sfnt"
+	"golang.org/x/image/math/fixed"
+)
+
+// Size of A4 pages in points.
+const (
+	PageWidth  = 595.28
+	PageHeight = 841.89
+)
+
+// Document is a PDF document. Fonts are embedded as a whole, with the widths of the glyphs used.
+type Document struct {
+	fonts []*Font
+	pages []*Page
+}
+
+// Font is a TrueType font of a document.
+type Font struct {
+	name string // resource name, e.g. F1
+	data []byte
+	font *sfnt.Font
+	buf  sfnt.Buffer
+	used map[sfnt.GlyphIndex]rune
+}
+
+// Page is a page of a document. Coordinates are in points from the bottom left corner.
+type Page struct {
+	content bytes.Buffer
+}
+
+func New() *Document {
+	return &Document{}
+}
+
+// AddFont parses a TrueType font and adds it to the document.
+func (d *Document) AddFont(ttf []byte) (*Font, error) {
+	f, err := sfnt.Parse(ttf)
+	if err != nil {
+		return nil, err
+	}
+	font := &Font{
+		name: fmt.Sprintf("F%d", len(d.fonts)+1),
+		data: ttf,
+		font: f,
+		used: map[sfnt.GlyphIndex]rune{},
+	}
+	d.fonts = append(d.fonts, font)
+	return font, nil
+}
+
+// AddPage adds an A4 page.
+func (d *Document) AddPage() *Page {
+	p := &Page{}
+	d.pages = append(d.pages, p)
+	return p
+}
+
+// Width returns the width of the text in points.
+func (f *Font) Width(text string, size float64) float64 {
+	w := 0.0
+	for _, r := range text {
+		gid, _ := f.font.GlyphIndex(&f.buf, r)
+		w += f.advance(gid)
+	}
+	return w * size / 1000
+}
+
+// advance returns the advance of the glyph in thousandths of the font size.
+func (f *Font) advance(gid sfnt.GlyphIndex) float64 {
+	adv, err := f.font.GlyphAdvance(&f.buf, gid, fixed.I(1000), font.HintingNone)
+	if err != nil {
+		return 0
+	}
+	return float64(adv) / 64
+}
+
+// Text writes the text with its baseline starting at x, y.
+func (p *Page) Text(x, y float64, f *Font, size float64, text string) {
+	var hex strings.Builder
+	for _, r := range text {
+		gid, _ := f.font.GlyphIndex(&f.buf, r)
+		f.used[gid] = r
+		fmt.Fprintf(&hex, "%04X", uint16(gid))
+	}
+	fmt.Fprintf(&p.content, "BT /%s %.2f Tf %.2f %.2f Td <%s> Tj ET\n", f.name, size, x, y, hex.String())
+}
+
+// Line draws a line of the given width.
+func (p *Page) Line(x1, y1, x2, y2, width float64) {
+	fmt.Fprintf(&p.content, "%.2f w %.2f %.2f m %.2f %.2f l S\n", width, x1, y1, x2, y2)
+}
+
+// Write writes the document.
+func (d *Document) Write(w io.Writer) error {
+	out := &writer{}
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1 and 2 are the catalog and the page tree, fonts and pages follow.
+	catalog, pages := out.reserve(), out.reserve()
+	fontObjs := map[*Font]int{}
+	for _, f := range d.fonts {
+		id, err := writeFont(out, f)
+		if err != nil {
+			return err
+		}
+		fontObjs[f] = id
+	}
+
+	var fonts strings.Builder
+	for _, f := range d.fonts {
+		fmt.Fprintf(&fonts, "/%s %d 0 R ", f.name, fontObjs[f])
+	}
+	kids := []string{}
+	for _, p := range d.pages {
+		content := out.stream("", p.content.Bytes())
+		id := out.object(fmt.Sprintf("<< /Type /Page /Parent %d 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << %s>> >> /Contents %d 0 R >>",
+			pages, PageWidth, PageHeight, fonts.String(), content))
+		kids = append(kids, fmt.Sprintf("%d 0 R", id))
+	}
+	out.set(pages, fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(kids)))
+	out.set(catalog, fmt.Sprintf("<< /Type /Catalog /Pages %d 0 R >>", pages))
+
+	xref := out.Len()
+	fmt.Fprintf(out, "xref\n0 %d\n0000000000 65535 f \n", len(out.offsets)+1)
+	for _, off := range out.offsets {
+		fmt.Fprintf(out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(out, "trailer\n<< /Size %d /Root %d 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(out.offsets)+1, catalog, xref)
+	_, err := w.Write(out.Bytes())
+	return err
+}
+
+// writeFont writes the font as a Type0 font with Identity-H encoding, text being glyph IDs,
+// and returns the ID of the font object.
+func writeFont(out *writer, f *Font) (int, error) {
+	ppem := fixed.I(1000)
+	metrics, err := f.font.Metrics(&f.buf, ppem, font.HintingNone)
+	if err != nil {
+		return 0, err
+	}
+	bounds, err := f.font.Bounds(&f.buf, ppem, font.HintingNone)
+	if err != nil {
+		return 0, err
+	}
+	name, err := f.font.Name(&f.buf, sfnt.NameIDPostScript)
+	if err != nil || name == "" {
+		name = "Font" + f.name
+	}
+	name = strings.ReplaceAll(name, " ", "")
+
+	file := out.stream(fmt.Sprintf("/Length1 %d", len(f.data)), f.data)
+	descriptor := out.object(fmt.Sprintf("<< /Type /FontDescriptor /FontName /%s /Flags 32 /FontBBox [%d %d %d %d] /ItalicAngle 0 /Ascent %d /Descent %d /CapHeight %d /StemV 80 /FontFile2 %d 0 R >>",
+		name, bounds.Min.X.Round(), -bounds.Max.Y.Round(), bounds.Max.X.Round(), -bounds.Min.Y.Round(),
+		metrics.Ascent.Round(), -metrics.Descent.Round(), metrics.CapHeight.Round(), file))
+
+	gids := []int{}
+	for gid := range f.used {
+		gids = append(gids, int(gid))
+	}
+	sort.Ints(gids)
+	var widths strings.Builder
+	for _, gid := range gids {
+		fmt.Fprintf(&widths, "%d [%d] ", gid, int(f.advance(sfnt.GlyphIndex(gid))+0.5))
+	}
+	cid := out.object(fmt.Sprintf("<< /Type /Font /Subtype /CIDFontType2 /BaseFont /%s /CIDSystemInfo << /Registry (Adobe) /Ordering (Identity) /Supplement 0 >> /FontDescriptor %d 0 R /W [%s] /CIDToGIDMap /Identity >>",
+		name, descriptor, widths.String()))
+
+	toUnicode := out.stream("", toUnicodeCMap(gids, f.used))
+	return out.object(fmt.Sprintf("<< /Type /Font /Subtype /Type0 /BaseFont /%s /Encoding /Identity-H /DescendantFonts [%d 0 R] /ToUnicode %d 0 R >>",
+		name, cid, toUnicode)), nil
+}
+
+// toUnicodeCMap maps the glyphs back to text, so that it can be copied and searched.
+func toUnicodeCMap(gids []int, used map[sfnt.GlyphIndex]rune) []byte {
+	var b bytes.Buffer
+	b.WriteString("/CIDInit /ProcSet findresource begin\n12 dict begin\nbegincmap\n")
+	b.WriteString("/CIDSystemInfo << /Registry (Adobe) /Ordering (UCS) /Supplement 0 >> def\n")
+	b.WriteString("/CMapName /Adobe-Identity-UCS def\n/CMapType 2 def\n")
+	b.WriteString("1 begincodespacerange\n<0000> <FFFF>\nendcodespacerange\n")
+	for i := 0; i < len(gids); i += 100 {
+		chunk := gids[i:min(i+100, len(gids))]
+		fmt.Fprintf(&b, "%d beginbfchar\n", len(chunk))
+		for _, gid := range chunk {
+			fmt.Fprintf(&b, "<%04X> <", gid)
+			for _, u := range utf16.Encode([]rune{used[sfnt.GlyphIndex(gid)]}) {
+				fmt.Fprintf(&b, "%04X", u)
+			}
+			b.WriteString(">\n")
+		}
+		b.WriteString("endbfchar\n")
+	}
+	b.WriteString("endcmap\nCMapName currentdict /CMap defineresource pop\nend\nend\n")
+	return b.Bytes()
+}
+
+// writer numbers the objects and remembers their offsets for the cross-reference table.
+// Reserved objects get their number first and are written when they are set.
+type writer struct {
+	bytes.Buffer
+	offsets []int
+}
+
+func (w *writer) reserve() int {
+	w.offsets = append(w.offsets, 0)
+	return len(w.offsets)
+}
+
+func (w *writer) set(id int, dict string) {
+	w.offsets[id-1] = w.Len()
+	fmt.Fprintf(w, "%d 0 obj\n%s\nendobj\n", id, dict)
+}
+
+func (w *writer) object(dict string) int {
+	w.offsets = append(w.offsets, w.Len())
+	id := len(w.offsets)
+	fmt.Fprintf(w, "%d 0 obj\n%s\nendobj\n", id, dict)
+	return id
+}
+
+// stream writes the data compressed, dict has the entries of the stream dictionary other than
+// the length and the filter.
+func (w *writer) stream(dict string, data []byte) int {
+	var compressed bytes.Buffer
+	zw := zlib.NewWriter(&compressed)
+	zw.Write(data)
+	zw.Close()
+
+	w.offsets = append(w.offsets, w.Len())
+	id := len(w.offsets)
+	fmt.Fprintf(w, "%d 0 obj\n<< %s /Filter /FlateDecode /Length %d >>\nstream\n", id, strings.TrimSpace(dict), compressed.Len())
+	w.Write(compressed.Bytes())
+	w.WriteString("\nendstream\nendobj\n")
+	return id
+}
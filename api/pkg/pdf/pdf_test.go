@@ -0,0 +1,82 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"golang.org/x/image/font/gofont/goregular"
+)
+
+func TestWrite(t *testing.T) {
+	doc := New()
+	font, err := doc.AddFont(goregular.TTF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w := font.Width("Счёт", 10); w <= 0 {
+		t.Errorf("expected a positive width, got %v", w)
+	}
+	for _, text := range []string{"Счёт № 1", "Итого"} {
+		page := doc.AddPage()
+		page.Text(50, 700, font, 12, text)
+		page.Line(50, 690, 200, 690, 0.5)
+	}
+
+	var buf bytes.Buffer
+	if err := doc.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.Bytes()
+	if !bytes.HasPrefix(out, []byte("%PDF-1.4")) || !bytes.HasSuffix(out, []byte("%%EOF\n")) {
+		t.Fatal("expected a PDF header and trailer")
+	}
+
+	// Every offset of the cross-reference table must point at its object.
+	start := regexp.MustCompile(`startxref\n(\d+)`).FindSubmatch(out)
+	if start == nil {
+		t.Fatal("expected startxref")
+	}
+	xref, _ := strconv.Atoi(string(start[1]))
+	lines := strings.Split(string(out[xref:]), "\n")
+	if lines[0] != "xref" {
+		t.Fatalf("expected xref at %d, got %q", xref, lines[0])
+	}
+	count, _ := strconv.Atoi(strings.Fields(lines[1])[1])
+	for id := 1; id < count; id++ {
+		offset, _ := strconv.Atoi(strings.Fields(lines[2+id])[0])
+		if want := strconv.Itoa(id) + " 0 obj"; !bytes.HasPrefix(out[offset:], []byte(want)) {
+			t.Errorf("object %d: expected %q at %d", id, want, offset)
+		}
+	}
+	if !bytes.Contains(out, []byte("/Count 2")) {
+		t.Error("expected two pages")
+	}
+
+	// The ToUnicode maps must let the text be extracted again.
+	cmaps := ""
+	for _, m := range regexp.MustCompile(`(?s)/Length (\d+) >>\nstream\n`).FindAllSubmatchIndex(out, -1) {
+		n, _ := strconv.Atoi(string(out[m[2]:m[3]]))
+		zr, err := zlib.NewReader(bytes.NewReader(out[m[1] : m[1]+n]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(zr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(data, []byte("beginbfchar")) {
+			cmaps += string(data)
+		}
+	}
+	for _, r := range "Счёт№Итого" {
+		if !strings.Contains(cmaps, fmt.Sprintf("> <%04X>", r)) {
+			t.Errorf("expected %q in the ToUnicode map", r)
+		}
+	}
+}
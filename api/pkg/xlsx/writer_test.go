@@ -0,0 +1,74 @@
+package xlsx
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, "Times & more")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]Cell{
+		{{Value: "Task"}, {Value: "Hours"}, {Value: "=1+1"}},
+		{{Value: `Fix "login" <now>`, Link: "https://www.notion.so/abc"}, {Value: 1.5}, {Value: ""}, {Value: 3}},
+	}
+	for _, row := range rows {
+		if err := w.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(data)
+
+		// Every part must be well-formed.
+		d := xml.NewDecoder(bytes.NewReader(data))
+		for {
+			if _, err := d.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s: %v", f.Name, err)
+			}
+		}
+	}
+
+	sheet := files["xl/worksheets/sheet1.xml"]
+	for _, want := range []string{
+		`<c r="A1" t="inlineStr"><is><t xml:space="preserve">Task</t></is></c>`,
+		`<c r="A2" s="1" t="str"><f>HYPERLINK(&#34;https://www.notion.so/abc&#34;,&#34;Fix &#34;&#34;login&#34;&#34; &lt;now&gt;&#34;)</f>`,
+		`<c r="C1" t="inlineStr"><is><t xml:space="preserve">=1+1</t></is></c>`,
+		`<c r="B2"><v>1.5</v></c>`,
+		`<c r="D2"><v>3</v></c>`,
+	} {
+		if !strings.Contains(sheet, want) {
+			t.Errorf("expected the sheet to contain %s, got %s", want, sheet)
+		}
+	}
+	if strings.Contains(sheet, `r="C2"`) {
+		t.Error("expected empty cells to be left out")
+	}
+	if !strings.Contains(files["xl/workbook.xml"], `name="Times &amp; more"`) {
+		t.Errorf("expected the sheet name to be escaped, got %s", files["xl/workbook.xml"])
+	}
+}
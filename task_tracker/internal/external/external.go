@@ -1,6 +1,7 @@
 package external
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -16,7 +17,8 @@ import (
 )
 
 type External struct {
-	tg *TelegramClient
+	tg     *TelegramClient
+	notion *notion.Client
 }
 
 type TelegramClient struct {
@@ -42,7 +44,8 @@ func NewClient(token string) *TelegramClient {
 
 func New() *External {
 	return &External{
-		tg: NewClient(os.Getenv("BOT_TOKEN")),
+		tg:     NewClient(os.Getenv("BOT_TOKEN")),
+		notion: notion.NewClientFromEnv(),
 	}
 }
 
@@ -72,9 +75,9 @@ type Worker struct {
 			} `json:"people"`
 		} `json:"Ссылка"`
 		Salary struct {
-			ID     string `json:"id"`
-			Type   string `json:"type"`
-			Number int    `json:"number"`
+			ID     string  `json:"id"`
+			Type   string  `json:"type"`
+			Number float64 `json:"number"`
 		} `json:"Ставка в час"`
 		Direction struct {
 			ID     string `json:"id"`
@@ -125,7 +128,7 @@ func (e *External) GetEmployees(lastSynced int64) (employees []entities.Employee
 		},
 	}
 
-	resp, err := notion.SearchPages(os.Getenv("EMPLOYEES_DB"), filter)
+	resp, err := e.notion.SearchPages(context.Background(), os.Getenv("EMPLOYEES_DB"), filter)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -242,7 +245,7 @@ func (e *External) GetTasks(timeFilterType string, lastSynced int64, startCursor
 	filter := buildFilter(timeFilterType, lastSynced, startCursor, useTitleFilter)
 
 	lastUpdate = 0
-	resp, err := notion.SearchPages(os.Getenv("TASKS_DB"), filter)
+	resp, err := e.notion.SearchPages(context.Background(), os.Getenv("TASKS_DB"), filter)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -331,7 +334,7 @@ func (e *External) GetNotCorrectPersonTimes() (times []entities.Time, lastUpdate
 		},
 	}
 
-	resp, err := notion.SearchPages(os.Getenv("TIMES_DB"), filter)
+	resp, err := e.notion.SearchPages(context.Background(), os.Getenv("TIMES_DB"), filter)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -391,7 +394,7 @@ func (e *External) SetProfileInTime(timeID, profileID string) error {
 		},
 	}
 
-	_, err := notion.UpdatePage(timeID, req)
+	_, err := e.notion.UpdatePage(context.Background(), timeID, req)
 	if err != nil {
 		slog.Error("error updating time page in notion: " + err.Error())
 		return err
@@ -504,7 +507,7 @@ func (e *External) GetProjects(lastSynced int64) (projects []entities.Project, l
 		},
 	}
 
-	resp, err := notion.SearchPages(os.Getenv("PROJECTS_DB"), filter)
+	resp, err := e.notion.SearchPages(context.Background(), os.Getenv("PROJECTS_DB"), filter)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -589,7 +592,7 @@ func (e *External) WriteOfTime(timeToWriteOf *entities.TimeMsg) error {
 		},
 	}
 
-	_, err := notion.CreatePage(os.Getenv("TIMES_DB"), req, "")
+	_, err := e.notion.CreatePage(context.Background(), os.Getenv("TIMES_DB"), req, "")
 	if err != nil {
 		slog.Error("error creating time page in notion: " + err.Error())
 		return err
@@ -726,7 +729,7 @@ func (e *External) GetTimes(timeFilterType string, lastSynced int64, startCursor
 
 	lastUpdate = 0
 
-	resp, err := notion.SearchPages(os.Getenv("TIMES_DB"), filter)
+	resp, err := e.notion.SearchPages(context.Background(), os.Getenv("TIMES_DB"), filter)
 	if err != nil {
 		return nil, 0, err
 	}
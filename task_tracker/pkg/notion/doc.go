@@ -0,0 +1,4 @@
+// Package notion is a copy of api/pkg/notion: client.go and limiter.go are kept byte-identical to it,
+// because the api and the task tracker are separate modules built from their own Docker contexts,
+// so neither can import the other's packages. Check the copies with diff after changing either side.
+package notion
@@ -1,13 +1,10 @@
 package notion
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
-	"log/slog"
 	"net/http"
-	"os"
 )
 
 const TIME_LAYOUT = "2006-01-02T15:04:05.000-07:00"
@@ -15,96 +12,37 @@ const TIME_LAYOUT_IN = "2006-01-02T15:04:05.999Z07:00"
 
 type TableType string
 
-var IsSyncing = false
-
 const (
 	TimeTable    TableType = "time"
 	TaskTable    TableType = "task"
 	ProjectTable TableType = "project"
 )
 
-func GetHTTPClient() *http.Client {
-
-	transport := &http.Transport{}
-
-	return &http.Client{
-		Transport: transport,
-	}
-}
-
 type searchResponse struct {
 	HasMore    bool   `json:"has_more"`
 	NextCursor string `json:"next_cursor"`
 }
 
-func SearchPages(dbid string, filter map[string]interface{}) ([]byte, error) {
-	urlStr := "https://api.notion.com/v1/databases/" + dbid + "/query"
-
-	data, err := json.Marshal(filter)
+func (c *Client) SearchPages(ctx context.Context, dbid string, filter map[string]interface{}) ([]byte, error) {
+	body, err := c.Do(ctx, http.MethodPost, "/databases/"+dbid+"/query", filter)
 	if err != nil {
-		return nil, err
-	}
-
-	req, err := http.NewRequest("POST", urlStr, bytes.NewBuffer(data))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Authorization", "Bearer "+os.Getenv("NOTION_SECRET"))
-	req.Header.Set("Notion-Version", "2022-06-28")
-	req.Header.Set("Content-Type", "application/json")
-
-	client := GetHTTPClient()
-
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-	if resp.StatusCode != 200 {
-		slog.Error("notion error while searching pages: " + string(body))
-		return nil, fmt.Errorf("notion error %s while searching pages with body %s", string(body), string(data))
+		data, _ := json.Marshal(filter)
+		return nil, fmt.Errorf("%w while searching pages with body %s", err, string(data))
 	}
 
 	return body, nil
 }
 
-func GetPage(pageid string) ([]byte, error) {
-	url := "https://api.notion.com/v1/pages/" + pageid
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Authorization", "Bearer "+os.Getenv("NOTION_SECRET"))
-	req.Header.Set("Notion-Version", "2022-06-28")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+func (c *Client) GetPage(ctx context.Context, pageid string) ([]byte, error) {
+	body, err := c.Do(ctx, http.MethodGet, "/pages/"+pageid, nil)
 	if err != nil {
-		return nil, err
-	}
-
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("notion error while getting page: %s", string(body))
+		return nil, fmt.Errorf("%w while getting page %s", err, pageid)
 	}
 
 	return body, nil
 }
 
-func CreatePage(dbid string, properties interface{}, icon string) ([]byte, error) {
-	url := "https://api.notion.com/v1/pages"
-
+func (c *Client) CreatePage(ctx context.Context, dbid string, properties interface{}, icon string) ([]byte, error) {
 	reqBody := map[string]interface{}{
 		"parent": map[string]interface{}{
 			"type":        "database_id",
@@ -112,6 +50,7 @@ func CreatePage(dbid string, properties interface{}, icon string) ([]byte, error
 		},
 		"properties": properties,
 	}
+
 	if icons[icon] != "" {
 		reqBody["icon"] = map[string]interface{}{
 			"type": "external",
@@ -121,78 +60,27 @@ func CreatePage(dbid string, properties interface{}, icon string) ([]byte, error
 		}
 	}
 
-	data, err := json.Marshal(reqBody)
-	if err != nil {
-		return nil, err
-	}
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(data))
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Authorization", "Bearer "+os.Getenv("NOTION_SECRET"))
-	req.Header.Set("Notion-Version", "2022-06-28")
-	req.Header.Set("Content-Type", "application/json")
-
-	client := GetHTTPClient()
-	resp, err := client.Do(req)
+	body, err := c.Do(ctx, http.MethodPost, "/pages", reqBody)
 	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("notion error %s while creating page with properties %s", string(body), string(data))
+		data, _ := json.Marshal(properties)
+		return nil, fmt.Errorf("%w while creating page with properties %s", err, string(data))
 	}
 
 	return body, nil
 }
 
-func UpdatePage(pageid string, properties interface{}) ([]byte, error) {
-	url := "https://api.notion.com/v1/pages/" + pageid
-
+func (c *Client) UpdatePage(ctx context.Context, pageid string, properties interface{}) ([]byte, error) {
 	reqBody := map[string]interface{}{
 		"properties": properties,
 	}
 
-	data, err := json.Marshal(reqBody)
-	if err != nil {
-		return nil, err
-	}
-
-	req, err := http.NewRequest("PATCH", url, bytes.NewBuffer(data))
+	body, err := c.Do(ctx, http.MethodPatch, "/pages/"+pageid, reqBody)
 	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Authorization", "Bearer "+os.Getenv("NOTION_SECRET"))
-	req.Header.Set("Notion-Version", "2022-06-28")
-	req.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("notion error %s while updating page with properties %s", string(body), string(data))
+		data, _ := json.Marshal(properties)
+		return nil, fmt.Errorf("%w while updating page with properties %s", err, string(data))
 	}
 
 	return body, nil
-
 }
 
 var icons = map[string]string{
@@ -212,30 +100,10 @@ type Schema struct {
 	Properties map[string]interface{} `json:"properties"`
 }
 
-func GetSchema(dbid string) ([]string, error) {
-	url := "https://api.notion.com/v1/databases/" + dbid
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-
-	req.Header.Set("Authorization", "Bearer "+os.Getenv("NOTION_SECRET"))
-	req.Header.Set("Notion-Version", "2022-06-28")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	body, err := io.ReadAll(resp.Body)
+func (c *Client) GetSchema(ctx context.Context, dbid string) ([]string, error) {
+	body, err := c.Do(ctx, http.MethodGet, "/databases/"+dbid, nil)
 	if err != nil {
-		return nil, err
-	}
-
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("notion error while getting page: %s", string(body))
+		return nil, fmt.Errorf("%w while getting database %s", err, dbid)
 	}
 
 	schema := Schema{}